@@ -48,17 +48,69 @@ func yaml_insert_token(parser *yaml_parser_t, pos int, token *yaml_token_t) {
 // Create a new parser object.
 func yaml_parser_initialize(parser *yaml_parser_t) bool {
 	*parser = yaml_parser_t{
-		raw_buffer: make([]byte, 0, input_raw_buffer_size),
-		buffer:     make([]byte, 0, input_buffer_size),
+		raw_buffer:     get_buffer(input_raw_buffer_size),
+		buffer:         get_buffer(input_buffer_size),
+		pooled_buffers: true,
 	}
 	return true
 }
 
 // Destroy a parser object.
 func yaml_parser_delete(parser *yaml_parser_t) {
+	yaml_parser_put_buffers(parser)
 	*parser = yaml_parser_t{}
 }
 
+// [Go] Put the raw and working buffers back into the buffer pools if they
+// were taken from them.
+func yaml_parser_put_buffers(parser *yaml_parser_t) {
+	if !parser.pooled_buffers {
+		return
+	}
+	if parser.input_borrowed {
+		put_buffer(parser.owned_buffer)
+	} else {
+		put_buffer(parser.buffer)
+	}
+	if parser.raw_borrowed {
+		put_buffer(parser.owned_raw_buffer)
+	} else {
+		put_buffer(parser.raw_buffer)
+	}
+	parser.pooled_buffers = false
+}
+
+// Reset a parser object so it may read a new input, keeping its buffers
+// and options. The input source must be set again afterwards.
+func yaml_parser_reset(parser *yaml_parser_t) {
+	if parser.input_borrowed {
+		parser.buffer = parser.owned_buffer
+	}
+	if parser.raw_borrowed {
+		parser.raw_buffer = parser.owned_raw_buffer
+	}
+	*parser = yaml_parser_t{
+		raw_buffer:       parser.raw_buffer[:0],
+		buffer:           parser.buffer[:0],
+		pooled_buffers:   parser.pooled_buffers,
+		replace_invalid:  parser.replace_invalid,
+		strict_chars:     parser.strict_chars,
+		surrogates:       parser.surrogates,
+		windows1252:      parser.windows1252,
+		normalize_breaks: parser.normalize_breaks,
+		max_bytes:        parser.max_bytes,
+		max_warnings:     parser.max_warnings,
+		transform:        parser.transform,
+		transform_src:    parser.transform_src[:0],
+		debug:            parser.debug,
+		tokens:           parser.tokens[:0],
+		indents:          parser.indents[:0],
+		simple_keys:      parser.simple_keys[:0],
+		states:           parser.states[:0],
+		marks:            parser.marks[:0],
+	}
+}
+
 // String read handler.
 func yaml_string_read_handler(parser *yaml_parser_t, buffer []byte) (n int, err error) {
 	if parser.input_pos == len(parser.input) {
@@ -93,7 +145,24 @@ func yaml_parser_set_input_reader(parser *yaml_parser_t, r io.Reader) {
 	parser.input_reader = r
 }
 
+// Set the raw and working input buffers.
+func yaml_parser_set_buffers(parser *yaml_parser_t, raw_buffer, buffer []byte) {
+	if parser.encoding_determined || len(parser.raw_buffer) > 0 || len(parser.buffer) > 0 {
+		panic("must set the input buffers before reading the input")
+	}
+	yaml_parser_put_buffers(parser)
+	parser.raw_buffer = raw_buffer[:0]
+	parser.buffer = buffer[:0]
+}
+
 // Set the source encoding.
+func yaml_parser_set_transform(parser *yaml_parser_t, transform yaml_transform_t) {
+	if parser.encoding_determined || len(parser.raw_buffer) > 0 {
+		panic("must set the input transform before reading the input")
+	}
+	parser.transform = transform
+}
+
 func yaml_parser_set_encoding(parser *yaml_parser_t, encoding yaml_encoding_t) {
 	if parser.encoding != yaml_ANY_ENCODING {
 		panic("must set the encoding only once")
@@ -109,6 +178,7 @@ func yaml_emitter_initialize(emitter *yaml_emitter_t) {
 		states:     make([]yaml_emitter_state_t, 0, initial_stack_size),
 		events:     make([]yaml_event_t, 0, initial_queue_size),
 		best_width: -1,
+		seq_indent: -1,
 	}
 }
 
@@ -148,6 +218,15 @@ func yaml_emitter_set_output_writer(emitter *yaml_emitter_t, w io.Writer) {
 	emitter.output_writer = w
 }
 
+// [Go] Set the size of the output buffer.
+func yaml_emitter_set_buffer_size(emitter *yaml_emitter_t, size int) {
+	if emitter.buffer_pos > 0 {
+		panic("must set the output buffer size while the buffer is empty")
+	}
+	emitter.buffer = make([]byte, size)
+	emitter.raw_buffer = make([]byte, 0, size*2+2)
+}
+
 // Set the output encoding.
 func yaml_emitter_set_encoding(emitter *yaml_emitter_t, encoding yaml_encoding_t) {
 	if emitter.encoding != yaml_ANY_ENCODING {
@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import "sync"
+
+// [Go] The input buffers of parsers are taken from pools by size class,
+// from input_raw_buffer_size up to 64KB, and put back when the parsers
+// are deleted, so that decoding many documents doesn't allocate them
+// anew for every one. Larger buffers are left to the garbage collector, as
+// are the buffers of parsers that are never deleted, such as those of the
+// decoders returned by NewDecoder, which get buffers of their own.
+const (
+	buffer_pool_min_size = input_raw_buffer_size
+	buffer_pool_classes  = 8
+)
+
+var buffer_pools [buffer_pool_classes]sync.Pool
+
+// [Go] Return the size class of buffers of at least size bytes, or -1 if
+// they are too large to be pooled.
+func buffer_class(size int) int {
+	class, class_size := 0, buffer_pool_min_size
+	for class_size < size {
+		class++
+		class_size <<= 1
+	}
+	if class >= buffer_pool_classes {
+		return -1
+	}
+	return class
+}
+
+// [Go] Get an empty buffer with room for at least size bytes.
+func get_buffer(size int) []byte {
+	class := buffer_class(size)
+	if class < 0 {
+		return make([]byte, 0, size)
+	}
+	if b, ok := buffer_pools[class].Get().(*[]byte); ok {
+		return (*b)[:0]
+	}
+	return make([]byte, 0, buffer_pool_min_size<<uint(class))
+}
+
+// [Go] Put a buffer obtained from get_buffer back into its pool. Buffers
+// of other sizes are dropped.
+func put_buffer(b []byte) {
+	class := buffer_class(cap(b))
+	if class < 0 || cap(b) != buffer_pool_min_size<<uint(class) {
+		return
+	}
+	b = b[:0]
+	buffer_pools[class].Put(&b)
+}
@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import "strings"
+
+// CommentText returns the text of the comment c, in the form held by the
+// comment fields of Node, without the "#" that starts each of its lines,
+// the space after it, and the indentation ahead of it. Lines that are
+// blank, or hold a "#" alone, are blank in the text, and the blank lines
+// at the start and end of c are left out.
+func CommentText(c string) string {
+	lines := commentLines(c)
+	for i, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			line = line[1:]
+			if strings.HasPrefix(line, " ") {
+				line = line[1:]
+			}
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FormatComment returns text as a comment for the comment fields of Node,
+// with each of its lines started with "# ", or with "#" alone for blank
+// lines so that the comment stays in one block. The indentation common to
+// the lines of text is removed, along with the whitespace at the end of
+// lines and the blank lines at the start and end of text.
+func FormatComment(text string) string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	indent := -1
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		lines[i] = line
+		if line == "" {
+			continue
+		}
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	lines = trimBlankLines(lines)
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "#"
+		} else {
+			lines[i] = "# " + line[indent:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapComment returns text as FormatComment does, with the lines longer
+// than a positive width, "# " included, broken at spaces where they can
+// be. Lines that start with whitespace are left as they are.
+func wrapComment(text string, width int) string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if strings.TrimLeft(line, " \t") != line {
+			lines = append(lines, line)
+			continue
+		}
+		words := strings.Fields(line)
+		line = ""
+		for _, w := range words {
+			if width > 0 && line != "" && len(line)+1+len(w)+2 > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += w
+		}
+		lines = append(lines, line)
+	}
+	return FormatComment(strings.Join(lines, "\n"))
+}
+
+// normalizeComment returns the comment c written as set with
+// Encoder.SetNormalizeComments. Each line starts with "#" and a space,
+// unless it's blank or the "#" is followed by another "#" or a space
+// already. A line comment can't span lines, so the lines of one are
+// joined.
+func normalizeComment(c []byte, line bool) []byte {
+	if len(c) == 0 {
+		return c
+	}
+	lines := commentLines(string(c))
+	if line && len(lines) > 1 {
+		lines = []string{"# " + strings.Join(strings.Fields(CommentText(string(c))), " ")}
+	}
+	for i, l := range lines {
+		switch {
+		case l == "":
+		case !strings.HasPrefix(l, "#"):
+			lines[i] = "# " + l
+		case len(l) > 1 && l[1] != '#' && l[1] != ' ':
+			lines[i] = "# " + l[1:]
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// commentLines returns the lines of the comment c with the whitespace
+// around each of them and the blank lines at its start and end removed.
+func commentLines(c string) []string {
+	lines := strings.Split(c, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return trimBlankLines(lines)
+}
+
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// HeadCommentText returns the text of the head comment of n, as
+// CommentText does.
+func (n *Node) HeadCommentText() string {
+	return CommentText(n.HeadComment)
+}
+
+// LineCommentText returns the text of the line comment of n, as
+// CommentText does.
+func (n *Node) LineCommentText() string {
+	return CommentText(n.LineComment)
+}
+
+// FootCommentText returns the text of the foot comment of n, as
+// CommentText does.
+func (n *Node) FootCommentText() string {
+	return CommentText(n.FootComment)
+}
+
+// SetHeadComment sets the head comment of n to text, formatted as
+// FormatComment does.
+func (n *Node) SetHeadComment(text string) {
+	n.HeadComment = FormatComment(text)
+}
+
+// SetLineComment sets the line comment of n to text, formatted as
+// FormatComment does, with the lines of text joined by spaces as a line
+// comment can't span lines.
+func (n *Node) SetLineComment(text string) {
+	n.LineComment = FormatComment(strings.Join(strings.Fields(text), " "))
+}
+
+// SetFootComment sets the foot comment of n to text, formatted as
+// FormatComment does.
+func (n *Node) SetFootComment(text string) {
+	n.FootComment = FormatComment(text)
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+var commentTextTests = []struct {
+	comment, text string
+}{
+	{"", ""},
+	{"# a", "a"},
+	{"#a", "a"},
+	{"#  indented", " indented"},
+	{"# a\n#\n# b", "a\n\nb"},
+	{"\n  # a  \n\n# b\n\n", "a\n\nb"},
+	{"## banner", "# banner"},
+}
+
+func (s *S) TestCommentText(c *C) {
+	for _, t := range commentTextTests {
+		c.Assert(yaml.CommentText(t.comment), Equals, t.text, Commentf("comment: %q", t.comment))
+	}
+}
+
+var formatCommentTests = []struct {
+	text, comment string
+}{
+	{"", ""},
+	{"a", "# a"},
+	{"a\n\nb", "# a\n#\n# b"},
+	{"\n    a  \n      b\n    c\n\n", "# a\n#   b\n# c"},
+	{"a\r\nb", "# a\n# b"},
+}
+
+func (s *S) TestFormatComment(c *C) {
+	for _, t := range formatCommentTests {
+		c.Assert(yaml.FormatComment(t.text), Equals, t.comment, Commentf("text: %q", t.text))
+	}
+}
+
+func (s *S) TestNodeCommentText(c *C) {
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("# head\n#  more\na: 1 #line\n# foot\n"), &n), IsNil)
+	key := n.Content[0].Content[0]
+	c.Assert(key.HeadCommentText(), Equals, "head\n more")
+	c.Assert(n.Content[0].Content[1].LineCommentText(), Equals, "line")
+	c.Assert(key.FootCommentText(), Equals, "foot")
+
+	key.SetHeadComment("  first\n\n  second")
+	key.SetFootComment("")
+	n.Content[0].Content[1].SetLineComment("one\ntwo")
+	data, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "# first\n#\n# second\na: 1 # one two\n")
+}
+
+func (s *S) TestEncoderNormalizeComments(c *C) {
+	n := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "a", HeadComment: "  #first  \n\nsecond\n## kept"},
+		{Kind: yaml.ScalarNode, Value: "1", LineComment: "#one\n# two"},
+		{Kind: yaml.ScalarNode, Value: "b", FootComment: "foot"},
+		{Kind: yaml.ScalarNode, Value: "2", LineComment: "#  spaced"},
+	}}
+	data, err := yaml.MarshalWithOptions(n, yaml.WithNormalizeComments(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "# first\n\n# second\n## kept\na: 1 # one two\nb: 2 #  spaced\n# foot\n")
+}
+
+func (s *S) TestEncoderBanner(c *C) {
+	banner := "Code generated by confgen. DO NOT EDIT. Licensed under the Apache License, Version 2.0.\n\n    https://www.apache.org/licenses/LICENSE-2.0"
+	var doc yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("# head\n\nb: 2\n"), &doc), IsNil)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetLineWidth(40)
+	enc.SetBanner(banner, true)
+	c.Assert(enc.Encode(map[string]int{"a": 1}), IsNil)
+	c.Assert(enc.Encode(&doc), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `# Code generated by confgen. DO NOT
+# EDIT. Licensed under the Apache
+# License, Version 2.0.
+#
+#     https://www.apache.org/licenses/LICENSE-2.0
+
+a: 1
+---
+# Code generated by confgen. DO NOT
+# EDIT. Licensed under the Apache
+# License, Version 2.0.
+#
+#     https://www.apache.org/licenses/LICENSE-2.0
+
+# head
+
+b: 2
+`)
+
+	// The banner is written once at the top of the stream otherwise.
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetBanner("generated", false)
+	c.Assert(enc.Encode(map[string]int{"a": 1}), IsNil)
+	c.Assert(enc.Encode(map[string]int{"b": 2}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "# generated\n\na: 1\n---\nb: 2\n")
+
+	data, err := yaml.MarshalWithOptions([]int{1}, yaml.WithBanner("generated", false))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "# generated\n\n- 1\n")
+}
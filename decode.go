@@ -13,318 +13,82 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
 package yaml
 
 import (
 	"encoding"
 	"encoding/base64"
 	"fmt"
-	"io"
 	"math"
 	"reflect"
-	"strconv"
 	"time"
 )
 
-// ----------------------------------------------------------------------------
-// Parser, produces a node tree out of a libyaml event stream.
-
-type parser struct {
-	parser   yaml_parser_t
-	event    yaml_event_t
-	doc      *Node
-	anchors  map[string]*Node
-	doneInit bool
-	textless bool
-}
-
-func newParser(b []byte) *parser {
-	p := parser{}
-	if !yaml_parser_initialize(&p.parser) {
-		panic("failed to initialize YAML emitter")
-	}
-	if len(b) == 0 {
-		b = []byte{'\n'}
-	}
-	yaml_parser_set_input_string(&p.parser, b)
-	return &p
-}
-
-func newParserFromReader(r io.Reader) *parser {
-	p := parser{}
-	if !yaml_parser_initialize(&p.parser) {
-		panic("failed to initialize YAML emitter")
-	}
-	yaml_parser_set_input_reader(&p.parser, r)
-	return &p
-}
-
-func (p *parser) init() {
-	if p.doneInit {
-		return
-	}
-	p.anchors = make(map[string]*Node)
-	p.expect(yaml_STREAM_START_EVENT)
-	p.doneInit = true
-}
-
-func (p *parser) destroy() {
-	if p.event.typ != yaml_NO_EVENT {
-		yaml_event_delete(&p.event)
-	}
-	yaml_parser_delete(&p.parser)
-}
-
-// expect consumes an event from the event stream and
-// checks that it's of the expected type.
-func (p *parser) expect(e yaml_event_type_t) {
-	if p.event.typ == yaml_NO_EVENT {
-		if !yaml_parser_parse(&p.parser, &p.event) {
-			p.fail()
-		}
-	}
-	if p.event.typ == yaml_STREAM_END_EVENT {
-		failf("attempted to go past the end of stream; corrupted value?")
-	}
-	if p.event.typ != e {
-		p.parser.problem = fmt.Sprintf("expected %s event but got %s", e, p.event.typ)
-		p.fail()
-	}
-	yaml_event_delete(&p.event)
-	p.event.typ = yaml_NO_EVENT
-}
-
-// peek peeks at the next event in the event stream,
-// puts the results into p.event and returns the event type.
-func (p *parser) peek() yaml_event_type_t {
-	if p.event.typ != yaml_NO_EVENT {
-		return p.event.typ
-	}
-	// It's curious choice from the underlying API to generally return a
-	// positive result on success, but on this case return true in an error
-	// scenario. This was the source of bugs in the past (issue #666).
-	if !yaml_parser_parse(&p.parser, &p.event) || p.parser.error != yaml_NO_ERROR {
-		p.fail()
-	}
-	return p.event.typ
-}
-
-func (p *parser) fail() {
-	var where string
-	var line int
-	if p.parser.context_mark.line != 0 {
-		line = p.parser.context_mark.line
-		// Scanner errors don't iterate line before returning error
-		if p.parser.error == yaml_SCANNER_ERROR {
-			line++
-		}
-	} else if p.parser.problem_mark.line != 0 {
-		line = p.parser.problem_mark.line
-		// Scanner errors don't iterate line before returning error
-		if p.parser.error == yaml_SCANNER_ERROR {
-			line++
-		}
-	}
-	if line != 0 {
-		where = "line " + strconv.Itoa(line) + ": "
-	}
-	var msg string
-	if len(p.parser.problem) > 0 {
-		msg = p.parser.problem
-	} else {
-		msg = "unknown problem parsing YAML content"
-	}
-	failf("%s%s", where, msg)
-}
-
-func (p *parser) anchor(n *Node, anchor []byte) {
-	if anchor != nil {
-		n.Anchor = string(anchor)
-		p.anchors[n.Anchor] = n
-	}
-}
-
-func (p *parser) parse() *Node {
-	p.init()
-	switch p.peek() {
-	case yaml_SCALAR_EVENT:
-		return p.scalar()
-	case yaml_ALIAS_EVENT:
-		return p.alias()
-	case yaml_MAPPING_START_EVENT:
-		return p.mapping()
-	case yaml_SEQUENCE_START_EVENT:
-		return p.sequence()
-	case yaml_DOCUMENT_START_EVENT:
-		return p.document()
-	case yaml_STREAM_END_EVENT:
-		// Happens when attempting to decode an empty buffer.
-		return nil
-	case yaml_TAIL_COMMENT_EVENT:
-		panic("internal error: unexpected tail comment event (please report)")
-	default:
-		panic("internal error: attempted to parse unknown event (please report): " + p.event.typ.String())
-	}
-}
-
-func (p *parser) node(kind Kind, defaultTag, tag, value string) *Node {
-	var style Style
-	if tag != "" && tag != "!" {
-		tag = shortTag(tag)
-		style = TaggedStyle
-	} else if defaultTag != "" {
-		tag = defaultTag
-	} else if kind == ScalarNode {
-		tag, _ = resolve("", value)
-	}
-	n := &Node{
-		Kind:  kind,
-		Tag:   tag,
-		Value: value,
-		Style: style,
-	}
-	if !p.textless {
-		n.Line = p.event.start_mark.line + 1
-		n.Column = p.event.start_mark.column + 1
-		n.HeadComment = string(p.event.head_comment)
-		n.LineComment = string(p.event.line_comment)
-		n.FootComment = string(p.event.foot_comment)
-	}
-	return n
-}
-
-func (p *parser) parseChild(parent *Node) *Node {
-	child := p.parse()
-	parent.Content = append(parent.Content, child)
-	return child
-}
-
-func (p *parser) document() *Node {
-	n := p.node(DocumentNode, "", "", "")
-	p.doc = n
-	p.expect(yaml_DOCUMENT_START_EVENT)
-	p.parseChild(n)
-	if p.peek() == yaml_DOCUMENT_END_EVENT {
-		n.FootComment = string(p.event.foot_comment)
-	}
-	p.expect(yaml_DOCUMENT_END_EVENT)
-	return n
-}
-
-func (p *parser) alias() *Node {
-	n := p.node(AliasNode, "", "", string(p.event.anchor))
-	n.Alias = p.anchors[n.Value]
-	if n.Alias == nil {
-		failf("unknown anchor '%s' referenced", n.Value)
-	}
-	p.expect(yaml_ALIAS_EVENT)
-	return n
-}
-
-func (p *parser) scalar() *Node {
-	var parsedStyle = p.event.scalar_style()
-	var nodeStyle Style
-	switch {
-	case parsedStyle&yaml_DOUBLE_QUOTED_SCALAR_STYLE != 0:
-		nodeStyle = DoubleQuotedStyle
-	case parsedStyle&yaml_SINGLE_QUOTED_SCALAR_STYLE != 0:
-		nodeStyle = SingleQuotedStyle
-	case parsedStyle&yaml_LITERAL_SCALAR_STYLE != 0:
-		nodeStyle = LiteralStyle
-	case parsedStyle&yaml_FOLDED_SCALAR_STYLE != 0:
-		nodeStyle = FoldedStyle
-	}
-	var nodeValue = string(p.event.value)
-	var nodeTag = string(p.event.tag)
-	var defaultTag string
-	if nodeStyle == 0 {
-		if nodeValue == "<<" {
-			defaultTag = mergeTag
-		}
-	} else {
-		defaultTag = strTag
-	}
-	n := p.node(ScalarNode, defaultTag, nodeTag, nodeValue)
-	n.Style |= nodeStyle
-	p.anchor(n, p.event.anchor)
-	p.expect(yaml_SCALAR_EVENT)
-	return n
-}
-
-func (p *parser) sequence() *Node {
-	n := p.node(SequenceNode, seqTag, string(p.event.tag), "")
-	if p.event.sequence_style()&yaml_FLOW_SEQUENCE_STYLE != 0 {
-		n.Style |= FlowStyle
-	}
-	p.anchor(n, p.event.anchor)
-	p.expect(yaml_SEQUENCE_START_EVENT)
-	for p.peek() != yaml_SEQUENCE_END_EVENT {
-		p.parseChild(n)
-	}
-	n.LineComment = string(p.event.line_comment)
-	n.FootComment = string(p.event.foot_comment)
-	p.expect(yaml_SEQUENCE_END_EVENT)
-	return n
-}
-
-func (p *parser) mapping() *Node {
-	n := p.node(MappingNode, mapTag, string(p.event.tag), "")
-	block := true
-	if p.event.mapping_style()&yaml_FLOW_MAPPING_STYLE != 0 {
-		block = false
-		n.Style |= FlowStyle
-	}
-	p.anchor(n, p.event.anchor)
-	p.expect(yaml_MAPPING_START_EVENT)
-	for p.peek() != yaml_MAPPING_END_EVENT {
-		k := p.parseChild(n)
-		if block && k.FootComment != "" {
-			// Must be a foot comment for the prior value when being dedented.
-			if len(n.Content) > 2 {
-				n.Content[len(n.Content)-3].FootComment = k.FootComment
-				k.FootComment = ""
-			}
-		}
-		v := p.parseChild(n)
-		if k.FootComment == "" && v.FootComment != "" {
-			k.FootComment = v.FootComment
-			v.FootComment = ""
-		}
-		if p.peek() == yaml_TAIL_COMMENT_EVENT {
-			if k.FootComment == "" {
-				k.FootComment = string(p.event.foot_comment)
-			}
-			p.expect(yaml_TAIL_COMMENT_EVENT)
-		}
-	}
-	n.LineComment = string(p.event.line_comment)
-	n.FootComment = string(p.event.foot_comment)
-	if n.Style&FlowStyle == 0 && n.FootComment != "" && len(n.Content) > 1 {
-		n.Content[len(n.Content)-2].FootComment = n.FootComment
-		n.FootComment = ""
-	}
-	p.expect(yaml_MAPPING_END_EVENT)
-	return n
-}
-
 // ----------------------------------------------------------------------------
 // Decoder, unmarshals a node into a provided value.
 
 type decoder struct {
 	doc     *Node
 	aliases map[*Node]bool
-	terrors []string
+	terrors []*UnmarshalError
+	path    Path
+
+	warnings []Warning
 
 	stringMapType  reflect.Type
 	generalMapType reflect.Type
 
+	// mapSlice has mappings decoded into interface{} values as MapSlice
+	// values, within a MapSlice.
+	mapSlice bool
+
 	knownFields bool
 	uniqueKeys  bool
+	strictTypes bool
 	decodeCount int
 	aliasCount  int
 	aliasDepth  int
+	expanding   *Node
+
+	// maxAliasCount limits aliasCount, unless it's zero.
+	maxAliasCount int
+
+	// maxErrors limits the number of problems recorded in terrors,
+	// unless it's zero.
+	maxErrors int
+
+	// patch has existing map entries decoded into rather than replaced.
+	patch bool
+
+	// slicePolicy is how sequences are decoded into slices, unless
+	// fieldSlicePolicy is set for the field being decoded.
+	slicePolicy      SlicePolicy
+	fieldSlicePolicy SlicePolicy
+
+	// mapPolicy is how mappings are decoded into maps.
+	mapPolicy MapPolicy
+
+	// keyNaming is how the keys of struct fields are named.
+	keyNaming KeyNaming
+
+	// presence records the paths decoded at, and whether with null,
+	// unless it's nil.
+	presence map[string]bool
 
 	mergedFields map[interface{}]bool
+
+	// keepMerges has merge keys decoded as other keys into maps of
+	// nodes, and restMerged is set while merging mappings into a struct
+	// whose rest map holds the merge key already.
+	keepMerges bool
+	restMerged bool
+
+	// fieldAnchors maps the anchored nodes decoded into fields tagged
+	// with an anchor to these fields.
+	fieldAnchors map[*Node]reflect.Value
 }
 
 var (
@@ -335,6 +99,8 @@ var (
 	ifaceType      = generalMapType.Elem()
 	timeType       = reflect.TypeOf(time.Time{})
 	ptrTimeType    = reflect.TypeOf(&time.Time{})
+	mapSliceType   = reflect.TypeOf(MapSlice{})
+	mapItemType    = mapSliceType.Elem()
 )
 
 func newDecoder() *decoder {
@@ -347,6 +113,107 @@ func newDecoder() *decoder {
 	return d
 }
 
+var obsoleteUnmarshalerType = reflect.TypeOf((*obsoleteUnmarshaler)(nil)).Elem()
+
+// An ignoreLevel holds the type a collection is decoded into, with the
+// information of the struct it is, if any, or nothing if the decoder may
+// not leave out any value within it.
+type ignoreLevel struct {
+	t      reflect.Type
+	sinfo  *structInfo
+	naming KeyNaming
+}
+
+// ignoring returns the levels to start parsing a document decoded into a
+// value of type t with, or nil if t holds no struct, so that no value is
+// sure to be left out. The keys of struct fields are named with naming.
+func ignoring(t reflect.Type, naming KeyNaming) []ignoreLevel {
+	for e := t; ; e = e.Elem() {
+		switch e.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Array:
+			continue
+		case reflect.Struct:
+			if level := newIgnoreLevel(t, naming); level.t != nil {
+				return []ignoreLevel{level}
+			}
+		}
+		return nil
+	}
+}
+
+// newIgnoreLevel returns the level of a collection decoded into a value
+// of type t, which is nothing for a node, an unmarshaler, or a struct
+// with an inline map or unmarshalers.
+func newIgnoreLevel(t reflect.Type, naming KeyNaming) ignoreLevel {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return ignoreLevel{}
+	}
+	if t == nodeType || reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(obsoleteUnmarshalerType) {
+		return ignoreLevel{}
+	}
+	level := ignoreLevel{t: t, naming: naming}
+	if t.Kind() == reflect.Struct {
+		sinfo, err := getStructInfo(t, naming)
+		if err != nil || sinfo.InlineMap != -1 || len(sinfo.InlineUnmarshalers) > 0 {
+			return ignoreLevel{}
+		}
+		level.sinfo = sinfo
+	}
+	return level
+}
+
+// item returns the level of the value at elem within the collection of
+// level l, given the type of its first event, and whether the decoder is
+// sure to leave it out, which it's only for a key matching no field of a
+// struct.
+func (l ignoreLevel) item(elem PathElem, typ yaml_event_type_t) (ignoreLevel, bool) {
+	var t reflect.Type
+	switch {
+	case l.t == nil:
+		return ignoreLevel{}, false
+	case l.sinfo != nil:
+		if !elem.IsKey() || elem.Key == "<<" {
+			return ignoreLevel{}, false
+		}
+		info, ok := l.sinfo.FieldsMap[elem.Key]
+		if !ok {
+			return ignoreLevel{}, true
+		}
+		if info.Inline == nil {
+			t = l.t.Field(info.Num).Type
+		} else {
+			t = l.t.FieldByIndex(info.Inline).Type
+		}
+	case l.t.Kind() == reflect.Map:
+		if !elem.IsKey() {
+			return ignoreLevel{}, false
+		}
+		t = l.t.Elem()
+	default:
+		if elem.IsKey() {
+			return ignoreLevel{}, false
+		}
+		t = l.t.Elem()
+	}
+	if typ != yaml_MAPPING_START_EVENT && typ != yaml_SEQUENCE_START_EVENT {
+		// Only the items of collections may be left out.
+		return ignoreLevel{}, false
+	}
+	return newIgnoreLevel(t, l.naming), false
+}
+
+// present records the value at the current path as present.
+func (d *decoder) present(n *Node) {
+	if d.presence != nil {
+		d.presence[d.path.String()] = n.ShortTag() == nullTag
+	}
+}
+
 func (d *decoder) terror(n *Node, tag string, out reflect.Value) {
 	if n.Tag != "" {
 		tag = n.Tag
@@ -359,13 +226,67 @@ func (d *decoder) terror(n *Node, tag string, out reflect.Value) {
 			value = " `" + value + "`"
 		}
 	}
-	d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot unmarshal %s%s into %s", n.Line, shortTag(tag), value, out.Type()))
+	d.addError(ErrCodeType, d.path, n, tag, out.Type(), "cannot unmarshal %s%s into %s", shortTag(tag), value, out.Type())
+}
+
+// addError records a problem with n that prevents it from being decoded,
+// without stopping the decoding of the rest of the document.
+func (d *decoder) addError(code ErrorCode, path Path, n *Node, tag string, typ reflect.Type, format string, args ...interface{}) {
+	d.record(&UnmarshalError{
+		Code:    code,
+		Path:    append(Path(nil), path...),
+		Line:    n.Line,
+		Column:  n.Column,
+		Tag:     shortTag(tag),
+		Type:    typ,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// record records the problem e, unless there are d.maxErrors problems
+// recorded already.
+func (d *decoder) record(e *UnmarshalError) {
+	if d.maxErrors > 0 && len(d.terrors) >= d.maxErrors {
+		return
+	}
+	d.terrors = append(d.terrors, e)
+}
+
+// addTypeError records the problems reported by an unmarshaler. Their
+// paths are relative to the value the unmarshaler was called for.
+func (d *decoder) addTypeError(e *TypeError) {
+	if len(e.Details) == 0 {
+		for _, msg := range e.Errors {
+			d.record(&UnmarshalError{
+				Code:    ErrCodeType,
+				Path:    append(Path(nil), d.path...),
+				Message: msg,
+			})
+		}
+		return
+	}
+	for _, detail := range e.Details {
+		detail := *detail
+		detail.Path = append(append(Path(nil), d.path...), detail.Path...)
+		d.record(&detail)
+	}
+}
+
+// warnf records a problem found in n that didn't prevent it from
+// being decoded.
+func (d *decoder) warnf(n *Node, format string, args ...interface{}) {
+	d.warnings = append(d.warnings, Warning{
+		Offset:  -1,
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
 }
 
 func (d *decoder) callUnmarshaler(n *Node, u Unmarshaler) (good bool) {
-	err := u.UnmarshalYAML(n)
+	err := callUser(func() error { return u.UnmarshalYAML(n) })
 	if e, ok := err.(*TypeError); ok {
-		d.terrors = append(d.terrors, e.Errors...)
+		d.addTypeError(e)
 		return false
 	}
 	if err != nil {
@@ -376,18 +297,27 @@ func (d *decoder) callUnmarshaler(n *Node, u Unmarshaler) (good bool) {
 
 func (d *decoder) callObsoleteUnmarshaler(n *Node, u obsoleteUnmarshaler) (good bool) {
 	terrlen := len(d.terrors)
-	err := u.UnmarshalYAML(func(v interface{}) (err error) {
-		defer handleErr(&err)
-		d.unmarshal(n, reflect.ValueOf(v))
-		if len(d.terrors) > terrlen {
-			issues := d.terrors[terrlen:]
-			d.terrors = d.terrors[:terrlen]
-			return &TypeError{issues}
-		}
-		return nil
+	err := callUser(func() error {
+		return u.UnmarshalYAML(func(v interface{}) (err error) {
+			defer handleDecodeErr(&err)
+			// Decode as if from the root, as addTypeError will add the
+			// current path to any problems found. The problems are all
+			// kept for the unmarshaler to see whether v was decoded, and
+			// are limited when recorded back.
+			path, maxErrors := d.path, d.maxErrors
+			d.path, d.maxErrors = nil, 0
+			d.unmarshal(n, reflect.ValueOf(v))
+			d.path, d.maxErrors = path, maxErrors
+			if len(d.terrors) > terrlen {
+				issues := d.terrors[terrlen:]
+				d.terrors = d.terrors[:terrlen]
+				return newTypeError(append([]*UnmarshalError(nil), issues...))
+			}
+			return nil
+		})
 	})
 	if e, ok := err.(*TypeError); ok {
-		d.terrors = append(d.terrors, e.Errors...)
+		d.addTypeError(e)
 		return false
 	}
 	if err != nil {
@@ -486,8 +416,11 @@ func (d *decoder) unmarshal(n *Node, out reflect.Value) (good bool) {
 	if d.aliasDepth > 0 {
 		d.aliasCount++
 	}
-	if d.aliasCount > 100 && d.decodeCount > 1000 && float64(d.aliasCount)/float64(d.decodeCount) > allowedAliasRatio(d.decodeCount) {
-		failf("document contains excessive aliasing")
+	if d.maxAliasCount > 0 && d.aliasCount > d.maxAliasCount || d.aliasCount > 100 && d.decodeCount > 1000 && float64(d.aliasCount)/float64(d.decodeCount) > allowedAliasRatio(d.decodeCount) {
+		if d.expanding == nil {
+			failAnchor(ErrCodeAliasLimit, nil, "document contains excessive aliasing")
+		}
+		failAnchor(ErrCodeAliasLimit, d.expanding, "document contains excessive aliasing of anchor '"+d.expanding.Value+"'")
 	}
 	if out.Type() == nodeType {
 		out.Set(reflect.ValueOf(n).Elem())
@@ -516,7 +449,7 @@ func (d *decoder) unmarshal(n *Node, out reflect.Value) (good bool) {
 		}
 		fallthrough
 	default:
-		failf("cannot decode node with unknown kind %d", n.Kind)
+		failCode(ErrCodeInternal, "cannot decode node with unknown kind %d", n.Kind)
 	}
 	return good
 }
@@ -533,11 +466,14 @@ func (d *decoder) document(n *Node, out reflect.Value) (good bool) {
 func (d *decoder) alias(n *Node, out reflect.Value) (good bool) {
 	if d.aliases[n] {
 		// TODO this could actually be allowed in some circumstances.
-		failf("anchor '%s' value contains itself", n.Value)
+		failAnchor(ErrCodeAliasCycle, n, "anchor '"+n.Value+"' value contains itself")
 	}
 	d.aliases[n] = true
 	d.aliasDepth++
+	expanding := d.expanding
+	d.expanding = n
 	good = d.unmarshal(n.Alias, out)
+	d.expanding = expanding
 	d.aliasDepth--
 	delete(d.aliases, n)
 	return good
@@ -551,8 +487,17 @@ func resetMap(out reflect.Value) {
 	}
 }
 
+// A nullSetter is a value that null resets, such as an Optional.
+type nullSetter interface {
+	setNull()
+}
+
 func (d *decoder) null(out reflect.Value) bool {
 	if out.CanAddr() {
+		if u, ok := out.Addr().Interface().(nullSetter); ok {
+			u.setNull()
+			return true
+		}
 		switch out.Kind() {
 		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
 			out.Set(reflect.Zero(out.Type()))
@@ -573,7 +518,8 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 		if tag == binaryTag {
 			data, err := base64.StdEncoding.DecodeString(resolved.(string))
 			if err != nil {
-				failf("!!binary value contains invalid base64 data")
+				d.addError(ErrCodeInvalidValue, d.path, n, tag, out.Type(), "!!binary value contains invalid base64 data")
+				return false
 			}
 			resolved = string(data)
 		}
@@ -581,6 +527,9 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 	if resolved == nil {
 		return d.null(out)
 	}
+	if tag == intTag && isLegacyOctal(n.Value) {
+		d.warnf(n, "%q is a YAML 1.1 octal number, which YAML 1.2 writes with a 0o prefix", n.Value)
+	}
 	if resolvedv := reflect.ValueOf(resolved); out.Type() == resolvedv.Type() {
 		// We've resolved to exactly the type we want, so use that.
 		out.Set(resolvedv)
@@ -600,9 +549,19 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 				// TextUnmarshaler itself should bowl out any dubious values.
 				text = []byte(n.Value)
 			}
-			err := u.UnmarshalText(text)
+			err := callUser(func() error { return u.UnmarshalText(text) })
 			if err != nil {
-				fail(err)
+				d.record(&UnmarshalError{
+					Code:    ErrCodeInvalidValue,
+					Path:    append(Path(nil), d.path...),
+					Line:    n.Line,
+					Column:  n.Column,
+					Tag:     shortTag(tag),
+					Type:    out.Type(),
+					Message: err.Error(),
+					Err:     err,
+				})
+				return false
 			}
 			return true
 		}
@@ -613,6 +572,9 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 			out.SetString(resolved.(string))
 			return true
 		}
+		if d.strictTypes && tag != strTag {
+			break
+		}
 		out.SetString(n.Value)
 		return true
 	case reflect.Interface:
@@ -639,7 +601,7 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 				return true
 			}
 		case float64:
-			if !isDuration && resolved <= math.MaxInt64 && !out.OverflowInt(int64(resolved)) {
+			if !isDuration && !d.strictTypes && resolved <= math.MaxInt64 && !out.OverflowInt(int64(resolved)) {
 				out.SetInt(int64(resolved))
 				return true
 			}
@@ -670,7 +632,7 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 				return true
 			}
 		case float64:
-			if resolved <= math.MaxUint64 && !out.OverflowUint(uint64(resolved)) {
+			if !d.strictTypes && resolved <= math.MaxUint64 && !out.OverflowUint(uint64(resolved)) {
 				out.SetUint(uint64(resolved))
 				return true
 			}
@@ -681,13 +643,18 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 			out.SetBool(resolved)
 			return true
 		case string:
+			if d.strictTypes {
+				break
+			}
 			// This offers some compatibility with the 1.1 spec (https://yaml.org/type/bool.html).
 			// It only works if explicitly attempting to unmarshal into a typed bool value.
 			switch resolved {
 			case "y", "Y", "yes", "Yes", "YES", "on", "On", "ON":
+				d.warnf(n, "%q is a YAML 1.1 boolean, which YAML 1.2 reads as a string", resolved)
 				out.SetBool(true)
 				return true
 			case "n", "N", "no", "No", "NO", "off", "Off", "OFF":
+				d.warnf(n, "%q is a YAML 1.1 boolean, which YAML 1.2 reads as a string", resolved)
 				out.SetBool(false)
 				return true
 			}
@@ -729,13 +696,33 @@ func settableValueOf(i interface{}) reflect.Value {
 func (d *decoder) sequence(n *Node, out reflect.Value) (good bool) {
 	l := len(n.Content)
 
+	policy := d.slicePolicy
+	if d.fieldSlicePolicy != 0 {
+		policy = d.fieldSlicePolicy
+		d.fieldSlicePolicy = 0
+	}
+
+	// The items are decoded into out from index base on.
+	base := 0
 	var iface reflect.Value
 	switch out.Kind() {
 	case reflect.Slice:
-		out.Set(reflect.MakeSlice(out.Type(), l, l))
+		switch {
+		case out.Type().Elem() == mapItemType:
+			// The items of a MapSlice come from mappings alone.
+			d.terror(n, seqTag, out)
+			return false
+		case policy == SliceAppend:
+			base = out.Len()
+			out.Set(reflect.AppendSlice(out, reflect.MakeSlice(out.Type(), l, l)))
+		case policy == SliceReuse && out.Cap() >= l:
+			out.SetLen(l)
+		default:
+			out.Set(reflect.MakeSlice(out.Type(), l, l))
+		}
 	case reflect.Array:
 		if l != out.Len() {
-			failf("invalid array: want %d elements but got %d", out.Len(), l)
+			failCode(ErrCodeArrayLength, "invalid array: want %d elements but got %d", out.Len(), l)
 		}
 	case reflect.Interface:
 		// No type hints. Will have to use a generic sequence.
@@ -750,13 +737,16 @@ func (d *decoder) sequence(n *Node, out reflect.Value) (good bool) {
 	j := 0
 	for i := 0; i < l; i++ {
 		e := reflect.New(et).Elem()
+		d.path = append(d.path, IndexElem(i))
+		d.present(n.Content[i])
 		if ok := d.unmarshal(n.Content[i], e); ok {
-			out.Index(j).Set(e)
+			out.Index(base + j).Set(e)
 			j++
 		}
+		d.path = d.path[:len(d.path)-1]
 	}
 	if out.Kind() != reflect.Array {
-		out.Set(out.Slice(0, j))
+		out.Set(out.Slice(0, base+j))
 	}
 	if iface.IsValid() {
 		iface.Set(out)
@@ -773,7 +763,7 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 			for j := i + 2; j < l; j += 2 {
 				nj := n.Content[j]
 				if ni.Kind == nj.Kind && ni.Value == nj.Value {
-					d.terrors = append(d.terrors, fmt.Sprintf("line %d: mapping key %#v already defined at line %d", nj.Line, nj.Value, ni.Line))
+					d.addError(ErrCodeDuplicateKey, d.path.Key(nj.Value), nj, nj.ShortTag(), nil, "mapping key %#v already defined at line %d", nj.Value, ni.Line)
 				}
 			}
 		}
@@ -786,14 +776,31 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 		return d.mappingStruct(n, out)
 	case reflect.Map:
 		// okay
+	case reflect.Slice:
+		if out.Type().Elem() != mapItemType {
+			d.terror(n, mapTag, out)
+			return false
+		}
+		return d.mappingSlice(n, out)
 	case reflect.Interface:
+		if d.mapSlice {
+			items := reflect.New(mapSliceType).Elem()
+			if !d.mappingSlice(n, items) {
+				return false
+			}
+			out.Set(items)
+			return true
+		}
 		iface := out
-		if isStringMap(n) {
+		if d.patch && d.mapPolicy != MapReplace && !iface.IsNil() && iface.Elem().Kind() == reflect.Map {
+			out = iface.Elem()
+		} else if isStringMap(n) {
 			out = reflect.MakeMap(d.stringMapType)
+			iface.Set(out)
 		} else {
 			out = reflect.MakeMap(d.generalMapType)
+			iface.Set(out)
 		}
-		iface.Set(out)
 	default:
 		d.terror(n, mapTag, out)
 		return false
@@ -801,7 +808,6 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 
 	outt := out.Type()
 	kt := outt.Key()
-	et := outt.Elem()
 
 	stringMapType := d.stringMapType
 	generalMapType := d.generalMapType
@@ -817,14 +823,15 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 	d.mergedFields = nil
 
 	var mergeNode *Node
+	keepMerge := d.keepMerges && outt.Elem() == nodeType
 
 	mapIsNew := false
-	if out.IsNil() {
+	if out.IsNil() || out.CanSet() && d.replaceMaps(mergedFields) {
 		out.Set(reflect.MakeMap(outt))
 		mapIsNew = true
 	}
 	for i := 0; i < l; i += 2 {
-		if isMerge(n.Content[i]) {
+		if isMerge(n.Content[i]) && !keepMerge {
 			mergeNode = n.Content[i+1]
 			continue
 		}
@@ -842,12 +849,15 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 				kkind = k.Elem().Kind()
 			}
 			if kkind == reflect.Map || kkind == reflect.Slice {
-				failf("invalid map key: %#v", k.Interface())
+				failCode(ErrCodeInvalidMapKey, "invalid map key: %#v", k.Interface())
 			}
-			e := reflect.New(et).Elem()
+			e := d.mapValue(out, k)
+			d.path = append(d.path, KeyElem(n.Content[i].Value))
+			d.present(n.Content[i+1])
 			if d.unmarshal(n.Content[i+1], e) || n.Content[i+1].ShortTag() == nullTag && (mapIsNew || !out.MapIndex(k).IsValid()) {
 				out.SetMapIndex(k, e)
 			}
+			d.path = d.path[:len(d.path)-1]
 		}
 	}
 
@@ -861,6 +871,70 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 	return true
 }
 
+// mapValue returns a settable value to decode the entry of m for key k
+// into, which holds the current value of the entry when patching.
+func (d *decoder) mapValue(m, k reflect.Value) reflect.Value {
+	e := reflect.New(m.Type().Elem()).Elem()
+	if d.patch {
+		if v := m.MapIndex(k); v.IsValid() {
+			e.Set(v)
+		}
+	}
+	return e
+}
+
+// replaceMaps reports whether existing maps are to be replaced when
+// decoding a mapping. Maps are never replaced when decoding the mappings
+// merged into another, whose entries are then decoded already.
+func (d *decoder) replaceMaps(mergedFields map[interface{}]bool) bool {
+	return d.mapPolicy == MapReplace && mergedFields == nil
+}
+
+// mappingSlice decodes the mapping n into out, a MapSlice or []MapItem.
+func (d *decoder) mappingSlice(n *Node, out reflect.Value) (good bool) {
+	mapSlice := d.mapSlice
+	d.mapSlice = true
+	mergedFields := d.mergedFields
+	d.mergedFields = nil
+
+	var mergeNode *Node
+	var items []MapItem
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if isMerge(n.Content[i]) {
+			mergeNode = n.Content[i+1]
+			continue
+		}
+		var item MapItem
+		if !d.unmarshal(n.Content[i], reflect.ValueOf(&item.Key).Elem()) {
+			continue
+		}
+		if mergedFields != nil && item.Key != nil && reflect.TypeOf(item.Key).Comparable() {
+			if mergedFields[item.Key] {
+				continue
+			}
+			mergedFields[item.Key] = true
+		}
+		d.path = append(d.path, KeyElem(n.Content[i].Value))
+		d.present(n.Content[i+1])
+		d.unmarshal(n.Content[i+1], reflect.ValueOf(&item.Value).Elem())
+		d.path = d.path[:len(d.path)-1]
+		items = append(items, item)
+	}
+	if mergedFields != nil {
+		// The items of a mapping merged into another follow its own.
+		out.Set(reflect.AppendSlice(out, reflect.ValueOf(items).Convert(out.Type())))
+	} else {
+		out.Set(reflect.ValueOf(items).Convert(out.Type()))
+	}
+
+	d.mergedFields = mergedFields
+	if mergeNode != nil {
+		d.merge(n, mergeNode, out)
+	}
+	d.mapSlice = mapSlice
+	return true
+}
+
 func isStringMap(n *Node) bool {
 	if n.Kind != MappingNode {
 		return false
@@ -876,17 +950,21 @@ func isStringMap(n *Node) bool {
 }
 
 func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
-	sinfo, err := getStructInfo(out.Type())
+	sinfo, err := getStructInfo(out.Type(), d.keyNaming)
 	if err != nil {
 		panic(err)
 	}
 
 	var inlineMap reflect.Value
-	var elemType reflect.Type
 	if sinfo.InlineMap != -1 {
 		inlineMap = out.Field(sinfo.InlineMap)
-		elemType = inlineMap.Type().Elem()
+		if d.replaceMaps(d.mergedFields) {
+			inlineMap.Set(reflect.Zero(inlineMap.Type()))
+		}
 	}
+	keepMerge := d.keepMerges && sinfo.InlineMap != -1 && inlineMap.Type().Elem() == nodeType
+	restMerged := d.restMerged
+	d.restMerged = false
 
 	for _, index := range sinfo.InlineUnmarshalers {
 		field := d.fieldByIndex(n, out, index)
@@ -906,7 +984,9 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 		ni := n.Content[i]
 		if isMerge(ni) {
 			mergeNode = n.Content[i+1]
-			continue
+			if !keepMerge {
+				continue
+			}
 		}
 		if !d.unmarshal(ni, name) {
 			continue
@@ -921,7 +1001,7 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 		if info, ok := sinfo.FieldsMap[sname]; ok {
 			if d.uniqueKeys {
 				if doneFields[info.Id] {
-					d.terrors = append(d.terrors, fmt.Sprintf("line %d: field %s already set in type %s", ni.Line, name.String(), out.Type()))
+					d.addError(ErrCodeDuplicateField, d.path.Key(sname), ni, ni.ShortTag(), out.Type(), "field %s already set in type %s", sname, out.Type())
 					continue
 				}
 				doneFields[info.Id] = true
@@ -932,28 +1012,74 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 			} else {
 				field = d.fieldByIndex(n, out, info.Inline)
 			}
-			d.unmarshal(n.Content[i+1], field)
+			d.path = append(d.path, KeyElem(sname))
+			d.present(n.Content[i+1])
+			if !d.fieldAlias(info, n.Content[i+1], field) {
+				d.fieldSlicePolicy = info.SlicePolicy
+				d.unmarshal(n.Content[i+1], field)
+				d.fieldSlicePolicy = 0
+				d.fieldAnchor(info, n.Content[i+1], field)
+			}
+			d.path = d.path[:len(d.path)-1]
 		} else if sinfo.InlineMap != -1 {
+			if restMerged {
+				// The rest map holds the merge key for these entries.
+				continue
+			}
 			if inlineMap.IsNil() {
 				inlineMap.Set(reflect.MakeMap(inlineMap.Type()))
 			}
-			value := reflect.New(elemType).Elem()
+			value := d.mapValue(inlineMap, name)
+			d.path = append(d.path, KeyElem(sname))
+			d.present(n.Content[i+1])
 			d.unmarshal(n.Content[i+1], value)
+			d.path = d.path[:len(d.path)-1]
 			inlineMap.SetMapIndex(name, value)
 		} else if d.knownFields {
-			d.terrors = append(d.terrors, fmt.Sprintf("line %d: field %s not found in type %s", ni.Line, name.String(), out.Type()))
+			d.addError(ErrCodeUnknownField, d.path.Key(sname), ni, ni.ShortTag(), out.Type(), "field %s not found in type %s", sname, out.Type())
+		} else {
+			d.warnf(ni, "field %s not found in type %s", name.String(), out.Type())
 		}
 	}
 
 	d.mergedFields = mergedFields
 	if mergeNode != nil {
+		d.restMerged = keepMerge
 		d.merge(n, mergeNode, out)
 	}
+	d.restMerged = restMerged
+	return true
+}
+
+// fieldAnchor records field as decoded from the anchored node n if its
+// tag has an anchor.
+func (d *decoder) fieldAnchor(info fieldInfo, n *Node, field reflect.Value) {
+	if info.Anchor == "" || n.Anchor == "" {
+		return
+	}
+	if d.fieldAnchors == nil {
+		d.fieldAnchors = make(map[*Node]reflect.Value)
+	}
+	d.fieldAnchors[n] = field
+}
+
+// fieldAlias sets field to the value of the field decoded from the node
+// that n is an alias of, if the tag of field is for an alias and there's
+// such a field of the same type, and reports whether it did.
+func (d *decoder) fieldAlias(info fieldInfo, n *Node, field reflect.Value) bool {
+	if info.Alias == "" || n.Kind != AliasNode {
+		return false
+	}
+	anchored, ok := d.fieldAnchors[n.Alias]
+	if !ok || anchored.Type() != field.Type() {
+		return false
+	}
+	field.Set(anchored)
 	return true
 }
 
 func failWantMap() {
-	failf("map merge requires map or sequence of maps as the value")
+	failCode(ErrCodeInvalidMerge, "map merge requires map or sequence of maps as the value")
 }
 
 func (d *decoder) merge(parent *Node, merge *Node, out reflect.Value) {
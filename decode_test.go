@@ -20,10 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"strings"
+	"testing"
 	"time"
+	"unicode/utf16"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v3"
@@ -802,6 +805,23 @@ var unmarshalTests = []struct {
 			"c": []interface{}{"d", "e"},
 		},
 	},
+	// MapSlice
+	{
+		"z: 1\na: {y: [2, {x: 3}], b: c}\n",
+		&yaml.MapSlice{
+			{Key: "z", Value: 1},
+			{Key: "a", Value: yaml.MapSlice{
+				{Key: "y", Value: []interface{}{2, yaml.MapSlice{{Key: "x", Value: 3}}}},
+				{Key: "b", Value: "c"},
+			}},
+		},
+	}, {
+		"b: 1\na: 2\n",
+		&[]yaml.MapItem{{Key: "b", Value: 1}, {Key: "a", Value: 2}},
+	}, {
+		"base: &b {k: v, z: 0}\nm:\n  <<: *b\n  z: 9\n",
+		&struct{ M yaml.MapSlice }{yaml.MapSlice{{Key: "z", Value: 9}, {Key: "k", Value: "v"}}},
+	},
 }
 
 type M map[string]interface{}
@@ -833,6 +853,86 @@ func (s *S) TestUnmarshal(c *C) {
 	}
 }
 
+func (s *S) TestUnmarshalLeavesInputAlone(c *C) {
+	// Valid UTF-8 input is decoded in place, so make sure it's never
+	// written to, and that the result matches reading it from a reader.
+	for i, item := range unmarshalTests {
+		c.Logf("test %d: %q", i, item.data)
+		data := []byte(item.data)
+		var fromBytes, fromReader interface{}
+		err1 := yaml.Unmarshal(data, &fromBytes)
+		err2 := yaml.NewDecoder(strings.NewReader(item.data)).Decode(&fromReader)
+		c.Assert(string(data), Equals, item.data)
+		if err2 == io.EOF {
+			continue
+		}
+		c.Assert(fmt.Sprint(err1), Equals, fmt.Sprint(err2))
+		c.Assert(fromBytes, DeepEquals, fromReader)
+	}
+
+	data := []byte("a: 1\n---\nb: 2\n")
+	dec := yaml.NewDecoder(nil)
+	dec.ResetBytes(data)
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	dec.Reset(strings.NewReader(strings.Repeat("x", 100)))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, strings.Repeat("x", 100))
+	c.Assert(string(data), Equals, "a: 1\n---\nb: 2\n")
+
+	// Input that isn't decoded in place is still read from where it is.
+	data = []byte("\xff\xfea\x00:\x00 \x001\x00\r\x00\n\x00")
+	dec.ResetBytes(data)
+	dec.NormalizeLineEndings(true)
+	v = nil
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": 1})
+	dec.Reset(strings.NewReader(strings.Repeat("y", 100)))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, strings.Repeat("y", 100))
+	c.Assert(string(data), Equals, "\xff\xfea\x00:\x00 \x001\x00\r\x00\n\x00")
+}
+
+func (s *S) TestUnmarshalConcurrently(c *C) {
+	// The buffers of parsers are reused once they're done with them, so
+	// make sure that documents decoded at the same time don't mix.
+	const goroutines, runs = 8, 50
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			for i := 0; i < runs; i++ {
+				want := make(map[string]string)
+				var buf bytes.Buffer
+				for k := 0; k < 20*(i%10+1); k++ {
+					key, value := fmt.Sprintf("k%d", k), fmt.Sprintf("v%d-%d-%d", g, i, k)
+					want[key] = value
+					fmt.Fprintf(&buf, "%s: %s\n", key, value)
+				}
+				data := buf.Bytes()
+				if i%2 == 1 {
+					data = []byte("\xff\xfe")
+					for _, r := range utf16.Encode([]rune(buf.String())) {
+						data = append(data, byte(r), byte(r>>8))
+					}
+				}
+				var got map[string]string
+				if err := yaml.Unmarshal(data, &got); err != nil {
+					errs <- err
+					return
+				}
+				if !reflect.DeepEqual(got, want) {
+					errs <- fmt.Errorf("goroutine %d, run %d: got %v", g, i, got)
+					return
+				}
+			}
+			errs <- nil
+		}(g)
+	}
+	for g := 0; g < goroutines; g++ {
+		c.Assert(<-errs, IsNil)
+	}
+}
+
 func (s *S) TestUnmarshalFullTimestamp(c *C) {
 	// Full timestamp in same format as encoded. This is confirmed to be
 	// properly decoded by Python as a timestamp as well.
@@ -905,6 +1005,688 @@ func (s *S) TestDecoder(c *C) {
 	}
 }
 
+func (s *S) TestDecoderAnchors(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("defaults: &defaults {a: 1}\nitem: {<<: *defaults, b: 2}\n---\nother: &other [x]\n"))
+	c.Assert(dec.Anchors(), HasLen, 0)
+
+	var doc yaml.Node
+	c.Assert(dec.Decode(&doc), IsNil)
+	anchors := dec.Anchors()
+	c.Assert(anchors, HasLen, 1)
+	c.Assert(anchors["defaults"], Equals, doc.Content[0].Content[1])
+
+	var defaults struct{ A int }
+	c.Assert(anchors["defaults"].Decode(&defaults), IsNil)
+	c.Assert(defaults.A, Equals, 1)
+
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	anchors = dec.Anchors()
+	c.Assert(anchors, HasLen, 2)
+	c.Assert(anchors["other"].Kind, Equals, yaml.SequenceNode)
+
+	dec.ResetBytes([]byte("a: b"))
+	c.Assert(dec.Anchors(), HasLen, 0)
+}
+
+func (s *S) TestDecoderMore(c *C) {
+	for i, item := range decoderTests {
+		c.Logf("test %d: %q", i, item.data)
+		var values []interface{}
+		dec := yaml.NewDecoder(strings.NewReader(item.data))
+		for dec.More() {
+			var value interface{}
+			c.Assert(dec.Decode(&value), IsNil)
+			values = append(values, value)
+		}
+		c.Assert(values, DeepEquals, item.values)
+		c.Assert(dec.More(), Equals, false)
+		c.Assert(dec.Decode(new(interface{})), Equals, io.EOF)
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\n---\n[b"))
+	c.Assert(dec.More(), Equals, true)
+	c.Assert(dec.Decode(new(interface{})), IsNil)
+	c.Assert(dec.More(), Equals, true)
+	c.Assert(dec.Decode(new(interface{})), ErrorMatches, "yaml: line 2: did not find expected ',' or ']'")
+}
+
+func (s *S) TestValid(c *C) {
+	for i, item := range unmarshalTests {
+		if strings.HasSuffix(item.data, "}not yaml") {
+			// Unmarshal stops after the first document.
+			continue
+		}
+		c.Assert(yaml.Valid([]byte(item.data)), Equals, true, Commentf("test %d: %q", i, item.data))
+	}
+	c.Assert(yaml.Valid([]byte("a: [b")), Equals, false)
+	c.Assert(yaml.Valid([]byte("a: *b")), Equals, false)
+
+	errs := yaml.Validate(strings.NewReader("a: &x 1\nb: *x\nc: *y\n---\nd: *x\ne: *z\nf: [\n"))
+	c.Assert(errs, HasLen, 3)
+	c.Assert(errs[0], DeepEquals, &yaml.AnchorError{
+		Code:    yaml.ErrCodeUnknownAnchor,
+		Anchor:  "y",
+		Line:    3,
+		Column:  4,
+		Message: "unknown anchor 'y' referenced",
+	})
+	c.Assert(errs[1], ErrorMatches, "yaml: line 6: unknown anchor 'z' referenced")
+	c.Assert(errs[2], ErrorMatches, "yaml: line 7: did not find expected node content")
+	c.Assert(yaml.Validate(strings.NewReader("a: b")), IsNil)
+}
+
+func (s *S) TestReadStats(c *C) {
+	stats, err := yaml.ReadStats(strings.NewReader("a: &x [1, 22, {b: *x}]\n---\nccc\n---\n"))
+	c.Assert(err, IsNil)
+	c.Assert(*stats, DeepEquals, yaml.Stats{
+		Documents:      3,
+		MaxDepth:       3,
+		Mappings:       2,
+		Sequences:      1,
+		Scalars:        6,
+		Aliases:        1,
+		Anchors:        1,
+		ScalarBytes:    8,
+		MaxScalarBytes: 3,
+		ScalarSizes:    []int{1, 3, 2},
+		ExpandedNodes:  10,
+	})
+	c.Assert(stats.Nodes(), Equals, 10)
+	c.Assert(stats.Expansion(), Equals, 1.0)
+
+	stats, err = yaml.ReadStats(strings.NewReader("a: [b, c\n"))
+	c.Assert(err, ErrorMatches, "yaml: line 1: did not find expected ',' or ']'")
+	c.Assert(*stats, DeepEquals, yaml.Stats{Documents: 1, MaxDepth: 2, Mappings: 1, Sequences: 1, Scalars: 3, ScalarBytes: 3, MaxScalarBytes: 1, ScalarSizes: []int{0, 3}})
+}
+
+func (s *S) TestStatsCheck(c *C) {
+	in := `
+a: &a [x, x, x, x]
+b: &b [*a, *a, *a, *a]
+c: &c [*b, *b, *b, *b]
+d: &a 0123456789abcdef
+e: [*a, *c]
+`
+	stats, err := yaml.ReadStats(strings.NewReader(in))
+	c.Assert(err, IsNil)
+	c.Assert(stats.Nodes(), Equals, 25)
+	c.Assert(stats.ExpandedNodes, Equals, int64(205))
+	c.Assert(stats.MaxScalarBytes, Equals, 16)
+	c.Assert(stats.ScalarSizes, DeepEquals, []int{0, 9, 0, 0, 0, 1})
+	c.Assert(stats.Check(yaml.Limits{MaxDepth: 2, MaxExpansion: 10}), IsNil)
+
+	tests := []struct {
+		limits yaml.Limits
+		code   yaml.ErrorCode
+		error  string
+	}{
+		{yaml.Limits{MaxDepth: 1}, yaml.ErrCodeMaxDepth, "yaml: nesting depth 2 exceeds the limit of 1"},
+		{yaml.Limits{MaxNodes: 20}, yaml.ErrCodeInputTooLarge, "yaml: 25 nodes exceed the limit of 20"},
+		{yaml.Limits{MaxScalarBytes: 8}, yaml.ErrCodeInputTooLarge, "yaml: scalar of 16 bytes exceeds the limit of 8"},
+		{yaml.Limits{MaxTotalScalarBytes: 8}, yaml.ErrCodeInputTooLarge, "yaml: scalars of 25 bytes in total exceed the limit of 8"},
+		{yaml.Limits{MaxExpandedNodes: 100}, yaml.ErrCodeAliasLimit, "yaml: aliases expand to 205 nodes, over the limit of 100"},
+		{yaml.Limits{MaxExpansion: 2}, yaml.ErrCodeAliasLimit, "yaml: aliases expand nodes by a factor of 8.2, over the limit of 2.0"},
+	}
+	for _, t := range tests {
+		err := stats.Check(t.limits)
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, t.error)
+		c.Assert(yaml.CodeOf(err), Equals, t.code)
+	}
+
+	// The count of expanded nodes is capped rather than overflowing.
+	var b bytes.Buffer
+	b.WriteString("a0: &a0 [x, x]\n")
+	for i := 1; i < 70; i++ {
+		fmt.Fprintf(&b, "a%d: &a%d [*a%d, *a%d]\n", i, i, i-1, i-1)
+	}
+	stats, err = yaml.ReadStats(strings.NewReader(b.String()))
+	c.Assert(err, IsNil)
+	c.Assert(stats.ExpandedNodes, Equals, int64(1<<62))
+}
+
+func (s *S) TestUnmarshalRestField(c *C) {
+	var v struct {
+		A    int
+		Rest map[string]yaml.Node `yaml:",rest"`
+	}
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: [x, y] # c\nc: {d: e}\n"))
+	dec.KnownFields(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.A, Equals, 1)
+	c.Assert(v.Rest, HasLen, 2)
+	c.Assert(v.Rest["b"].Kind, Equals, yaml.SequenceNode)
+	c.Assert(v.Rest["b"].LineComment, Equals, "# c")
+
+	data, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: 1\nb: [x, y] # c\nc: {d: e}\n")
+
+	var bad struct {
+		Rest []string `yaml:",rest"`
+	}
+	err = yaml.Unmarshal([]byte("a: 1"), &bad)
+	c.Assert(err, ErrorMatches, ".*option ,rest may only be used on a map field")
+}
+
+type patchServer struct {
+	Host string
+	Port int
+}
+
+type patchConfig struct {
+	Name    string
+	Server  patchServer
+	Servers map[string]patchServer
+	Extra   interface{}
+	Tags    []string
+	Rest    map[string]map[string]int `yaml:",inline"`
+}
+
+func patchDefaults() patchConfig {
+	return patchConfig{
+		Name:    "default",
+		Server:  patchServer{"localhost", 80},
+		Servers: map[string]patchServer{"a": {"a.example", 80}, "b": {"b.example", 80}},
+		Extra:   map[string]interface{}{"x": 1, "y": map[string]interface{}{"z": 2}},
+		Tags:    []string{"t1"},
+		Rest:    map[string]map[string]int{"r": {"i": 1, "j": 2}},
+	}
+}
+
+func (s *S) TestDecoderPatch(c *C) {
+	data := "server: {port: 8080}\nservers: {a: {port: 8081}, c: {host: c.example}}\nextra: {y: {w: 3}}\ntags: [t2]\nr: {j: 3}\n"
+
+	v := patchDefaults()
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.Patch(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, patchConfig{
+		Name:    "default",
+		Server:  patchServer{"localhost", 8080},
+		Servers: map[string]patchServer{"a": {"a.example", 8081}, "b": {"b.example", 80}, "c": {"c.example", 0}},
+		Extra:   map[string]interface{}{"x": 1, "y": map[string]interface{}{"z": 2, "w": 3}},
+		Tags:    []string{"t2"},
+		Rest:    map[string]map[string]int{"r": {"i": 1, "j": 3}},
+	})
+
+	// Without patching, map entries and interface values are replaced.
+	v = patchDefaults()
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v, DeepEquals, patchConfig{
+		Name:    "default",
+		Server:  patchServer{"localhost", 8080},
+		Servers: map[string]patchServer{"a": {"", 8081}, "b": {"b.example", 80}, "c": {"c.example", 0}},
+		Extra:   map[string]interface{}{"y": map[string]interface{}{"w": 3}},
+		Tags:    []string{"t2"},
+		Rest:    map[string]map[string]int{"r": {"j": 3}},
+	})
+
+	v = patchDefaults()
+	err := yaml.UnmarshalWithOptions([]byte("servers: {a: null}\nextra: ~\n"), &v, yaml.WithPatch(true))
+	c.Assert(err, IsNil)
+	c.Assert(v.Servers, DeepEquals, patchDefaults().Servers)
+	c.Assert(v.Extra, IsNil)
+}
+
+func (s *S) TestDecoderSetProjection(c *C) {
+	in := `
+name: app
+big: {a: [1, 2, {b: 3}], c: &c {d: 4}}
+spec:
+  replicas: 3
+  containers:
+    - name: web
+      image: web:1
+      args: [x, y]
+    - name: side
+      image: side:2
+  other: *c
+`
+	dec := yaml.NewDecoder(strings.NewReader(in))
+	dec.SetProjection("name", "spec.containers[*].image", "spec.other")
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"name": "app",
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"image": "web:1"},
+				map[string]interface{}{"image": "side:2"},
+			},
+			"other": map[string]interface{}{"d": 4},
+		},
+	})
+
+	// Items skipped are null.
+	var n yaml.Node
+	dec = yaml.NewDecoder(strings.NewReader("a: [x, y, {z: 1}]\n"))
+	dec.SetProjection("a[2].**")
+	c.Assert(dec.Decode(&n), IsNil)
+	out, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a: [null, null, {z: 1}]\n")
+
+	var spec struct {
+		Spec struct{ Replicas int }
+	}
+	err = yaml.UnmarshalWithOptions([]byte(in), &spec, yaml.WithProjection("spec.replicas"), yaml.WithKnownFields(true))
+	c.Assert(err, IsNil)
+	c.Assert(spec.Spec.Replicas, Equals, 3)
+
+	c.Assert(func() { dec.SetProjection("a[") }, PanicMatches, `yaml: invalid path "a\["`)
+}
+
+func (s *S) TestDecoderSkipValue(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: [1, {b: &x 2}]\n---\nc: 3\n---\nd\n"))
+	c.Assert(dec.SkipValue(), IsNil)
+	var v map[string]int
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]int{"c": 3})
+	c.Assert(dec.SkipValue(), IsNil)
+	c.Assert(dec.SkipValue(), Equals, io.EOF)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: [1\n"))
+	c.Assert(dec.SkipValue(), ErrorMatches, "yaml: line 1: did not find expected ',' or ']'")
+}
+
+func (s *S) TestUnmarshalSkipsIgnoredValues(c *C) {
+	type T struct {
+		A      int
+		Secret map[string]int `yaml:"-"`
+		B      struct{ C []int }
+		D      interface{}
+	}
+	in := `
+a: 1
+secret: {x: 1}
+extra: [&e {y: 2}, !custom z]
+b:
+  c: [1, 2]
+  unknown: {deep: [true]}
+d: *e
+`
+	var v T
+	dec := yaml.NewDecoder(strings.NewReader(in))
+	// Values skipped are not checked for tags.
+	dec.DisallowCustomTags(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.A, Equals, 1)
+	c.Assert(v.Secret, IsNil)
+	c.Assert(v.B.C, DeepEquals, []int{1, 2})
+	c.Assert(v.D, DeepEquals, map[string]interface{}{"y": 2})
+	c.Assert(dec.Warnings(), DeepEquals, []yaml.Warning{
+		{Offset: -1, Line: 3, Column: 1, Message: "field secret not found in type yaml_test.T"},
+		{Offset: -1, Line: 4, Column: 1, Message: "field extra not found in type yaml_test.T"},
+		{Offset: -1, Line: 7, Column: 3, Message: "field unknown not found in type struct { C []int }"},
+	})
+
+	// Keys skipped are still checked.
+	err := yaml.UnmarshalStrict([]byte("a: 1\nextra: {x: [1]}\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: field extra not found in type yaml_test.T")
+	err = yaml.Unmarshal([]byte("extra: 1\nextra: {x: 2}\n"), &v)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 2: mapping key "extra" already defined at line 1`)
+
+	// Inline maps and unmarshalers get all the keys.
+	var w struct {
+		A    int
+		Rest map[string]interface{} `yaml:",inline"`
+	}
+	c.Assert(yaml.Unmarshal([]byte("a: 1\nb: {c: 2}\n"), &w), IsNil)
+	c.Assert(w.Rest, DeepEquals, map[string]interface{}{"b": map[string]interface{}{"c": 2}})
+}
+
+var errUnknownLevel = errors.New("unknown level")
+
+type logLevel int
+
+func (l *logLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return errUnknownLevel
+	}
+	return nil
+}
+
+func (s *S) TestDecoderMaxErrors(c *C) {
+	type T struct {
+		Port  int
+		Level logLevel
+		Key   []byte
+		Hosts []struct{ Weight int }
+		Debug bool
+	}
+	in := `
+port: http
+level: loud
+key: !!binary =
+hosts: [{weight: 1}, {weight: heavy}]
+debug: maybe
+`
+	var v T
+	err := yaml.NewDecoder(strings.NewReader(in)).Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 2: cannot unmarshal !!str `http` into int\n"+
+		"  line 3: unknown level\n"+
+		"  line 4: !!binary value contains invalid base64 data\n"+
+		"  line 5: cannot unmarshal !!str `heavy` into int\n"+
+		"  line 6: cannot unmarshal !!str `maybe` into bool")
+	details := err.(*yaml.TypeError).Details
+	c.Assert(details[1].Code, Equals, yaml.ErrCodeInvalidValue)
+	c.Assert(details[1].Path.String(), Equals, "level")
+	c.Assert(details[1].Err, Equals, errUnknownLevel)
+	c.Assert(details[2].Code, Equals, yaml.ErrCodeInvalidValue)
+	c.Assert(details[3].Path.String(), Equals, "hosts[1].weight")
+
+	dec := yaml.NewDecoder(strings.NewReader(in))
+	dec.SetMaxErrors(2)
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 2: cannot unmarshal !!str `http` into int\n"+
+		"  line 3: unknown level")
+
+	err = yaml.UnmarshalWithOptions([]byte(in), &v, yaml.WithMaxErrors(1))
+	c.Assert(err.(*yaml.TypeError).Details, HasLen, 1)
+}
+
+func (s *S) TestDecoderSlicePolicy(c *C) {
+	type T struct {
+		A []int
+		B []int  `yaml:",append"`
+		C *[]int `yaml:",replace"`
+	}
+	data := "a: [3, 4]\nb: [3, 4]\nc: [3, 4]\n"
+	initial := func() T {
+		c := []int{1, 2}
+		return T{A: []int{1, 2}, B: []int{1, 2}, C: &c}
+	}
+
+	for _, item := range []struct {
+		policy yaml.SlicePolicy
+		a      []int
+	}{
+		{0, []int{3, 4}},
+		{yaml.SliceReplace, []int{3, 4}},
+		{yaml.SliceReuse, []int{3, 4}},
+		{yaml.SliceAppend, []int{1, 2, 3, 4}},
+	} {
+		v := initial()
+		a := v.A
+		err := yaml.UnmarshalWithOptions([]byte(data), &v, yaml.WithSlicePolicy(item.policy))
+		c.Assert(err, IsNil)
+		c.Assert(v.A, DeepEquals, item.a)
+		c.Assert(&v.A[0] == &a[0], Equals, item.policy == yaml.SliceReuse)
+		c.Assert(v.B, DeepEquals, []int{1, 2, 3, 4})
+		c.Assert(*v.C, DeepEquals, []int{3, 4})
+	}
+
+	// Reusing needs the capacity for the items.
+	v := initial()
+	a := v.A
+	err := yaml.UnmarshalWithOptions([]byte("a: [3, 4, 5]"), &v, yaml.WithSlicePolicy(yaml.SliceReuse))
+	c.Assert(err, IsNil)
+	c.Assert(v.A, DeepEquals, []int{3, 4, 5})
+	c.Assert(a, DeepEquals, []int{1, 2})
+
+	// The policy of a field doesn't apply to the slices nested in it.
+	var w struct {
+		A [][]int `yaml:",append"`
+	}
+	w.A = [][]int{{1}}
+	c.Assert(yaml.Unmarshal([]byte("a: [[2], [3]]"), &w), IsNil)
+	c.Assert(w.A, DeepEquals, [][]int{{1}, {2}, {3}})
+
+	var bad struct {
+		A map[string]int `yaml:",append"`
+	}
+	err = yaml.Unmarshal([]byte("a: {}"), &bad)
+	c.Assert(err, ErrorMatches, ".*option ,append may only be used on a slice field")
+}
+
+func (s *S) TestDecoderMapPolicy(c *C) {
+	type T struct {
+		M    map[string]int
+		I    interface{}
+		Rest map[string]int `yaml:",rest"`
+	}
+	data := "m: {b: 3, <<: {c: 4, b: 5}}\ni: {b: 3}\nz: 3\n"
+	initial := func() T {
+		return T{
+			M:    map[string]int{"a": 1, "b": 2},
+			I:    map[string]interface{}{"a": 1},
+			Rest: map[string]int{"y": 1},
+		}
+	}
+
+	v := initial()
+	m := v.M
+	err := yaml.UnmarshalWithOptions([]byte(data), &v, yaml.WithMapPolicy(yaml.MapMerge), yaml.WithPatch(true))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, T{
+		M:    map[string]int{"a": 1, "b": 3, "c": 4},
+		I:    map[string]interface{}{"a": 1, "b": 3},
+		Rest: map[string]int{"y": 1, "z": 3},
+	})
+	c.Assert(m, DeepEquals, v.M)
+
+	v = initial()
+	m = v.M
+	err = yaml.UnmarshalWithOptions([]byte(data), &v, yaml.WithMapPolicy(yaml.MapReplace), yaml.WithPatch(true))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, T{
+		M:    map[string]int{"b": 3, "c": 4},
+		I:    map[string]interface{}{"b": 3},
+		Rest: map[string]int{"z": 3},
+	})
+	c.Assert(m, DeepEquals, map[string]int{"a": 1, "b": 2})
+}
+
+type namedInner struct {
+	RetryCount int
+}
+
+type namedKeys struct {
+	UserID     string
+	HTTPServer string
+	Max_Size   int
+	Port8080   bool
+	Tagged     int `yaml:"Custom"`
+	namedInner `yaml:",inline"`
+}
+
+func (s *S) TestDecoderKeyNaming(c *C) {
+	tests := []struct {
+		naming yaml.KeyNaming
+		data   string
+	}{
+		{0, "userid: a\nhttpserver: b\nmax_size: 1\nport8080: true\nCustom: 2\nretrycount: 3\n"},
+		{yaml.KeyLowercase, "userid: a\nhttpserver: b\nmax_size: 1\nport8080: true\nCustom: 2\nretrycount: 3\n"},
+		{yaml.KeySnakeCase, "user_id: a\nhttp_server: b\nmax_size: 1\nport8080: true\nCustom: 2\nretry_count: 3\n"},
+		{yaml.KeyKebabCase, "user-id: a\nhttp-server: b\nmax-size: 1\nport8080: true\nCustom: 2\nretry-count: 3\n"},
+		{yaml.KeyCamelCase, "userId: a\nhttpServer: b\nmaxSize: 1\nport8080: true\nCustom: 2\nretryCount: 3\n"},
+	}
+	want := namedKeys{"a", "b", 1, true, 2, namedInner{3}}
+	for _, test := range tests {
+		dec := yaml.NewDecoder(strings.NewReader(test.data))
+		dec.SetKeyNaming(test.naming)
+		dec.KnownFields(true)
+		var v namedKeys
+		c.Assert(dec.Decode(&v), IsNil, Commentf("naming %d", test.naming))
+		c.Assert(v, DeepEquals, want)
+
+		var w []namedKeys
+		err := yaml.UnmarshalWithOptions([]byte("- "+strings.Replace(test.data, "\n", "\n  ", -1)), &w, yaml.WithKeyNaming(test.naming))
+		c.Assert(err, IsNil)
+		c.Assert(w, DeepEquals, []namedKeys{want})
+	}
+
+	// The keys named otherwise are unknown.
+	dec := yaml.NewDecoder(strings.NewReader("userid: a\nuser_id: b\n"))
+	dec.SetKeyNaming(yaml.KeySnakeCase)
+	var v namedKeys
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.UserID, Equals, "b")
+}
+
+func (s *S) TestDecoderPreserveMergeKeys(c *C) {
+	type service struct {
+		Image string
+		Rest  map[string]yaml.Node `yaml:",rest"`
+	}
+	type T struct {
+		Base    yaml.Node
+		Prod    map[string]yaml.Node
+		Service service
+	}
+	data := `base: &base {image: app, replicas: 1}
+prod:
+    <<: *base
+    replicas: 3
+service:
+    <<: *base
+    debug: true
+`
+	var v T
+	c.Assert(yaml.UnmarshalWithOptions([]byte(data), &v, yaml.WithPreserveMergeKeys(true)), IsNil)
+	c.Assert(v.Base.Anchor, Equals, "base")
+	c.Assert(v.Prod, HasLen, 2)
+	merge := v.Prod["<<"]
+	c.Assert(merge.Kind, Equals, yaml.AliasNode)
+	c.Assert(merge.Value, Equals, "base")
+	c.Assert(v.Prod["replicas"].Value, Equals, "3")
+	c.Assert(v.Service.Image, Equals, "app")
+	c.Assert(v.Service.Rest, HasLen, 2)
+	c.Assert(v.Service.Rest["<<"].Kind, Equals, yaml.AliasNode)
+	c.Assert(v.Service.Rest["debug"].Value, Equals, "true")
+
+	// The anchored mapping is written back with the alias to it.
+	out, err := yaml.Marshal(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "base"}, merge.Alias,
+		{Kind: yaml.ScalarNode, Value: "prod"}, {Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "<<"}, &merge,
+			{Kind: yaml.ScalarNode, Value: "replicas"}, {Kind: yaml.ScalarNode, Value: "3"},
+		}},
+	}})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "base: &base {image: app, replicas: 1}\nprod:\n    <<: *base\n    replicas: 3\n")
+
+	// The entries are merged otherwise.
+	v = T{}
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v.Prod, HasLen, 2)
+	c.Assert(v.Prod["image"].Value, Equals, "app")
+	c.Assert(v.Service.Rest, HasLen, 2)
+	c.Assert(v.Service.Rest["replicas"].Value, Equals, "1")
+}
+
+func (s *S) TestDecoderPresence(c *C) {
+	var v struct {
+		Name     string
+		Replicas *int
+		Image    string
+		Ports    []int
+		Labels   map[string]string
+	}
+	dec := yaml.NewDecoder(strings.NewReader("name: a\nreplicas: ~\nports: [80, null]\nlabels: {app.name: x}\n<<: {image: b}\nextra: 1\n---\nname: b\n"))
+	dec.TrackPresence(true)
+	err := dec.Decode(&v)
+	c.Assert(err, IsNil)
+	for path, want := range map[string]yaml.Presence{
+		"name":               yaml.Present,
+		"replicas":           yaml.PresentNull,
+		"image":              yaml.Present,
+		"ports":              yaml.Present,
+		"ports[0]":           yaml.Present,
+		"ports[1]":           yaml.PresentNull,
+		"ports[2]":           yaml.Absent,
+		`labels["app.name"]`: yaml.Present,
+		"extra":              yaml.Absent,
+		"missing":            yaml.Absent,
+	} {
+		c.Check(dec.Presence(path), Equals, want, Commentf("path %s", path))
+	}
+
+	err = dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(dec.Presence("name"), Equals, yaml.Present)
+	c.Assert(dec.Presence("replicas"), Equals, yaml.Absent)
+
+	dec.TrackPresence(false)
+	err = dec.Decode(&v)
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(dec.Presence("name"), Equals, yaml.Absent)
+}
+
+func (s *S) TestUnmarshalStrict(c *C) {
+	var v struct {
+		A string
+		B int
+		C uint
+		D bool
+		E float64
+	}
+	err := yaml.UnmarshalStrict([]byte("a: x\nb: -1\nc: 2\nd: true\ne: 3"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.A, Equals, "x")
+	c.Assert(v.E, Equals, 3.0)
+
+	err = yaml.UnmarshalStrict([]byte("a: 1\nb: 1.0\nc: 2.0\nd: yes\nf: 1"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!int `1` into string\n"+
+		"  line 2: cannot unmarshal !!float `1.0` into int\n"+
+		"  line 3: cannot unmarshal !!float `2.0` into uint\n"+
+		"  line 4: cannot unmarshal !!str `yes` into bool\n"+
+		"  line 5: field f not found in type struct .*")
+
+	err = yaml.Unmarshal([]byte("a: 1\nb: 1.0\nc: 2.0\nd: yes\nf: 1"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.A, Equals, "1")
+
+	err = yaml.UnmarshalStrict([]byte("a: x\na: y"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 2: mapping key \"a\" already defined at line 1")
+}
+
+func (s *S) TestUnmarshalWithOptions(c *C) {
+	var v struct{ A []int }
+	err := yaml.UnmarshalWithOptions([]byte("a: [1, 2]\n---\nb: 1"), &v, yaml.WithIndent(2))
+	c.Assert(err, IsNil)
+	c.Assert(v.A, DeepEquals, []int{1, 2})
+
+	err = yaml.UnmarshalWithOptions(nil, &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.A, DeepEquals, []int{1, 2})
+
+	err = yaml.UnmarshalWithOptions([]byte("a: [1]\nb: 2"), &v, yaml.WithKnownFields(true))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeType)
+
+	err = yaml.UnmarshalWithOptions([]byte("a: [[1]]"), new(interface{}), yaml.WithMaxDepth(2))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeMaxDepth)
+
+	err = yaml.UnmarshalWithOptions([]byte("a: &a [1]\nb: *a"), new(interface{}), yaml.WithDisallowAliases(true))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeAliasDisallowed)
+
+	err = yaml.UnmarshalWithOptions([]byte("a: !x 1"), new(interface{}), yaml.WithDisallowCustomTags(true))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeCustomTag)
+
+	err = yaml.UnmarshalWithOptions([]byte("a: &a [1, 1]\nb: *a"), new(interface{}), yaml.WithMaxAliasExpansions(2))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeAliasLimit)
+
+	err = yaml.UnmarshalWithOptions([]byte("a: 1234"), new(interface{}), yaml.WithMaxBytes(4))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeInputTooLarge)
+
+	var warnings []yaml.Warning
+	err = yaml.UnmarshalWithOptions([]byte("a: 1"), new(interface{}), yaml.DecoderOption(func(dec *yaml.Decoder) {
+		warnings = dec.Warnings()
+	}))
+	c.Assert(err, IsNil)
+	c.Assert(warnings, HasLen, 0)
+}
+
 type errReader struct{}
 
 func (errReader) Read([]byte) (int, error) {
@@ -916,6 +1698,556 @@ func (s *S) TestDecoderReadError(c *C) {
 	c.Assert(err, ErrorMatches, `yaml: input error: some read error`)
 }
 
+func (s *S) TestDecoderReplaceInvalid(c *C) {
+	var v map[string]string
+	dec := yaml.NewDecoder(strings.NewReader("a: b\xffc\nd: e\xe2\x82"))
+	dec.ReplaceInvalid(true)
+	err := dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "b\ufffdc", "d": "e\ufffd"})
+	c.Assert(dec.Warnings(), DeepEquals, []yaml.Warning{
+		{Offset: 4, Message: "invalid leading UTF-8 octet"},
+		{Offset: 11, Message: "incomplete UTF-8 octet sequence"},
+	})
+
+	// UTF-16LE with an unpaired low surrogate.
+	dec = yaml.NewDecoder(strings.NewReader("\xff\xfea\x00:\x00 \x00\x00\xdc\n\x00"))
+	dec.ReplaceInvalid(true)
+	v = nil
+	err = dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "\ufffd"})
+	c.Assert(dec.Warnings(), HasLen, 1)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: b\xffc\n"))
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: invalid leading UTF-8 octet at byte 4")
+
+	// The warnings are limited, with a count of those left out.
+	dec = yaml.NewDecoder(strings.NewReader("a: " + strings.Repeat("\xff", 1500)))
+	dec.ReplaceInvalid(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	warnings := dec.Warnings()
+	c.Assert(warnings, HasLen, 1001)
+	c.Assert(warnings[1000].String(), Equals, "yaml: 500 more problems in the input left out")
+
+	dec = yaml.NewDecoder(strings.NewReader("a: \xff\xff\xff"))
+	dec.ReplaceInvalid(true)
+	dec.SetMaxErrors(2)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.Warnings(), DeepEquals, []yaml.Warning{
+		{Offset: 3, Message: "invalid leading UTF-8 octet"},
+		{Offset: 4, Message: "invalid leading UTF-8 octet"},
+		{Offset: -1, Message: "1 more problems in the input left out"},
+	})
+}
+
+var encodingErrorTests = []struct {
+	data   string
+	offset int
+	bytes  string
+	err    error
+}{
+	{"a: b\nc: \xe9t\xe9\n", 9, "\xe9t", yaml.ErrInvalidUTF8},
+	{"a: \xf0\x9f\x98", 3, "\xf0\x9f\x98", yaml.ErrInvalidUTF8},
+	{"\xff\xfea\x00:\x00 \x00\x00\xdcb\x00", 8, "\x00\xdc", yaml.ErrInvalidUTF16},
+	{"a: \x1b[0m", 3, "\x1b", yaml.ErrDisallowedCharacter},
+}
+
+func (s *S) TestDecoderEncodingError(c *C) {
+	for i, item := range encodingErrorTests {
+		c.Logf("test %d: %q", i, item.data)
+		var v interface{}
+		err := yaml.NewDecoder(strings.NewReader(item.data)).Decode(&v)
+		e, ok := err.(*yaml.EncodingError)
+		c.Assert(ok, Equals, true, Commentf("error: %v", err))
+		c.Assert(e.Offset, Equals, item.offset)
+		c.Assert(string(e.Bytes), Equals, item.bytes)
+		c.Assert(e.Unwrap(), Equals, item.err)
+		c.Assert(err, ErrorMatches, fmt.Sprintf("yaml: .* at byte %d", item.offset))
+	}
+}
+
+func (s *S) TestDecoderFallbackToWindows1252(c *C) {
+	// Latin-1 and Windows-1252 text mixed with valid UTF-8.
+	data := "caf\xe9: \x93na\xefve\x94 \xc3\xa9t\xe9\x80\n\xff: \x81"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.FallbackToWindows1252(true)
+	var v map[string]string
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]string{
+		"café": "\u201cnaïve\u201d été€",
+		"ÿ":    "\ufffd",
+	})
+	c.Assert(dec.Warnings(), HasLen, 8)
+	c.Assert(dec.Warnings()[0], Equals, yaml.Warning{Offset: 3, Message: "invalid UTF-8 octet read as Windows-1252"})
+}
+
+func (s *S) TestDecoderSetSurrogatePolicy(c *C) {
+	// "a: " followed by a lone low surrogate, "b", a lone high surrogate,
+	// "c" and a high surrogate ending the input.
+	data := "\xff\xfea\x00:\x00 \x00\x00\xdcb\x00\x00\xd8c\x00\x3d\xd8"
+	tests := []struct {
+		policy yaml.SurrogatePolicy
+		value  string
+		error  string
+	}{
+		{yaml.SurrogateError, "", "yaml: unexpected low surrogate area at byte 8"},
+		{yaml.SurrogateReplace, "\ufffdb\ufffdc\ufffd", ""},
+		{yaml.SurrogateWTF8, "\xed\xb0\x80b\xed\xa0\x80c\xed\xa0\xbd", ""},
+	}
+	for _, test := range tests {
+		c.Logf("policy %d", test.policy)
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetSurrogatePolicy(test.policy)
+		var v map[string]string
+		err := dec.Decode(&v)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(v["a"], Equals, test.value)
+		if test.policy == yaml.SurrogateReplace {
+			c.Assert(dec.Warnings(), HasLen, 3)
+		} else {
+			c.Assert(dec.Warnings(), HasLen, 0)
+		}
+	}
+}
+
+func (s *S) TestDecoderStrictCharacters(c *C) {
+	data := "a: \ufdd0\nb: \U0001fffe\n"
+	var v map[string]interface{}
+	c.Assert(yaml.NewDecoder(strings.NewReader(data)).Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": "\ufdd0", "b": "\U0001fffe"})
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.StrictCharacters(true)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, "yaml: noncharacters are not allowed at byte 3")
+	c.Assert(err.(*yaml.EncodingError).Err, Equals, yaml.ErrDisallowedCharacter)
+
+	v = nil
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.StrictCharacters(true)
+	dec.ReplaceInvalid(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": "\ufffd", "b": "\ufffd"})
+	c.Assert(dec.Warnings(), DeepEquals, []yaml.Warning{
+		{Offset: 3, Message: "noncharacters are not allowed"},
+		{Offset: 10, Message: "noncharacters are not allowed"},
+	})
+}
+
+func (s *S) TestDecoderNormalizeLineEndings(c *C) {
+	want := "# c\n\n# d\na: |\n  x\n  y\n"
+	for _, data := range []string{want, strings.Replace(want, "\n", "\r\n", -1), strings.Replace(want, "\n", "\r", -1)} {
+		c.Logf("data %q", data)
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetBufferSize(16)
+		dec.NormalizeLineEndings(true)
+		var n yaml.Node
+		c.Assert(dec.Decode(&n), IsNil)
+		c.Assert(n.HeadComment, Equals, "# c")
+		c.Assert(n.Content[0].Content[0].HeadComment, Equals, "# d")
+		c.Assert(n.Content[0].Content[1].Value, Equals, "x\ny\n")
+		c.Assert(n.Content[0].Content[1].Line, Equals, 4)
+	}
+}
+
+func (s *S) TestDecoderSetNormalizer(c *C) {
+	// A stand-in for NFC that only composes e and U+0301.
+	nfc := func(s string) string {
+		return strings.Replace(s, "e\u0301", "\u00e9", -1)
+	}
+	data := "caf\u00e9: 1\ncafe\u0301: 2\n"
+	var v map[string]int
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetNormalizer(nfc)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 2: mapping key \"caf\u00e9\" already defined at line 1")
+
+	var t struct {
+		Cafe string `yaml:"caf\u00e9"`
+	}
+	dec = yaml.NewDecoder(strings.NewReader("cafe\u0301: cre\u0300me\n"))
+	dec.SetNormalizer(nfc)
+	c.Assert(dec.Decode(&t), IsNil)
+	c.Assert(t.Cafe, Equals, "cre\u0300me")
+}
+
+func (s *S) TestDecoderWarnings(c *C) {
+	data := "enabled: yes\nmode: 0755\nextra: 1\nname: \xff\n"
+	var v struct {
+		Enabled bool
+		Mode    int
+		Name    string
+	}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.ReplaceInvalid(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Enabled, Equals, true)
+	c.Assert(v.Mode, Equals, 0755)
+	c.Assert(dec.Warnings(), DeepEquals, []yaml.Warning{
+		{Offset: 39, Message: "invalid leading UTF-8 octet"},
+		{Offset: -1, Line: 1, Column: 10, Message: `"yes" is a YAML 1.1 boolean, which YAML 1.2 reads as a string`},
+		{Offset: -1, Line: 2, Column: 7, Message: `"0755" is a YAML 1.1 octal number, which YAML 1.2 writes with a 0o prefix`},
+		{Offset: -1, Line: 3, Column: 1, Message: "field extra not found in type struct { Enabled bool; Mode int; Name string }"},
+	})
+	c.Assert(dec.Warnings()[1].String(), Equals, `yaml: line 1: "yes" is a YAML 1.1 boolean, which YAML 1.2 reads as a string`)
+}
+
+func (s *S) TestDecoderSetEncoding(c *C) {
+	var v map[string]string
+	dec := yaml.NewDecoder(strings.NewReader("a\x00:\x00 \x00b\x00"))
+	dec.SetEncoding(yaml.UTF16LE)
+	err := dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "b"})
+
+	// A matching byte order mark is skipped.
+	v = nil
+	dec = yaml.NewDecoder(strings.NewReader("\xfe\xff\x00a\x00:\x00 \x00b"))
+	dec.SetEncoding(yaml.UTF16BE)
+	err = dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "b"})
+
+	c.Assert(func() { dec.SetEncoding(yaml.Encoding(42)) }, PanicMatches, "yaml: unknown encoding")
+}
+
+func (s *S) TestUnmarshalWithReaderOptions(c *C) {
+	var v map[string]string
+	err := yaml.UnmarshalWithOptions([]byte("a\x00:\x00 \x00b\x00"), &v, yaml.WithEncoding(yaml.UTF16LE))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "b"})
+
+	v = nil
+	err = yaml.UnmarshalWithOptions([]byte("a: \xff\n"), &v)
+	c.Assert(err, NotNil)
+	err = yaml.UnmarshalWithOptions([]byte("a: \xff\n"), &v, yaml.WithReplaceInvalid(true))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "\ufffd"})
+
+	v = nil
+	err = yaml.UnmarshalWithOptions([]byte("a: \xe9\n"), &v, yaml.WithFallbackToWindows1252(true))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "\u00e9"})
+
+	v = nil
+	err = yaml.UnmarshalWithOptions([]byte("a: |\r  b\r  c\r"), &v, yaml.WithNormalizeLineEndings(true))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"a": "b\nc\n"})
+
+	v = nil
+	err = yaml.UnmarshalWithOptions([]byte("a: b"), &v, yaml.WithNormalizer(strings.ToUpper))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]string{"A": "B"})
+}
+
+var detectedEncodingTests = []struct {
+	data string
+	enc  yaml.Encoding
+	bom  bool
+}{
+	{"a: b", yaml.UTF8, false},
+	{"\xef\xbb\xbfa: b", yaml.UTF8, true},
+	{"\xff\xfea\x00:\x00 \x00b\x00", yaml.UTF16LE, true},
+	{"\xfe\xff\x00a\x00:\x00 \x00b", yaml.UTF16BE, true},
+}
+
+func (s *S) TestEncodingNames(c *C) {
+	for _, enc := range []yaml.Encoding{yaml.AnyEncoding, yaml.UTF8, yaml.UTF16LE, yaml.UTF16BE} {
+		parsed, err := yaml.ParseEncoding(enc.String())
+		c.Assert(err, IsNil)
+		c.Assert(parsed, Equals, enc)
+	}
+	c.Assert(yaml.UTF16LE.String(), Equals, "utf-16le")
+	c.Assert(yaml.Encoding(7).String(), Equals, "Encoding(7)")
+
+	enc, err := yaml.ParseEncoding("UTF-8")
+	c.Assert(err, IsNil)
+	c.Assert(enc, Equals, yaml.UTF8)
+	_, err = yaml.ParseEncoding("latin1")
+	c.Assert(err, ErrorMatches, `yaml: unknown encoding "latin1"`)
+}
+
+func (s *S) TestDecoderDetectedEncoding(c *C) {
+	for i, item := range detectedEncodingTests {
+		c.Logf("test %d: %q", i, item.data)
+		dec := yaml.NewDecoder(strings.NewReader(item.data))
+		enc, bom := dec.DetectedEncoding()
+		c.Assert(enc, Equals, yaml.AnyEncoding)
+		c.Assert(bom, Equals, false)
+		var v map[string]string
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v, DeepEquals, map[string]string{"a": "b"})
+		enc, bom = dec.DetectedEncoding()
+		c.Assert(enc, Equals, item.enc)
+		c.Assert(bom, Equals, item.bom)
+	}
+}
+
+var documentBOMTests = []struct {
+	data   string
+	values []interface{}
+	error  string
+}{{
+	"a\n---\n\xef\xbb\xbfb\n",
+	[]interface{}{"a", "b"},
+	"",
+}, {
+	"\xef\xbb\xbfa\n...\n\xef\xbb\xbf---\nb\n",
+	[]interface{}{"a", "b"},
+	"",
+}, {
+	"\xff\xfea\x00\n\x00-\x00-\x00-\x00\n\x00\xff\xfeb\x00\n\x00",
+	[]interface{}{"a", "b"},
+	"",
+}, {
+	"a\n---\n\xff\xfeb\x00\n\x00",
+	nil,
+	"yaml: found a UTF-16 byte order mark in a UTF-8 stream at byte 6",
+}, {
+	"\xff\xfea\x00\n\x00-\x00-\x00-\x00\n\x00\xfe\xff",
+	nil,
+	"yaml: found a byte order mark that does not match the UTF-16 stream at byte 14",
+}}
+
+func (s *S) TestDecoderDocumentBOM(c *C) {
+	for i, item := range documentBOMTests {
+		c.Logf("test %d: %q", i, item.data)
+		var values []interface{}
+		dec := yaml.NewDecoder(strings.NewReader(item.data))
+		var err error
+		for {
+			var value interface{}
+			err = dec.Decode(&value)
+			if err != nil {
+				break
+			}
+			values = append(values, value)
+		}
+		if item.error != "" {
+			c.Assert(err, ErrorMatches, item.error)
+		} else {
+			c.Assert(err, Equals, io.EOF)
+			c.Assert(values, DeepEquals, item.values)
+		}
+	}
+}
+
+func (s *S) TestDecoderBufferSize(c *C) {
+	data := "a: " + strings.Repeat("x", 1000) + "\nb: [\"\\U0001F600\", 2]\n"
+	want := map[string]interface{}{"a": strings.Repeat("x", 1000), "b": []interface{}{"\U0001F600", 2}}
+	for _, size := range []int{0, 16, 100, 4096} {
+		c.Logf("size %d", size)
+		var v map[string]interface{}
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetBufferSize(size)
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v, DeepEquals, want)
+	}
+
+	var v map[string]interface{}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetBuffer(make([]byte, 64))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, want)
+
+	c.Assert(func() { dec.SetBufferSize(1024) }, PanicMatches, "must set the input buffers before reading the input")
+	c.Assert(func() { yaml.NewDecoder(nil).SetBuffer(make([]byte, 63)) }, PanicMatches, "yaml: decoder buffer must be at least 64 bytes long")
+}
+
+// latin1Transform decodes ISO 8859-1 input into UTF-8.
+func latin1Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for _, b := range src {
+		if b < 0x80 {
+			if nDst+1 > len(dst) {
+				return nDst, nSrc, errors.New("short destination buffer")
+			}
+			dst[nDst] = b
+			nDst++
+		} else {
+			if nDst+2 > len(dst) {
+				return nDst, nSrc, errors.New("short destination buffer")
+			}
+			dst[nDst] = 0xC0 | b>>6
+			dst[nDst+1] = 0x80 | b&0x3F
+			nDst += 2
+		}
+		nSrc++
+	}
+	return nDst, nSrc, nil
+}
+
+func (s *S) TestDecoderSetTransform(c *C) {
+	data := "caf\xe9: " + strings.Repeat("\xe9", 100) + "\n---\n\xbfqu\xe9?\n"
+	for _, size := range []int{16, 512} {
+		c.Logf("size %d", size)
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetBufferSize(size)
+		dec.SetTransform(latin1Transform)
+		var v interface{}
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v, DeepEquals, map[string]interface{}{"café": strings.Repeat("é", 100)})
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v, Equals, "¿qué?")
+		c.Assert(dec.Decode(&v), Equals, io.EOF)
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader("a\x00:\x00 \x00b\x00"))
+	dec.SetTransform(yaml.NewTransformer(yaml.UTF16LE).Transform)
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": "b"})
+
+	failing := func(dst, src []byte, atEOF bool) (int, int, error) {
+		return 0, 0, errors.New("bad input")
+	}
+	dec = yaml.NewDecoder(strings.NewReader("a: b"))
+	dec.SetTransform(failing)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: input error: bad input")
+}
+
+func (s *S) TestDecoderSetMaxBytes(c *C) {
+	data := "a: 1\n---\nb: " + strings.Repeat("x", 100) + "\n"
+	utf16 := "\xff\xfe" + strings.Join(strings.Split(data, ""), "\x00") + "\x00"
+	tests := []struct {
+		data  string
+		limit int
+		docs  int
+	}{
+		{data, 0, 2},
+		{data, len(data), 2},
+		{data, len(data) - 1, 1},
+		{utf16, len(utf16), 2},
+		{utf16, len(data), 1},
+	}
+	for i, test := range tests {
+		c.Logf("test %d", i)
+		dec := yaml.NewDecoder(strings.NewReader(test.data))
+		dec.SetBufferSize(16)
+		dec.SetMaxBytes(test.limit)
+		var err error
+		for docs := 0; ; docs++ {
+			var v interface{}
+			if err = dec.Decode(&v); err != nil {
+				c.Assert(docs, Equals, test.docs)
+				break
+			}
+		}
+		if test.docs == 2 {
+			c.Assert(err, Equals, io.EOF)
+			continue
+		}
+		c.Assert(err, ErrorMatches, fmt.Sprintf("yaml: input exceeds the limit of %d bytes", test.limit))
+		c.Assert(err.(*yaml.SizeLimitError).Limit, Equals, test.limit)
+	}
+}
+
+func (s *S) TestDecoderInputOffset(c *C) {
+	first := "a: é\r\n..."
+	data := first + "\r\n--- [" + strings.Repeat("é", 60) + "]\r\n"
+	encodings := []struct {
+		name   string
+		encode func(s string) string
+	}{
+		{"utf-8", func(s string) string { return s }},
+		{"utf-8 with bom", func(s string) string { return "\xef\xbb\xbf" + s }},
+		{"utf-16le", func(s string) string {
+			b := []byte("\xff\xfe")
+			for _, r := range utf16.Encode([]rune(s)) {
+				b = append(b, byte(r), byte(r>>8))
+			}
+			return string(b)
+		}},
+		{"windows-1252", func(s string) string { return strings.Replace(s, "é", "\xe9", -1) }},
+	}
+	for _, enc := range encodings {
+		for _, normalize := range []bool{false, true} {
+			c.Logf("encoding %s, normalize %v", enc.name, normalize)
+			dec := yaml.NewDecoder(strings.NewReader(enc.encode(data)))
+			dec.SetBufferSize(16)
+			dec.NormalizeLineEndings(normalize)
+			dec.FallbackToWindows1252(true)
+			c.Assert(dec.InputOffset(), Equals, int64(0))
+
+			var v interface{}
+			c.Assert(dec.Decode(&v), IsNil)
+			c.Assert(dec.InputOffset(), Equals, int64(len(enc.encode(first))))
+			line, column := dec.InputPos()
+			c.Assert([]int{line, column}, DeepEquals, []int{2, 4})
+
+			c.Assert(dec.Decode(&v), IsNil)
+			c.Assert(dec.InputOffset(), Equals, int64(len(enc.encode(data))))
+			line, column = dec.InputPos()
+			c.Assert([]int{line, column}, DeepEquals, []int{4, 1})
+		}
+	}
+}
+
+func (s *S) TestDecoderBuffered(c *C) {
+	payload := "\x00\x01\xff\xfe binary payload " + strings.Repeat("\x00", 100)
+	data := "title: x\ntags: [a, b]\n...\n" + payload
+	for _, size := range []int{0, 16} {
+		c.Logf("size %d", size)
+		r := strings.NewReader(data)
+		dec := yaml.NewDecoder(r)
+		dec.SetBufferSize(size)
+		var v map[string]interface{}
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v, DeepEquals, map[string]interface{}{"title": "x", "tags": []interface{}{"a", "b"}})
+		c.Assert(dec.InputOffset(), Equals, int64(len(data)-len(payload)-1))
+		rest, err := ioutil.ReadAll(io.MultiReader(dec.Buffered(), r))
+		c.Assert(err, IsNil)
+		c.Assert(string(rest), Equals, "\n"+payload)
+		c.Assert(dec.Decode(&v), ErrorMatches, "yaml: control characters are not allowed at byte 26")
+	}
+
+	dec := yaml.NewDecoder(nil)
+	dec.ResetBytes([]byte("a: 1\n---\nb: 2\n"))
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	rest, err := ioutil.ReadAll(dec.Buffered())
+	c.Assert(err, IsNil)
+	c.Assert(string(rest), Equals, "---\nb: 2\n")
+}
+
+func (s *S) TestDecoderReset(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("\xff\xfea\x00\n\x00-\x00-\x00-\x00\n\x00b\x00"))
+	dec.SetBufferSize(32)
+	dec.ReplaceInvalid(true)
+	var v interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, "a")
+
+	// The pending document and the detected encoding are discarded.
+	dec.Reset(strings.NewReader("c: \xff\n"))
+	enc, _ := dec.DetectedEncoding()
+	c.Assert(enc, Equals, yaml.AnyEncoding)
+	v = nil
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"c": "\ufffd"})
+	c.Assert(dec.Warnings(), HasLen, 1)
+	c.Assert(dec.Decode(&v), Equals, io.EOF)
+
+	dec.ResetBytes([]byte("d\n---\ne\n"))
+	c.Assert(dec.Warnings(), HasLen, 0)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, "d")
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, "e")
+	c.Assert(dec.Decode(&v), Equals, io.EOF)
+
+	// A forced encoding is kept.
+	dec = yaml.NewDecoder(nil)
+	dec.SetEncoding(yaml.UTF16BE)
+	dec.ResetBytes([]byte("\x00f"))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, Equals, "f")
+}
+
 func (s *S) TestUnmarshalNaN(c *C) {
 	value := map[string]interface{}{}
 	err := yaml.Unmarshal([]byte("notanum: .NaN"), &value)
@@ -930,6 +2262,12 @@ func (s *S) TestUnmarshalDurationInt(c *C) {
 	c.Assert(err, ErrorMatches, "(?s).* line 1: cannot unmarshal !!int `123` into time.Duration")
 }
 
+func (s *S) TestUnmarshalSequenceIntoMapSlice(c *C) {
+	var m yaml.MapSlice
+	err := yaml.Unmarshal([]byte("[1]"), &m)
+	c.Assert(err, ErrorMatches, "(?s).* line 1: cannot unmarshal !!seq into yaml.MapSlice")
+}
+
 var unmarshalErrorTests = []struct {
 	data, error string
 }{
@@ -937,18 +2275,18 @@ var unmarshalErrorTests = []struct {
 	{"v: [A,", "yaml: line 1: did not find expected node content"},
 	{"v:\n- [A,", "yaml: line 2: did not find expected node content"},
 	{"a:\n- b: *,", "yaml: line 2: did not find expected alphabetic or numeric character"},
-	{"a: *b\n", "yaml: unknown anchor 'b' referenced"},
-	{"a: &a\n  b: *a\n", "yaml: anchor 'a' value contains itself"},
+	{"a: *b\n", "yaml: line 1: unknown anchor 'b' referenced"},
+	{"a: &a\n  b: *a\n", `yaml: line 2: anchor 'a' value contains itself \(defined at line 1\)`},
 	{"value: -", "yaml: block sequence entries are not allowed in this context"},
-	{"a: !!binary ==", "yaml: !!binary value contains invalid base64 data"},
+	{"a: !!binary ==", "yaml: unmarshal errors:\n  line 1: !!binary value contains invalid base64 data"},
 	{"{[.]}", `yaml: invalid map key: \[\]interface \{\}\{"\."\}`},
 	{"{{.}}", `yaml: invalid map key: map\[string]interface \{\}\{".":interface \{\}\(nil\)\}`},
-	{"b: *a\na: &a {c: 1}", `yaml: unknown anchor 'a' referenced`},
+	{"b: *a\na: &a {c: 1}", `yaml: line 1: unknown anchor 'a' referenced`},
 	{"%TAG !%79! tag:yaml.org,2002:\n---\nv: !%79!int '1'", "yaml: did not find expected whitespace"},
 	{"a:\n  1:\nb\n  2:", ".*could not find expected ':'"},
 	{"a: 1\nb: 2\nc 2\nd: 3\n", "^yaml: line 3: could not find expected ':'$"},
 	{"#\n-\n{", "yaml: line 3: could not find expected ':'"}, // Issue #665
-	{"0: [:!00 \xef", "yaml: incomplete UTF-8 octet sequence"}, // Issue #666
+	{"0: [:!00 \xef", "yaml: incomplete UTF-8 octet sequence at byte 9"}, // Issue #666
 	{
 		"a: &a [00,00,00,00,00,00,00,00,00]\n" +
 			"b: &b [*a,*a,*a,*a,*a,*a,*a,*a,*a]\n" +
@@ -959,7 +2297,7 @@ var unmarshalErrorTests = []struct {
 			"g: &g [*f,*f,*f,*f,*f,*f,*f,*f,*f]\n" +
 			"h: &h [*g,*g,*g,*g,*g,*g,*g,*g,*g]\n" +
 			"i: &i [*h,*h,*h,*h,*h,*h,*h,*h,*h]\n",
-		"yaml: document contains excessive aliasing",
+		`yaml: line 3: document contains excessive aliasing of anchor 'b' \(defined at line 2\)`,
 	},
 }
 
@@ -980,6 +2318,267 @@ func (s *S) TestDecoderErrors(c *C) {
 	}
 }
 
+var errorCodeTests = []struct {
+	data  string
+	value interface{}
+	code  yaml.ErrorCode
+}{
+	{"a: [b", nil, yaml.ErrCodeSyntax},
+	{"a:\n\t- b", nil, yaml.ErrCodeTabIndent},
+	{"a: |\n  b\n\tc", nil, yaml.ErrCodeTabIndent},
+	{"a:\n  b\n\tc", nil, yaml.ErrCodeTabIndent},
+	{"a: %b", nil, yaml.ErrCodeSyntax},
+	{strings.Repeat("- ", 10001), nil, yaml.ErrCodeMaxDepth},
+	{strings.Repeat("[", 10001), nil, yaml.ErrCodeMaxDepth},
+	{"a: *b", nil, yaml.ErrCodeUnknownAnchor},
+	{"a: &a [*a]", nil, yaml.ErrCodeAliasCycle},
+	{"a: !!int b", nil, yaml.ErrCodeInvalidValue},
+	{"a: \xff", nil, yaml.ErrCodeInvalidEncoding},
+	{"a: \x01", nil, yaml.ErrCodeDisallowedChar},
+	{"a: b", &struct{ A int }{}, yaml.ErrCodeType},
+	{"[1, 2]", &[1]int{}, yaml.ErrCodeArrayLength},
+	{"a: b", nil, ""},
+}
+
+func (s *S) TestErrorCodes(c *C) {
+	for i, item := range errorCodeTests {
+		c.Logf("test %d: %q", i, item.data)
+		value := item.value
+		if value == nil {
+			value = new(interface{})
+		}
+		err := yaml.Unmarshal([]byte(item.data), value)
+		c.Assert(yaml.CodeOf(err), Equals, item.code, Commentf("error: %v", err))
+		if e, ok := err.(*yaml.Error); ok {
+			c.Assert(e.Error(), Equals, err.Error())
+		}
+	}
+	err := yaml.Unmarshal([]byte("a: [b"), new(interface{}))
+	c.Assert(err, DeepEquals, &yaml.Error{Code: yaml.ErrCodeSyntax, Line: 1, Message: "did not find expected ',' or ']'"})
+
+	// The codes of wrapped errors are found as well.
+	c.Assert(yaml.CodeOf(wrappedError{err}), Equals, yaml.ErrCodeSyntax)
+	c.Assert(yaml.CodeOf(wrappedError{wrappedError{&yaml.TagError{}}}), Equals, yaml.ErrCodeCustomTag)
+	c.Assert(yaml.CodeOf(wrappedErrors{errors.New("other"), err}), Equals, yaml.ErrCodeSyntax)
+	c.Assert(yaml.CodeOf(wrappedError{errors.New("other")}), Equals, yaml.ErrorCode(""))
+	c.Assert(yaml.CodeOf(&yaml.LoadError{Source: "a", Err: err}), Equals, yaml.ErrCodeSyntax)
+}
+
+// wrappedError and wrappedErrors wrap errors as fmt.Errorf does with %w.
+type wrappedError struct{ err error }
+
+func (e wrappedError) Error() string { return "wrapped: " + e.err.Error() }
+func (e wrappedError) Unwrap() error { return e.err }
+
+type wrappedErrors []error
+
+func (e wrappedErrors) Error() string   { return "wrapped" }
+func (e wrappedErrors) Unwrap() []error { return e }
+
+func (s *S) TestAnchorErrors(c *C) {
+	err := yaml.Unmarshal([]byte("a: 1\nb: [*c]\n"), new(interface{}))
+	c.Assert(err, DeepEquals, &yaml.AnchorError{
+		Code:    yaml.ErrCodeUnknownAnchor,
+		Anchor:  "c",
+		Line:    2,
+		Column:  5,
+		Message: "unknown anchor 'c' referenced",
+	})
+
+	err = yaml.Unmarshal([]byte("a: 1\nb: &b\n  - c: [*b]\n"), new(interface{}))
+	c.Assert(err, DeepEquals, &yaml.AnchorError{
+		Code:         yaml.ErrCodeAliasCycle,
+		Anchor:       "b",
+		Line:         3,
+		Column:       9,
+		AnchorLine:   2,
+		AnchorColumn: 4,
+		Message:      "anchor 'b' value contains itself",
+	})
+	c.Assert(err, ErrorMatches, `yaml: line 3: anchor 'b' value contains itself \(defined at line 2\)`)
+}
+
+func (s *S) TestUnmarshalAnchorAliasFields(c *C) {
+	var v struct {
+		Defaults *struct{ Host string } `yaml:"defaults,anchor"`
+		Primary  *struct{ Host string } `yaml:"primary,alias=defaults"`
+		Replica  *struct{ Host string } `yaml:"replica,alias=defaults"`
+		Other    *struct{ Host string } `yaml:"other"`
+	}
+	data := "defaults: &d {host: a}\nprimary: *d\nreplica: {host: b}\nother: *d\n"
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v.Primary, Equals, v.Defaults)
+	c.Assert(v.Replica.Host, Equals, "b")
+	c.Assert(v.Other.Host, Equals, "a")
+	c.Assert(v.Other, Not(Equals), v.Defaults)
+
+	var m struct {
+		Base  map[string]int `yaml:"base,anchor"`
+		Extra map[string]int `yaml:"extra,alias=base"`
+	}
+	c.Assert(yaml.Unmarshal([]byte("base: &b {x: 1}\nextra: *b\n"), &m), IsNil)
+	m.Extra["y"] = 2
+	c.Assert(m.Base, DeepEquals, map[string]int{"x": 1, "y": 2})
+}
+
+func (s *S) TestDecoderDisallowAliases(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: &b [2]\nc: *b\n"))
+	dec.DisallowAliases(true)
+	err := dec.Decode(new(interface{}))
+	c.Assert(err, DeepEquals, &yaml.AnchorError{
+		Code:    yaml.ErrCodeAliasDisallowed,
+		Anchor:  "b",
+		Line:    2,
+		Column:  4,
+		Message: "anchor 'b' is not allowed",
+	})
+	c.Assert(err, ErrorMatches, "yaml: line 2: anchor 'b' is not allowed")
+
+	dec.ResetBytes([]byte("a: [1, *b]\n"))
+	err = dec.Decode(new(yaml.Node))
+	c.Assert(err, ErrorMatches, "yaml: line 1: alias of anchor 'b' is not allowed")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeAliasDisallowed)
+
+	dec.ResetBytes([]byte("a: [1, '*b']\n"))
+	c.Assert(dec.Decode(new(interface{})), IsNil)
+}
+
+func (s *S) TestDecoderDisallowCustomTags(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: !!str 1\nb: ! 2\nc: [!!binary aGk=, !foo 3]\n"))
+	dec.DisallowCustomTags(true)
+	err := dec.Decode(new(interface{}))
+	c.Assert(err, DeepEquals, &yaml.TagError{Tag: "!foo", Line: 3, Column: 20})
+	c.Assert(err, ErrorMatches, "yaml: line 3: tag !foo is not allowed")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeCustomTag)
+
+	dec.ResetBytes([]byte("--- !<tag:yaml.org,2002:set>\n? a\n"))
+	err = dec.Decode(new(yaml.Node))
+	c.Assert(err, ErrorMatches, "yaml: line 1: tag !!set is not allowed")
+
+	dec.ResetBytes([]byte("a: !!int 1\nb: !!map {<<: {c: 2}}\n"))
+	c.Assert(dec.Decode(new(interface{})), IsNil)
+}
+
+func (s *S) TestDecoderLimits(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("a: [b, {c: [d]}]\n"))
+	dec.SetMaxDepth(3)
+	err := dec.Decode(new(interface{}))
+	c.Assert(err, ErrorMatches, "yaml: line 1: exceeded max depth of 3")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeMaxDepth)
+
+	dec.ResetBytes([]byte("a: [b, {c: d}]\n"))
+	c.Assert(dec.Decode(new(interface{})), IsNil)
+
+	data := "a: &a [1, 2, 3]\nb: [*a, *a]\n"
+	dec.ResetBytes([]byte(data))
+	dec.SetMaxAliasExpansions(7)
+	err = dec.Decode(new(interface{}))
+	c.Assert(err, ErrorMatches, `yaml: line 2: document contains excessive aliasing of anchor 'a' \(defined at line 1\)`)
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeAliasLimit)
+
+	dec.ResetBytes([]byte(data))
+	dec.SetMaxAliasExpansions(8)
+	c.Assert(dec.Decode(new(interface{})), IsNil)
+}
+
+func (s *S) TestNewSafeDecoder(c *C) {
+	var v interface{}
+	dec := yaml.NewSafeDecoder(strings.NewReader("a: &a [1, {b: c}]\nd: *a\n"))
+	c.Assert(dec.Decode(&v), IsNil)
+
+	dec = yaml.NewSafeDecoder(strings.NewReader(strings.Repeat("[", 101) + strings.Repeat("]", 101)))
+	c.Assert(yaml.CodeOf(dec.Decode(&v)), Equals, yaml.ErrCodeMaxDepth)
+
+	dec = yaml.NewSafeDecoder(strings.NewReader("a: !foo b\n"))
+	c.Assert(yaml.CodeOf(dec.Decode(&v)), Equals, yaml.ErrCodeCustomTag)
+
+	dec = yaml.NewSafeDecoder(strings.NewReader("a: &a [" + strings.Repeat("1, ", 10000) + "]\nb: *a\n"))
+	c.Assert(yaml.CodeOf(dec.Decode(&v)), Equals, yaml.ErrCodeAliasLimit)
+
+	dec = yaml.NewSafeDecoder(strings.NewReader("a: " + strings.Repeat("b", 8<<20)))
+	c.Assert(yaml.CodeOf(dec.Decode(&v)), Equals, yaml.ErrCodeInputTooLarge)
+}
+
+type panickingUnmarshaler struct{}
+
+func (panickingUnmarshaler) UnmarshalYAML(node *yaml.Node) error {
+	return node.Content[len(node.Content)].Decode(nil)
+}
+
+type brokenNodeUnmarshaler struct{}
+
+func (brokenNodeUnmarshaler) UnmarshalYAML(node *yaml.Node) error {
+	// A mapping node missing the value of its key.
+	n := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "a"}}}
+	var m map[string]int
+	return n.Decode(&m)
+}
+
+func (s *S) TestDecodeRecoversPanics(c *C) {
+	var v struct{ A brokenNodeUnmarshaler }
+	err := yaml.Unmarshal([]byte("a: [1]"), &v)
+	c.Assert(err, ErrorMatches, `yaml: internal error at decode.go:\d+: runtime error: index out of range.*`)
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeInternal)
+
+	err = yaml.NewDecoder(strings.NewReader("a: [1]")).Decode(&v)
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeInternal)
+
+	n := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "a"}}}
+	var m map[string]int
+	err = n.Decode(&m)
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeInternal)
+}
+
+func (s *S) TestDecodeKeepsUnmarshalerPanics(c *C) {
+	// Panics raised by the methods of the value decoded into are not
+	// the decoder's, and reach the caller unchanged.
+	var v struct{ A panickingUnmarshaler }
+	c.Assert(func() { yaml.Unmarshal([]byte("a: [1]"), &v) }, PanicMatches, `runtime error: index out of range.*`)
+	dec := yaml.NewDecoder(strings.NewReader("a: [1]"))
+	c.Assert(func() { dec.Decode(&v) }, PanicMatches, `runtime error: index out of range.*`)
+
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("a: [1]"), &n), IsNil)
+	c.Assert(func() { n.Decode(&v) }, PanicMatches, `runtime error: index out of range.*`)
+
+	var t struct{ A panickingTextUnmarshaler }
+	c.Assert(func() { yaml.Unmarshal([]byte("a: b"), &t) }, PanicMatches, `text`)
+
+	var o struct{ A panickingObsoleteUnmarshaler }
+	c.Assert(func() { yaml.Unmarshal([]byte("a: {a: [1]}"), &o) }, PanicMatches, `runtime error: index out of range.*`)
+}
+
+type panickingTextUnmarshaler struct{}
+
+func (*panickingTextUnmarshaler) UnmarshalText(text []byte) error {
+	panic("text")
+}
+
+type panickingObsoleteUnmarshaler struct{}
+
+func (panickingObsoleteUnmarshaler) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v struct{ A panickingUnmarshaler }
+	return unmarshal(&v)
+}
+
+func (s *S) TestUnmarshalCorruptedInputNeverFailsInternally(c *C) {
+	for i, item := range unmarshalTests {
+		data := []byte(item.data)
+		for j := 0; j < len(data); j++ {
+			for _, b := range []byte{0, '[', '{', ':', '&', '*', '\'', '"', '\n', '\t', '|', 0xC3} {
+				corrupted := append(append(append([]byte(nil), data[:j]...), b), data[j+1:]...)
+				for _, in := range [][]byte{data[:j], corrupted} {
+					var v interface{}
+					err := yaml.Unmarshal(in, &v)
+					if yaml.CodeOf(err) == yaml.ErrCodeInternal {
+						c.Fatalf("test %d: %q: %v", i, in, err)
+					}
+				}
+			}
+		}
+	}
+}
+
 var unmarshalerTests = []struct {
 	data, tag string
 	value     interface{}
@@ -1112,8 +2711,8 @@ func (s *S) TestUnmarshalerWholeDocument(c *C) {
 }
 
 func (s *S) TestUnmarshalerTypeError(c *C) {
-	unmarshalerResult[2] = &yaml.TypeError{[]string{"foo"}}
-	unmarshalerResult[4] = &yaml.TypeError{[]string{"bar"}}
+	unmarshalerResult[2] = &yaml.TypeError{Errors: []string{"foo"}}
+	unmarshalerResult[4] = &yaml.TypeError{Errors: []string{"bar"}}
 	defer func() {
 		delete(unmarshalerResult, 2)
 		delete(unmarshalerResult, 4)
@@ -1143,8 +2742,8 @@ func (s *S) TestUnmarshalerTypeError(c *C) {
 }
 
 func (s *S) TestObsoleteUnmarshalerTypeError(c *C) {
-	unmarshalerResult[2] = &yaml.TypeError{[]string{"foo"}}
-	unmarshalerResult[4] = &yaml.TypeError{[]string{"bar"}}
+	unmarshalerResult[2] = &yaml.TypeError{Errors: []string{"foo"}}
+	unmarshalerResult[4] = &yaml.TypeError{Errors: []string{"bar"}}
 	defer func() {
 		delete(unmarshalerResult, 2)
 		delete(unmarshalerResult, 4)
@@ -1249,6 +2848,102 @@ func (s *S) TestObsoleteUnmarshalerTypeErrorProxying(c *C) {
 		"  line 1: cannot unmarshal !!str `B` into int")
 }
 
+func (s *S) TestTypeErrorDetails(c *C) {
+	type T struct {
+		A int
+		B []map[string]bool
+		M map[string]*proxyTypeError
+		O map[string]*obsoleteProxyTypeError
+	}
+	data := "" +
+		"a: A\n" +
+		"b:\n" +
+		"- {x: true, y: 1}\n" +
+		"- {x: true, x: false}\n" +
+		"m: {k: b}\n" +
+		"o: {k.l: a}\n" +
+		"c: 3\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.KnownFields(true)
+	var v T
+	err := dec.Decode(&v)
+	e, ok := err.(*yaml.TypeError)
+	c.Assert(ok, Equals, true, Commentf("err: %#v", err))
+
+	type detail struct {
+		Code   yaml.ErrorCode
+		Path   string
+		Line   int
+		Column int
+		Tag    string
+		Type   reflect.Type
+	}
+	var details []detail
+	for _, d := range e.Details {
+		details = append(details, detail{d.Code, d.Path.String(), d.Line, d.Column, d.Tag, d.Type})
+	}
+	c.Assert(details, DeepEquals, []detail{
+		{yaml.ErrCodeType, "a", 1, 4, "!!str", reflect.TypeOf(0)},
+		{yaml.ErrCodeType, "b[0].y", 3, 16, "!!int", reflect.TypeOf(false)},
+		{yaml.ErrCodeDuplicateKey, "b[1].x", 4, 13, "!!str", nil},
+		{yaml.ErrCodeType, "m.k", 5, 8, "!!str", reflect.TypeOf(int64(0))},
+		{yaml.ErrCodeType, `o["k.l"]`, 6, 10, "!!str", reflect.TypeOf(int32(0))},
+		{yaml.ErrCodeUnknownField, "c", 7, 1, "!!str", reflect.TypeOf(v)},
+	})
+	c.Assert(e.Errors, HasLen, len(e.Details))
+	for i, d := range e.Details {
+		c.Assert(d.Error(), Equals, e.Errors[i])
+	}
+	c.Assert(e.Unwrap()[0], Equals, error(e.Details[0]))
+
+	// The details are there whatever the entry point.
+	var w T
+	err = yaml.Unmarshal([]byte(data), &w)
+	c.Assert(err.(*yaml.TypeError).Details, HasLen, 5)
+	c.Assert(err.(*yaml.TypeError).Details[3].Line, Equals, 5)
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	err = n.Decode(&w)
+	c.Assert(err.(*yaml.TypeError).Details, HasLen, 5)
+	err = yaml.UnmarshalWithOptions([]byte(data), &w)
+	c.Assert(err.(*yaml.TypeError).Details, HasLen, 5)
+	err = yaml.UnmarshalWithOptions([]byte(data), &w, yaml.WithMaxErrors(4))
+	c.Assert(err.(*yaml.TypeError).Details, HasLen, 4)
+}
+
+func (s *S) TestPathString(c *C) {
+	tests := []struct {
+		path yaml.Path
+		want string
+	}{
+		{nil, ""},
+		{yaml.Path{yaml.KeyElem("a")}, "a"},
+		{yaml.Path{yaml.IndexElem(3)}, "[3]"},
+		{yaml.Path(nil).Key("a").Index(0).Key("b"), "a[0].b"},
+		{yaml.Path(nil).Key("a").Key("b.c").Key(""), `a["b.c"][""]`},
+		{yaml.Path(nil).Key("a b").Key(`"`), `["a b"]["\""]`},
+	}
+	for _, test := range tests {
+		c.Assert(test.path.String(), Equals, test.want)
+	}
+}
+
+func (s *S) TestParsePath(c *C) {
+	for _, path := range []string{"", "a", "[3]", "a[0].b", `a["b.c"][""]`, `["a b"]["\""]`, "[0][1].a"} {
+		p, err := yaml.ParsePath(path)
+		c.Assert(err, IsNil)
+		c.Assert(p.String(), Equals, path)
+	}
+	p, err := yaml.ParsePath(`a.b["c"]`)
+	c.Assert(err, IsNil)
+	c.Assert(p, DeepEquals, yaml.Path(nil).Key("a").Key("b").Key("c"))
+
+	for _, path := range []string{".a", "a.", "a..b", "a]", "[", "[a]", "[-1]", "[+1]", `["a]`, `["a"`, `["\q"]`, "[0]b"} {
+		_, err := yaml.ParsePath(path)
+		c.Assert(err, ErrorMatches, "yaml: invalid path .*", Commentf("path %q", path))
+	}
+}
+
 var failingErr = errors.New("failingErr")
 
 type failingUnmarshaler struct{}
@@ -1769,3 +3464,27 @@ func (s *S) TestFuzzCrashers(c *C) {
 //		yaml.Marshal(&v)
 //	}
 //}
+
+type benchmarkItem struct {
+	Name  string
+	Size  int
+	Tags  []string
+	Attrs map[string]string
+}
+
+func BenchmarkUnmarshalStruct(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("items:\n")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&buf, "- name: item%d\n  size: %d\n  tags: [a, b, c]\n  attrs: {x: y, z: w}\n  unknown: {p: [1, 2]}\n", i, i)
+	}
+	data := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v struct{ Items []benchmarkItem }
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
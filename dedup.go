@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// An eventNode describes the node whose events start at an index of the
+// events of a document, as found by eventNodes.
+type eventNode struct {
+	// id is the same for nodes written with equal events, anchors of
+	// collections aside.
+	id int
+
+	// end is the index of the last event of the node, and size the
+	// number of nodes within it, itself included.
+	end  int
+	size int
+
+	// keep tells whether the node holds anchors or comments.
+	keep bool
+}
+
+// eventNodes returns the nodes of the events of a document by the index
+// they start at, and the names of the anchors they hold.
+func eventNodes(events []yaml_event_t) ([]eventNode, map[string]bool) {
+	type frame struct {
+		start int
+		key   []byte
+	}
+	var stack []frame
+	ids := make(map[string]int)
+	nodes := make([]eventNode, len(events))
+	names := make(map[string]bool)
+
+	intern := func(key []byte) int {
+		n, ok := ids[string(key)]
+		if !ok {
+			n = len(ids) + 1
+			ids[string(key)] = n
+		}
+		return n
+	}
+	for i := range events {
+		event := &events[i]
+		keep := len(event.head_comment)+len(event.line_comment)+len(event.foot_comment)+len(event.tail_comment) > 0
+		if event.typ != yaml_ALIAS_EVENT && len(event.anchor) > 0 {
+			names[string(event.anchor)] = true
+			keep = true
+		}
+		var start int
+		switch event.typ {
+		case yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			stack = append(stack, frame{start: i, key: []byte{byte(event.typ)}})
+			if len(event.tag) > 0 {
+				stack[len(stack)-1].key = append(append(stack[len(stack)-1].key, event.tag...), 0)
+			}
+			nodes[i] = eventNode{size: 1, keep: keep}
+			continue
+		case yaml_SEQUENCE_END_EVENT, yaml_MAPPING_END_EVENT:
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			start = f.start
+			nodes[start].id = intern(f.key)
+			nodes[start].end = i
+			nodes[start].keep = nodes[start].keep || keep
+		case yaml_SCALAR_EVENT:
+			key := []byte{byte(event.typ), byte(event.style)}
+			if event.implicit {
+				key = append(key, 'p')
+			}
+			if event.quoted_implicit {
+				key = append(key, 'q')
+			}
+			key = append(append(key, event.tag...), 0)
+			start = i
+			nodes[i] = eventNode{id: intern(append(key, event.value...)), end: i, size: 1, keep: keep}
+		case yaml_ALIAS_EVENT:
+			start = i
+			nodes[i] = eventNode{id: intern(append([]byte{byte(event.typ)}, event.anchor...)), end: i, size: 1, keep: keep}
+		default:
+			continue
+		}
+		if len(stack) > 0 {
+			f := &stack[len(stack)-1]
+			f.key = strconv.AppendInt(append(f.key, ' '), int64(nodes[start].id), 10)
+			p := &nodes[f.start]
+			p.size += nodes[start].size
+			p.keep = p.keep || nodes[start].keep
+		}
+	}
+	return nodes, names
+}
+
+// anchorName returns the first name of the form id001 that isn't in
+// names, and adds it to them.
+func anchorName(names map[string]bool) string {
+	var name string
+	for n := 1; name == "" || names[name]; n++ {
+		name = fmt.Sprintf("id%03d", n)
+	}
+	names[name] = true
+	return name
+}
+
+// dedupEvents returns the events of a document with the collections of
+// at least min nodes that are equal to an earlier one replaced by aliases
+// to it, and the earlier ones anchored. Collections holding anchors or
+// comments are left alone, as aliases would lose or duplicate them.
+func dedupEvents(events []yaml_event_t, min int) []yaml_event_t {
+	nodes, names := eventNodes(events)
+	eligible := func(i int) bool {
+		switch events[i].typ {
+		case yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			return !nodes[i].keep && nodes[i].size >= min
+		}
+		return false
+	}
+
+	// Count the collections that are written, leaving out those within
+	// the ones replaced by aliases.
+	count := make(map[int]int)
+	for i := 0; i < len(events); i++ {
+		if eligible(i) {
+			count[nodes[i].id]++
+			if count[nodes[i].id] > 1 {
+				i = nodes[i].end
+			}
+		}
+	}
+
+	var out []yaml_event_t
+	anchors := make(map[int]string)
+	for i := 0; i < len(events); i++ {
+		if !eligible(i) || count[nodes[i].id] < 2 {
+			out = append(out, events[i])
+			continue
+		}
+		if name, ok := anchors[nodes[i].id]; ok {
+			var alias yaml_event_t
+			yaml_alias_event_initialize(&alias, []byte(name))
+			out = append(out, alias)
+			i = nodes[i].end
+			continue
+		}
+		name := anchorName(names)
+		anchors[nodes[i].id] = name
+		event := events[i]
+		event.anchor = []byte(name)
+		out = append(out, event)
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestDeduplication(c *C) {
+	v := map[string]interface{}{
+		"a": map[string]interface{}{"res": map[string]string{"cpu": "1", "mem": "1Gi"}, "x": []int{1, 2}},
+		"b": map[string]interface{}{"res": map[string]string{"cpu": "1", "mem": "1Gi"}, "x": []int{1, 2}},
+		"c": map[string]interface{}{"res": map[string]string{"cpu": "1", "mem": "1Gi"}, "x": []int{1}},
+		"d": []int{1, 2},
+	}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithDeduplication(4))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `a: &id001
+    res: &id002
+        cpu: "1"
+        mem: 1Gi
+    x:
+        - 1
+        - 2
+b: *id001
+c:
+    res: *id002
+    x:
+        - 1
+d:
+    - 1
+    - 2
+`)
+
+	var back map[string]interface{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back["b"], DeepEquals, back["a"])
+
+	data, err = yaml.MarshalWithOptions(v, yaml.WithDeduplication(3))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: &id001\n    res: &id002\n        cpu: \"1\"\n        mem: 1Gi\n    x: &id003\n        - 1\n        - 2\nb: *id001\nc:\n    res: *id002\n    x:\n        - 1\nd: *id003\n")
+}
+
+func (s *S) TestDeduplicationKeepsAnchorsAndComments(c *C) {
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte("a: &id001 [1, 2]\nb: [1, 2]\nc: [3, 4] # note\nd: [3, 4]\ne: {x: [5]}\nf: {x: [5]}\n"), &node)
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetDeduplication(2)
+	c.Assert(enc.Encode(&node), IsNil)
+	c.Assert(enc.Encode(&node), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	doc := "a: &id001 [1, 2]\nb: [1, 2]\nc: [3, 4] # note\nd: [3, 4]\ne: &id002 {x: [5]}\nf: *id002\n"
+	c.Assert(buf.String(), Equals, doc+"---\n"+doc)
+}
@@ -0,0 +1,154 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// docComments documents the mapping entries written by an encoder, as set
+// with Encoder.SetDocComments.
+type docComments struct {
+	schema *Schema
+
+	// patterns holds the paths of the descriptions given in texts.
+	patterns []Path
+	texts    []string
+}
+
+// comment returns the head comment documenting the value v at path, with
+// desc the description in the tag of its field, if any, or nil if there
+// is nothing to tell of it.
+func (d *docComments) comment(path Path, desc string, v reflect.Value) []byte {
+	for i, p := range d.patterns {
+		if matchPath(p, path) {
+			desc = d.texts[i]
+			break
+		}
+	}
+	s := d.schemaAt(path)
+	if s != nil && desc == "" {
+		desc = s.Description
+	}
+	if s == nil && desc == "" {
+		return nil
+	}
+	var facts []string
+	if t := docType(s, v); t != "" {
+		facts = append(facts, "Type: "+t+".")
+	}
+	if s != nil && s.Default != nil {
+		facts = append(facts, "Default: "+docValue(s.Default)+".")
+	}
+	if s != nil && len(s.Enum) > 0 {
+		values := make([]string, len(s.Enum))
+		for i, value := range s.Enum {
+			values[i] = docValue(value)
+		}
+		facts = append(facts, "Allowed values: "+strings.Join(values, ", ")+".")
+	}
+	lines := []string{desc}
+	if len(facts) > 0 {
+		lines = append(lines, strings.Join(facts, " "))
+	}
+	return []byte(FormatComment(strings.Join(lines, "\n")))
+}
+
+// schemaAt returns the schema of the value at path, or nil if there's
+// none.
+func (d *docComments) schemaAt(path Path) *Schema {
+	s := d.schema
+	for _, e := range path {
+		switch {
+		case s == nil:
+			return nil
+		case !e.IsKey():
+			s = s.Items
+		case s.Properties[e.Key] != nil:
+			s = s.Properties[e.Key]
+		default:
+			s = s.AdditionalProperties
+		}
+	}
+	return s
+}
+
+// docType returns the type of the value v in the words of schemas, as
+// declared by s, or as told by the Go type of v if s declares none.
+func docType(s *Schema, v reflect.Value) string {
+	switch {
+	case s != nil && s.IntOrString:
+		return "integer or string"
+	case s != nil && s.Type != "":
+		return s.Type
+	case !v.IsValid():
+		return ""
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Interface && !v.IsNil() {
+		t = v.Elem().Type()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType, t == timeType:
+		return "string"
+	case t == nodeType, t == mapSliceType, reflect.PtrTo(t).Implements(marshalerType):
+		return ""
+	case reflect.PtrTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return ""
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// docValue returns value written in flow style, for a comment.
+func docValue(value interface{}) string {
+	if d, ok := value.(time.Duration); ok {
+		return d.String()
+	}
+	out, err := MarshalFlow(value)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,235 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetPath replaces the node at path within doc by value, leaving the rest
+// of doc as it is, with its comments, styles and anchors, so that it may
+// be encoded again with only that value changed. The path is in the
+// string form of a Path, and doc is usually a document node, whose
+// content the path starts from. The comments of the node replaced are
+// moved to value unless it has comments of its own.
+//
+// A key missing from an existing mapping is added to it, but the other
+// steps of the path must exist. Aliases on the way are followed, which
+// changes the value under the anchor for all the aliases to it.
+func SetPath(doc *Node, path string, value *Node) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		if doc.Kind != DocumentNode || len(doc.Content) != 1 {
+			return errors.New("yaml: cannot set the root of a node that is not a document")
+		}
+		keepComments(value, doc.Content[0])
+		doc.Content[0] = value
+		return nil
+	}
+	parent := pathContent(FindPath(doc, p[:len(p)-1]))
+	if parent == nil {
+		return errors.New("yaml: no value at path " + p[:len(p)-1].String())
+	}
+	e := p[len(p)-1]
+	i := pathChild(parent, e)
+	switch {
+	case i >= 0:
+		keepComments(value, parent.Content[i])
+		parent.Content[i] = value
+	case parent.Kind == MappingNode && e.IsKey():
+		key := &Node{Kind: ScalarNode, Tag: strTag, Value: e.Key}
+		parent.Content = append(parent.Content, key, value)
+	default:
+		return errors.New("yaml: no value at path " + p.String())
+	}
+	return nil
+}
+
+// SetPathString sets the value at path within doc to the string value,
+// as SetPath does. A scalar found there is changed in place, keeping its
+// style and anchor; the string is quoted when encoded if it would read
+// as another type of value otherwise.
+func SetPathString(doc *Node, path string, value string) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	if n := FindPath(doc, p); n != nil && n.Kind == ScalarNode {
+		n.Tag = strTag
+		n.Value = value
+		return nil
+	}
+	return SetPath(doc, path, &Node{Kind: ScalarNode, Tag: strTag, Value: value})
+}
+
+// keepComments moves the comments of old to n, unless n has any.
+func keepComments(n, old *Node) {
+	if n.HeadComment == "" && n.LineComment == "" && n.FootComment == "" {
+		n.HeadComment = old.HeadComment
+		n.LineComment = old.LineComment
+		n.FootComment = old.FootComment
+	}
+}
+
+// An Edit is a change to a YAML document for ApplyEdits.
+type Edit struct {
+	Document int    // The index of the document in the input, from 0.
+	Path     string // The path of the value to replace, as for SetPath.
+	Value    *Node  // The node to replace the value with.
+}
+
+// ApplyEdits returns a copy of the UTF-8 encoded input in with the values
+// at the paths of edits replaced. Only the bytes of the values replaced
+// change, so that the rest of the input is left exactly as it was, with
+// its comments and formatting, and the changes make a minimal diff.
+//
+// Replacement values are written on a single line, with collections in
+// flow style and without comments, and keep the anchor of the value
+// replaced unless they have one of their own. Unlike with SetPath, the
+// values to replace must exist in the input, and edits must not replace
+// values within one another.
+func ApplyEdits(in []byte, edits ...Edit) (out []byte, err error) {
+	defer handleDecodeErr(&err)
+	p := newParser(in)
+	defer p.destroy()
+	p.spans = make(map[*Node]nodeSpan)
+	var docs []*Node
+	for doc := p.parse(); doc != nil; doc = p.parse() {
+		docs = append(docs, doc)
+	}
+	if p.parser.encoding != yaml_UTF8_ENCODING {
+		return nil, errors.New("yaml: cannot edit input that is not encoded in UTF-8")
+	}
+
+	splices := make(spliceList, 0, len(edits))
+	for _, edit := range edits {
+		path, err := ParsePath(edit.Path)
+		if err != nil {
+			return nil, err
+		}
+		var n, parent *Node
+		if edit.Document >= 0 && edit.Document < len(docs) {
+			n = FindPath(docs[edit.Document], path)
+			if len(path) > 0 {
+				parent = pathContent(FindPath(docs[edit.Document], path[:len(path)-1]))
+			}
+		}
+		if n == nil {
+			return nil, errors.New("yaml: no value at path " + path.String() + " of document " + strconv.Itoa(edit.Document))
+		}
+		span := p.spans[n]
+		if n.Style&(LiteralStyle|FoldedStyle) != 0 {
+			// Block scalars end after their trailing line breaks.
+			for span.end > span.start && isSpace(int(in[span.end-1])) {
+				span.end--
+			}
+		}
+		text := inlineText(edit.Value, n.Anchor, parent != nil && parent.Style&FlowStyle != 0)
+		if span.start == span.end && span.start > 0 {
+			// An empty value, as in "key:" or "- ".
+			switch in[span.start-1] {
+			case ':', '-':
+				text = append([]byte{' '}, text...)
+			case ' ', '\t':
+			default:
+				return nil, errors.New("yaml: cannot edit the implicit value at path " + path.String() + " of document " + strconv.Itoa(edit.Document))
+			}
+		}
+		splices = append(splices, splice{span, text})
+	}
+	sort.Stable(splices)
+
+	out = make([]byte, 0, len(in))
+	pos := 0
+	for _, s := range splices {
+		if s.start < pos {
+			return nil, errors.New("yaml: edits overlap")
+		}
+		out = append(out, in[pos:s.start]...)
+		out = append(out, s.text...)
+		pos = s.end
+	}
+	return append(out, in[pos:]...), nil
+}
+
+type splice struct {
+	nodeSpan
+	text []byte
+}
+
+type spliceList []splice
+
+func (l spliceList) Len() int           { return len(l) }
+func (l spliceList) Less(i, j int) bool { return l[i].start < l[j].start }
+func (l spliceList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// inlineText returns the encoding of n on a single line, for writing it
+// in place of a value within a flow collection or a block one, with the
+// anchor given unless n has one. Collections are written in flow style.
+func inlineText(n *Node, anchor string, flow bool) []byte {
+	if n.Kind == DocumentNode && len(n.Content) == 1 {
+		n = n.Content[0]
+	}
+	n = inlineNode(n)
+	if n.Anchor == "" {
+		n.Anchor = anchor
+	}
+	// Encoding n as the item of a sequence quotes scalars as needed in
+	// the context of the value replaced.
+	seq := &Node{Kind: SequenceNode, Content: []*Node{n}}
+	if flow {
+		seq.Style = FlowStyle
+	}
+	e := newEncoder()
+	defer e.destroy()
+	e.marshalDoc("", reflect.ValueOf(seq))
+	e.finish()
+	// Drop the "[" and "]\n", or the "- " and "\n".
+	if flow {
+		return e.out[1 : len(e.out)-2]
+	}
+	return e.out[2 : len(e.out)-1]
+}
+
+// inlineNode returns a copy of n and its content that encodes on a single
+// line, without comments and with multi-line strings double-quoted.
+func inlineNode(n *Node) *Node {
+	c := *n
+	c.HeadComment, c.LineComment, c.FootComment = "", "", ""
+	switch {
+	case n.Kind == MappingNode || n.Kind == SequenceNode:
+		c.Style |= FlowStyle
+	case n.Kind == ScalarNode && strings.ContainsAny(n.Value, "\r\n"):
+		c.Style = c.Style&^(LiteralStyle|FoldedStyle|SingleQuotedStyle) | DoubleQuotedStyle
+	}
+	if len(n.Content) > 0 {
+		c.Content = make([]*Node, len(n.Content))
+		for i, child := range n.Content {
+			c.Content[i] = inlineNode(child)
+		}
+	}
+	return &c
+}
@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+const editInput = `# Deployment
+spec:
+  image: &img nginx:1.24 # pinned
+  replicas: 2
+  containers:
+    - name: web
+      image: *img
+    - name: "sidecar"
+`
+
+func (s *S) TestFindPath(c *C) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(editInput), &doc)
+	c.Assert(err, IsNil)
+
+	find := func(path string) *yaml.Node {
+		p, err := yaml.ParsePath(path)
+		c.Assert(err, IsNil)
+		return yaml.FindPath(&doc, p)
+	}
+	c.Assert(find("").Kind, Equals, yaml.MappingNode)
+	c.Assert(find("spec.replicas").Value, Equals, "2")
+	c.Assert(find("spec.containers[1].name").Value, Equals, "sidecar")
+	c.Assert(find("spec.containers[0].image").Kind, Equals, yaml.AliasNode)
+	c.Assert(find("spec.containers[2]"), IsNil)
+	c.Assert(find("spec.missing"), IsNil)
+	c.Assert(find("spec[0]"), IsNil)
+	c.Assert(find("spec.replicas.x"), IsNil)
+}
+
+func (s *S) TestSetPathString(c *C) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(editInput), &doc)
+	c.Assert(err, IsNil)
+
+	c.Assert(yaml.SetPathString(&doc, "spec.image", "nginx:1.25"), IsNil)
+	c.Assert(yaml.SetPathString(&doc, "spec.containers[1].name", "proxy"), IsNil)
+	c.Assert(yaml.SetPathString(&doc, "spec.replicas", "3"), IsNil)
+	c.Assert(yaml.SetPathString(&doc, "spec.containers[0].tag", "v1"), IsNil)
+
+	out, err := yaml.Marshal(&doc)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, `# Deployment
+spec:
+    image: &img nginx:1.25 # pinned
+    replicas: "3"
+    containers:
+        - name: web
+          image: *img
+          tag: v1
+        - name: "proxy"
+`)
+
+	err = yaml.SetPathString(&doc, "spec.containers[2].name", "x")
+	c.Assert(err, ErrorMatches, `yaml: no value at path spec.containers\[2\]`)
+	err = yaml.SetPathString(&doc, "spec.containers[2]", "x")
+	c.Assert(err, ErrorMatches, `yaml: no value at path spec.containers\[2\]`)
+	err = yaml.SetPathString(&doc, "spec..x", "x")
+	c.Assert(err, ErrorMatches, `yaml: invalid path "spec..x"`)
+}
+
+func (s *S) TestSetPath(c *C) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(editInput), &doc)
+	c.Assert(err, IsNil)
+
+	var value yaml.Node
+	err = yaml.Unmarshal([]byte("[a, b]"), &value)
+	c.Assert(err, IsNil)
+	c.Assert(yaml.SetPath(&doc, "spec.image", value.Content[0]), IsNil)
+
+	out, err := yaml.Marshal(doc.Content[0].Content[1])
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, `image: [a, b] # pinned
+replicas: 2
+containers:
+    - name: web
+      image: *img
+    - name: "sidecar"
+`)
+
+	c.Assert(yaml.SetPath(&doc, "", &yaml.Node{Kind: yaml.ScalarNode, Value: "x"}), IsNil)
+	out, err = yaml.Marshal(&doc)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "x\n")
+
+	err = yaml.SetPath(doc.Content[0], "", &yaml.Node{})
+	c.Assert(err, ErrorMatches, "yaml: cannot set the root of a node that is not a document")
+}
+
+func (s *S) TestApplyEdits(c *C) {
+	in := "# Deployment\nspec:\n  image: &img  nginx:1.24   # pinned\n  args: |\n    -v\n\n  env:\n    - {name: A,   value: '1'}\n  empty:\n---\nlist: [a,   b]\n"
+	str := func(v string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: v}
+	}
+	out, err := yaml.ApplyEdits([]byte(in),
+		yaml.Edit{Path: "spec.image", Value: str("nginx:1.25")},
+		yaml.Edit{Path: "spec.args", Value: &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{str("-q"), str("a, b")}}},
+		yaml.Edit{Path: "spec.env[0].value", Value: str("2")},
+		yaml.Edit{Path: "spec.empty", Value: str("x\ny")},
+		yaml.Edit{Document: 1, Path: "list[1]", Value: &yaml.Node{Kind: yaml.ScalarNode, Value: "c", HeadComment: "# dropped"}},
+	)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "# Deployment\nspec:\n  image: &img nginx:1.25   # pinned\n  args: [-q, 'a, b']\n\n  env:\n    - {name: A,   value: 2}\n  empty: \"x\\ny\"\n---\nlist: [a,   c]\n")
+
+	var doc yaml.Node
+	c.Assert(yaml.Unmarshal(out, &doc), IsNil)
+
+	out, err = yaml.ApplyEdits([]byte(in), yaml.Edit{Path: "spec", Value: str("x")})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "# Deployment\nspec:\n  x\n---\nlist: [a,   b]\n")
+
+	_, err = yaml.ApplyEdits([]byte(in), yaml.Edit{Path: "spec.missing", Value: str("x")})
+	c.Assert(err, ErrorMatches, "yaml: no value at path spec.missing of document 0")
+	_, err = yaml.ApplyEdits([]byte(in), yaml.Edit{Document: 2, Path: "", Value: str("x")})
+	c.Assert(err, ErrorMatches, "yaml: no value at path  of document 2")
+	_, err = yaml.ApplyEdits([]byte(in), yaml.Edit{Path: "spec", Value: str("x")}, yaml.Edit{Path: "spec.image", Value: str("x")})
+	c.Assert(err, ErrorMatches, "yaml: edits overlap")
+	_, err = yaml.ApplyEdits([]byte("{a}"), yaml.Edit{Path: "a", Value: str("x")})
+	c.Assert(err, ErrorMatches, "yaml: cannot edit the implicit value at path a of document 0")
+	_, err = yaml.ApplyEdits([]byte("a: [b"), yaml.Edit{Path: "a", Value: str("x")})
+	c.Assert(err, ErrorMatches, "yaml: line 1: did not find expected ',' or ']'")
+}
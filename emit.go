@@ -0,0 +1,688 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A MultilinePolicy chooses the style of strings that span more than one
+// line, given the line width set with Encoder.SetLineWidth or a negative
+// width if there is none. It may return DoubleQuotedStyle,
+// SingleQuotedStyle, LiteralStyle or FoldedStyle, or 0 to leave the
+// choice to the encoder.
+type MultilinePolicy func(value string, width int) Style
+
+// AutoMultiline is a MultilinePolicy that writes strings ending in a line
+// break in the literal style, strings with lines longer than the width,
+// or 80 characters if there is none, in the folded style, and any other
+// strings double-quoted.
+func AutoMultiline(value string, width int) Style {
+	if strings.HasSuffix(value, "\n") {
+		return LiteralStyle
+	}
+	if width < 0 {
+		width = 80
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if utf8.RuneCountInString(line) > width {
+			return FoldedStyle
+		}
+	}
+	return DoubleQuotedStyle
+}
+
+// A TagPolicy tells the encoder when to write the tags of values.
+type TagPolicy int
+
+const (
+	// TagsAsNeeded writes the tags of values that would otherwise
+	// resolve to different ones, and of nodes with TaggedStyle set.
+	// This is the default.
+	TagsAsNeeded TagPolicy = iota
+
+	// TagsNever writes no tags at all. Strings that would resolve to
+	// other tags are quoted instead, while any other tags are dropped,
+	// such as those of custom types.
+	TagsNever
+
+	// TagsAlways writes the tag of every value, for consumers that
+	// don't resolve tags on their own.
+	TagsAlways
+)
+
+// An encoder writes nodes as events for the emitter. The state only
+// needed for writing Go values, which the yaml_noreflect build leaves out,
+// is kept in the embedded encoderValues.
+type encoder struct {
+	encoderValues
+
+	emitter  yaml_emitter_t
+	event    yaml_event_t
+	out      []byte
+	flow     bool
+	indent   int
+	doneInit bool
+
+	// stringStyle chooses the style of strings, unless it's nil. The
+	// path is the one of the value being encoded, and key tells whether
+	// the next string is a mapping key.
+	stringStyle func(path Path, key bool, value string) Style
+	path        []pathStep
+	pathBuf     Path
+	key         bool
+
+	// multiline chooses the style of strings with line breaks, unless
+	// it's nil.
+	multiline MultilinePolicy
+
+	tags TagPolicy
+
+	// normalizeComments has comments written with normalizeComment.
+	normalizeComments bool
+
+	// anchor is the anchor for the next node.
+	anchor string
+
+	// headComment and lineComment are the comments for the next node,
+	// with lineDepth the nesting within the flow collection whose end
+	// takes lineComment, and held the start of the block collection that
+	// may take it, as placeLineComment places them.
+	headComment []byte
+	lineComment []byte
+	lineDepth   int
+	held        *yaml_event_t
+
+	// banner is the text of the comment written at the top of the
+	// stream, or of every document if bannerEach is set, and bannerDone
+	// tells whether it has been written already.
+	banner     string
+	bannerEach bool
+	bannerDone bool
+
+	// dedup is the size from which equal collections are written as
+	// aliases, with the events of the document buffered in events, or
+	// zero to write them all.
+	dedup  int
+	events []yaml_event_t
+
+	// mergeKeys is the number of entries from which mappings are written
+	// with merge keys, as for dedup, or zero to write them in full.
+	mergeKeys int
+
+	// capture has the events kept in events rather than written, as for
+	// EventsFromNode.
+	capture bool
+
+	// depth is the nesting of the collection being encoded, limited to
+	// maxDepth, or to maxEncodeDepth if that is zero.
+	depth    int
+	maxDepth int
+
+	// The directives and markers of the documents, as set by
+	// Stream.Encode.
+	version       *yaml_version_directive_t
+	tagDirectives []yaml_tag_directive_t
+	explicitStart bool
+	explicitEnd   bool
+}
+
+// maxEncodeDepth is the nesting of collections beyond which encoding
+// fails unless a limit is set, as with values that contain themselves.
+const maxEncodeDepth = 10000
+
+func newEncoder() *encoder {
+	e := &encoder{}
+	yaml_emitter_initialize(&e.emitter)
+	yaml_emitter_set_output_string(&e.emitter, &e.out)
+	yaml_emitter_set_unicode(&e.emitter, true)
+	return e
+}
+
+func newEncoderWithWriter(w io.Writer) *encoder {
+	e := &encoder{}
+	yaml_emitter_initialize(&e.emitter)
+	yaml_emitter_set_output_writer(&e.emitter, w)
+	yaml_emitter_set_unicode(&e.emitter, true)
+	return e
+}
+
+func (e *encoder) init() {
+	if e.doneInit {
+		return
+	}
+	if e.indent == 0 {
+		e.indent = 4
+	}
+	e.emitter.best_indent = e.indent
+	yaml_stream_start_event_initialize(&e.event, yaml_UTF8_ENCODING)
+	e.emit()
+	e.doneInit = true
+}
+
+func (e *encoder) finish() {
+	e.emitter.open_ended = false
+	yaml_stream_end_event_initialize(&e.event)
+	e.emit()
+}
+
+func (e *encoder) destroy() {
+	yaml_emitter_delete(&e.emitter)
+}
+
+func (e *encoder) emit() {
+	if e.anchor != "" {
+		switch e.event.typ {
+		case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			if len(e.event.anchor) == 0 {
+				e.event.anchor = []byte(e.anchor)
+			}
+			e.anchor = ""
+		}
+	}
+	if e.headComment != nil {
+		switch e.event.typ {
+		case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			if len(e.event.head_comment) == 0 {
+				e.event.head_comment = e.headComment
+			}
+			e.headComment = nil
+		case yaml_ALIAS_EVENT:
+			e.headComment = nil
+		}
+	}
+	if e.banner != "" && e.event.typ == yaml_DOCUMENT_START_EVENT && (e.bannerEach || !e.bannerDone) {
+		e.event.head_comment = e.bannerComment(e.event.head_comment)
+		e.bannerDone = true
+	}
+	if e.normalizeComments {
+		e.event.head_comment = normalizeComment(e.event.head_comment, false)
+		e.event.line_comment = normalizeComment(e.event.line_comment, true)
+		e.event.foot_comment = normalizeComment(e.event.foot_comment, false)
+		e.event.tail_comment = normalizeComment(e.event.tail_comment, false)
+	}
+	// Anchors and tags are checked before the emitter queues the event,
+	// for problems to be reported with the path of their value.
+	switch e.event.typ {
+	case yaml_ALIAS_EVENT:
+		e.must(yaml_emitter_analyze_anchor(&e.emitter, e.event.anchor, true))
+	case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+		if len(e.event.anchor) > 0 {
+			e.must(yaml_emitter_analyze_anchor(&e.emitter, e.event.anchor, false))
+		}
+		if len(e.event.tag) > 0 && !e.event.implicit && !e.event.quoted_implicit {
+			e.must(yaml_emitter_analyze_tag(&e.emitter, e.event.tag))
+		}
+	}
+	if (e.lineComment != nil || e.lineDepth > 0) && !e.placeLineComment() {
+		return
+	}
+	e.send()
+}
+
+// bannerComment returns the head comment of a document with the banner
+// ahead of head, apart from it by a blank line. The banner is wrapped to
+// the line width, if any.
+func (e *encoder) bannerComment(head []byte) []byte {
+	width := e.emitter.best_width
+	if width < 0 || width == 1<<31-1 {
+		width = 0
+	}
+	c := []byte(wrapComment(e.banner, width))
+	if len(head) > 0 {
+		c = append(append(c, "\n\n"...), head...)
+	}
+	return c
+}
+
+// placeLineComment has the line comment set for the next node written on
+// the line of its end: with a scalar or an alias, with the end event of
+// a collection written in flow style, as empty ones are, and with the
+// start event of a block collection otherwise, for it to follow the key
+// of the collection. The start of a block collection is held back until
+// the next event tells whether it's empty, and false is returned for it.
+func (e *encoder) placeLineComment() bool {
+	c := e.lineComment
+	switch {
+	case e.lineDepth > 0:
+		switch e.event.typ {
+		case yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			e.lineDepth++
+		case yaml_SEQUENCE_END_EVENT, yaml_MAPPING_END_EVENT:
+			if e.lineDepth--; e.lineDepth == 0 {
+				e.setLineComment(c)
+			}
+		}
+		return true
+	case e.held != nil:
+		event := e.event
+		e.event = *e.held
+		e.held = nil
+		if event.typ == yaml_SEQUENCE_END_EVENT || event.typ == yaml_MAPPING_END_EVENT {
+			e.send()
+			e.event = event
+			e.setLineComment(c)
+			return true
+		}
+		e.setLineComment(c)
+		e.send()
+		e.event = event
+		return true
+	}
+	switch e.event.typ {
+	case yaml_SCALAR_EVENT, yaml_ALIAS_EVENT:
+		e.setLineComment(c)
+	case yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+		if e.event.sequence_style() == yaml_FLOW_SEQUENCE_STYLE || e.event.mapping_style() == yaml_FLOW_MAPPING_STYLE {
+			e.lineDepth = 1
+			return true
+		}
+		held := e.event
+		e.held = &held
+		return false
+	}
+	return true
+}
+
+// setLineComment sets the line comment of the event to c, unless it has
+// one, and clears the one set for the next node.
+func (e *encoder) setLineComment(c []byte) {
+	if len(e.event.line_comment) == 0 {
+		e.event.line_comment = c
+	}
+	e.lineComment = nil
+}
+
+// send queues the event for the emitter.
+func (e *encoder) send() {
+	if e.capture {
+		e.events = append(e.events, e.event)
+		return
+	}
+	if (e.dedup > 0 || e.mergeKeys > 0) && e.event.typ != yaml_STREAM_START_EVENT && e.event.typ != yaml_STREAM_END_EVENT {
+		e.events = append(e.events, e.event)
+		if e.event.typ != yaml_DOCUMENT_END_EVENT {
+			return
+		}
+		events := e.events
+		if e.mergeKeys > 0 {
+			events = mergeKeyEvents(events, e.mergeKeys)
+		}
+		if e.dedup > 0 {
+			events = dedupEvents(events, e.dedup)
+		}
+		e.events = nil
+		for i := range events {
+			e.must(yaml_emitter_emit(&e.emitter, &events[i]))
+		}
+		return
+	}
+	// This will internally delete the e.event value.
+	e.must(yaml_emitter_emit(&e.emitter, &e.event))
+}
+
+func (e *encoder) must(ok bool) {
+	if !ok {
+		msg := e.emitter.problem
+		if msg == "" {
+			msg = "unknown problem generating YAML content"
+		}
+		if e.emitter.error == yaml_EMITTER_ERROR {
+			fail(&EmitterError{
+				Line:    e.emitter.line + 1,
+				Column:  e.emitter.column + 1,
+				Path:    append(Path(nil), e.currentPath()...),
+				Message: msg,
+			})
+		}
+		failf("%s", msg)
+	}
+}
+
+func (e *encoder) documentStart() {
+	yaml_document_start_event_initialize(&e.event, e.version, e.tagDirectives, !e.explicitStart)
+}
+
+func (e *encoder) documentEnd() {
+	yaml_document_end_event_initialize(&e.event, !e.explicitEnd)
+}
+
+// enter extends the path of the value being encoded with elem.
+func (e *encoder) enter(elem PathElem) {
+	e.path = append(e.path, pathStep{elem: elem})
+}
+
+// setPath sets the path of the value being encoded to path.
+func (e *encoder) setPath(path Path) {
+	e.path = e.path[:0]
+	for _, elem := range path {
+		e.enter(elem)
+	}
+}
+
+// currentPath returns the path of the value being encoded, which is only
+// valid until the next call.
+func (e *encoder) currentPath() Path {
+	e.pathBuf = e.pathBuf[:0]
+	for _, s := range e.path {
+		e.pathBuf = append(e.pathBuf, s.pathElem())
+	}
+	return e.pathBuf
+}
+
+// leave undoes the last call to enter.
+func (e *encoder) leave() {
+	e.path = e.path[:len(e.path)-1]
+}
+
+// chooseStyle returns the style for the string value given by the
+// stringStyle function, or def if there is none.
+func (e *encoder) chooseStyle(value string, def yaml_scalar_style_t) yaml_scalar_style_t {
+	key := e.key
+	e.key = false
+	if e.stringStyle == nil {
+		return def
+	}
+	return scalarStyle(e.stringStyle(e.currentPath(), key, value), def)
+}
+
+// multilineStyle returns the style for the string value with line breaks
+// given by the multiline policy, or def if there is none.
+func (e *encoder) multilineStyle(value string, def yaml_scalar_style_t) yaml_scalar_style_t {
+	if e.multiline == nil {
+		return def
+	}
+	width := e.emitter.best_width
+	if width == 1<<31-1 {
+		// Set by the emitter for unlimited widths.
+		width = -1
+	}
+	return scalarStyle(e.multiline(value, width), def)
+}
+
+// scalarStyle returns the scalar style matching style, or def if style
+// holds none.
+func scalarStyle(style Style, def yaml_scalar_style_t) yaml_scalar_style_t {
+	switch {
+	case style&DoubleQuotedStyle != 0:
+		return yaml_DOUBLE_QUOTED_SCALAR_STYLE
+	case style&SingleQuotedStyle != 0:
+		return yaml_SINGLE_QUOTED_SCALAR_STYLE
+	case style&LiteralStyle != 0:
+		return yaml_LITERAL_SCALAR_STYLE
+	case style&FoldedStyle != 0:
+		return yaml_FOLDED_SCALAR_STYLE
+	}
+	return def
+}
+
+// nest accounts for encoding the items of a collection.
+func (e *encoder) nest() {
+	e.depth++
+	limit := e.maxDepth
+	if limit == 0 {
+		limit = maxEncodeDepth
+	}
+	if e.depth > limit {
+		failCode(ErrCodeMaxDepth, "exceeded max depth of %d", limit)
+	}
+}
+
+// yaml11Value returns the plain scalar value with the given tag as
+// written for YAML 1.1 parsers, which know neither the 0o prefix of octal
+// integers nor floats without a dot or with an unsigned exponent.
+func yaml11Value(value, tag string) string {
+	if tag == "" {
+		tag, _ = resolve("", value)
+	}
+	sign, digits := "", value
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		sign, digits = value[:1], value[1:]
+	}
+	switch shortTag(tag) {
+	case intTag:
+		if strings.HasPrefix(digits, "0o") {
+			return sign + "0" + digits[2:]
+		}
+	case floatTag:
+		i := strings.IndexAny(digits, "eE")
+		if i < 0 {
+			break
+		}
+		mantissa, exp := digits[:i], digits[i+1:]
+		if !strings.Contains(mantissa, ".") {
+			mantissa += ".0"
+		}
+		if !strings.HasPrefix(exp, "-") && !strings.HasPrefix(exp, "+") {
+			exp = "+" + exp
+		}
+		return sign + mantissa + digits[i:i+1] + exp
+	}
+	return value
+}
+
+func (e *encoder) nilv() {
+	e.emitScalar("null", "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
+func (e *encoder) emitScalar(value, anchor, tag string, style yaml_scalar_style_t, head, line, foot, tail []byte) {
+	// TODO Kill this function. Replace all initialize calls by their underlining Go literals.
+	if e.emitter.yaml11 && style == yaml_PLAIN_SCALAR_STYLE {
+		value = yaml11Value(value, tag)
+	}
+	switch {
+	case e.tags == TagsNever:
+		tag = ""
+	case e.tags == TagsAlways && tag == "":
+		tag = strTag
+		if style == yaml_PLAIN_SCALAR_STYLE {
+			tag, _ = resolve("", value)
+		}
+	}
+	implicit := tag == ""
+	if !implicit {
+		tag = longTag(tag)
+	}
+	e.must(yaml_scalar_event_initialize(&e.event, []byte(anchor), []byte(tag), []byte(value), implicit, implicit, style))
+	e.event.head_comment = head
+	e.event.line_comment = line
+	e.event.foot_comment = foot
+	e.event.tail_comment = tail
+	e.emit()
+}
+
+// collectionTag returns the tag to write for a collection with the given
+// tag, which is def when it has none, according to the tag policy.
+func (e *encoder) collectionTag(tag, def string) string {
+	switch e.tags {
+	case TagsNever:
+		return ""
+	case TagsAlways:
+		if tag == "" {
+			return longTag(def)
+		}
+	}
+	return tag
+}
+
+func (e *encoder) node(node *Node, tail string) {
+	// Zero nodes behave as nil.
+	if node.Kind == 0 && node.IsZero() {
+		e.nilv()
+		return
+	}
+
+	// If the tag was not explicitly requested, and dropping it won't change the
+	// implicit tag of the value, don't include it in the presentation.
+	var tag = node.Tag
+	var stag = shortTag(tag)
+	var forceQuoting bool
+	if tag != "" && (node.Style&TaggedStyle == 0 || e.tags == TagsNever) {
+		if node.Kind == ScalarNode {
+			if stag == strTag && node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
+				tag = ""
+			} else {
+				rtag, _ := resolve("", node.Value)
+				if rtag == stag {
+					tag = ""
+				} else if stag == strTag {
+					tag = ""
+					forceQuoting = true
+				}
+			}
+		} else {
+			var rtag string
+			switch node.Kind {
+			case MappingNode:
+				rtag = mapTag
+			case SequenceNode:
+				rtag = seqTag
+			}
+			if rtag == stag {
+				tag = ""
+			}
+		}
+	}
+	if e.tags == TagsNever {
+		tag = ""
+	}
+
+	switch node.Kind {
+	case DocumentNode:
+		e.documentStart()
+		e.event.head_comment = []byte(node.HeadComment)
+		e.emit()
+		for _, node := range node.Content {
+			e.node(node, "")
+		}
+		e.documentEnd()
+		e.event.foot_comment = []byte(node.FootComment)
+		e.emit()
+
+	case SequenceNode:
+		style := yaml_BLOCK_SEQUENCE_STYLE
+		if node.Style&FlowStyle != 0 || e.flow {
+			e.flow = false
+			style = yaml_FLOW_SEQUENCE_STYLE
+		}
+		tag = e.collectionTag(longTag(tag), seqTag)
+		e.must(yaml_sequence_start_event_initialize(&e.event, []byte(node.Anchor), []byte(tag), tag == "", style))
+		e.event.head_comment = []byte(node.HeadComment)
+		e.emit()
+		e.nest()
+		for i, node := range node.Content {
+			e.enter(IndexElem(i))
+			e.node(node, "")
+			e.leave()
+		}
+		e.depth--
+		e.must(yaml_sequence_end_event_initialize(&e.event))
+		e.event.line_comment = []byte(node.LineComment)
+		e.event.foot_comment = []byte(node.FootComment)
+		e.emit()
+
+	case MappingNode:
+		style := yaml_BLOCK_MAPPING_STYLE
+		if node.Style&FlowStyle != 0 || e.flow {
+			e.flow = false
+			style = yaml_FLOW_MAPPING_STYLE
+		}
+		tag = e.collectionTag(longTag(tag), mapTag)
+		yaml_mapping_start_event_initialize(&e.event, []byte(node.Anchor), []byte(tag), tag == "", style)
+		e.event.tail_comment = []byte(tail)
+		e.event.head_comment = []byte(node.HeadComment)
+		e.emit()
+
+		// The tail logic below moves the foot comment of prior keys to the following key,
+		// since the value for each key may be a nested structure and the foot needs to be
+		// processed only the entirety of the value is streamed. The last tail is processed
+		// with the mapping end event.
+		e.nest()
+		var tail string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k := node.Content[i]
+			foot := k.FootComment
+			if foot != "" {
+				kopy := *k
+				kopy.FootComment = ""
+				k = &kopy
+			}
+			e.key = true
+			e.node(k, tail)
+			e.key = false
+			tail = foot
+
+			v := node.Content[i+1]
+			e.enter(KeyElem(k.Value))
+			e.node(v, "")
+			e.leave()
+		}
+		e.depth--
+
+		yaml_mapping_end_event_initialize(&e.event)
+		e.event.tail_comment = []byte(tail)
+		e.event.line_comment = []byte(node.LineComment)
+		e.event.foot_comment = []byte(node.FootComment)
+		e.emit()
+
+	case AliasNode:
+		yaml_alias_event_initialize(&e.event, []byte(node.Value))
+		e.event.head_comment = []byte(node.HeadComment)
+		e.event.line_comment = []byte(node.LineComment)
+		e.event.foot_comment = []byte(node.FootComment)
+		e.emit()
+
+	case ScalarNode:
+		value := node.Value
+		if !utf8.ValidString(value) {
+			if stag == binaryTag {
+				failf("explicitly tagged !!binary data must be base64-encoded")
+			}
+			if stag != "" {
+				failf("cannot marshal invalid UTF-8 data as %s", stag)
+			}
+			// It can't be encoded directly as YAML so use a binary tag
+			// and encode it as base64.
+			tag = binaryTag
+			value = encodeBase64(value)
+		}
+
+		style := yaml_PLAIN_SCALAR_STYLE
+		switch {
+		case node.Style&DoubleQuotedStyle != 0:
+			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
+		case node.Style&SingleQuotedStyle != 0:
+			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+		case node.Style&LiteralStyle != 0:
+			style = yaml_LITERAL_SCALAR_STYLE
+		case node.Style&FoldedStyle != 0:
+			style = yaml_FOLDED_SCALAR_STYLE
+		case strings.Contains(value, "\n"):
+			style = e.multilineStyle(value, yaml_LITERAL_SCALAR_STYLE)
+		case forceQuoting:
+			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
+		}
+		if node.Style&(DoubleQuotedStyle|SingleQuotedStyle|LiteralStyle|FoldedStyle) == 0 && tag != binaryTag && node.ShortTag() == strTag {
+			style = e.chooseStyle(value, style)
+		}
+
+		e.emitScalar(value, node.Anchor, tag, style, []byte(node.HeadComment), []byte(node.LineComment), []byte(node.FootComment), []byte(tail))
+	default:
+		failf("cannot encode node with unknown kind %d", node.Kind)
+	}
+}
@@ -147,6 +147,9 @@ func yaml_emitter_emit(emitter *yaml_emitter_t, event *yaml_event_t) bool {
 	emitter.events = append(emitter.events, *event)
 	for !yaml_emitter_need_more_events(emitter) {
 		event := &emitter.events[emitter.events_head]
+		if emitter.debug != nil {
+			emitter.debug("yaml: event", "type", event.typ.String())
+		}
 		if !yaml_emitter_analyze_event(emitter, event) {
 			return false
 		}
@@ -184,6 +187,10 @@ func yaml_emitter_need_more_events(emitter *yaml_emitter_t) bool {
 	default:
 		return false
 	}
+	if emitter.wrap_items && yaml_emitter_check_flow_start(emitter) {
+		// [Go] Whether a flow collection fits depends on all of it.
+		accumulate = len(emitter.events)
+	}
 	if len(emitter.events)-emitter.events_head > accumulate {
 		return false
 	}
@@ -531,7 +538,7 @@ func yaml_emitter_emit_document_end(emitter *yaml_emitter_t, event *yaml_event_t
 // Expect a flow item node.
 func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_event_t, first, trail bool) bool {
 	if first {
-		if !yaml_emitter_write_indicator(emitter, []byte{'['}, true, true, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{'['}, true, !emitter.padded, false) {
 			return false
 		}
 		if !yaml_emitter_increase_indent(emitter, true, false) {
@@ -546,15 +553,17 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 				return false
 			}
 		}
+		wrapped := emitter.wrapped[len(emitter.wrapped)-1]
+		emitter.wrapped = emitter.wrapped[:len(emitter.wrapped)-1]
 		emitter.flow_level--
 		emitter.indent = emitter.indents[len(emitter.indents)-1]
 		emitter.indents = emitter.indents[:len(emitter.indents)-1]
-		if emitter.column == 0 || emitter.canonical && !first {
+		if emitter.column == 0 || (emitter.canonical || wrapped) && !first {
 			if !yaml_emitter_write_indent(emitter) {
 				return false
 			}
 		}
-		if !yaml_emitter_write_indicator(emitter, []byte{']'}, false, false, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{']'}, emitter.padded && !first, false, false) {
 			return false
 		}
 		if !yaml_emitter_process_line_comment(emitter) {
@@ -570,7 +579,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 	}
 
 	if !first && !trail {
-		if !yaml_emitter_write_indicator(emitter, []byte{','}, false, false, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{','}, false, emitter.tight_comma, false) {
 			return false
 		}
 	}
@@ -584,7 +593,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 		}
 	}
 
-	if emitter.canonical || emitter.column > emitter.best_width {
+	if emitter.canonical || emitter.wrapped[len(emitter.wrapped)-1] || emitter.column > emitter.best_width {
 		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
@@ -614,7 +623,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 // Expect a flow key node.
 func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_event_t, first, trail bool) bool {
 	if first {
-		if !yaml_emitter_write_indicator(emitter, []byte{'{'}, true, true, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{'{'}, true, !emitter.padded, false) {
 			return false
 		}
 		if !yaml_emitter_increase_indent(emitter, true, false) {
@@ -632,15 +641,17 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 		if !yaml_emitter_process_head_comment(emitter) {
 			return false
 		}
+		wrapped := emitter.wrapped[len(emitter.wrapped)-1]
+		emitter.wrapped = emitter.wrapped[:len(emitter.wrapped)-1]
 		emitter.flow_level--
 		emitter.indent = emitter.indents[len(emitter.indents)-1]
 		emitter.indents = emitter.indents[:len(emitter.indents)-1]
-		if emitter.canonical && !first {
+		if (emitter.canonical || wrapped) && !first {
 			if !yaml_emitter_write_indent(emitter) {
 				return false
 			}
 		}
-		if !yaml_emitter_write_indicator(emitter, []byte{'}'}, false, false, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{'}'}, emitter.padded && !first, false, false) {
 			return false
 		}
 		if !yaml_emitter_process_line_comment(emitter) {
@@ -655,7 +666,7 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 	}
 
 	if !first && !trail {
-		if !yaml_emitter_write_indicator(emitter, []byte{','}, false, false, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{','}, false, emitter.tight_comma, false) {
 			return false
 		}
 	}
@@ -670,7 +681,7 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 		}
 	}
 
-	if emitter.canonical || emitter.column > emitter.best_width {
+	if emitter.canonical || emitter.wrapped[len(emitter.wrapped)-1] || emitter.column > emitter.best_width {
 		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
@@ -678,7 +689,14 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 
 	if !emitter.canonical && yaml_emitter_check_simple_key(emitter) {
 		emitter.states = append(emitter.states, yaml_EMIT_FLOW_MAPPING_SIMPLE_VALUE_STATE)
-		return yaml_emitter_emit_node(emitter, event, false, false, true, true)
+		if !yaml_emitter_emit_node(emitter, event, false, false, true, true) {
+			return false
+		}
+		// [Go] A value may only follow the ":" without a space when the
+		// key is quoted, as otherwise it reads as part of the key.
+		style := emitter.scalar_data.style
+		emitter.json_key = event.typ == yaml_SCALAR_EVENT && (style == yaml_SINGLE_QUOTED_SCALAR_STYLE || style == yaml_DOUBLE_QUOTED_SCALAR_STYLE)
+		return true
 	}
 	if !yaml_emitter_write_indicator(emitter, []byte{'?'}, true, false, false) {
 		return false
@@ -690,7 +708,7 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 // Expect a flow value node.
 func yaml_emitter_emit_flow_mapping_value(emitter *yaml_emitter_t, event *yaml_event_t, simple bool) bool {
 	if simple {
-		if !yaml_emitter_write_indicator(emitter, []byte{':'}, false, false, false) {
+		if !yaml_emitter_write_indicator(emitter, []byte{':'}, false, emitter.tight_colon && emitter.json_key, false) {
 			return false
 		}
 	} else {
@@ -728,7 +746,11 @@ func yaml_emitter_emit_flow_mapping_value(emitter *yaml_emitter_t, event *yaml_e
 // Expect a block item node.
 func yaml_emitter_emit_block_sequence_item(emitter *yaml_emitter_t, event *yaml_event_t, first bool) bool {
 	if first {
-		if !yaml_emitter_increase_indent(emitter, false, false) {
+		if emitter.seq_indent >= 0 && emitter.mapping_context && !emitter.indention {
+			// [Go] Sequences that are mapping values may be indented on their own.
+			emitter.indents = append(emitter.indents, emitter.indent)
+			emitter.indent += emitter.seq_indent
+		} else if !yaml_emitter_increase_indent(emitter, false, false) {
 			return false
 		}
 	}
@@ -919,6 +941,7 @@ func yaml_emitter_emit_sequence_start(emitter *yaml_emitter_t, event *yaml_event
 	}
 	if emitter.flow_level > 0 || emitter.canonical || event.sequence_style() == yaml_FLOW_SEQUENCE_STYLE ||
 		yaml_emitter_check_empty_sequence(emitter) {
+		emitter.wrapped = append(emitter.wrapped, emitter.wrap_items && !emitter.canonical && !yaml_emitter_check_flow_fits(emitter))
 		emitter.state = yaml_EMIT_FLOW_SEQUENCE_FIRST_ITEM_STATE
 	} else {
 		emitter.state = yaml_EMIT_BLOCK_SEQUENCE_FIRST_ITEM_STATE
@@ -936,6 +959,7 @@ func yaml_emitter_emit_mapping_start(emitter *yaml_emitter_t, event *yaml_event_
 	}
 	if emitter.flow_level > 0 || emitter.canonical || event.mapping_style() == yaml_FLOW_MAPPING_STYLE ||
 		yaml_emitter_check_empty_mapping(emitter) {
+		emitter.wrapped = append(emitter.wrapped, emitter.wrap_items && !emitter.canonical && !yaml_emitter_check_flow_fits(emitter))
 		emitter.state = yaml_EMIT_FLOW_MAPPING_FIRST_KEY_STATE
 	} else {
 		emitter.state = yaml_EMIT_BLOCK_MAPPING_FIRST_KEY_STATE
@@ -943,6 +967,53 @@ func yaml_emitter_emit_mapping_start(emitter *yaml_emitter_t, event *yaml_event_
 	return true
 }
 
+// [Go] Check if the event at the head of the queue starts a collection
+// written in the flow style of its own accord.
+func yaml_emitter_check_flow_start(emitter *yaml_emitter_t) bool {
+	event := &emitter.events[emitter.events_head]
+	switch event.typ {
+	case yaml_SEQUENCE_START_EVENT:
+		return event.sequence_style() == yaml_FLOW_SEQUENCE_STYLE
+	case yaml_MAPPING_START_EVENT:
+		return event.mapping_style() == yaml_FLOW_MAPPING_STYLE
+	}
+	return false
+}
+
+// [Go] Check if the flow collection at the head of the event queue fits
+// in the rest of the line. The length is estimated from the events, as
+// the styles of its scalars are not chosen yet.
+func yaml_emitter_check_flow_fits(emitter *yaml_emitter_t) bool {
+	length := 0
+	level := 0
+	for i := emitter.events_head; i < len(emitter.events); i++ {
+		event := &emitter.events[i]
+		switch event.typ {
+		case yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			level++
+			length += 2
+			if emitter.padded {
+				length += 2
+			}
+		case yaml_SEQUENCE_END_EVENT, yaml_MAPPING_END_EVENT:
+			level--
+		case yaml_SCALAR_EVENT:
+			length += len(event.value)
+		case yaml_ALIAS_EVENT:
+			length += len(event.anchor) + 1
+		}
+		if level == 0 {
+			break
+		}
+		if i > emitter.events_head && len(event.anchor) > 0 && event.typ != yaml_ALIAS_EVENT {
+			length += len(event.anchor) + 2
+		}
+		// The separator that follows, as in ", " or ": ".
+		length += 2
+	}
+	return emitter.column+length <= emitter.best_width
+}
+
 // Check if the document content is an empty scalar.
 func yaml_emitter_check_empty_document(emitter *yaml_emitter_t) bool {
 	return false // [Go] Huh?
@@ -1030,6 +1101,13 @@ func yaml_emitter_select_scalar_style(emitter *yaml_emitter_t, event *yaml_event
 		if no_tag && !event.implicit {
 			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
 		}
+		// [Go] YAML 1.1 parsers read some plain scalars differently, and
+		// reject colons within plain scalars in flow collections.
+		value := emitter.scalar_data.value
+		if emitter.yaml11 && (isOldBool(string(value)) || isBase60Float(string(value)) ||
+			(emitter.flow_level > 0 || emitter.simple_key_context) && bytes.IndexByte(value, ':') >= 0) {
+			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+		}
 	}
 	if style == yaml_SINGLE_QUOTED_SCALAR_STYLE {
 		if !emitter.scalar_data.single_quoted_allowed {
@@ -1045,6 +1123,10 @@ func yaml_emitter_select_scalar_style(emitter *yaml_emitter_t, event *yaml_event
 	if no_tag && !event.quoted_implicit && style != yaml_PLAIN_SCALAR_STYLE {
 		emitter.tag_data.handle = []byte{'!'}
 	}
+	if requested := event.scalar_style(); emitter.debug != nil && style != requested && (requested != yaml_ANY_SCALAR_STYLE || style != yaml_PLAIN_SCALAR_STYLE) {
+		emitter.debug("yaml: scalar style", "value", string(emitter.scalar_data.value),
+			"requested", requested.String(), "style", style.String())
+	}
 	emitter.scalar_data.style = style
 	return true
 }
@@ -1095,15 +1177,16 @@ func yaml_emitter_process_tag(emitter *yaml_emitter_t) bool {
 
 // Write a scalar.
 func yaml_emitter_process_scalar(emitter *yaml_emitter_t) bool {
+	allow_breaks := !emitter.simple_key_context && !emitter.no_breaks
 	switch emitter.scalar_data.style {
 	case yaml_PLAIN_SCALAR_STYLE:
-		return yaml_emitter_write_plain_scalar(emitter, emitter.scalar_data.value, !emitter.simple_key_context)
+		return yaml_emitter_write_plain_scalar(emitter, emitter.scalar_data.value, allow_breaks)
 
 	case yaml_SINGLE_QUOTED_SCALAR_STYLE:
-		return yaml_emitter_write_single_quoted_scalar(emitter, emitter.scalar_data.value, !emitter.simple_key_context)
+		return yaml_emitter_write_single_quoted_scalar(emitter, emitter.scalar_data.value, allow_breaks)
 
 	case yaml_DOUBLE_QUOTED_SCALAR_STYLE:
-		return yaml_emitter_write_double_quoted_scalar(emitter, emitter.scalar_data.value, !emitter.simple_key_context)
+		return yaml_emitter_write_double_quoted_scalar(emitter, emitter.scalar_data.value, allow_breaks)
 
 	case yaml_LITERAL_SCALAR_STYLE:
 		return yaml_emitter_write_literal_scalar(emitter, emitter.scalar_data.value)
@@ -1965,7 +2048,7 @@ func yaml_emitter_write_folded_scalar(emitter *yaml_emitter_t, value []byte) boo
 				}
 				leading_spaces = is_blank(value, i)
 			}
-			if !breaks && is_space(value, i) && !is_space(value, i+1) && emitter.column > emitter.best_width {
+			if !breaks && !emitter.no_breaks && is_space(value, i) && !is_space(value, i+1) && emitter.column > emitter.best_width {
 				if !yaml_emitter_write_indent(emitter) {
 					return false
 				}
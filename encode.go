@@ -13,14 +13,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
 package yaml
 
 import (
 	"encoding"
 	"fmt"
-	"io"
 	"reflect"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,71 +29,36 @@ import (
 	"unicode/utf8"
 )
 
-type encoder struct {
-	emitter  yaml_emitter_t
-	event    yaml_event_t
-	out      []byte
-	flow     bool
-	indent   int
-	doneInit bool
-}
-
-func newEncoder() *encoder {
-	e := &encoder{}
-	yaml_emitter_initialize(&e.emitter)
-	yaml_emitter_set_output_string(&e.emitter, &e.out)
-	yaml_emitter_set_unicode(&e.emitter, true)
-	return e
-}
-
-func newEncoderWithWriter(w io.Writer) *encoder {
-	e := &encoder{}
-	yaml_emitter_initialize(&e.emitter)
-	yaml_emitter_set_output_writer(&e.emitter, w)
-	yaml_emitter_set_unicode(&e.emitter, true)
-	return e
-}
-
-func (e *encoder) init() {
-	if e.doneInit {
-		return
-	}
-	if e.indent == 0 {
-		e.indent = 4
-	}
-	e.emitter.best_indent = e.indent
-	yaml_stream_start_event_initialize(&e.event, yaml_UTF8_ENCODING)
-	e.emit()
-	e.doneInit = true
-}
-
-func (e *encoder) finish() {
-	e.emitter.open_ended = false
-	yaml_stream_end_event_initialize(&e.event)
-	e.emit()
-}
-
-func (e *encoder) destroy() {
-	yaml_emitter_delete(&e.emitter)
-}
-
-func (e *encoder) emit() {
-	// This will internally delete the e.event value.
-	e.must(yaml_emitter_emit(&e.emitter, &e.event))
+// encoderValues holds the state of an encoder for writing Go values.
+type encoderValues struct {
+	// keyNaming is how the keys of struct fields are named.
+	keyNaming KeyNaming
+
+	// anchors has values reached more than once through the same pointer
+	// or map written with an anchor. shared maps each such value in the
+	// document to its anchor, or to "" until it's written.
+	anchors     bool
+	anchorNamer func(path Path, value interface{}) string
+	shared      map[sharedKey]string
+	names       map[string]bool
+
+	// docs documents the mapping entries written, unless it's nil.
+	docs *docComments
+
+	// fieldAnchors maps the anchors of the fields tagged with one in the
+	// document to their values, for the fields tagged as aliases of them.
+	fieldAnchors map[string]reflect.Value
 }
 
-func (e *encoder) must(ok bool) {
-	if !ok {
-		msg := e.emitter.problem
-		if msg == "" {
-			msg = "unknown problem generating YAML content"
-		}
-		failf("%s", msg)
-	}
+type sharedKey struct {
+	typ reflect.Type
+	ptr uintptr
 }
 
 func (e *encoder) marshalDoc(tag string, in reflect.Value) {
 	e.init()
+	e.depth = 0
+	e.path = e.path[:0]
 	var node *Node
 	if in.IsValid() {
 		node, _ = in.Interface().(*Node)
@@ -100,10 +66,17 @@ func (e *encoder) marshalDoc(tag string, in reflect.Value) {
 	if node != nil && node.Kind == DocumentNode {
 		e.nodev(in)
 	} else {
-		yaml_document_start_event_initialize(&e.event, nil, nil, true)
+		e.documentStart()
 		e.emit()
+		if e.anchors {
+			e.shared = make(map[sharedKey]string)
+			e.names = make(map[string]bool)
+			e.findShared(in, make(map[sharedKey]bool))
+		}
 		e.marshal(tag, in)
-		yaml_document_end_event_initialize(&e.event, true)
+		e.shared = nil
+		e.fieldAnchors = nil
+		e.documentEnd()
 		e.emit()
 	}
 }
@@ -136,6 +109,12 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	case time.Duration:
 		e.stringv(tag, reflect.ValueOf(value.String()))
 		return
+	case MapSlice:
+		e.itemsv(tag, value)
+		return
+	case []MapItem:
+		e.itemsv(tag, value)
+		return
 	case Marshaler:
 		v, err := value.MarshalYAML()
 		if err != nil {
@@ -161,8 +140,14 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	case reflect.Interface:
 		e.marshal(tag, in.Elem())
 	case reflect.Map:
+		if e.alias(in) {
+			return
+		}
 		e.mapv(tag, in)
 	case reflect.Ptr:
+		if e.alias(in) {
+			return
+		}
 		e.marshal(tag, in.Elem())
 	case reflect.Struct:
 		e.structv(tag, in)
@@ -183,13 +168,133 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	}
 }
 
+// findShared adds the pointers and maps reached more than once from in
+// to e.shared, following the values that marshal writes. The ones
+// reached so far are in seen.
+func (e *encoder) findShared(in reflect.Value, seen map[sharedKey]bool) {
+	if !in.IsValid() {
+		return
+	}
+	switch in.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map:
+		if in.IsNil() {
+			return
+		}
+	}
+	switch in.Interface().(type) {
+	case *Node, Node, time.Time, *time.Time, time.Duration, Marshaler, encoding.TextMarshaler:
+		return
+	}
+	switch in.Kind() {
+	case reflect.Interface:
+		e.findShared(in.Elem(), seen)
+	case reflect.Ptr, reflect.Map:
+		key := sharedKey{in.Type(), in.Pointer()}
+		if seen[key] {
+			e.shared[key] = ""
+			return
+		}
+		seen[key] = true
+		if in.Kind() == reflect.Ptr {
+			e.findShared(in.Elem(), seen)
+			return
+		}
+		for _, k := range in.MapKeys() {
+			e.findShared(k, seen)
+			e.findShared(in.MapIndex(k), seen)
+		}
+	case reflect.Struct:
+		sinfo, err := getStructInfo(in.Type(), e.keyNaming)
+		if err != nil {
+			panic(err)
+		}
+		for _, info := range sinfo.FieldsList {
+			var value reflect.Value
+			if info.Inline == nil {
+				value = in.Field(info.Num)
+			} else {
+				value = e.fieldByIndex(in, info.Inline)
+			}
+			if value.IsValid() && !(info.OmitEmpty && isZero(value)) {
+				e.findShared(value, seen)
+			}
+		}
+		if sinfo.InlineMap >= 0 {
+			m := in.Field(sinfo.InlineMap)
+			for _, k := range m.MapKeys() {
+				e.findShared(m.MapIndex(k), seen)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < in.Len(); i++ {
+			e.findShared(in.Index(i), seen)
+		}
+	}
+}
+
+// alias writes an alias for the pointer or map in if it was written
+// before, and reports whether it did. Otherwise, in is anchored if it's
+// shared.
+func (e *encoder) alias(in reflect.Value) bool {
+	if e.shared == nil {
+		return false
+	}
+	key := sharedKey{in.Type(), in.Pointer()}
+	name, ok := e.shared[key]
+	if !ok {
+		return false
+	}
+	if name != "" {
+		yaml_alias_event_initialize(&e.event, []byte(name))
+		e.emit()
+		return true
+	}
+	if e.anchorNamer != nil {
+		name = e.anchorNamer(e.currentPath(), in.Interface())
+	}
+	switch {
+	case name == "":
+		for i := 1; name == "" || e.names[name]; i++ {
+			name = fmt.Sprintf("id%03d", i)
+		}
+	case e.names[name]:
+		base := name
+		for i := 2; e.names[name]; i++ {
+			name = base + strconv.Itoa(i)
+		}
+	}
+	e.names[name] = true
+	e.shared[key] = name
+	e.anchor = name
+	return false
+}
+
 func (e *encoder) mapv(tag string, in reflect.Value) {
 	e.mappingv(tag, func() {
 		keys := keyList(in.MapKeys())
 		sort.Sort(keys)
 		for _, k := range keys {
-			e.marshal("", k)
+			if e.docs != nil {
+				e.document(k, "", in.MapIndex(k))
+			}
+			e.marshalKey(k)
+			e.enterKey(k)
 			e.marshal("", in.MapIndex(k))
+			e.leave()
+		}
+	})
+}
+
+func (e *encoder) itemsv(tag string, items []MapItem) {
+	e.mappingv(tag, func() {
+		for _, item := range items {
+			if e.docs != nil {
+				e.document(reflect.ValueOf(item.Key), "", reflect.ValueOf(item.Value))
+			}
+			e.marshalKey(reflect.ValueOf(item.Key))
+			e.enterKey(reflect.ValueOf(item.Key))
+			e.marshal("", reflect.ValueOf(item.Value))
+			e.leave()
 		}
 	})
 }
@@ -212,7 +317,7 @@ func (e *encoder) fieldByIndex(v reflect.Value, index []int) (field reflect.Valu
 }
 
 func (e *encoder) structv(tag string, in reflect.Value) {
-	sinfo, err := getStructInfo(in.Type())
+	sinfo, err := getStructInfo(in.Type(), e.keyNaming)
 	if err != nil {
 		panic(err)
 	}
@@ -230,9 +335,19 @@ func (e *encoder) structv(tag string, in reflect.Value) {
 			if info.OmitEmpty && isZero(value) {
 				continue
 			}
-			e.marshal("", reflect.ValueOf(info.Key))
+			if e.docs != nil {
+				e.document(reflect.ValueOf(info.Key), info.Description, value)
+			}
+			e.fieldComment(info)
+			e.marshalKey(reflect.ValueOf(info.Key))
+			e.fieldLineComment(info)
 			e.flow = info.Flow
-			e.marshal("", value)
+			e.enter(KeyElem(info.Key))
+			if !e.fieldAlias(info, value) {
+				e.fieldAnchor(info, value)
+				e.marshal("", value)
+			}
+			e.leave()
 		}
 		if sinfo.InlineMap >= 0 {
 			m := in.Field(sinfo.InlineMap)
@@ -244,16 +359,117 @@ func (e *encoder) structv(tag string, in reflect.Value) {
 					if _, found := sinfo.FieldsMap[k.String()]; found {
 						panic(fmt.Sprintf("cannot have key %q in inlined map: conflicts with struct field", k.String()))
 					}
-					e.marshal("", k)
+					if e.docs != nil {
+						e.document(k, "", m.MapIndex(k))
+					}
+					e.marshalKey(k)
 					e.flow = false
+					e.enterKey(k)
 					e.marshal("", m.MapIndex(k))
+					e.leave()
 				}
 			}
 		}
 	})
 }
 
+// fieldComment has the key of the field written with the head comment
+// set in its tag, ahead of the one of SetDocComments.
+func (e *encoder) fieldComment(info fieldInfo) {
+	if info.Comment != "" {
+		c := []byte(FormatComment(info.Comment))
+		if e.headComment != nil {
+			c = append(append(c, '\n'), e.headComment...)
+		}
+		e.headComment = c
+	}
+}
+
+// fieldLineComment has the value of the field written with the line
+// comment set in its tag, on a single line.
+func (e *encoder) fieldLineComment(info fieldInfo) {
+	if info.LineComment != "" {
+		e.lineComment = []byte("# " + strings.Join(strings.Fields(info.LineComment), " "))
+	}
+}
+
+// fieldAnchor has the value of the field anchored if its tag says so.
+func (e *encoder) fieldAnchor(info fieldInfo, value reflect.Value) {
+	if info.Anchor == "" {
+		return
+	}
+	if e.fieldAnchors == nil {
+		e.fieldAnchors = make(map[string]reflect.Value)
+	}
+	e.fieldAnchors[info.Anchor] = value
+	e.anchor = info.Anchor
+}
+
+// fieldAlias writes an alias for the value of the field if its tag says
+// so and the anchored value is equal to it, and reports whether it did.
+func (e *encoder) fieldAlias(info fieldInfo, value reflect.Value) bool {
+	if info.Alias == "" {
+		return false
+	}
+	anchored, ok := e.fieldAnchors[info.Alias]
+	if !ok || anchored.Type() != value.Type() || !reflect.DeepEqual(anchored.Interface(), value.Interface()) {
+		return false
+	}
+	yaml_alias_event_initialize(&e.event, []byte(info.Alias))
+	e.emit()
+	return true
+}
+
+// marshalKey marshals k as a mapping key.
+func (e *encoder) marshalKey(k reflect.Value) {
+	e.key = true
+	e.marshal("", k)
+	e.key = false
+}
+
+// A pathStep is a step of the path of the value being encoded. The keys
+// of maps other than strings are kept as they are, as formatting them is
+// only needed when the path is read.
+type pathStep struct {
+	elem PathElem
+	key  reflect.Value
+}
+
+// enterKey extends the path with a step into the value of the map key k.
+func (e *encoder) enterKey(k reflect.Value) {
+	e.path = append(e.path, keyStep(k))
+}
+
+// keyStep returns the path step into the value of the map key k.
+func keyStep(k reflect.Value) pathStep {
+	for k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
+	}
+	if k.Kind() == reflect.String {
+		return pathStep{elem: KeyElem(k.String())}
+	}
+	return pathStep{elem: KeyElem(""), key: k}
+}
+
+// pathElem returns the path element of s.
+func (s pathStep) pathElem() PathElem {
+	if s.key.IsValid() {
+		return KeyElem(fmt.Sprint(s.key.Interface()))
+	}
+	return s.elem
+}
+
+// document has the mapping entry of the key k and the value v documented
+// as set with SetDocComments, with desc the description in the tag of its
+// field, if any. It's only called with e.docs set, as the values it takes
+// are not needed otherwise.
+func (e *encoder) document(k reflect.Value, desc string, v reflect.Value) {
+	path := append(e.currentPath(), keyStep(k).pathElem())
+	e.headComment = e.docs.comment(path, desc, v)
+}
+
 func (e *encoder) mappingv(tag string, f func()) {
+	tag = e.collectionTag(tag, mapTag)
 	implicit := tag == ""
 	style := yaml_BLOCK_MAPPING_STYLE
 	if e.flow {
@@ -262,12 +478,15 @@ func (e *encoder) mappingv(tag string, f func()) {
 	}
 	yaml_mapping_start_event_initialize(&e.event, nil, []byte(tag), implicit, style)
 	e.emit()
+	e.nest()
 	f()
+	e.depth--
 	yaml_mapping_end_event_initialize(&e.event)
 	e.emit()
 }
 
 func (e *encoder) slicev(tag string, in reflect.Value) {
+	tag = e.collectionTag(tag, seqTag)
 	implicit := tag == ""
 	style := yaml_BLOCK_SEQUENCE_STYLE
 	if e.flow {
@@ -276,51 +495,18 @@ func (e *encoder) slicev(tag string, in reflect.Value) {
 	}
 	e.must(yaml_sequence_start_event_initialize(&e.event, nil, []byte(tag), implicit, style))
 	e.emit()
+	e.nest()
 	n := in.Len()
 	for i := 0; i < n; i++ {
+		e.enter(IndexElem(i))
 		e.marshal("", in.Index(i))
+		e.leave()
 	}
+	e.depth--
 	e.must(yaml_sequence_end_event_initialize(&e.event))
 	e.emit()
 }
 
-// isBase60 returns whether s is in base 60 notation as defined in YAML 1.1.
-//
-// The base 60 float notation in YAML 1.1 is a terrible idea and is unsupported
-// in YAML 1.2 and by this package, but these should be marshalled quoted for
-// the time being for compatibility with other parsers.
-func isBase60Float(s string) (result bool) {
-	// Fast path.
-	if s == "" {
-		return false
-	}
-	c := s[0]
-	if !(c == '+' || c == '-' || c >= '0' && c <= '9') || strings.IndexByte(s, ':') < 0 {
-		return false
-	}
-	// Do the full match.
-	return base60float.MatchString(s)
-}
-
-// From http://yaml.org/type/float.html, except the regular expression there
-// is bogus. In practice parsers do not enforce the "\.[0-9_]*" suffix.
-var base60float = regexp.MustCompile(`^[-+]?[0-9][0-9_]*(?::[0-5]?[0-9])+(?:\.[0-9_]*)?$`)
-
-// isOldBool returns whether s is bool notation as defined in YAML 1.1.
-//
-// We continue to force strings that YAML 1.1 would interpret as booleans to be
-// rendered as quotes strings so that the marshalled output valid for YAML 1.1
-// parsing.
-func isOldBool(s string) (result bool) {
-	switch s {
-	case "y", "Y", "yes", "Yes", "YES", "on", "On", "ON",
-		"n", "N", "no", "No", "NO", "off", "Off", "OFF":
-		return true
-	default:
-		return false
-	}
-}
-
 func (e *encoder) stringv(tag string, in reflect.Value) {
 	var style yaml_scalar_style_t
 	s := in.String()
@@ -352,13 +538,16 @@ func (e *encoder) stringv(tag string, in reflect.Value) {
 		if e.flow {
 			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
 		} else {
-			style = yaml_LITERAL_SCALAR_STYLE
+			style = e.multilineStyle(s, yaml_LITERAL_SCALAR_STYLE)
 		}
 	case canUsePlain:
 		style = yaml_PLAIN_SCALAR_STYLE
 	default:
 		style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
 	}
+	if tag != binaryTag {
+		style = e.chooseStyle(s, style)
+	}
 	e.emitScalar(s, "", tag, style, nil, nil, nil, nil)
 }
 
@@ -407,171 +596,6 @@ func (e *encoder) floatv(tag string, in reflect.Value) {
 	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
 }
 
-func (e *encoder) nilv() {
-	e.emitScalar("null", "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
-}
-
-func (e *encoder) emitScalar(value, anchor, tag string, style yaml_scalar_style_t, head, line, foot, tail []byte) {
-	// TODO Kill this function. Replace all initialize calls by their underlining Go literals.
-	implicit := tag == ""
-	if !implicit {
-		tag = longTag(tag)
-	}
-	e.must(yaml_scalar_event_initialize(&e.event, []byte(anchor), []byte(tag), []byte(value), implicit, implicit, style))
-	e.event.head_comment = head
-	e.event.line_comment = line
-	e.event.foot_comment = foot
-	e.event.tail_comment = tail
-	e.emit()
-}
-
 func (e *encoder) nodev(in reflect.Value) {
 	e.node(in.Interface().(*Node), "")
 }
-
-func (e *encoder) node(node *Node, tail string) {
-	// Zero nodes behave as nil.
-	if node.Kind == 0 && node.IsZero() {
-		e.nilv()
-		return
-	}
-
-	// If the tag was not explicitly requested, and dropping it won't change the
-	// implicit tag of the value, don't include it in the presentation.
-	var tag = node.Tag
-	var stag = shortTag(tag)
-	var forceQuoting bool
-	if tag != "" && node.Style&TaggedStyle == 0 {
-		if node.Kind == ScalarNode {
-			if stag == strTag && node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
-				tag = ""
-			} else {
-				rtag, _ := resolve("", node.Value)
-				if rtag == stag {
-					tag = ""
-				} else if stag == strTag {
-					tag = ""
-					forceQuoting = true
-				}
-			}
-		} else {
-			var rtag string
-			switch node.Kind {
-			case MappingNode:
-				rtag = mapTag
-			case SequenceNode:
-				rtag = seqTag
-			}
-			if rtag == stag {
-				tag = ""
-			}
-		}
-	}
-
-	switch node.Kind {
-	case DocumentNode:
-		yaml_document_start_event_initialize(&e.event, nil, nil, true)
-		e.event.head_comment = []byte(node.HeadComment)
-		e.emit()
-		for _, node := range node.Content {
-			e.node(node, "")
-		}
-		yaml_document_end_event_initialize(&e.event, true)
-		e.event.foot_comment = []byte(node.FootComment)
-		e.emit()
-
-	case SequenceNode:
-		style := yaml_BLOCK_SEQUENCE_STYLE
-		if node.Style&FlowStyle != 0 {
-			style = yaml_FLOW_SEQUENCE_STYLE
-		}
-		e.must(yaml_sequence_start_event_initialize(&e.event, []byte(node.Anchor), []byte(longTag(tag)), tag == "", style))
-		e.event.head_comment = []byte(node.HeadComment)
-		e.emit()
-		for _, node := range node.Content {
-			e.node(node, "")
-		}
-		e.must(yaml_sequence_end_event_initialize(&e.event))
-		e.event.line_comment = []byte(node.LineComment)
-		e.event.foot_comment = []byte(node.FootComment)
-		e.emit()
-
-	case MappingNode:
-		style := yaml_BLOCK_MAPPING_STYLE
-		if node.Style&FlowStyle != 0 {
-			style = yaml_FLOW_MAPPING_STYLE
-		}
-		yaml_mapping_start_event_initialize(&e.event, []byte(node.Anchor), []byte(longTag(tag)), tag == "", style)
-		e.event.tail_comment = []byte(tail)
-		e.event.head_comment = []byte(node.HeadComment)
-		e.emit()
-
-		// The tail logic below moves the foot comment of prior keys to the following key,
-		// since the value for each key may be a nested structure and the foot needs to be
-		// processed only the entirety of the value is streamed. The last tail is processed
-		// with the mapping end event.
-		var tail string
-		for i := 0; i+1 < len(node.Content); i += 2 {
-			k := node.Content[i]
-			foot := k.FootComment
-			if foot != "" {
-				kopy := *k
-				kopy.FootComment = ""
-				k = &kopy
-			}
-			e.node(k, tail)
-			tail = foot
-
-			v := node.Content[i+1]
-			e.node(v, "")
-		}
-
-		yaml_mapping_end_event_initialize(&e.event)
-		e.event.tail_comment = []byte(tail)
-		e.event.line_comment = []byte(node.LineComment)
-		e.event.foot_comment = []byte(node.FootComment)
-		e.emit()
-
-	case AliasNode:
-		yaml_alias_event_initialize(&e.event, []byte(node.Value))
-		e.event.head_comment = []byte(node.HeadComment)
-		e.event.line_comment = []byte(node.LineComment)
-		e.event.foot_comment = []byte(node.FootComment)
-		e.emit()
-
-	case ScalarNode:
-		value := node.Value
-		if !utf8.ValidString(value) {
-			if stag == binaryTag {
-				failf("explicitly tagged !!binary data must be base64-encoded")
-			}
-			if stag != "" {
-				failf("cannot marshal invalid UTF-8 data as %s", stag)
-			}
-			// It can't be encoded directly as YAML so use a binary tag
-			// and encode it as base64.
-			tag = binaryTag
-			value = encodeBase64(value)
-		}
-
-		style := yaml_PLAIN_SCALAR_STYLE
-		switch {
-		case node.Style&DoubleQuotedStyle != 0:
-			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
-		case node.Style&SingleQuotedStyle != 0:
-			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
-		case node.Style&LiteralStyle != 0:
-			style = yaml_LITERAL_SCALAR_STYLE
-		case node.Style&FoldedStyle != 0:
-			style = yaml_FOLDED_SCALAR_STYLE
-		case strings.Contains(value, "\n"):
-			style = yaml_LITERAL_SCALAR_STYLE
-		case forceQuoting:
-			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
-		}
-
-		e.emitScalar(value, node.Anchor, tag, style, []byte(node.HeadComment), []byte(node.LineComment), []byte(node.FootComment), []byte(tail))
-	default:
-		failf("cannot encode node with unknown kind %d", node.Kind)
-	}
-}
@@ -494,6 +494,19 @@ var marshalTests = []struct {
 		},
 		"value: !!seq []\n",
 	},
+	// MapSlice
+	{
+		yaml.MapSlice{{"b", 2}, {"a", 1}, {"c", yaml.MapSlice{{"y", []interface{}{1}}, {1, nil}}}},
+		"b: 2\na: 1\nc:\n    \"y\":\n        - 1\n    1: null\n",
+	}, {
+		map[string][]yaml.MapItem{"m": {{"z", 1}, {"a", 2}}},
+		"m:\n    z: 1\n    a: 2\n",
+	}, {
+		&struct {
+			M yaml.MapSlice `yaml:",flow"`
+		}{yaml.MapSlice{{"z", 1}, {"a", 2}}},
+		"m: {z: 1, a: 2}\n",
+	},
 }
 
 func (s *S) TestMarshal(c *C) {
@@ -560,6 +573,11 @@ var marshalErrorTests = []struct {
 		B map[string]int ",inline"
 	}{1, map[string]int{"a": 2}},
 	panic: `cannot have key "a" in inlined map: conflicts with struct field`,
+}, {
+	value: &struct {
+		A int `yaml:"a,anchor,alias"`
+	}{1},
+	panic: `options ,anchor and ,alias may not be used together in tag of struct .*`,
 }}
 
 func (s *S) TestMarshalErrors(c *C) {
@@ -656,6 +674,676 @@ func (s *S) TestSetIndent(c *C) {
 	c.Assert(buf.String(), Equals, "a:\n        b:\n                c: d\n")
 }
 
+func (s *S) TestSetSequenceIndent(c *C) {
+	v := map[string]interface{}{
+		"a": []interface{}{1, map[string]interface{}{"b": []interface{}{2}, "c": 3}},
+		"d": 4,
+	}
+	tests := []struct {
+		indent, seqIndent int
+		want              string
+	}{
+		{4, 0, "a:\n- 1\n- b:\n  - 2\n  c: 3\nd: 4\n"},
+		{4, 2, "a:\n  - 1\n  - b:\n      - 2\n    c: 3\nd: 4\n"},
+		{2, 4, "a:\n    - 1\n    - b:\n          - 2\n      c: 3\nd: 4\n"},
+	}
+	for _, test := range tests {
+		data, err := yaml.MarshalWithOptions(v, yaml.WithIndent(test.indent), yaml.WithSequenceIndent(test.seqIndent))
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, test.want)
+
+		var back interface{}
+		c.Assert(yaml.Unmarshal(data, &back), IsNil)
+		c.Assert(back, DeepEquals, v)
+	}
+
+	data, err := yaml.MarshalWithOptions([][]int{{1}}, yaml.WithSequenceIndent(0))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "- - 1\n")
+
+	enc := yaml.NewEncoder(nil)
+	c.Assert(func() { enc.SetSequenceIndent(-1) }, PanicMatches, "yaml: cannot indent to a negative number of spaces")
+}
+
+func (s *S) TestSetCompactFlow(c *C) {
+	type T struct {
+		A []interface{}          `yaml:"a,flow"`
+		B map[string]interface{} `yaml:"b,flow"`
+	}
+	v := T{
+		A: []interface{}{1, "x y", []int{2, 3}, map[string]int{"1": 4}},
+		B: map[string]interface{}{"c": []interface{}{}, "d": "e", "f:g": nil},
+	}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithCompactFlow(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: [1,x y,[2,3],{\"1\":4}]\nb: {c: [],d: e,'f:g':null}\n")
+
+	var back T
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, T{
+		A: []interface{}{1, "x y", []interface{}{2, 3}, map[string]interface{}{"1": 4}},
+		B: v.B,
+	})
+
+	data, err = yaml.MarshalWithOptions(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: [1, x y, [2, 3], {\"1\": 4}]\nb: {c: [], d: e, 'f:g': null}\n")
+}
+
+func (s *S) TestSetFlowFormat(c *C) {
+	type T struct {
+		A []interface{}          `yaml:"a,flow"`
+		B map[string]interface{} `yaml:"b,flow"`
+	}
+	v := T{
+		A: []interface{}{1, "x y", []int{2, 3}, []int{}},
+		B: map[string]interface{}{"c": []interface{}{}, "d": "e", "f:g": nil},
+	}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithFlowFormat(yaml.FlowFormat{SpaceAfterComma: true, SpaceInside: true}))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: [ 1, x y, [ 2, 3 ], [] ]\nb: { c: [], d: e, 'f:g':null }\n")
+
+	format := yaml.FlowFormat{SpaceAfterColon: true, SpaceAfterComma: true, ItemPerLine: true}
+	data, err = yaml.MarshalWithOptions(v, yaml.WithFlowFormat(format), yaml.WithLineWidth(20))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: [\n    1,\n    x y,\n    [2, 3],\n    []\n]\nb: {\n    c: [],\n    d: e,\n    'f:g': null\n}\n")
+
+	var back T
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, T{
+		A: []interface{}{1, "x y", []interface{}{2, 3}, []interface{}{}},
+		B: v.B,
+	})
+
+	// Collections that fit are left on their line.
+	data, err = yaml.MarshalWithOptions(v, yaml.WithFlowFormat(format))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: [1, x y, [2, 3], []]\nb: {c: [], d: e, 'f:g': null}\n")
+}
+
+func (s *S) TestSetLineWidth(c *C) {
+	v := map[string]interface{}{
+		"a": "lorem ipsum dolor sit amet",
+		"b": []string{"consectetur", "adipiscing", "elit"},
+		"c": "sed do eiusmod\ntempor",
+	}
+	data, err := yaml.MarshalWithOptions(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: lorem ipsum dolor sit amet\nb:\n    - consectetur\n    - adipiscing\n    - elit\nc: |-\n    sed do eiusmod\n    tempor\n")
+
+	v["b"] = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "consectetur"},
+		{Kind: yaml.ScalarNode, Value: "adipiscing"},
+		{Kind: yaml.ScalarNode, Value: "elit"},
+	}}
+	v["c"] = &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: "sed do eiusmod tempor"}
+	data, err = yaml.MarshalWithOptions(v, yaml.WithLineWidth(10))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: lorem ipsum\n    dolor sit\n    amet\nb: [consectetur,\n    adipiscing,\n    elit]\nc: \"sed do eiusmod\n    tempor\"\n")
+
+	data, err = yaml.MarshalWithOptions(v, yaml.WithLineWidth(10), yaml.WithScalarWrapping(false))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: lorem ipsum dolor sit amet\nb: [consectetur,\n    adipiscing,\n    elit]\nc: \"sed do eiusmod tempor\"\n")
+}
+
+func (s *S) TestSetStringStyle(c *C) {
+	type container struct {
+		Name string
+		Env  map[string]string
+		Args []string
+	}
+	v := map[string]interface{}{
+		"containers": []container{{
+			Name: "web",
+			Env:  map[string]string{"PORT": "8080", "MODE": "prod"},
+			Args: []string{"-v", "line\n"},
+		}},
+		"notes": "a\nb",
+	}
+	var paths []string
+	style := func(path yaml.Path, key bool, value string) yaml.Style {
+		if !key {
+			paths = append(paths, path.String())
+		}
+		switch {
+		case key && value == "notes":
+			return yaml.LiteralStyle
+		case !key && len(path) > 2 && path[2].Key == "env":
+			return yaml.DoubleQuotedStyle
+		case !key && len(path) > 2 && path[2].Key == "args":
+			return yaml.SingleQuotedStyle
+		case value == "a\nb":
+			return yaml.FoldedStyle
+		}
+		return 0
+	}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithStringStyle(style))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `containers:
+    - name: web
+      env:
+        MODE: "prod"
+        PORT: "8080"
+      args:
+        - '-v'
+        - 'line
+
+'
+"notes": >-
+    a
+
+    b
+`)
+	c.Assert(paths, DeepEquals, []string{
+		"containers[0].name", "containers[0].env.MODE", "containers[0].env.PORT",
+		"containers[0].args[0]", "containers[0].args[1]", "notes",
+	})
+
+	var node yaml.Node
+	err = yaml.Unmarshal(data, &node)
+	c.Assert(err, IsNil)
+	paths = nil
+	data, err = yaml.MarshalWithOptions(&node, yaml.WithStringStyle(style))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `containers:
+    - name: web
+      env:
+        MODE: "prod"
+        PORT: "8080"
+      args:
+        - '-v'
+        - 'line
+
+'
+"notes": >-
+    a
+
+    b
+`)
+	c.Assert(paths, DeepEquals, []string{"containers[0].name"})
+}
+
+func (s *S) TestSetMultilinePolicy(c *C) {
+	v := map[string]interface{}{
+		"a": "one\ntwo\n",
+		"b": "one\ntwo",
+		"c": "a rather long line of text\nand a short one",
+	}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithMultilinePolicy(yaml.AutoMultiline))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: |\n    one\n    two\nb: \"one\\ntwo\"\nc: \"a rather long line of text\\nand a short one\"\n")
+
+	data, err = yaml.MarshalWithOptions(v, yaml.WithMultilinePolicy(yaml.AutoMultiline), yaml.WithLineWidth(20))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: |\n    one\n    two\nb: \"one\\ntwo\"\nc: >-\n    a rather long line\n    of text\n\n    and a short one\n")
+
+	var back map[string]interface{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	// Node values without a style follow the policy too.
+	var node yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("a: 'x\n\n  y'\nb: |\n  z\n"), &node), IsNil)
+	node.Content[0].Content[1].Style = 0
+	data, err = yaml.MarshalWithOptions(&node, yaml.WithMultilinePolicy(func(value string, width int) yaml.Style {
+		return yaml.SingleQuotedStyle
+	}))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: 'x\n\n    y'\nb: |\n    z\n")
+}
+
+func (s *S) TestSetTagPolicy(c *C) {
+	v := map[string]interface{}{"a": 1, "b": "123", "c": []interface{}{true, nil, 1.5}}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithTagPolicy(yaml.TagsAlways))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "!!map\n!!str a: !!int 1\n!!str b: !!str \"123\"\n!!str c: !!seq\n    - !!bool true\n    - !!null null\n    - !!float 1.5\n")
+
+	var back map[string]interface{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	var node yaml.Node
+	err = yaml.Unmarshal([]byte("a: !!str 1\nb: !foo {x: 1}\nc: !!int 2\n"), &node)
+	c.Assert(err, IsNil)
+	data, err = yaml.MarshalWithOptions(&node, yaml.WithTagPolicy(yaml.TagsNever))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: \"1\"\nb: {x: 1}\nc: 2\n")
+
+	data, err = yaml.MarshalWithOptions(&node, yaml.WithTagPolicy(yaml.TagsAlways))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "!!map\n!!str a: !!str 1\n!!str b: !foo {!!str x: !!int 1}\n!!str c: !!int 2\n")
+
+	data, err = yaml.MarshalWithOptions(&node, yaml.WithTagPolicy(yaml.TagsAsNeeded))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: !!str 1\nb: !foo {x: 1}\nc: !!int 2\n")
+}
+
+func (s *S) TestSetYAML11(c *C) {
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte("a: yes\nb: 0o17\nc: -0o17\nd: 1e5\ne: 2.5E-3\nf: [a:b, c]\ng:h: 1\ni: 1:20\n"), &node)
+	c.Assert(err, IsNil)
+	data, err := yaml.MarshalWithOptions(&node, yaml.WithYAML11(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: 'yes'\nb: 017\nc: -017\nd: 1.0e+5\ne: 2.5E-3\nf: ['a:b', c]\n'g:h': 1\ni: '1:20'\n")
+
+	var back, want interface{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(node.Decode(&want), IsNil)
+	c.Assert(back, DeepEquals, want)
+
+	data, err = yaml.MarshalWithOptions(map[string]interface{}{"f": 1e21, "n": "off"}, yaml.WithYAML11(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "f: 1.0e+21\n\"n\": \"off\"\n")
+}
+
+type anchorDB struct {
+	ID   string `yaml:"id"`
+	Host string `yaml:"host"`
+}
+
+type anchorList struct {
+	Name string
+	Next *anchorList `yaml:",omitempty"`
+}
+
+func (s *S) TestSetAnchors(c *C) {
+	db := &anchorDB{"main", "db.local"}
+	labels := map[string]string{"app": "web"}
+	v := map[string]interface{}{
+		"a": db,
+		"b": []interface{}{db, labels},
+		"c": labels,
+		"d": &anchorDB{"other", "x"},
+	}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithAnchors(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `a: &id001
+    id: main
+    host: db.local
+b:
+    - *id001
+    - &id002
+      app: web
+c: *id002
+d:
+    id: other
+    host: x
+`)
+
+	var paths []string
+	namer := func(path yaml.Path, value interface{}) string {
+		paths = append(paths, path.String())
+		if db, ok := value.(*anchorDB); ok {
+			return db.ID
+		}
+		return ""
+	}
+	data, err = yaml.MarshalWithOptions(v, yaml.WithAnchors(true), yaml.WithAnchorNamer(namer))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `a: &main
+    id: main
+    host: db.local
+b:
+    - *main
+    - &id001
+      app: web
+c: *id001
+d:
+    id: other
+    host: x
+`)
+	c.Assert(paths, DeepEquals, []string{"a", "b[1]"})
+
+	var back map[string]interface{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back["b"], DeepEquals, []interface{}{back["a"], back["c"]})
+
+	// Values that contain themselves are written with an alias.
+	list := &anchorList{Name: "x"}
+	list.Next = list
+	data, err = yaml.MarshalWithOptions(list, yaml.WithAnchors(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "&id001\nname: x\nnext: *id001\n")
+}
+
+type anchorConfig struct {
+	Defaults *anchorDB `yaml:"defaults,anchor"`
+	Primary  *anchorDB `yaml:"primary,alias=defaults"`
+	Replica  *anchorDB `yaml:"replica,alias=defaults"`
+}
+
+func (s *S) TestMarshalAnchorAliasFields(c *C) {
+	db := &anchorDB{"main", "db.local"}
+	data, err := yaml.Marshal(&anchorConfig{db, db, &anchorDB{"other", "x"}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `defaults: &defaults
+    id: main
+    host: db.local
+primary: *defaults
+replica:
+    id: other
+    host: x
+`)
+
+	// Equal values are aliased too, but not values left out.
+	v := struct {
+		A []int `yaml:"a,anchor=list,omitempty"`
+		B []int `yaml:"b,alias=list"`
+	}{B: []int{}}
+	data, err = yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "b: []\n")
+	v.A, v.B = []int{1, 2}, []int{1, 2}
+	data, err = yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: &list\n    - 1\n    - 2\nb: *list\n")
+}
+
+type docServer struct {
+	Host    string        `yaml:"host" description:"Address to listen on."`
+	Port    int           `yaml:"port"`
+	Mode    string        `yaml:"mode"`
+	Timeout time.Duration `yaml:"timeout" description:"How long to wait for requests."`
+	Hidden  bool          `yaml:"hidden"`
+}
+
+type docConfig struct {
+	Server docServer         `yaml:"server"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+func (s *S) TestEncoderSetDocComments(c *C) {
+	schema := &yaml.Schema{Properties: map[string]*yaml.Schema{
+		"server": {Description: "The HTTP server.", Properties: map[string]*yaml.Schema{
+			"port": {Type: "integer", Default: 80, Description: "Port to listen on."},
+			"mode": {Type: "string", Enum: []interface{}{"dev", "prod"}, Default: "prod"},
+		}},
+		"labels": {AdditionalProperties: &yaml.Schema{Type: "string"}},
+	}}
+	v := docConfig{
+		Server: docServer{Host: "localhost", Port: 80, Mode: "prod", Timeout: time.Minute},
+		Labels: map[string]string{"app": "web"},
+	}
+	docs := map[string]string{
+		"labels":      "Labels added to requests.",
+		"server.mode": "How the server runs,\nwith more checks in dev.",
+	}
+	data, err := yaml.MarshalWithOptions(&v, yaml.WithDocComments(schema, docs))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `# The HTTP server.
+# Type: object.
+server:
+    # Address to listen on.
+    # Type: string.
+    host: localhost
+    # Port to listen on.
+    # Type: integer. Default: 80.
+    port: 80
+    # How the server runs,
+    # with more checks in dev.
+    # Type: string. Default: prod. Allowed values: dev, prod.
+    mode: prod
+    # How long to wait for requests.
+    # Type: string.
+    timeout: 1m0s
+    hidden: false
+# Labels added to requests.
+# Type: object.
+labels:
+    # Type: string.
+    app: web
+`)
+
+	// The comments are left out when read back.
+	var back docConfig
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	// Descriptions alone document fields with the types of their values.
+	data, err = yaml.MarshalWithOptions(&v.Server, yaml.WithDocComments(nil, map[string]string{"**.port": "Port."}))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `# Address to listen on.
+# Type: string.
+host: localhost
+# Port.
+# Type: integer.
+port: 80
+mode: prod
+# How long to wait for requests.
+# Type: string.
+timeout: 1m0s
+hidden: false
+`)
+
+	enc := yaml.NewEncoder(nil)
+	c.Assert(func() { enc.SetDocComments(nil, map[string]string{"a[": ""}) }, PanicMatches, `yaml: invalid path "a\["`)
+}
+
+type commentedConfig struct {
+	Retries int               `yaml:"retries" comment:"number of times to retry; 0 disables"`
+	Hosts   []string          `yaml:"hosts" comment:"Hosts to connect to,\nin order." linecomment:"at least one"`
+	Labels  map[string]string `yaml:"labels,omitempty" linecomment:"free form"`
+	Level   string            `yaml:"level" linecomment:"debug, info\nor error"`
+}
+
+func (s *S) TestMarshalCommentTags(c *C) {
+	v := commentedConfig{Retries: 3, Hosts: []string{"a", "b"}, Labels: map[string]string{"app": "web"}, Level: "info"}
+	data, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `# number of times to retry; 0 disables
+retries: 3
+# Hosts to connect to,
+# in order.
+hosts: # at least one
+    - a
+    - b
+labels: # free form
+    app: web
+level: info # debug, info or error
+`)
+
+	var back commentedConfig
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	// The comments of the tags come ahead of the ones documenting fields.
+	docs := map[string]string{"retries": "Retries."}
+	data, err = yaml.MarshalWithOptions(&commentedConfig{}, yaml.WithDocComments(nil, docs))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `# number of times to retry; 0 disables
+# Retries.
+# Type: integer.
+retries: 0
+# Hosts to connect to,
+# in order.
+hosts: [] # at least one
+level: "" # debug, info or error
+`)
+}
+
+func (s *S) TestEncoderMaxDepth(c *C) {
+	v := map[string]interface{}{"a": []interface{}{[]int{1}}}
+	_, err := yaml.MarshalWithOptions(v, yaml.WithMaxDepth(2))
+	c.Assert(err, ErrorMatches, "yaml: exceeded max depth of 2")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeMaxDepth)
+
+	data, err := yaml.MarshalWithOptions(v, yaml.WithMaxDepth(3))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a:\n    - - 1\n")
+
+	var node yaml.Node
+	c.Assert(yaml.Unmarshal(data, &node), IsNil)
+	_, err = yaml.MarshalWithOptions(&node, yaml.WithMaxDepth(2))
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeMaxDepth)
+
+	// Values that contain themselves hit the built-in limit.
+	list := &anchorList{Name: "x"}
+	list.Next = list
+	_, err = yaml.Marshal(list)
+	c.Assert(err, ErrorMatches, "yaml: exceeded max depth of 10000")
+}
+
+func (s *S) TestEmitterError(c *C) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "a"},
+		{Kind: yaml.SequenceNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "1"},
+			{Kind: yaml.ScalarNode, Value: "x", Anchor: "bad anchor"},
+		}},
+	}}
+	_, err := yaml.Marshal(node)
+	c.Assert(err, ErrorMatches, "yaml: output line 1, column 2, at a\\[1\\]: anchor value must contain alphanumerical characters only")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeEmitter)
+	eerr, ok := err.(*yaml.EmitterError)
+	c.Assert(ok, Equals, true)
+	c.Assert(eerr.Path, DeepEquals, yaml.Path{yaml.KeyElem("a"), yaml.IndexElem(1)})
+
+	_, err = yaml.Marshal(map[string]interface{}{"j": 1, "k": &yaml.Node{Kind: yaml.AliasNode}})
+	c.Assert(err, ErrorMatches, "yaml: output line 2, column 2, at k: alias value must not be empty")
+
+	// Keys other than strings are formatted in the path.
+	_, err = yaml.Marshal(map[int]interface{}{10: 1, 20: &yaml.Node{Kind: yaml.AliasNode}})
+	c.Assert(err, ErrorMatches, "yaml: output line 2, column 3, at 20: alias value must not be empty")
+	_, err = yaml.Marshal(yaml.MapSlice{{Key: true, Value: &yaml.Node{Kind: yaml.AliasNode}}})
+	c.Assert(err, ErrorMatches, "yaml: output line 1, column 1, at true: alias value must not be empty")
+
+	_, err = yaml.Marshal(&yaml.Node{Kind: yaml.AliasNode})
+	c.Assert(err, ErrorMatches, "yaml: output line 1, column 1: alias value must not be empty")
+}
+
+func (s *S) TestMarshalWithOptions(c *C) {
+	for i, item := range marshalTests {
+		data, err := yaml.MarshalWithOptions(item.value)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, item.data, Commentf("test %d", i))
+	}
+
+	v := map[string]interface{}{"a": map[string]interface{}{"b": []int{1}}}
+	data, err := yaml.MarshalWithOptions(v, yaml.WithIndent(2), yaml.WithKnownFields(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a:\n  b:\n    - 1\n")
+
+	_, err = yaml.MarshalWithOptions(&failingMarshaler{}, yaml.EncoderOption(func(enc *yaml.Encoder) { enc.SetIndent(8) }))
+	c.Assert(err, Equals, failingErr)
+}
+
+func (s *S) TestEncoderKeyNaming(c *C) {
+	v := struct {
+		UserID     string
+		HTTPServer string `yaml:",omitempty"`
+		Tagged     int    `yaml:"Custom"`
+	}{"a", "b", 1}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetKeyNaming(yaml.KeyKebabCase)
+	c.Assert(enc.Encode(v), IsNil)
+	c.Assert(buf.String(), Equals, "user-id: a\nhttp-server: b\nCustom: 1\n")
+
+	data, err := yaml.MarshalWithOptions(v, yaml.WithKeyNaming(yaml.KeyCamelCase))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "userId: a\nhttpServer: b\nCustom: 1\n")
+
+	data, err = yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "userid: a\nhttpserver: b\nCustom: 1\n")
+}
+
+func (s *S) TestMarshalIndent(c *C) {
+	v := map[string]interface{}{"a": map[string]interface{}{"b": []int{1}}}
+	data, err := yaml.MarshalIndent(v, 2)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a:\n  b:\n    - 1\n")
+
+	data, err = yaml.MarshalIndent(v, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a:\n    b:\n        - 1\n")
+
+	c.Assert(func() { yaml.MarshalIndent(v, -1) }, PanicMatches, "yaml: cannot indent to a negative number of spaces")
+}
+
+func (s *S) TestMarshalFlow(c *C) {
+	v := map[string]interface{}{
+		"a": map[string]interface{}{"b": []int{1, 2}},
+		"c": "multi\nline",
+		"d": struct{ E []string }{[]string{"x"}},
+	}
+	data, err := yaml.MarshalFlow(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "{a: {b: [1, 2]}, c: \"multi\\nline\", d: {e: [x]}}\n")
+
+	data, err = yaml.MarshalFlow("text")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "text\n")
+
+	var node yaml.Node
+	err = yaml.Unmarshal([]byte("a:\n  - 1\n"), &node)
+	c.Assert(err, IsNil)
+	data, err = yaml.MarshalFlow(&node)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "{a: [1]}\n")
+}
+
+func (s *S) TestEncoderDocumentHooks(c *C) {
+	var buf bytes.Buffer
+	var calls []string
+	enc := yaml.NewEncoder(&buf)
+	enc.SetDocumentHooks(func(index int, n int64) {
+		calls = append(calls, fmt.Sprintf("before %d %d", index, n))
+		fmt.Fprintf(&buf, "# document %d\n", index)
+	}, func(index int, n int64) {
+		calls = append(calls, fmt.Sprintf("after %d %d", index, n))
+	})
+	c.Assert(enc.Encode(map[string]int{"a": 1}), IsNil)
+	c.Assert(enc.Encode([]int{1, 2}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "# document 0\na: 1\n# document 1\n---\n- 1\n- 2\n")
+	c.Assert(calls, DeepEquals, []string{"before 0 0", "after 0 5", "before 1 5", "after 1 12"})
+}
+
+// writeRecorder records the sizes of the writes made to it.
+type writeRecorder struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func (s *S) TestEncoderSetBufferSize(c *C) {
+	doc := make([]string, 1000)
+	for i := range doc {
+		doc[i] = fmt.Sprintf("item %d", i)
+	}
+	for _, size := range []int{0, 1000, 4096} {
+		c.Logf("size %d", size)
+		var w writeRecorder
+		enc := yaml.NewEncoder(&w)
+		if size > 0 {
+			enc.SetBufferSize(size)
+		}
+		c.Assert(enc.Encode(doc), IsNil)
+		c.Assert(enc.BytesWritten(), Equals, int64(w.Len()))
+		if size == 0 {
+			size = 128
+		}
+		// Every write but the last one at the end of the document takes
+		// nearly the whole buffer.
+		for _, n := range w.writes[:len(w.writes)-1] {
+			c.Assert(n > size-8 && n <= size, Equals, true, Commentf("write of %d bytes", n))
+		}
+
+		w.writes = nil
+		enc.SetBufferSize(16)
+		c.Assert(enc.Encode(map[string]string{"a": strings.Repeat("x", 50)}), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		c.Assert(enc.BytesWritten(), Equals, int64(w.Len()))
+		c.Assert(len(w.writes) > 3, Equals, true)
+		c.Assert(strings.HasSuffix(w.String(), "\n---\na: "+strings.Repeat("x", 50)+"\n"), Equals, true)
+	}
+}
+
 func (s *S) TestSortedOutput(c *C) {
 	order := []interface{}{
 		false,
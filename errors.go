@@ -0,0 +1,319 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// An ErrorCode identifies the kind of an error returned by this package.
+// Unlike error messages, codes are stable and can be relied upon.
+type ErrorCode string
+
+const (
+	ErrCodeInput           ErrorCode = "E_INPUT"                // The input could not be read.
+	ErrCodeInvalidEncoding ErrorCode = "E_INVALID_ENCODING"     // The input is not valid in its encoding.
+	ErrCodeDisallowedChar  ErrorCode = "E_DISALLOWED_CHARACTER" // The input holds characters not allowed in YAML.
+	ErrCodeInputTooLarge   ErrorCode = "E_INPUT_TOO_LARGE"      // The input exceeds the size limit.
+	ErrCodeSyntax          ErrorCode = "E_SYNTAX"               // The input is not valid YAML.
+	ErrCodeTabIndent       ErrorCode = "E_SYNTAX_TAB_INDENT"    // A tab is used for indentation.
+	ErrCodeMaxDepth        ErrorCode = "E_MAX_DEPTH"            // Collections are nested too deeply.
+	ErrCodeUnknownAnchor   ErrorCode = "E_UNKNOWN_ANCHOR"       // An alias refers to an unknown anchor.
+	ErrCodeAliasCycle      ErrorCode = "E_ALIAS_CYCLE"          // An anchored value contains an alias to itself.
+	ErrCodeAliasLimit      ErrorCode = "E_ALIAS_LIMIT"          // Aliases expand to too many values.
+	ErrCodeAliasDisallowed ErrorCode = "E_ALIAS_DISALLOWED"     // An anchor or alias is used where these are disallowed.
+	ErrCodeCustomTag       ErrorCode = "E_CUSTOM_TAG"           // A tag is used that is not known to the decoder.
+	ErrCodeInvalidValue    ErrorCode = "E_INVALID_VALUE"        // A scalar is not valid for its explicit tag.
+	ErrCodeInvalidMapKey   ErrorCode = "E_INVALID_MAP_KEY"      // A key cannot be used in the Go map decoded into.
+	ErrCodeInvalidMerge    ErrorCode = "E_INVALID_MERGE"        // A merge key has a value that cannot be merged.
+	ErrCodeArrayLength     ErrorCode = "E_ARRAY_LENGTH"         // A sequence does not fit the Go array decoded into.
+	ErrCodeType            ErrorCode = "E_TYPE"                 // Values cannot be decoded into the Go types given.
+	ErrCodeDuplicateKey    ErrorCode = "E_DUP_KEY"              // A mapping holds the same key more than once.
+	ErrCodeDuplicateField  ErrorCode = "E_DUP_FIELD"            // Keys for the same struct field appear more than once.
+	ErrCodeUnknownField    ErrorCode = "E_UNKNOWN_FIELD"        // A key matches no struct field, with KnownFields set.
+	ErrCodeSchema          ErrorCode = "E_SCHEMA"               // A value does not follow its schema.
+	ErrCodeSubstitution    ErrorCode = "E_SUBSTITUTION"         // A placeholder cannot be substituted.
+	ErrCodeEmitter         ErrorCode = "E_EMITTER"              // A value cannot be written as YAML.
+	ErrCodeInternal        ErrorCode = "E_INTERNAL"             // An internal error, which should be reported.
+)
+
+// An Error describes a failure to parse or decode YAML content.
+type Error struct {
+	Code ErrorCode
+
+	// Line holds the line the error was found at, or 0 if unknown.
+	Line int
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line != 0 {
+		return fmt.Sprintf("yaml: line %d: %s", e.Line, e.Message)
+	}
+	return "yaml: " + e.Message
+}
+
+// A SizeLimitError is returned when the input is longer than allowed
+// by Decoder.SetMaxBytes.
+type SizeLimitError struct {
+	Limit int
+}
+
+func (e *SizeLimitError) Error() string {
+	return fmt.Sprintf("yaml: input exceeds the limit of %d bytes", e.Limit)
+}
+
+// A Warning describes a problem found in the input that did not
+// prevent it from being decoded.
+type Warning struct {
+	// Offset holds the byte offset in the input where the problem was
+	// found, for problems found while reading the input, or -1.
+	Offset int
+
+	// Line and Column hold the position of the node the problem was
+	// found in, for problems found while decoding nodes, or 0.
+	Line   int
+	Column int
+
+	// Message describes the problem.
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Line > 0 {
+		return fmt.Sprintf("yaml: line %d: %s", w.Line, w.Message)
+	}
+	if w.Offset < 0 {
+		return "yaml: " + w.Message
+	}
+	return fmt.Sprintf("yaml: offset %d: %s", w.Offset, w.Message)
+}
+
+var (
+	// ErrInvalidUTF8 is wrapped by the EncodingError reporting
+	// invalid UTF-8 input.
+	ErrInvalidUTF8 = errors.New("invalid UTF-8")
+
+	// ErrInvalidUTF16 is wrapped by the EncodingError reporting
+	// invalid UTF-16 input.
+	ErrInvalidUTF16 = errors.New("invalid UTF-16")
+
+	// ErrDisallowedCharacter is wrapped by the EncodingError reporting
+	// a character that is valid Unicode but isn't allowed in YAML.
+	ErrDisallowedCharacter = errors.New("character not allowed in YAML")
+)
+
+// An EncodingError is returned when the input isn't valid in its
+// character encoding, or holds characters that aren't allowed in YAML.
+// Err is ErrInvalidUTF8, ErrInvalidUTF16 or ErrDisallowedCharacter.
+type EncodingError struct {
+	// Offset holds the byte offset in the input where the problem was found.
+	Offset int
+
+	// Bytes holds the invalid sequence.
+	Bytes []byte
+
+	// Message describes the problem.
+	Message string
+
+	Err error
+}
+
+func (e *EncodingError) Error() string {
+	return fmt.Sprintf("yaml: %s at byte %d", e.Message, e.Offset)
+}
+
+func (e *EncodingError) Unwrap() error {
+	return e.Err
+}
+
+// An EmitterError describes a value that could not be written as YAML,
+// such as one with an invalid anchor or tag. Its code is ErrCodeEmitter.
+type EmitterError struct {
+	// Line and Column hold the position in the output that was reached
+	// when the problem was found, starting at 1.
+	Line   int
+	Column int
+
+	// Path holds the path in the document of the value being encoded.
+	Path Path
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *EmitterError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("yaml: output line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("yaml: output line %d, column %d, at %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// An AnchorError describes a problem with an alias or the anchor it
+// refers to. Its code is ErrCodeUnknownAnchor, ErrCodeAliasCycle,
+// ErrCodeAliasLimit or ErrCodeAliasDisallowed.
+type AnchorError struct {
+	Code ErrorCode
+
+	// Anchor holds the name of the anchor, or "" for excessive aliasing
+	// found outside of any alias.
+	Anchor string
+
+	// Line and Column hold the position of the alias, or of the anchored
+	// value for a disallowed anchor, or 0 if unknown.
+	Line   int
+	Column int
+
+	// AnchorLine and AnchorColumn hold the position of the anchored
+	// value, or 0 if unknown.
+	AnchorLine   int
+	AnchorColumn int
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *AnchorError) Error() string {
+	msg := e.Message
+	if e.AnchorLine != 0 {
+		msg += fmt.Sprintf(" (defined at line %d)", e.AnchorLine)
+	}
+	if e.Line != 0 {
+		return fmt.Sprintf("yaml: line %d: %s", e.Line, msg)
+	}
+	return "yaml: " + msg
+}
+
+// A TagError is returned for a tag not known to the decoder when these
+// are disallowed by Decoder.DisallowCustomTags.
+type TagError struct {
+	// Tag holds the tag, with the !! handle for tags of the YAML namespace.
+	Tag string
+
+	// Line and Column hold the position of the tagged value.
+	Line   int
+	Column int
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("yaml: line %d: tag %s is not allowed", e.Line, e.Tag)
+}
+
+// failAnchor fails with an AnchorError describing a problem with alias,
+// which may be nil if the problem isn't tied to any alias.
+func failAnchor(code ErrorCode, alias *Node, msg string) {
+	e := &AnchorError{Code: code, Message: msg}
+	if alias != nil {
+		e.Anchor = alias.Value
+		e.Line = alias.Line
+		e.Column = alias.Column
+		if alias.Alias != nil {
+			e.AnchorLine = alias.Alias.Line
+			e.AnchorColumn = alias.Alias.Column
+		}
+	}
+	fail(e)
+}
+
+func handleErr(err *error) {
+	if v := recover(); v != nil {
+		if e, ok := v.(yamlError); ok {
+			*err = e.err
+		} else {
+			panic(v)
+		}
+	}
+}
+
+// handleDecodeErr is like handleErr, but also turns any other panic into
+// an error, so that decoding can't crash the program whatever its input.
+// Panics raised by the user's own methods are not the decoder's to
+// recover and are let through unchanged.
+func handleDecodeErr(err *error) {
+	if v := recover(); v != nil {
+		if e, ok := v.(yamlError); ok {
+			*err = e.err
+		} else if p, ok := v.(userPanic); ok {
+			panic(p.v)
+		} else {
+			*err = &Error{Code: ErrCodeInternal, Message: fmt.Sprintf("internal error at %s: %v", panicLocation(), v)}
+		}
+	}
+}
+
+// panicLocation returns the file and line a panic being recovered
+// from was raised at.
+func panicLocation() string {
+	pc := make([]uintptr, 32)
+	panicking := false
+	for _, pc := range pc[:runtime.Callers(1, pc)] {
+		f := runtime.FuncForPC(pc - 1)
+		if f == nil {
+			continue
+		}
+		if panicking && !strings.HasPrefix(f.Name(), "runtime.") {
+			file, line := f.FileLine(pc - 1)
+			return filepath.Base(file) + ":" + strconv.Itoa(line)
+		}
+		if f.Name() == "runtime.gopanic" {
+			panicking = true
+		}
+	}
+	return "unknown location"
+}
+
+// userPanic marks a panic raised by a method of the value being decoded
+// into, which handleDecodeErr lets through instead of recovering.
+type userPanic struct {
+	v interface{}
+}
+
+// callUser calls f, which calls a method of the value being decoded into,
+// marking any panic it raises as a userPanic.
+func callUser(f func() error) error {
+	defer func() {
+		if v := recover(); v != nil {
+			if _, ok := v.(userPanic); ok {
+				panic(v)
+			}
+			panic(userPanic{v})
+		}
+	}()
+	return f()
+}
+
+type yamlError struct {
+	err error
+}
+
+func fail(err error) {
+	panic(yamlError{err})
+}
+
+func failf(format string, args ...interface{}) {
+	panic(yamlError{fmt.Errorf("yaml: "+format, args...)})
+}
+
+func failCode(code ErrorCode, format string, args ...interface{}) {
+	panic(yamlError{&Error{Code: code, Message: fmt.Sprintf(format, args...)}})
+}
@@ -0,0 +1,485 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"io"
+	"strconv"
+)
+
+// An EventKind identifies the kind of an Event.
+type EventKind int
+
+const (
+	DocumentStartEvent EventKind = iota + 1
+	DocumentEndEvent
+	ScalarEvent
+	AliasEvent
+	SequenceStartEvent
+	SequenceEndEvent
+	MappingStartEvent
+	MappingEndEvent
+)
+
+var eventKindNames = []string{
+	DocumentStartEvent: "DocumentStart",
+	DocumentEndEvent:   "DocumentEnd",
+	ScalarEvent:        "Scalar",
+	AliasEvent:         "Alias",
+	SequenceStartEvent: "SequenceStart",
+	SequenceEndEvent:   "SequenceEnd",
+	MappingStartEvent:  "MappingStart",
+	MappingEndEvent:    "MappingEnd",
+}
+
+func (k EventKind) String() string {
+	if k > 0 && int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// An Event is a step in the parsing of a YAML stream. Events let a stream
+// be handled one value at a time, without building the Node tree of any
+// of its documents.
+type Event struct {
+	Kind EventKind
+
+	// Style holds the style of scalars and of the start of collections,
+	// as for Node, but without TaggedStyle.
+	Style Style
+
+	// Tag holds the tag written for a scalar or collection, in the short
+	// form of Node.Tag, or "" when there is none.
+	Tag string
+
+	// Value holds the value of a scalar, or the anchor an alias refers
+	// to.
+	Value string
+
+	// Anchor holds the anchor of a scalar or collection.
+	Anchor string
+
+	HeadComment string
+	LineComment string
+	FootComment string
+
+	// Implicit reports whether the "---" of a document start, or the
+	// "..." of a document end, is left out.
+	Implicit bool
+
+	// Directives holds the %YAML and %TAG directives of a document start,
+	// as for StreamDocument.
+	Directives []string
+
+	// Path holds the path of the value the event belongs to in its
+	// document, and Key reports whether the event starts a mapping key.
+	// The path of a key is the one of its value. These, Line and Column
+	// are set for the events read from the input, and are not needed for
+	// the events written.
+	Path Path
+	Key  bool
+
+	Line   int
+	Column int
+
+	// tail holds comments left after a mapping value, which the parser
+	// reports on their own, to be written ahead of this event.
+	tail []byte
+}
+
+// An EventFilter transforms the events of a stream. It is called with
+// each event in turn, and returns the events that take its place, which
+// may be none to drop it, or more than one to add others.
+type EventFilter func(e Event) ([]Event, error)
+
+// Pipe reads a YAML stream from r, passes each of its events through the
+// filters in order, and writes the events the last one returns to w. The
+// stream is transformed one event at a time, so inputs of any size can be
+// rewritten without building their documents, such as to rename keys,
+// drop fields or add values.
+//
+// The events written must still make a valid stream. The first error
+// returned by a filter stops Pipe and is returned by it.
+func Pipe(w io.Writer, r io.Reader, filters ...EventFilter) (err error) {
+	defer handleErr(&err)
+	p := newParserFromReader(r)
+	defer p.destroy()
+	e := newEncoderWithWriter(w)
+	defer e.destroy()
+	e.init()
+
+	var paths eventPaths
+	var tail []byte
+	for {
+		typ := p.peek()
+		switch typ {
+		case yaml_STREAM_START_EVENT:
+		case yaml_STREAM_END_EVENT:
+			e.finish()
+			return nil
+		case yaml_TAIL_COMMENT_EVENT:
+			tail = append([]byte(nil), p.event.foot_comment...)
+		default:
+			event := eventOf(&p.event)
+			event.Path, event.Key = paths.next(event.Kind, event.Value)
+			event.tail, tail = tail, nil
+			events, err := filterEvent(event, filters)
+			if err != nil {
+				return err
+			}
+			for i := range events {
+				e.setPath(events[i].Path)
+				events[i].yamlEvent(&e.event)
+				e.emit()
+			}
+		}
+		p.expect(typ)
+	}
+}
+
+// EventsFromNode returns the events that write n, the way an Encoder
+// writes it, with their paths within n. For a DocumentNode, these start
+// and end the document.
+func EventsFromNode(n *Node) (events []Event, err error) {
+	defer handleErr(&err)
+	if n == nil {
+		n = &Node{}
+	}
+	e := newEncoder()
+	defer e.destroy()
+	e.capture = true
+	e.node(n, "")
+	var paths eventPaths
+	for i := range e.events {
+		event := eventOf(&e.events[i])
+		event.Path, event.Key = paths.next(event.Kind, event.Value)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// NodeFromEvents returns the node made of the events that next returns
+// in turn, the way a Decoder builds it, from the first event up to the
+// end of the value or document it starts. The function next returns
+// io.EOF when there are no more events, and NodeFromEvents returns io.EOF
+// as well if there were none, and any other error of next as it is.
+// Events that don't make a valid value, such as a MappingEnd after a key
+// or io.EOF within a sequence, are an error naming the unexpected event.
+func NodeFromEvents(next func() (Event, error)) (n *Node, err error) {
+	defer handleDecodeErr(&err)
+	p := newParser(nil)
+	defer p.destroy()
+	started := false
+	var pending *Event
+	var order eventOrder
+	p.source = func(out *yaml_event_t) {
+		if !started {
+			started = true
+			yaml_stream_start_event_initialize(out, yaml_UTF8_ENCODING)
+			return
+		}
+		if pending != nil {
+			pending.yamlEvent(out)
+			pending = nil
+			return
+		}
+		e, err := next()
+		if err == io.EOF {
+			if len(order.open) > 0 {
+				failf("unexpected end of events %s", order.open[len(order.open)-1].where())
+			}
+			yaml_stream_end_event_initialize(out)
+			return
+		} else if err != nil {
+			fail(err)
+		}
+		order.next(e.Kind)
+		if len(e.tail) > 0 {
+			// The comments after a mapping value come on their own,
+			// as from the parser.
+			*out = yaml_event_t{typ: yaml_TAIL_COMMENT_EVENT, foot_comment: e.tail}
+			e.tail = nil
+			pending = &e
+			return
+		}
+		e.yamlEvent(out)
+	}
+	p.init()
+	if n = p.parse(); n == nil {
+		return nil, io.EOF
+	}
+	return n, nil
+}
+
+// eventOrder checks that the events given to NodeFromEvents make a single
+// value or document, so that these are caller errors rather than
+// internal ones of the parser.
+type eventOrder struct {
+	// open holds the documents and collections started and not ended.
+	open []openEvent
+}
+
+// An openEvent is a document or collection started, with the number of
+// values it holds so far.
+type openEvent struct {
+	kind   EventKind
+	values int
+}
+
+// where describes the place of the next event within o.
+func (o openEvent) where() string {
+	switch {
+	case o.kind == DocumentStartEvent:
+		return "in a document"
+	case o.kind == SequenceStartEvent:
+		return "in a sequence"
+	case o.values%2 == 1:
+		return "after a mapping key"
+	}
+	return "in a mapping"
+}
+
+// next checks that an event of kind k may come next, and fails if not.
+func (o *eventOrder) next(k EventKind) {
+	var top *openEvent
+	if len(o.open) > 0 {
+		top = &o.open[len(o.open)-1]
+	}
+	ok := false
+	switch k {
+	case DocumentStartEvent:
+		ok = top == nil
+	case DocumentEndEvent:
+		ok = top != nil && top.kind == DocumentStartEvent && top.values == 1
+	case SequenceEndEvent:
+		ok = top != nil && top.kind == SequenceStartEvent
+	case MappingEndEvent:
+		ok = top != nil && top.kind == MappingStartEvent && top.values%2 == 0
+	case ScalarEvent, AliasEvent, SequenceStartEvent, MappingStartEvent:
+		ok = top == nil || top.kind != DocumentStartEvent || top.values == 0
+	}
+	if !ok {
+		where := "at the start"
+		if top != nil {
+			where = top.where()
+		}
+		failf("unexpected %s event %s", k, where)
+	}
+	switch k {
+	case DocumentEndEvent, SequenceEndEvent, MappingEndEvent:
+		o.open = o.open[:len(o.open)-1]
+		return
+	}
+	if top != nil {
+		top.values++
+	}
+	switch k {
+	case DocumentStartEvent, SequenceStartEvent, MappingStartEvent:
+		o.open = append(o.open, openEvent{kind: k})
+	}
+}
+
+// filterEvent passes e through the filters in order.
+func filterEvent(e Event, filters []EventFilter) ([]Event, error) {
+	events := []Event{e}
+	for _, f := range filters {
+		var next []Event
+		for _, e := range events {
+			out, err := f(e)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		events = next
+	}
+	return events, nil
+}
+
+// eventOf returns the Event for the parser event e.
+func eventOf(e *yaml_event_t) Event {
+	event := Event{
+		Anchor:      string(e.anchor),
+		HeadComment: string(e.head_comment),
+		LineComment: string(e.line_comment),
+		FootComment: string(e.foot_comment),
+		Implicit:    e.implicit,
+		tail:        e.tail_comment,
+		Line:        e.start_mark.line + 1,
+		Column:      e.start_mark.column + 1,
+	}
+	if len(e.tag) > 0 {
+		event.Tag = shortTag(string(e.tag))
+	}
+	switch e.typ {
+	case yaml_DOCUMENT_START_EVENT:
+		event.Kind = DocumentStartEvent
+		event.Directives = directivesOf(e)
+	case yaml_DOCUMENT_END_EVENT:
+		event.Kind = DocumentEndEvent
+	case yaml_ALIAS_EVENT:
+		event.Kind = AliasEvent
+		event.Value, event.Anchor = event.Anchor, ""
+	case yaml_SCALAR_EVENT:
+		event.Kind = ScalarEvent
+		event.Value = string(e.value)
+		switch e.scalar_style() {
+		case yaml_DOUBLE_QUOTED_SCALAR_STYLE:
+			event.Style = DoubleQuotedStyle
+		case yaml_SINGLE_QUOTED_SCALAR_STYLE:
+			event.Style = SingleQuotedStyle
+		case yaml_LITERAL_SCALAR_STYLE:
+			event.Style = LiteralStyle
+		case yaml_FOLDED_SCALAR_STYLE:
+			event.Style = FoldedStyle
+		}
+	case yaml_SEQUENCE_START_EVENT:
+		event.Kind = SequenceStartEvent
+		if e.sequence_style() == yaml_FLOW_SEQUENCE_STYLE {
+			event.Style = FlowStyle
+		}
+	case yaml_SEQUENCE_END_EVENT:
+		event.Kind = SequenceEndEvent
+	case yaml_MAPPING_START_EVENT:
+		event.Kind = MappingStartEvent
+		if e.mapping_style() == yaml_FLOW_MAPPING_STYLE {
+			event.Style = FlowStyle
+		}
+	case yaml_MAPPING_END_EVENT:
+		event.Kind = MappingEndEvent
+	}
+	return event
+}
+
+// yamlEvent sets out to the emitter event for e.
+func (e *Event) yamlEvent(out *yaml_event_t) {
+	tag := e.Tag
+	if tag != "" {
+		tag = longTag(tag)
+	}
+	implicit := tag == ""
+	switch e.Kind {
+	case DocumentStartEvent:
+		var version *yaml_version_directive_t
+		var tags []yaml_tag_directive_t
+		for _, d := range e.Directives {
+			addDirective(&version, &tags, d)
+		}
+		yaml_document_start_event_initialize(out, version, tags, e.Implicit)
+	case DocumentEndEvent:
+		yaml_document_end_event_initialize(out, e.Implicit)
+	case ScalarEvent:
+		style := yaml_PLAIN_SCALAR_STYLE
+		switch {
+		case e.Style&DoubleQuotedStyle != 0:
+			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
+		case e.Style&SingleQuotedStyle != 0:
+			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+		case e.Style&LiteralStyle != 0:
+			style = yaml_LITERAL_SCALAR_STYLE
+		case e.Style&FoldedStyle != 0:
+			style = yaml_FOLDED_SCALAR_STYLE
+		}
+		yaml_scalar_event_initialize(out, []byte(e.Anchor), []byte(tag), []byte(e.Value), implicit, implicit, style)
+	case AliasEvent:
+		yaml_alias_event_initialize(out, []byte(e.Value))
+	case SequenceStartEvent:
+		style := yaml_BLOCK_SEQUENCE_STYLE
+		if e.Style&FlowStyle != 0 {
+			style = yaml_FLOW_SEQUENCE_STYLE
+		}
+		yaml_sequence_start_event_initialize(out, []byte(e.Anchor), []byte(tag), implicit, style)
+	case SequenceEndEvent:
+		yaml_sequence_end_event_initialize(out)
+	case MappingStartEvent:
+		style := yaml_BLOCK_MAPPING_STYLE
+		if e.Style&FlowStyle != 0 {
+			style = yaml_FLOW_MAPPING_STYLE
+		}
+		yaml_mapping_start_event_initialize(out, []byte(e.Anchor), []byte(tag), implicit, style)
+	case MappingEndEvent:
+		yaml_mapping_end_event_initialize(out)
+	default:
+		failf("cannot write event of unknown kind %d", e.Kind)
+	}
+	out.start_mark = yaml_mark_t{line: e.Line - 1, column: e.Column - 1}
+	out.end_mark = out.start_mark
+	out.head_comment = []byte(e.HeadComment)
+	out.line_comment = []byte(e.LineComment)
+	out.foot_comment = []byte(e.FootComment)
+	out.tail_comment = e.tail
+}
+
+// eventPaths tracks the path of the events of a document.
+type eventPaths struct {
+	stack []eventFrame
+}
+
+type eventFrame struct {
+	path    Path
+	mapping bool
+	n       int    // The number of keys and values or items seen.
+	key     string // The last key of a mapping.
+}
+
+// next returns the path of the next event, of the given kind and value,
+// and whether it starts a mapping key.
+func (t *eventPaths) next(kind EventKind, value string) (path Path, key bool) {
+	switch kind {
+	case DocumentStartEvent, DocumentEndEvent:
+		t.stack = t.stack[:0]
+		return nil, false
+	case SequenceEndEvent, MappingEndEvent:
+		path = t.stack[len(t.stack)-1].path
+		t.stack = t.stack[:len(t.stack)-1]
+		t.done()
+		return path, false
+	}
+	if len(t.stack) > 0 {
+		f := &t.stack[len(t.stack)-1]
+		switch {
+		case !f.mapping:
+			path = f.path.Index(f.n)
+		case f.n%2 == 0:
+			key = true
+			f.key = ""
+			if kind == ScalarEvent {
+				f.key = value
+			}
+			path = f.path.Key(f.key)
+		default:
+			path = f.path.Key(f.key)
+		}
+	}
+	switch kind {
+	case SequenceStartEvent, MappingStartEvent:
+		t.stack = append(t.stack, eventFrame{path: path, mapping: kind == MappingStartEvent})
+	default:
+		t.done()
+	}
+	return path, key
+}
+
+// done counts a value finished in the collection holding it.
+func (t *eventPaths) done() {
+	if len(t.stack) > 0 {
+		t.stack[len(t.stack)-1].n++
+	}
+}
@@ -0,0 +1,271 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+var pipeInput = `# head
+a: 1 # line
+b:
+    c: [1, 2]
+    d: |
+        text
+    # foot of d
+e: &x 'q'
+f: *x
+---
+- !!str 3
+- {k: v}
+`
+
+func (s *S) TestPipe(c *C) {
+	var buf bytes.Buffer
+	c.Assert(yaml.Pipe(&buf, strings.NewReader(pipeInput)), IsNil)
+	c.Assert(buf.String(), Equals, pipeInput)
+
+	var events []string
+	buf.Reset()
+	err := yaml.Pipe(&buf, strings.NewReader(pipeInput), func(e yaml.Event) ([]yaml.Event, error) {
+		events = append(events, e.Kind.String()+" "+e.Value+" "+e.Path.String())
+		return []yaml.Event{e}, nil
+	}, func(e yaml.Event) ([]yaml.Event, error) {
+		switch {
+		case len(e.Path) >= 2 && e.Path[:2].String() == "b.c":
+			return nil, nil
+		case e.Key && e.Value == "a":
+			e.Value = "renamed"
+		case e.Kind == yaml.MappingEndEvent && len(e.Path) == 0:
+			return []yaml.Event{{Kind: yaml.ScalarEvent, Value: "added"}, {Kind: yaml.ScalarEvent, Value: "yes"}, e}, nil
+		}
+		return []yaml.Event{e}, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, `# head
+renamed: 1 # line
+b:
+    d: |
+        text
+    # foot of d
+e: &x 'q'
+f: *x
+added: yes
+---
+- !!str 3
+- {k: v}
+`)
+	c.Assert(events[:12], DeepEquals, []string{
+		"DocumentStart  ",
+		"MappingStart  ",
+		"Scalar a a",
+		"Scalar 1 a",
+		"Scalar b b",
+		"MappingStart  b",
+		"Scalar c b.c",
+		"SequenceStart  b.c",
+		"Scalar 1 b.c[0]",
+		"Scalar 2 b.c[1]",
+		"SequenceEnd  b.c",
+		"Scalar d b.d",
+	})
+}
+
+func (s *S) TestPipeDirectives(c *C) {
+	in := "%YAML 1.1\n%TAG !e! tag:example.com,2000:\n---\na: !e!foo 1\n---\nb: 2\n"
+	var buf bytes.Buffer
+	var directives [][]string
+	err := yaml.Pipe(&buf, strings.NewReader(in), func(e yaml.Event) ([]yaml.Event, error) {
+		if e.Kind == yaml.DocumentStartEvent {
+			directives = append(directives, e.Directives)
+		}
+		return []yaml.Event{e}, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "%YAML 1.1\n%TAG !e! tag:example.com,2000:\n---\na: !e!foo 1\n---\nb: 2\n")
+	c.Assert(directives, DeepEquals, [][]string{{"%YAML 1.1", "%TAG !e! tag:example.com,2000:"}, nil})
+
+	// Directives may be set by filters too.
+	buf.Reset()
+	err = yaml.Pipe(&buf, strings.NewReader("a: !<tag:example.com,2000:foo> 1\n"), func(e yaml.Event) ([]yaml.Event, error) {
+		if e.Kind == yaml.DocumentStartEvent {
+			e.Directives = []string{"%TAG !e! tag:example.com,2000:"}
+		}
+		return []yaml.Event{e}, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "%TAG !e! tag:example.com,2000:\n---\na: !e!foo 1\n")
+}
+
+func (s *S) TestPipeErrors(c *C) {
+	var buf bytes.Buffer
+	errStop := errors.New("stop")
+	err := yaml.Pipe(&buf, strings.NewReader(pipeInput), func(e yaml.Event) ([]yaml.Event, error) {
+		if e.Kind == yaml.AliasEvent {
+			return nil, errStop
+		}
+		return []yaml.Event{e}, nil
+	})
+	c.Assert(err, Equals, errStop)
+
+	err = yaml.Pipe(&buf, strings.NewReader("a: [1, 2]\n"), func(e yaml.Event) ([]yaml.Event, error) {
+		if e.Kind == yaml.ScalarEvent && !e.Key {
+			e.Anchor = "bad anchor"
+		}
+		return []yaml.Event{e}, nil
+	})
+	c.Assert(err, ErrorMatches, `yaml: output line 1, column 1, at a\[0\]: anchor value must contain alphanumerical characters only`)
+
+	err = yaml.Pipe(&buf, strings.NewReader("a: [1"))
+	c.Assert(err, ErrorMatches, "yaml: line 1: did not find expected ',' or ']'")
+}
+
+// eventSource returns a function giving the events in turn, as taken by
+// NodeFromEvents.
+func eventSource(events []yaml.Event) func() (yaml.Event, error) {
+	return func() (yaml.Event, error) {
+		if len(events) == 0 {
+			return yaml.Event{}, io.EOF
+		}
+		e := events[0]
+		events = events[1:]
+		return e, nil
+	}
+}
+
+func (s *S) TestEventsFromNode(c *C) {
+	in := "# head\na: 1 # line\nb:\n    c: [1, 2]\n    d: |\n        text\n    # foot of d\n# head e\ne: &x 'q'\nf: *x\n# foot\n"
+	var node yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(in), &node), IsNil)
+
+	events, err := yaml.EventsFromNode(&node)
+	c.Assert(err, IsNil)
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Kind.String()+" "+e.Value+" "+e.Path.String())
+	}
+	c.Assert(kinds, DeepEquals, []string{
+		"DocumentStart  ",
+		"MappingStart  ",
+		"Scalar a a",
+		"Scalar 1 a",
+		"Scalar b b",
+		"MappingStart  b",
+		"Scalar c b.c",
+		"SequenceStart  b.c",
+		"Scalar 1 b.c[0]",
+		"Scalar 2 b.c[1]",
+		"SequenceEnd  b.c",
+		"Scalar d b.d",
+		"Scalar text\n b.d",
+		"MappingEnd  b",
+		"Scalar e e",
+		"Scalar q e",
+		"Scalar f f",
+		"Alias x f",
+		"MappingEnd  ",
+		"DocumentEnd  ",
+	})
+	c.Assert(events[2].HeadComment, Equals, "# head")
+	c.Assert(events[3].LineComment, Equals, "# line")
+
+	back, err := yaml.NodeFromEvents(eventSource(events))
+	c.Assert(err, IsNil)
+	c.Assert(back.Kind, Equals, yaml.DocumentNode)
+	data, err := yaml.Marshal(back)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, in)
+}
+
+func (s *S) TestNodeFromEvents(c *C) {
+	// Splice a streamed value into a tree.
+	var tree yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("spec:\n    replicas: 1\n"), &tree), IsNil)
+	events := []yaml.Event{
+		{Kind: yaml.SequenceStartEvent, Style: yaml.FlowStyle},
+		{Kind: yaml.ScalarEvent, Value: "a", Anchor: "x"},
+		{Kind: yaml.ScalarEvent, Value: "2", Tag: "!!str"},
+		{Kind: yaml.AliasEvent, Value: "x"},
+		{Kind: yaml.SequenceEndEvent},
+		{Kind: yaml.ScalarEvent, Value: "left over"},
+	}
+	next := eventSource(events)
+	value, err := yaml.NodeFromEvents(next)
+	c.Assert(err, IsNil)
+	c.Assert(value.Kind, Equals, yaml.SequenceNode)
+	c.Assert(value.Content[1].Tag, Equals, "!!str")
+	c.Assert(value.Content[2].Alias, Equals, value.Content[0])
+	spec := tree.Content[0].Content[1]
+	spec.Content = append(spec.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "args"}, value)
+	data, err := yaml.Marshal(&tree)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "spec:\n    replicas: 1\n    args: [&x a, !!str 2, *x]\n")
+
+	// The next value is left to the next call.
+	value, err = yaml.NodeFromEvents(next)
+	c.Assert(err, IsNil)
+	c.Assert(value.Value, Equals, "left over")
+	_, err = yaml.NodeFromEvents(next)
+	c.Assert(err, Equals, io.EOF)
+
+	errStop := errors.New("stop")
+	_, err = yaml.NodeFromEvents(func() (yaml.Event, error) { return yaml.Event{}, errStop })
+	c.Assert(err, Equals, errStop)
+	_, err = yaml.NodeFromEvents(eventSource([]yaml.Event{{Kind: yaml.AliasEvent, Value: "x"}}))
+	c.Assert(err, ErrorMatches, "yaml: unknown anchor 'x' referenced")
+}
+
+var nodeFromEventsErrorTests = []struct {
+	events []yaml.Event
+	error  string
+}{{
+	events: []yaml.Event{{Kind: yaml.MappingEndEvent}},
+	error:  "yaml: unexpected MappingEnd event at the start",
+}, {
+	events: []yaml.Event{{Kind: yaml.SequenceStartEvent}, {Kind: yaml.MappingEndEvent}},
+	error:  "yaml: unexpected MappingEnd event in a sequence",
+}, {
+	events: []yaml.Event{{Kind: yaml.MappingStartEvent}, {Kind: yaml.ScalarEvent, Value: "a"}, {Kind: yaml.MappingEndEvent}},
+	error:  "yaml: unexpected MappingEnd event after a mapping key",
+}, {
+	events: []yaml.Event{{Kind: yaml.MappingStartEvent}, {Kind: yaml.DocumentEndEvent}},
+	error:  "yaml: unexpected DocumentEnd event in a mapping",
+}, {
+	events: []yaml.Event{{Kind: yaml.DocumentStartEvent}, {Kind: yaml.ScalarEvent}, {Kind: yaml.ScalarEvent}},
+	error:  "yaml: unexpected Scalar event in a document",
+}, {
+	events: []yaml.Event{{Kind: yaml.DocumentStartEvent}, {Kind: yaml.DocumentStartEvent}},
+	error:  "yaml: unexpected DocumentStart event in a document",
+}, {
+	events: []yaml.Event{{Kind: yaml.SequenceStartEvent}, {Kind: yaml.ScalarEvent}},
+	error:  "yaml: unexpected end of events in a sequence",
+}, {
+	events: []yaml.Event{{}},
+	error:  `yaml: unexpected EventKind\(0\) event at the start`,
+}}
+
+func (s *S) TestNodeFromEventsErrors(c *C) {
+	for _, t := range nodeFromEventsErrorTests {
+		_, err := yaml.NodeFromEvents(eventSource(t.events))
+		c.Assert(err, ErrorMatches, t.error)
+	}
+}
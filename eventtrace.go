@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+// EventTrace returns the events of the YAML stream in, one per line, in
+// the format of the test.event files of the YAML test suite:
+//
+//     +STR
+//     +DOC ---
+//     +MAP
+//     =VAL :key
+//     =VAL &a <tag:yaml.org,2002:str> 'value
+//     -MAP
+//     -DOC
+//     -STR
+//
+// When the stream is not valid YAML, the events before the error are
+// returned along with it.
+func EventTrace(in []byte) (trace string, err error) {
+	defer handleErr(&err)
+	var b []byte
+	defer func() { trace = string(b) }()
+
+	p := newParser(in)
+	defer p.destroy()
+	for {
+		e := &p.event
+		typ := p.peek()
+		switch typ {
+		case yaml_STREAM_START_EVENT:
+			b = append(b, "+STR"...)
+		case yaml_STREAM_END_EVENT:
+			b = append(b, "-STR\n"...)
+			return
+		case yaml_DOCUMENT_START_EVENT:
+			b = append(b, "+DOC"...)
+			if !e.implicit {
+				b = append(b, " ---"...)
+			}
+		case yaml_DOCUMENT_END_EVENT:
+			b = append(b, "-DOC"...)
+			if !e.implicit {
+				b = append(b, " ..."...)
+			}
+		case yaml_MAPPING_START_EVENT:
+			b = append(b, "+MAP"...)
+			if e.mapping_style() == yaml_FLOW_MAPPING_STYLE {
+				b = append(b, " {}"...)
+			}
+			b = appendProperties(b, e)
+		case yaml_MAPPING_END_EVENT:
+			b = append(b, "-MAP"...)
+		case yaml_SEQUENCE_START_EVENT:
+			b = append(b, "+SEQ"...)
+			if e.sequence_style() == yaml_FLOW_SEQUENCE_STYLE {
+				b = append(b, " []"...)
+			}
+			b = appendProperties(b, e)
+		case yaml_SEQUENCE_END_EVENT:
+			b = append(b, "-SEQ"...)
+		case yaml_SCALAR_EVENT:
+			b = append(b, "=VAL"...)
+			b = appendProperties(b, e)
+			switch e.scalar_style() {
+			case yaml_SINGLE_QUOTED_SCALAR_STYLE:
+				b = append(b, " '"...)
+			case yaml_DOUBLE_QUOTED_SCALAR_STYLE:
+				b = append(b, ` "`...)
+			case yaml_LITERAL_SCALAR_STYLE:
+				b = append(b, " |"...)
+			case yaml_FOLDED_SCALAR_STYLE:
+				b = append(b, " >"...)
+			default:
+				b = append(b, " :"...)
+			}
+			b = appendEscaped(b, e.value)
+		case yaml_ALIAS_EVENT:
+			b = append(b, "=ALI *"...)
+			b = append(b, e.anchor...)
+		}
+		b = append(b, '\n')
+		yaml_event_delete(e)
+		e.typ = yaml_NO_EVENT
+	}
+}
+
+func appendProperties(b []byte, e *yaml_event_t) []byte {
+	if len(e.anchor) > 0 {
+		b = append(b, " &"...)
+		b = append(b, e.anchor...)
+	}
+	if len(e.tag) > 0 {
+		b = append(b, " <"...)
+		b = append(b, e.tag...)
+		b = append(b, '>')
+	}
+	return b
+}
+
+// appendEscaped appends value with backslashes and the characters that
+// would break the line format escaped as the test suite does.
+func appendEscaped(b []byte, value []byte) []byte {
+	for _, c := range value {
+		switch c {
+		case '\\':
+			b = append(b, `\\`...)
+		case 0:
+			b = append(b, `\0`...)
+		case '\b':
+			b = append(b, `\b`...)
+		case '\n':
+			b = append(b, `\n`...)
+		case '\r':
+			b = append(b, `\r`...)
+		case '\t':
+			b = append(b, `\t`...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
@@ -0,0 +1,54 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+var eventTraceTests = []struct {
+	input string
+	trace string
+	error string
+}{{
+	input: "",
+	trace: "+STR\n-STR\n",
+}, {
+	input: "--- &a !!map\nk: &b !x 'v\\'\n? [a, *b]\n: |\n  l\t\n...\n",
+	trace: "+STR\n+DOC ---\n+MAP &a <tag:yaml.org,2002:map>\n=VAL :k\n=VAL &b <!x> 'v\\\\\n" +
+		"+SEQ []\n=VAL :a\n=ALI *b\n-SEQ\n=VAL |l\\t\\n\n-MAP\n-DOC ...\n-STR\n",
+}, {
+	input: "{a: \"\\0\"}\n---\n",
+	trace: "+STR\n+DOC\n+MAP {}\n=VAL :a\n=VAL \"\\0\n-MAP\n-DOC\n+DOC ---\n=VAL :\n-DOC\n-STR\n",
+}, {
+	input: "a: [b\n",
+	trace: "+STR\n+DOC\n+MAP\n=VAL :a\n+SEQ []\n=VAL :b\n",
+	error: "yaml: line 1: did not find expected ',' or ']'",
+}}
+
+func (s *S) TestEventTrace(c *C) {
+	for i, item := range eventTraceTests {
+		c.Logf("test %d: %q", i, item.input)
+		trace, err := yaml.EventTrace([]byte(item.input))
+		if item.error != "" {
+			c.Assert(err, ErrorMatches, item.error)
+		} else {
+			c.Assert(err, IsNil)
+		}
+		c.Assert(trace, Equals, item.trace)
+	}
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+// A Match is a node found by FindAll or FindKey.
+type Match struct {
+	// Node is the node found, and Path its path within the node searched.
+	Node *Node
+	Path Path
+
+	// Key is the key of the mapping entry the node is the value of, or
+	// nil for the root node and sequence items.
+	Key *Node
+}
+
+// FindAll returns the nodes within n, n included, for which match returns
+// true, in document order, with their paths. The node n may be a
+// document node, whose content the paths start from. Mapping keys are not
+// searched, but aliases are followed, so nodes under an anchor are found
+// again at the paths of the aliases to it.
+func FindAll(n *Node, match func(n *Node, path Path) bool) []Match {
+	var matches []Match
+	walkValues(n, func(m Match) {
+		if match(m.Node, m.Path) {
+			matches = append(matches, m)
+		}
+	})
+	return matches
+}
+
+// FindKey returns the values of the mapping entries within n whose key is
+// a scalar with the given value, anywhere in n, as FindAll does.
+func FindKey(n *Node, key string) []Match {
+	var matches []Match
+	walkValues(n, func(m Match) {
+		if k := m.Key; k != nil && k.Kind == ScalarNode && k.Value == key {
+			matches = append(matches, m)
+		}
+	})
+	return matches
+}
+
+// walkValues calls fn with the nodes within n, n included, in document
+// order, following aliases and leaving mapping keys out.
+func walkValues(n *Node, fn func(m Match)) {
+	w := valueWalker{fn: fn, active: make(map[*Node]bool)}
+	if n != nil && n.Kind == DocumentNode {
+		for _, c := range n.Content {
+			w.walk(Match{Node: c})
+		}
+		return
+	}
+	w.walk(Match{Node: n})
+}
+
+type valueWalker struct {
+	fn func(m Match)
+
+	// active holds the nodes being walked, for aliases within their
+	// anchored value to be skipped.
+	active map[*Node]bool
+}
+
+func (w *valueWalker) walk(m Match) {
+	n := m.Node
+	if n == nil || w.active[n] {
+		return
+	}
+	w.fn(m)
+	w.active[n] = true
+	w.children(n, m.Path)
+	delete(w.active, n)
+}
+
+// children walks the items or entry values of n, found at path, or of
+// the node n is an alias of.
+func (w *valueWalker) children(n *Node, path Path) {
+	switch n.Kind {
+	case SequenceNode:
+		for i, c := range n.Content {
+			w.walk(Match{Node: c, Path: path.Index(i)})
+		}
+	case MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			w.walk(Match{Node: n.Content[i+1], Path: path.Key(k.Value), Key: k})
+		}
+	case AliasNode:
+		if a := n.Alias; a != nil && !w.active[a] {
+			w.active[a] = true
+			w.children(a, path)
+			delete(w.active, a)
+		}
+	}
+}
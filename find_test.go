@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestFindAll(c *C) {
+	var n yaml.Node
+	in := "a: 1\nb: [x, 2]\nc: &c {d: 3}\ne: *c\n"
+	c.Assert(yaml.Unmarshal([]byte(in), &n), IsNil)
+	matches := yaml.FindAll(&n, func(n *yaml.Node, path yaml.Path) bool {
+		return n.ShortTag() == "!!int"
+	})
+	var paths []string
+	for _, m := range matches {
+		paths = append(paths, m.Path.String()+"="+m.Node.Value)
+	}
+	c.Assert(paths, DeepEquals, []string{"a=1", "b[1]=2", "c.d=3", "e.d=3"})
+	c.Assert(matches[0].Key.Value, Equals, "a")
+	c.Assert(matches[1].Key, IsNil)
+
+	matches = yaml.FindAll(n.Content[0], func(n *yaml.Node, path yaml.Path) bool { return len(path) == 0 })
+	c.Assert(matches, DeepEquals, []yaml.Match{{Node: n.Content[0]}})
+}
+
+func (s *S) TestFindKey(c *C) {
+	var n yaml.Node
+	in := `
+spec:
+  containers:
+    - name: app
+      image: app:1
+    - name: side
+      image: side:2
+  image: {}
+image: top
+`
+	c.Assert(yaml.Unmarshal([]byte(in), &n), IsNil)
+	var paths []string
+	for _, m := range yaml.FindKey(&n, "image") {
+		paths = append(paths, m.Path.String())
+		c.Assert(m.Key.Value, Equals, "image")
+	}
+	c.Assert(paths, DeepEquals, []string{"spec.containers[0].image", "spec.containers[1].image", "spec.image", "image"})
+	c.Assert(yaml.FindKey(&n, "missing"), HasLen, 0)
+}
@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+// A Leaf is a value of a document that holds no other, as returned by
+// Flatten: a scalar, or an empty mapping or sequence.
+type Leaf struct {
+	// Path holds the path of the value in its document.
+	Path Path
+
+	// Node is the node of the value, or of the alias to it.
+	Node *Node
+
+	// Value holds the text of a scalar, or "{}" or "[]" for an empty
+	// mapping or sequence.
+	Value string
+
+	// Tag holds the type of the value, as a short tag such as "!!str",
+	// "!!int" or "!!map".
+	Tag string
+}
+
+// Flatten returns the leaves of n in document order, with their paths.
+// The node n may be a document node, whose content the paths start from,
+// and aliases on the way are followed. The string forms of the paths,
+// which join keys with dots and write indexes within brackets, make keys
+// for flat stores of configuration such as environment variables or
+// properties files, and the tags tell the types of the values.
+func Flatten(n *Node) []Leaf {
+	var leaves []Leaf
+	walkValues(n, func(m Match) {
+		v := m.Node
+		for v.Kind == AliasNode && v.Alias != nil {
+			v = v.Alias
+		}
+		leaf := Leaf{Path: m.Path, Node: m.Node, Tag: v.ShortTag()}
+		switch {
+		case v.Kind == ScalarNode:
+			leaf.Value = v.Value
+		case v.Kind == MappingNode && len(v.Content) == 0:
+			leaf.Value = "{}"
+		case v.Kind == SequenceNode && len(v.Content) == 0:
+			leaf.Value = "[]"
+		default:
+			return
+		}
+		leaves = append(leaves, leaf)
+	})
+	return leaves
+}
+
+// FlattenStrings returns the text of the leaves of n by the string form
+// of their paths, as Flatten finds them.
+func FlattenStrings(n *Node) map[string]string {
+	m := make(map[string]string)
+	for _, leaf := range Flatten(n) {
+		m[leaf.Path.String()] = leaf.Value
+	}
+	return m
+}
+
+// FlattenValues returns the leaves of n decoded into interface{} values
+// by the string form of their paths, as Flatten finds them. An empty
+// mapping is a map[string]interface{} and an empty sequence a
+// []interface{}. The error is the one of the first leaf that cannot be
+// decoded.
+func FlattenValues(n *Node) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for _, leaf := range Flatten(n) {
+		var v interface{}
+		if err := leaf.Node.Decode(&v); err != nil {
+			return nil, err
+		}
+		m[leaf.Path.String()] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+const flattenDoc = `
+server:
+  host: example.com
+  port: 8080
+  tls: {cert: /etc/cert, enabled: true}
+list: [a, 1.5, ~]
+empty: {}
+none: []
+"a.b": x
+base: &b {k: v}
+copy: *b
+`
+
+func (s *S) TestFlatten(c *C) {
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(flattenDoc), &n), IsNil)
+	var got []string
+	for _, leaf := range yaml.Flatten(&n) {
+		got = append(got, leaf.Path.String()+" "+leaf.Tag+" "+leaf.Value)
+	}
+	c.Assert(got, DeepEquals, []string{
+		"server.host !!str example.com",
+		"server.port !!int 8080",
+		"server.tls.cert !!str /etc/cert",
+		"server.tls.enabled !!bool true",
+		"list[0] !!str a",
+		"list[1] !!float 1.5",
+		"list[2] !!null ~",
+		"empty !!map {}",
+		"none !!seq []",
+		`["a.b"] !!str x`,
+		"base.k !!str v",
+		"copy.k !!str v",
+	})
+}
+
+func (s *S) TestFlattenStrings(c *C) {
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("a: {b: 1, c: [x]}\n"), &n), IsNil)
+	c.Assert(yaml.FlattenStrings(&n), DeepEquals, map[string]string{"a.b": "1", "a.c[0]": "x"})
+}
+
+func (s *S) TestFlattenValues(c *C) {
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(flattenDoc), &n), IsNil)
+	m, err := yaml.FlattenValues(&n)
+	c.Assert(err, IsNil)
+	c.Assert(m["server.port"], Equals, 8080)
+	c.Assert(m["server.tls.enabled"], Equals, true)
+	c.Assert(m["list[1]"], Equals, 1.5)
+	c.Assert(m["list[2]"], IsNil)
+	c.Assert(m["empty"], DeepEquals, map[string]interface{}{})
+	c.Assert(m["none"], DeepEquals, []interface{}{})
+	c.Assert(m, HasLen, 12)
+
+	c.Assert(yaml.Unmarshal([]byte("a: !!int x\n"), &n), IsNil)
+	_, err = yaml.FlattenValues(&n)
+	c.Assert(err, ErrorMatches, "yaml: cannot decode !!str `x` as a !!int")
+}
@@ -0,0 +1,45 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package yaml_test
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FuzzUnmarshal checks that no input makes decoding fail internally.
+func FuzzUnmarshal(f *testing.F) {
+	for _, item := range unmarshalTests {
+		f.Add([]byte(item.data))
+	}
+	for _, item := range unmarshalErrorTests {
+		f.Add([]byte(item.data))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); yaml.CodeOf(err) == yaml.ErrCodeInternal {
+			t.Fatal(err)
+		}
+		var n yaml.Node
+		if err := yaml.Unmarshal(data, &n); yaml.CodeOf(err) == yaml.ErrCodeInternal {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18 && !yaml_noreflect
+// +build go1.18,!yaml_noreflect
+
+package yaml
+
+// UnmarshalTo decodes the first document found within data into a new
+// value of type T and returns it.
+//
+// See the documentation for Unmarshal for details about the
+// conversion of YAML into a Go value.
+func UnmarshalTo[T any](data []byte) (T, error) {
+	var v T
+	err := Unmarshal(data, &v)
+	return v, err
+}
+
+// DecodeTo reads the next YAML-encoded value from the input of dec into
+// a new value of type T and returns it. It returns io.EOF when there are
+// no more documents, as Decoder.Decode does. Go methods cannot have type
+// parameters, which is why this isn't a method of Decoder.
+func DecodeTo[T any](dec *Decoder) (T, error) {
+	var v T
+	err := dec.Decode(&v)
+	return v, err
+}
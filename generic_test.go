@@ -0,0 +1,55 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package yaml_test
+
+import (
+	"io"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestUnmarshalTo(c *C) {
+	m, err := yaml.UnmarshalTo[map[string]int]([]byte("a: 1\nb: 2\n"))
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string]int{"a": 1, "b": 2})
+
+	v, err := yaml.UnmarshalTo[struct{ A []string }]([]byte("a: [x, y]\n"))
+	c.Assert(err, IsNil)
+	c.Assert(v.A, DeepEquals, []string{"x", "y"})
+
+	n, err := yaml.UnmarshalTo[int]([]byte("x"))
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `x` into int")
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestDecodeTo(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("1\n---\n[2]\n"))
+	n, err := yaml.DecodeTo[int](dec)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	l, err := yaml.DecodeTo[[]int](dec)
+	c.Assert(err, IsNil)
+	c.Assert(l, DeepEquals, []int{2})
+
+	_, err = yaml.DecodeTo[[]int](dec)
+	c.Assert(err, Equals, io.EOF)
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"io"
+	"strconv"
+)
+
+// SpanKind classifies the text covered by a Span.
+type SpanKind int
+
+const (
+	SpanKey       SpanKind = iota + 1 // A scalar used as a mapping key.
+	SpanValue                         // Any other scalar.
+	SpanAnchor                        // An anchor, as in &name.
+	SpanAlias                         // An alias, as in *name.
+	SpanTag                           // A tag, as in !!str.
+	SpanComment                       // A comment, from # to the end of the line.
+	SpanDocument                      // A document marker, --- or ...
+	SpanDirective                     // A directive, as in %YAML 1.2.
+	SpanIndicator                     // A structural indicator, as in - : ? [ ] { } ,
+	SpanError                         // The input from where it stopped making sense.
+)
+
+var spanKindNames = []string{
+	SpanKey:       "key",
+	SpanValue:     "value",
+	SpanAnchor:    "anchor",
+	SpanAlias:     "alias",
+	SpanTag:       "tag",
+	SpanComment:   "comment",
+	SpanDocument:  "document",
+	SpanDirective: "directive",
+	SpanIndicator: "indicator",
+	SpanError:     "error",
+}
+
+func (k SpanKind) String() string {
+	if k > 0 && int(k) < len(spanKindNames) {
+		return spanKindNames[k]
+	}
+	return "SpanKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Span is a classified range of bytes in the input given to Highlight.
+type Span struct {
+	Kind  SpanKind
+	Start int // The offset of the first byte.
+	End   int // The offset after the last byte.
+}
+
+// Highlight classifies the text of in for syntax highlighting, without
+// building any values from it. The returned spans are ordered, do not
+// overlap, and leave out blanks, line breaks and the byte order mark.
+//
+// Highlight looks at the tokens of the input only, so it reports some
+// documents as valid that Unmarshal rejects. Where the input cannot be
+// tokenized, the rest of it is reported as a single SpanError.
+func Highlight(in []byte) []Span {
+	var parser yaml_parser_t
+	yaml_parser_initialize(&parser)
+	yaml_parser_set_input_string(&parser, in)
+	defer yaml_parser_delete(&parser)
+
+	h := highlighter{in: in, unit: 1}
+	var token yaml_token_t
+	for {
+		if !yaml_parser_scan(&parser, &token) {
+			// Tokens scanned ahead of the problem are still good.
+			for _, t := range parser.tokens[parser.tokens_head:] {
+				h.token(&t)
+			}
+			offset := parser.problem_mark.offset
+			if parser.error == yaml_READER_ERROR {
+				offset = parser.problem_offset
+			} else if parser.context != "" {
+				// Such as the start of an unterminated quoted scalar.
+				offset = parser.context_mark.offset
+			}
+			if offset < h.pos {
+				offset = h.pos
+			}
+			h.comments(offset)
+			h.add(SpanError, offset, len(in))
+			return h.spans
+		}
+		if token.typ == yaml_STREAM_START_TOKEN && token.encoding != yaml_UTF8_ENCODING {
+			h.unit = 2
+			h.bigEndian = token.encoding == yaml_UTF16BE_ENCODING
+		}
+		h.token(&token)
+		if token.typ == yaml_STREAM_END_TOKEN {
+			h.comments(len(in))
+			return h.spans
+		}
+	}
+}
+
+// A Theme maps each kind of span to the parameters of the ANSI SGR
+// escape sequence that colors it, such as "1;34" for bold blue.
+// Kinds without an entry are not colored.
+type Theme map[SpanKind]string
+
+// DefaultTheme is a Theme that reads well on both dark and light
+// terminal backgrounds.
+var DefaultTheme = Theme{
+	SpanKey:       "34",
+	SpanValue:     "32",
+	SpanAnchor:    "35",
+	SpanAlias:     "35",
+	SpanTag:       "36",
+	SpanComment:   "90",
+	SpanDocument:  "1",
+	SpanDirective: "1",
+	SpanError:     "31",
+}
+
+// Fprint writes the YAML encoding of node to w, colored by theme with
+// ANSI escape sequences for display in a terminal. The encoding is the
+// one Marshal produces for node, keeping its styles and comments.
+func Fprint(w io.Writer, node *Node, theme Theme) error {
+	out, err := Marshal(node)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	pos := 0
+	for _, span := range Highlight(out) {
+		sgr, ok := theme[span.Kind]
+		if !ok {
+			continue
+		}
+		b = append(b, out[pos:span.Start]...)
+		b = append(b, "\x1b["...)
+		b = append(b, sgr...)
+		b = append(b, 'm')
+		b = append(b, out[span.Start:span.End]...)
+		b = append(b, "\x1b[0m"...)
+		pos = span.End
+	}
+	b = append(b, out[pos:]...)
+	_, err = w.Write(b)
+	return err
+}
+
+type highlighter struct {
+	in        []byte
+	spans     []Span
+	pos       int  // The offset up to which the input is classified.
+	key       bool // Whether the next scalar is a mapping key.
+	unit      int  // The size of a code unit of the input encoding.
+	bigEndian bool
+}
+
+func (h *highlighter) add(kind SpanKind, start, end int) {
+	if start < end {
+		h.spans = append(h.spans, Span{Kind: kind, Start: start, End: end})
+		h.pos = end
+	}
+}
+
+func (h *highlighter) token(token *yaml_token_t) {
+	start, end := token.start_mark.offset, token.end_mark.offset
+	if start < h.pos {
+		return
+	}
+	h.comments(start)
+
+	var kind SpanKind
+	switch token.typ {
+	case yaml_KEY_TOKEN:
+		h.key = true
+		kind = SpanIndicator
+	case yaml_SCALAR_TOKEN:
+		kind = SpanValue
+		if h.key {
+			kind = SpanKey
+		}
+		h.key = false
+		// Block scalars end after their trailing line breaks.
+		for end-h.unit > start && isSpace(h.char(end-h.unit)) {
+			end -= h.unit
+		}
+	case yaml_ALIAS_TOKEN:
+		kind = SpanAlias
+		h.key = false
+	case yaml_ANCHOR_TOKEN:
+		kind = SpanAnchor
+	case yaml_TAG_TOKEN:
+		kind = SpanTag
+	case yaml_VERSION_DIRECTIVE_TOKEN, yaml_TAG_DIRECTIVE_TOKEN:
+		kind = SpanDirective
+	case yaml_DOCUMENT_START_TOKEN, yaml_DOCUMENT_END_TOKEN:
+		kind = SpanDocument
+	case yaml_STREAM_START_TOKEN, yaml_STREAM_END_TOKEN:
+		return
+	default:
+		// Collection starts, ends and entries.
+		h.key = false
+		kind = SpanIndicator
+	}
+	h.add(kind, start, end)
+}
+
+// comments adds the comments found between the classified input and end,
+// which hold nothing else but blanks and line breaks.
+func (h *highlighter) comments(end int) {
+	for i := h.pos; i+h.unit <= end; i += h.unit {
+		if h.char(i) != '#' {
+			continue
+		}
+		j := i
+		for j+h.unit <= end && h.char(j) != '\r' && h.char(j) != '\n' {
+			j += h.unit
+		}
+		h.add(SpanComment, i, j)
+		i = j
+	}
+}
+
+func isSpace(c int) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// char returns the code unit at offset i of the input.
+func (h *highlighter) char(i int) int {
+	switch {
+	case h.unit == 1:
+		return int(h.in[i])
+	case h.bigEndian:
+		return int(h.in[i])<<8 | int(h.in[i+1])
+	}
+	return int(h.in[i+1])<<8 | int(h.in[i])
+}
@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+var highlightTests = []struct {
+	input string
+	want  []string
+}{{
+	input: "# head\na: &x !!str b # line\nc:\n- *x\n",
+	want: []string{
+		`comment "# head"`, `key "a"`, `indicator ":"`, `anchor "&x"`, `tag "!!str"`, `value "b"`, `comment "# line"`,
+		`key "c"`, `indicator ":"`, `indicator "-"`, `alias "*x"`,
+	},
+}, {
+	input: "%YAML 1.2\n---\n? k\n: {q: 'v', r}\n...\n",
+	want: []string{
+		`directive "%YAML 1.2"`, `document "---"`, `indicator "?"`, `key "k"`, `indicator ":"`,
+		`indicator "{"`, `key "q"`, `indicator ":"`, `value "'v'"`, `indicator ","`, `value "r"`, `indicator "}"`,
+		`document "..."`,
+	},
+}, {
+	input: "z: |\n  lit\n\n# foot\n",
+	want:  []string{`key "z"`, `indicator ":"`, `value "|\n  lit"`, `comment "# foot"`},
+}, {
+	input: "a: 'b\n# c\n",
+	want:  []string{`key "a"`, `indicator ":"`, `error "'b\n# c\n"`},
+}, {
+	input: "a: \"b\x01\"\n",
+	want:  []string{`key "a"`, `indicator ":"`, `error "\x01\"\n"`},
+}, {
+	input: "\xff\xfea\x00:\x00 \x00#\x00\n\x00",
+	want:  []string{`key "a\x00"`, `indicator ":\x00"`, `comment "#\x00"`},
+}}
+
+func (s *S) TestHighlight(c *C) {
+	for i, item := range highlightTests {
+		c.Logf("test %d: %q", i, item.input)
+		var got []string
+		for _, span := range yaml.Highlight([]byte(item.input)) {
+			got = append(got, fmt.Sprintf("%s %q", span.Kind, item.input[span.Start:span.End]))
+		}
+		c.Assert(got, DeepEquals, item.want)
+	}
+}
+
+func (s *S) TestFprint(c *C) {
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte("# head\na: [&x 1, *x] # line\n"), &node)
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	err = yaml.Fprint(&buf, &node, yaml.Theme{yaml.SpanKey: "1;34", yaml.SpanComment: "90"})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "\x1b[90m# head\x1b[0m\n\x1b[1;34ma\x1b[0m: [&x 1, *x] \x1b[90m# line\x1b[0m\n")
+
+	buf.Reset()
+	err = yaml.Fprint(&buf, &node, nil)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "# head\na: [&x 1, *x] # line\n")
+}
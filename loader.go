@@ -0,0 +1,314 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Loader decodes configuration layered from a list of YAML sources, in
+// which later sources take precedence over earlier ones, such as defaults
+// built into a program, then a system-wide file, then a user file. Every
+// document of a source is a layer of its own, in order.
+type Loader struct {
+	sources     []loaderSource
+	strategy    MergeStrategy
+	envPrefix   string
+	envLookup   func(name string) (string, bool)
+	knownFields bool
+}
+
+type loaderSource struct {
+	name string
+	read func() ([]byte, error)
+}
+
+// A MergeStrategy controls how a Loader merges the layers of
+// configuration.
+type MergeStrategy int
+
+const (
+	// MergeDeep merges mappings key by key, at any depth, and replaces
+	// any other value. This is the default.
+	MergeDeep MergeStrategy = iota + 1
+
+	// MergeAppend is like MergeDeep, but appends the items of sequences
+	// to the ones of the sequences they are merged with.
+	MergeAppend
+
+	// MergeShallow merges the mappings at the root of the layers key by
+	// key, and replaces the values of their keys as a whole.
+	MergeShallow
+)
+
+// An Origin tells where a value loaded by a Loader was set.
+type Origin struct {
+	// Source holds the name of the source, or of the environment
+	// variable with a "$" prefix.
+	Source string
+
+	// Line and Column hold the position of the value in the source,
+	// starting at 1, or 0 for an environment variable.
+	Line   int
+	Column int
+}
+
+// NewLoader returns a new Loader without any source.
+func NewLoader() *Loader {
+	return &Loader{strategy: MergeDeep}
+}
+
+// AddBytes adds the YAML data as the next source, under the given name.
+func (l *Loader) AddBytes(name string, data []byte) {
+	l.sources = append(l.sources, loaderSource{name, func() ([]byte, error) { return data, nil }})
+}
+
+// AddReader adds the YAML data read from r as the next source, under the
+// given name. The data is read by Load.
+func (l *Loader) AddReader(name string, r io.Reader) {
+	l.sources = append(l.sources, loaderSource{name, func() ([]byte, error) { return ioutil.ReadAll(r) }})
+}
+
+// AddFile adds the YAML file at path as the next source, named after
+// path. The file is read by Load.
+func (l *Loader) AddFile(path string) {
+	l.sources = append(l.sources, loaderSource{path, func() ([]byte, error) { return ioutil.ReadFile(path) }})
+}
+
+// SetMergeStrategy sets how the layers of configuration are merged.
+func (l *Loader) SetMergeStrategy(strategy MergeStrategy) {
+	l.strategy = strategy
+}
+
+// SetEnv has the values of the configuration overridden by environment
+// variables once the layers are merged. The variable for a value is named
+// after its path, with prefix and an underscore ahead of it, letters in
+// upper case, and any other character than a letter or digit replaced by
+// an underscore, as APP_SERVER_PORT for "server.port" with the prefix
+// APP, or APP_HOSTS_0 for "hosts[0]". Only the scalars and empty
+// collections set by the sources may be overridden, and the values of
+// variables are read as plain scalars. Variables are looked up with
+// lookup, or with os.LookupEnv if it's nil.
+func (l *Loader) SetEnv(prefix string, lookup func(name string) (string, bool)) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	l.envPrefix = prefix
+	l.envLookup = lookup
+}
+
+// KnownFields ensures that the keys in the configuration match fields of
+// the struct it is decoded into, as for Decoder.KnownFields.
+func (l *Loader) KnownFields(enable bool) {
+	l.knownFields = enable
+}
+
+// Load merges the layers of configuration and decodes the result into
+// the value pointed to by out, as Decode does. It returns the origins of
+// the values decoded by the string form of their paths, for the scalars
+// and empty collections of the configuration. Errors reading or parsing
+// a source are returned as a *LoadError naming it.
+func (l *Loader) Load(out interface{}) (origins map[string]Origin, err error) {
+	n, origins, err := l.LoadNode()
+	if err != nil {
+		return nil, err
+	}
+	defer handleDecodeErr(&err)
+	d := newDecoder()
+	d.knownFields = l.knownFields
+	v := reflect.ValueOf(out)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	d.unmarshal(n, v)
+	if len(d.terrors) > 0 {
+		return origins, newTypeError(d.terrors)
+	}
+	return origins, nil
+}
+
+// eachDocument calls f with the value of each document in data, skipping
+// the empty and null ones.
+func eachDocument(data []byte, f func(n *Node)) error {
+	dec := &Decoder{parser: newParser(data)}
+	defer dec.parser.destroy()
+	for {
+		var doc Node
+		if err := dec.Decode(&doc); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].ShortTag() == nullTag {
+			continue
+		}
+		f(doc.Content[0])
+	}
+}
+
+// LoadNode is like Load, but returns the document the layers merge into
+// rather than decoding it.
+func (l *Loader) LoadNode() (*Node, map[string]Origin, error) {
+	m := layerMerger{strategy: l.strategy, sources: make(map[*Node]string)}
+	var root *Node
+	for _, s := range l.sources {
+		data, err := s.read()
+		if err != nil {
+			return nil, nil, &LoadError{Source: s.name, Err: err}
+		}
+		err = eachDocument(data, func(n *Node) {
+			m.add(n, s.name)
+			root = m.merge(root, n, 0)
+		})
+		if err != nil {
+			return nil, nil, &LoadError{Source: s.name, Err: err}
+		}
+	}
+	if root == nil {
+		root = &Node{Kind: MappingNode, Tag: mapTag}
+	}
+	doc := &Node{Kind: DocumentNode, Content: []*Node{root}}
+	origins := make(map[string]Origin)
+	for _, leaf := range Flatten(doc) {
+		path := leaf.Path.String()
+		if l.envLookup != nil {
+			name := envName(l.envPrefix, leaf.Path)
+			if value, ok := l.envLookup(name); ok {
+				n := &Node{}
+				setLeaf(n, Leaf{Value: value})
+				if err := SetPath(doc, path, n); err != nil {
+					return nil, nil, err
+				}
+				origins[path] = Origin{Source: "$" + name}
+				continue
+			}
+		}
+		origins[path] = Origin{Source: m.sources[leaf.Node], Line: leaf.Node.Line, Column: leaf.Node.Column}
+	}
+	return doc, origins, nil
+}
+
+// envName returns the name of the environment variable for the value at
+// path, as described for Loader.SetEnv.
+func envName(prefix string, path Path) string {
+	var words []string
+	if prefix != "" {
+		words = append(words, prefix)
+	}
+	for _, e := range path {
+		if e.IsKey() {
+			words = append(words, e.Key)
+		} else {
+			words = append(words, strconv.Itoa(e.Index))
+		}
+	}
+	name := []byte(strings.Join(words, "_"))
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z':
+			name[i] = c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// A LoadError describes a source of a Loader that could not be read or
+// parsed. Its code is the one of Err.
+type LoadError struct {
+	// Source holds the name of the source.
+	Source string
+
+	// Err holds the error reading or parsing the source.
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return e.Source + ": " + e.Err.Error()
+}
+
+// Unwrap returns e.Err.
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// layerMerger merges layers of configuration.
+type layerMerger struct {
+	strategy MergeStrategy
+
+	// sources maps the nodes of the layers, and the mappings made by
+	// merging them, to the names of their sources.
+	sources map[*Node]string
+}
+
+// add records the nodes within n as coming from source.
+func (m *layerMerger) add(n *Node, source string) {
+	if _, ok := m.sources[n]; ok {
+		return
+	}
+	m.sources[n] = source
+	for _, c := range n.Content {
+		m.add(c, source)
+	}
+}
+
+// merge returns the layer src merged onto dst, at the given depth, with
+// neither of these changed.
+func (m *layerMerger) merge(dst, src *Node, depth int) *Node {
+	if dst == nil {
+		return src
+	}
+	d, s := dst, src
+	for d.Kind == AliasNode && d.Alias != nil {
+		d = d.Alias
+	}
+	for s.Kind == AliasNode && s.Alias != nil {
+		s = s.Alias
+	}
+	switch {
+	case d.Kind == MappingNode && s.Kind == MappingNode && (m.strategy != MergeShallow || depth == 0):
+		out := *d
+		out.Anchor = ""
+		out.Content = append([]*Node(nil), d.Content...)
+		for i := 0; i+1 < len(s.Content); i += 2 {
+			k, v := s.Content[i], s.Content[i+1]
+			if j := pathChild(&out, KeyElem(k.Value)); j >= 0 && k.Kind == ScalarNode {
+				out.Content[j] = m.merge(out.Content[j], v, depth+1)
+			} else {
+				out.Content = append(out.Content, k, v)
+			}
+		}
+		m.sources[&out] = m.sources[d]
+		return &out
+	case d.Kind == SequenceNode && s.Kind == SequenceNode && m.strategy == MergeAppend:
+		out := *d
+		out.Anchor = ""
+		out.Content = append(append([]*Node(nil), d.Content...), s.Content...)
+		m.sources[&out] = m.sources[d]
+		return &out
+	}
+	return src
+}
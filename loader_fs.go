@@ -0,0 +1,29 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16 && !yaml_noreflect
+// +build go1.16,!yaml_noreflect
+
+package yaml
+
+import (
+	"io/fs"
+)
+
+// AddFS adds the YAML file at path within fsys as the next source, named
+// after path. The file is read by Load.
+func (l *Loader) AddFS(fsys fs.FS, path string) {
+	l.sources = append(l.sources, loaderSource{path, func() ([]byte, error) { return fs.ReadFile(fsys, path) }})
+}
@@ -0,0 +1,45 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package yaml_test
+
+import (
+	"testing/fstest"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestLoaderAddFS(c *C) {
+	fsys := fstest.MapFS{
+		"base.yaml":  {Data: []byte(loaderDefaults)},
+		"local.yaml": {Data: []byte("server: {port: 8081}\n")},
+	}
+	l := yaml.NewLoader()
+	l.AddFS(fsys, "base.yaml")
+	l.AddFS(fsys, "local.yaml")
+	var cfg loaderConfig
+	origins, err := l.Load(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server.Port, Equals, 8081)
+	c.Assert(origins["server.port"].Source, Equals, "local.yaml")
+
+	l.AddFS(fsys, "missing.yaml")
+	_, err = l.Load(&cfg)
+	c.Assert(err, ErrorMatches, "missing.yaml: open missing.yaml: file does not exist")
+}
@@ -0,0 +1,125 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"errors"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+type loaderConfig struct {
+	Server struct {
+		Host string
+		Port int
+	}
+	Hosts  []string
+	Labels map[string]string
+}
+
+const loaderDefaults = `
+server:
+  host: localhost
+  port: 80
+hosts: [a]
+labels: {app: web, tier: front}
+`
+
+func (s *S) TestLoader(c *C) {
+	l := yaml.NewLoader()
+	l.AddBytes("defaults", []byte(loaderDefaults))
+	l.AddReader("site.yaml", strings.NewReader("# Site settings.\nserver:\n  port: 8080\nlabels:\n  tier: back\n---\nhosts: [b]\n"))
+	l.AddBytes("empty", []byte("# Nothing yet.\n"))
+	var cfg loaderConfig
+	origins, err := l.Load(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server.Host, Equals, "localhost")
+	c.Assert(cfg.Server.Port, Equals, 8080)
+	c.Assert(cfg.Hosts, DeepEquals, []string{"b"})
+	c.Assert(cfg.Labels, DeepEquals, map[string]string{"app": "web", "tier": "back"})
+	c.Assert(origins, DeepEquals, map[string]yaml.Origin{
+		"server.host": {Source: "defaults", Line: 3, Column: 9},
+		"server.port": {Source: "site.yaml", Line: 3, Column: 9},
+		"hosts[0]":    {Source: "site.yaml", Line: 7, Column: 9},
+		"labels.app":  {Source: "defaults", Line: 6, Column: 15},
+		"labels.tier": {Source: "site.yaml", Line: 5, Column: 9},
+	})
+}
+
+func (s *S) TestLoaderMergeStrategy(c *C) {
+	load := func(strategy yaml.MergeStrategy) loaderConfig {
+		l := yaml.NewLoader()
+		l.SetMergeStrategy(strategy)
+		l.AddBytes("defaults", []byte(loaderDefaults))
+		l.AddBytes("site", []byte("server: {port: 8080}\nhosts: [b]\n"))
+		var cfg loaderConfig
+		_, err := l.Load(&cfg)
+		c.Assert(err, IsNil)
+		return cfg
+	}
+	cfg := load(yaml.MergeAppend)
+	c.Assert(cfg.Server.Host, Equals, "localhost")
+	c.Assert(cfg.Hosts, DeepEquals, []string{"a", "b"})
+	cfg = load(yaml.MergeShallow)
+	c.Assert(cfg.Server.Host, Equals, "")
+	c.Assert(cfg.Server.Port, Equals, 8080)
+	c.Assert(cfg.Labels, HasLen, 2)
+}
+
+func (s *S) TestLoaderEnv(c *C) {
+	env := map[string]string{"APP_SERVER_PORT": "9090", "APP_HOSTS_0": "c", "APP_SERVER_NAME": "x"}
+	l := yaml.NewLoader()
+	l.AddBytes("defaults", []byte(loaderDefaults))
+	l.SetEnv("APP", func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	var cfg loaderConfig
+	origins, err := l.Load(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server.Port, Equals, 9090)
+	c.Assert(cfg.Hosts, DeepEquals, []string{"c"})
+	c.Assert(origins["server.port"], Equals, yaml.Origin{Source: "$APP_SERVER_PORT"})
+	c.Assert(origins["server.host"].Source, Equals, "defaults")
+}
+
+func (s *S) TestLoaderErrors(c *C) {
+	l := yaml.NewLoader()
+	l.AddBytes("defaults", []byte(loaderDefaults))
+	l.AddBytes("bad.yaml", []byte("a: [b\n"))
+	_, err := l.Load(new(loaderConfig))
+	c.Assert(err, ErrorMatches, `bad.yaml: yaml: line 1: did not find expected ',' or ']'`)
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeSyntax)
+
+	l = yaml.NewLoader()
+	l.AddReader("broken", &failingReader{})
+	_, err = l.Load(new(loaderConfig))
+	c.Assert(err, DeepEquals, &yaml.LoadError{Source: "broken", Err: errors.New("read failed")})
+
+	l = yaml.NewLoader()
+	l.AddBytes("defaults", []byte(loaderDefaults+"extra: 1\n"))
+	l.KnownFields(true)
+	_, err = l.Load(new(loaderConfig))
+	c.Assert(err, ErrorMatches, "(?s).*field extra not found in type yaml_test.loaderConfig")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
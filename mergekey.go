@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+// mergeMapping describes a mapping of a document found by mergeKeyEvents.
+type mergeMapping struct {
+	start, end int
+
+	// entries holds the entries of the mapping, in order.
+	entries []mergeEntry
+
+	// keys maps the values of the keys to the entries.
+	keys map[string]int
+}
+
+// A mergeEntry is an entry of a mergeMapping, with the value of its key,
+// and the index of the event starting the key and of the one starting the
+// value.
+type mergeEntry struct {
+	name       string
+	key, value int
+}
+
+// mergeKeyEvents returns the events of a document with the mappings that
+// hold every key of an earlier mapping, and at least min of its entries
+// with equal values, written with a "<<" merge key and an alias to the
+// earlier mapping in place of these entries, followed by their others.
+// The earlier mapping is anchored, unless it is already. Mappings with a
+// tag, with keys other than scalars, or equal to an earlier mapping are
+// left alone, as are the entries holding anchors or comments, which an
+// alias would lose.
+func mergeKeyEvents(events []yaml_event_t, min int) []yaml_event_t {
+	nodes, names := eventNodes(events)
+	var mappings []mergeMapping
+	for i := range events {
+		if m, ok := findMergeMapping(events, nodes, i); ok {
+			mappings = append(mappings, m)
+		}
+	}
+
+	// merged maps the start of each mapping written with a merge key to
+	// the mapping merged, and removed holds the entries left out of it.
+	merged := make(map[int]*mergeMapping)
+	removed := make([]bool, len(events))
+	anchors := make(map[int]string)
+	for i := range mappings {
+		m := &mappings[i]
+		if removed[m.start] {
+			continue
+		}
+		var base *mergeMapping
+		var best []int
+		for j := 0; j < i; j++ {
+			b := &mappings[j]
+			if b.end > m.start || removed[b.start] {
+				continue
+			}
+			if nodes[b.start].id == nodes[m.start].id {
+				// Mappings equal to an earlier one are left whole, as
+				// SetDeduplication writes them.
+				base = nil
+				break
+			}
+			if same := mergeableEntries(nodes, b, m); len(same) >= min && len(same) > len(best) && len(same) < len(m.entries) {
+				base, best = b, same
+			}
+		}
+		if base == nil {
+			continue
+		}
+		merged[m.start] = base
+		for _, k := range best {
+			for j := m.entries[k].key; j <= nodes[m.entries[k].value].end; j++ {
+				removed[j] = true
+			}
+		}
+		if _, ok := anchors[base.start]; !ok {
+			if anchor := events[base.start].anchor; len(anchor) > 0 {
+				anchors[base.start] = string(anchor)
+			} else {
+				anchors[base.start] = anchorName(names)
+			}
+		}
+	}
+	if len(merged) == 0 {
+		return events
+	}
+
+	var out []yaml_event_t
+	for i := range events {
+		if removed[i] {
+			continue
+		}
+		event := events[i]
+		if name, ok := anchors[i]; ok {
+			event.anchor = []byte(name)
+		}
+		out = append(out, event)
+		if base, ok := merged[i]; ok {
+			var key, alias yaml_event_t
+			yaml_scalar_event_initialize(&key, nil, nil, []byte("<<"), true, false, yaml_PLAIN_SCALAR_STYLE)
+			yaml_alias_event_initialize(&alias, []byte(anchors[base.start]))
+			out = append(out, key, alias)
+		}
+	}
+	return out
+}
+
+// findMergeMapping returns the mapping starting at the event i, if it
+// may take part in merges.
+func findMergeMapping(events []yaml_event_t, nodes []eventNode, i int) (mergeMapping, bool) {
+	event := &events[i]
+	if event.typ != yaml_MAPPING_START_EVENT || len(event.tag) > 0 && !event.implicit {
+		return mergeMapping{}, false
+	}
+	m := mergeMapping{start: i, end: nodes[i].end, keys: make(map[string]int)}
+	for j := i + 1; j < m.end; j = nodes[j].end + 1 {
+		key := &events[j]
+		if key.typ != yaml_SCALAR_EVENT || string(key.value) == "<<" {
+			return mergeMapping{}, false
+		}
+		m.keys[string(key.value)] = len(m.entries)
+		m.entries = append(m.entries, mergeEntry{name: string(key.value), key: j, value: j + 1})
+		j++
+	}
+	return m, true
+}
+
+// mergeableEntries returns the indexes of the entries of m that merging
+// b would stand for, or nil if b has keys that m has not, or if one of
+// these entries holds anchors or comments.
+func mergeableEntries(nodes []eventNode, b, m *mergeMapping) []int {
+	if len(b.entries) > len(m.entries) {
+		return nil
+	}
+	var same []int
+	for _, be := range b.entries {
+		k, ok := m.keys[be.name]
+		if !ok || nodes[m.entries[k].key].id != nodes[be.key].id {
+			return nil
+		}
+		me := m.entries[k]
+		if nodes[me.value].id != nodes[be.value].id {
+			continue
+		}
+		if nodes[me.key].keep || nodes[me.value].keep {
+			return nil
+		}
+		same = append(same, k)
+	}
+	return same
+}
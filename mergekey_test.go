@@ -0,0 +1,98 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+type mergeService struct {
+	Image    string            `yaml:"image"`
+	Replicas int               `yaml:"replicas"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	Debug    bool              `yaml:"debug,omitempty"`
+}
+
+func (s *S) TestMergeKeys(c *C) {
+	base := mergeService{Image: "app", Replicas: 1, Env: map[string]string{"LOG": "info"}}
+	prod, stage := base, base
+	prod.Replicas = 3
+	stage.Debug = true
+	v := struct {
+		Base  mergeService `yaml:"base"`
+		Prod  mergeService `yaml:"prod"`
+		Stage mergeService `yaml:"stage"`
+		Other mergeService `yaml:"other"`
+	}{base, prod, stage, mergeService{Image: "other", Replicas: 1}}
+	data, err := yaml.MarshalWithOptions(&v, yaml.WithMergeKeys(2))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `base: &id001
+    image: app
+    replicas: 1
+    env:
+        LOG: info
+prod:
+    <<: *id001
+    replicas: 3
+stage:
+    <<: *id001
+    debug: true
+other:
+    image: other
+    replicas: 1
+`)
+
+	back := v
+	back.Prod, back.Stage = mergeService{}, mergeService{}
+	c.Assert(yaml.Unmarshal(data, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	// Fewer entries in common than asked for are written in full.
+	data, err = yaml.MarshalWithOptions(&v, yaml.WithMergeKeys(4))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Not(Matches), "(?s).*<<.*")
+}
+
+func (s *S) TestMergeKeysKeepsAnchorsAndComments(c *C) {
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(`a: &base {x: 1, y: 2, z: 3}
+b: {x: 1, y: 2, z: 4}
+c: {x: 1, y: 2, z: 3}
+d: {x: 1, y: 2}
+e: {x: 1, y: 2, z: 3, w: 0} # note
+f:
+    x: 1 # one
+    y: 2
+    z: 3
+    v: 0
+`), &node)
+	c.Assert(err, IsNil)
+	data, err := yaml.MarshalWithOptions(&node, yaml.WithMergeKeys(2))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `a: &base {x: 1, y: 2, z: 3}
+b: {<<: *base, z: 4}
+c: {x: 1, y: 2, z: 3}
+d: {x: 1, y: 2}
+e: {<<: *base, w: 0} # note
+f:
+    x: 1 # one
+    y: 2
+    z: 3
+    v: 0
+`)
+	c.Assert(func() { yaml.NewEncoder(nil).SetMergeKeys(-1) }, PanicMatches, "yaml: cannot merge mappings with a negative number of entries")
+}
@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"reflect"
+	"time"
+)
+
+// AsString returns the string held by n, a !!str scalar or a !!binary one
+// with the bytes it encodes, or an alias to one. The accessors of Node
+// read scalars by their resolved tags, as UnmarshalStrict does, so that
+// AsString fails for a !!int scalar, whose text n.Value holds. They fail
+// for null values too, and their errors are of type *UnmarshalError,
+// with the position of the value and its path within n.
+func (n *Node) AsString() (string, error) {
+	var v string
+	err := n.as(&v)
+	return v, err
+}
+
+// AsInt returns the integer held by n, as AsString does.
+func (n *Node) AsInt() (int, error) {
+	var v int
+	err := n.as(&v)
+	return v, err
+}
+
+// AsInt64 returns the integer held by n, as AsString does.
+func (n *Node) AsInt64() (int64, error) {
+	var v int64
+	err := n.as(&v)
+	return v, err
+}
+
+// AsUint64 returns the unsigned integer held by n, as AsString does.
+func (n *Node) AsUint64() (uint64, error) {
+	var v uint64
+	err := n.as(&v)
+	return v, err
+}
+
+// AsFloat64 returns the number held by n, a !!float or !!int scalar, as
+// AsString does.
+func (n *Node) AsFloat64() (float64, error) {
+	var v float64
+	err := n.as(&v)
+	return v, err
+}
+
+// AsBool returns the boolean held by n, as AsString does.
+func (n *Node) AsBool() (bool, error) {
+	var v bool
+	err := n.as(&v)
+	return v, err
+}
+
+// AsTime returns the time held by n, a !!timestamp scalar or a string in
+// the RFC 3339 format, as AsString does.
+func (n *Node) AsTime() (time.Time, error) {
+	var v time.Time
+	err := n.as(&v)
+	return v, err
+}
+
+// AsDuration returns the duration held by n, a string such as "1h30m",
+// as AsString does.
+func (n *Node) AsDuration() (time.Duration, error) {
+	var v time.Duration
+	err := n.as(&v)
+	return v, err
+}
+
+// AsStringSlice returns the strings held by the sequence n, as AsString
+// does. A null item is an error, while an empty sequence gives an empty
+// slice.
+func (n *Node) AsStringSlice() ([]string, error) {
+	var v []string
+	err := n.as(&v)
+	if v == nil && err == nil {
+		v = []string{}
+	}
+	return v, err
+}
+
+// AsStringMap returns the strings held by the mapping n by their keys,
+// as AsString does.
+func (n *Node) AsStringMap() (map[string]string, error) {
+	var v map[string]string
+	err := n.as(&v)
+	return v, err
+}
+
+// as decodes n into the value pointed to by out for the accessors, and
+// returns the first problem found.
+func (n *Node) as(out interface{}) (err error) {
+	v := reflect.ValueOf(out).Elem()
+	d := newDecoder()
+	d.strictTypes = true
+	defer handleDecodeErr(&err)
+	r := n
+	for r.Kind == AliasNode && r.Alias != nil {
+		r = r.Alias
+	}
+	switch {
+	case r.Kind == ScalarNode && r.ShortTag() == nullTag || r.Kind == 0 && r.IsZero():
+		d.terror(r, nullTag, v)
+	case r.Kind == SequenceNode && v.Kind() == reflect.Slice:
+		// The items are checked for nulls as well.
+		v.Set(reflect.MakeSlice(v.Type(), len(r.Content), len(r.Content)))
+		for i, item := range r.Content {
+			if err := item.as(v.Index(i).Addr().Interface()); err != nil {
+				if e, ok := err.(*UnmarshalError); ok {
+					e.Path = append(Path{IndexElem(i)}, e.Path...)
+				}
+				return err
+			}
+		}
+		return nil
+	default:
+		d.unmarshal(n, v)
+	}
+	if len(d.terrors) > 0 {
+		return d.terrors[0]
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestNodeAccessors(c *C) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(`name: web
+port: 8080
+big: 18446744073709551615
+ratio: 0.5
+debug: true
+started: 2001-12-14t21:59:43.10-05:00
+timeout: 1m30s
+hosts: [a, b]
+labels: {app: web}
+alias: &name x
+ref: *name
+none: ~
+mixed: [a, 1, ~]
+`), &doc)
+	c.Assert(err, IsNil)
+	m := doc.Content[0]
+	value := func(key string) *yaml.Node {
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if m.Content[i].Value == key {
+				return m.Content[i+1]
+			}
+		}
+		c.Fatalf("no key %q", key)
+		return nil
+	}
+
+	str, err := value("name").AsString()
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "web")
+	i, err := value("port").AsInt()
+	c.Assert(err, IsNil)
+	c.Assert(i, Equals, 8080)
+	i64, err := value("port").AsInt64()
+	c.Assert(err, IsNil)
+	c.Assert(i64, Equals, int64(8080))
+	u, err := value("big").AsUint64()
+	c.Assert(err, IsNil)
+	c.Assert(u, Equals, uint64(18446744073709551615))
+	f, err := value("ratio").AsFloat64()
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, 0.5)
+	f, err = value("port").AsFloat64()
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, 8080.0)
+	b, err := value("debug").AsBool()
+	c.Assert(err, IsNil)
+	c.Assert(b, Equals, true)
+	t, err := value("started").AsTime()
+	c.Assert(err, IsNil)
+	c.Assert(t.Equal(time.Date(2001, 12, 15, 2, 59, 43, 1e8, time.UTC)), Equals, true)
+	d, err := value("timeout").AsDuration()
+	c.Assert(err, IsNil)
+	c.Assert(d, Equals, 90*time.Second)
+	list, err := value("hosts").AsStringSlice()
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"a", "b"})
+	labels, err := value("labels").AsStringMap()
+	c.Assert(err, IsNil)
+	c.Assert(labels, DeepEquals, map[string]string{"app": "web"})
+	str, err = value("ref").AsString()
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "x")
+
+	// Values of other types fail with their position.
+	_, err = value("port").AsString()
+	c.Assert(err, ErrorMatches, "line 2: cannot unmarshal !!int `8080` into string")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeType)
+	uerr := err.(*yaml.UnmarshalError)
+	c.Assert(uerr.Line, Equals, 2)
+	c.Assert(uerr.Column, Equals, 7)
+	_, err = value("ratio").AsInt64()
+	c.Assert(err, ErrorMatches, "line 4: cannot unmarshal !!float `0.5` into int64")
+	_, err = value("name").AsBool()
+	c.Assert(err, ErrorMatches, "line 1: cannot unmarshal !!str `web` into bool")
+	_, err = value("none").AsInt()
+	c.Assert(err, ErrorMatches, "line 12: cannot unmarshal !!null `~` into int")
+	_, err = value("labels").AsStringSlice()
+	c.Assert(err, ErrorMatches, "line 9: cannot unmarshal !!map into \\[\\]string")
+
+	// Errors within collections have the path of the value.
+	_, err = value("mixed").AsStringSlice()
+	c.Assert(err, ErrorMatches, "line 13: cannot unmarshal !!int `1` into string")
+	c.Assert(err.(*yaml.UnmarshalError).Path.String(), Equals, "[1]")
+	_, err = m.AsStringMap()
+	c.Assert(err, ErrorMatches, "line 2: cannot unmarshal !!int `8080` into string")
+	c.Assert(err.(*yaml.UnmarshalError).Path.String(), Equals, "port")
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build yaml_noreflect
+// +build yaml_noreflect
+
+// Package yaml implements YAML support for the Go language.
+//
+// Built with the yaml_noreflect tag, as done for TinyGo and small WASM
+// modules where reflection is missing or makes binaries too large, the
+// package is reduced to reading and writing Node values, and the values
+// of types implementing Unmarshaler or Marshaler, such as generated code
+// does. Unmarshal and Marshal keep their signatures, but fail for other
+// values, and the Decoder, the Encoder and the options of the full
+// package are left out.
+//
+// Reading and writing nodes shares its code with the full package. The
+// package then imports no reflect of its own, but still imports fmt for
+// its error messages, which links reflect in turn: binaries are smaller,
+// yet not free of it.
+package yaml
+
+// encoderValues and pathStep stand in for the state of the full
+// package's encoder for writing Go values, which only nodes are here.
+type encoderValues struct{}
+
+type pathStep struct {
+	elem PathElem
+}
+
+func (s pathStep) pathElem() PathElem {
+	return s.elem
+}
+
+// ignoreLevel stands in for the full package's record of where skipped
+// values are decoded to: without reflection no value is ever skipped.
+type ignoreLevel struct{}
+
+func (l ignoreLevel) item(elem PathElem, typ yaml_event_type_t) (ignoreLevel, bool) {
+	return ignoreLevel{}, false
+}
+
+// Unmarshal decodes the first document found within the in byte slice
+// into out, which must be a *Node or implement Unmarshaler. A *Node is
+// set to the document node, while UnmarshalYAML is called with its value
+// unless that's null.
+func Unmarshal(in []byte, out interface{}) (err error) {
+	defer handleDecodeErr(&err)
+	var u Unmarshaler
+	n, ok := out.(*Node)
+	if !ok {
+		if u, ok = out.(Unmarshaler); !ok {
+			failCode(ErrCodeType, "cannot unmarshal into %T without reflection", out)
+		}
+	}
+	p := newParser(in)
+	defer p.destroy()
+	doc := p.parse()
+	switch {
+	case doc == nil:
+	case n != nil:
+		*n = *doc
+	case doc.Content[0].ShortTag() != nullTag:
+		return callUser(func() error { return u.UnmarshalYAML(doc.Content[0]) })
+	}
+	return nil
+}
+
+// Marshal serializes in, which must be a Node or *Node, or implement
+// Marshaler with MarshalYAML returning one, as a YAML document. A nil
+// value is written as null.
+func Marshal(in interface{}) (out []byte, err error) {
+	defer handleErr(&err)
+	for {
+		m, ok := in.(Marshaler)
+		if !ok {
+			break
+		}
+		if in, err = m.MarshalYAML(); err != nil {
+			return nil, err
+		}
+	}
+	var n *Node
+	switch in := in.(type) {
+	case nil:
+		n = &Node{}
+	case *Node:
+		n = in
+	case Node:
+		n = &in
+	default:
+		failCode(ErrCodeType, "cannot marshal %T without reflection", in)
+	}
+	e := newEncoder()
+	defer e.destroy()
+	e.init()
+	if n.Kind == DocumentNode {
+		e.node(n, "")
+	} else {
+		e.documentStart()
+		e.emit()
+		e.node(n, "")
+		e.documentEnd()
+		e.emit()
+	}
+	e.finish()
+	return e.out, nil
+}
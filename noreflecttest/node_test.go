@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package noreflecttest tests the API shared by the full package and the
+// one built with the yaml_noreflect tag, which the tests of the package
+// itself go beyond. Both are tested with:
+//
+//     go test ./noreflecttest
+//     go test -tags yaml_noreflect ./noreflecttest
+//
+package noreflecttest_test
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var roundTripTests = []string{
+	"a: 1\n",
+	"- a\n- 'b'\n- \"c\"\n- !!str 1\n",
+	"# head\na: b # line\n# foot\n\nc: d\n",
+	"a:\n    b: c\n    # foot of b\nd: e\n",
+	"- a\n# foot of a\n\n- b\n",
+	"a: &x [1, 2]\nb: *x\n",
+	"a: |\n    line\n    break\nb: {c: d}\n",
+	"!!map\n? [a]\n: !custom b\n",
+	"~\n",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, data := range roundTripTests {
+		var n yaml.Node
+		if err := yaml.Unmarshal([]byte(data), &n); err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		if n.Kind != yaml.DocumentNode {
+			t.Fatalf("%q: got kind %d, want a document", data, n.Kind)
+		}
+		out, err := yaml.Marshal(&n)
+		if err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		if string(out) != data {
+			t.Fatalf("%q: got %q", data, out)
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte("a:\n  - b\n"), &n); err != nil {
+		t.Fatal(err)
+	}
+	b := n.Content[0].Content[1].Content[0]
+	if b.Value != "b" || b.Line != 2 || b.Column != 5 || b.ShortTag() != "!!str" {
+		t.Fatalf("got %q at %d:%d tagged %s", b.Value, b.Line, b.Column, b.ShortTag())
+	}
+}
+
+// point decodes and encodes by hand, as generated code does.
+type point struct {
+	X, Y string
+}
+
+func (p *point) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		return errors.New("point: want a mapping")
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		switch n.Content[i].Value {
+		case "x":
+			p.X = n.Content[i+1].Value
+		case "y":
+			p.Y = n.Content[i+1].Value
+		}
+	}
+	return nil
+}
+
+func (p point) MarshalYAML() (interface{}, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+	for _, s := range []string{"x", p.X, "y", p.Y} {
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s})
+	}
+	return n, nil
+}
+
+func TestUnmarshaler(t *testing.T) {
+	var p point
+	if err := yaml.Unmarshal([]byte("y: 2\nx: 1\n"), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p != (point{"1", "2"}) {
+		t.Fatalf("got %+v", p)
+	}
+	if err := yaml.Unmarshal([]byte("[1]"), &p); err == nil || err.Error() != "point: want a mapping" {
+		t.Fatalf("got error %v", err)
+	}
+	out, err := yaml.Marshal(point{"3", "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "{x: 3, y: 4}\n" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	var n yaml.Node
+	err := yaml.Unmarshal([]byte("a: b\n- c\n"), &n)
+	e, ok := err.(*yaml.Error)
+	if !ok {
+		t.Fatalf("got error %#v", err)
+	}
+	if e.Code != yaml.ErrCodeSyntax || e.Error() != "yaml: line 1: did not find expected key" {
+		t.Fatalf("got %s: %v", e.Code, e)
+	}
+	err = yaml.Unmarshal([]byte("a: *b\n"), &n)
+	if err == nil || err.Error() != "yaml: line 1: unknown anchor 'b' referenced" {
+		t.Fatalf("got error %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build yaml_noreflect
+// +build yaml_noreflect
+
+package noreflecttest_test
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNoReflectionTypes(t *testing.T) {
+	var v map[string]int
+	err := yaml.Unmarshal([]byte("a: 1"), &v)
+	if err == nil || err.Error() != "yaml: cannot unmarshal into *map[string]int without reflection" {
+		t.Fatalf("got error %v", err)
+	}
+	_, err = yaml.Marshal(v)
+	if err == nil || err.Error() != "yaml: cannot marshal map[string]int without reflection" {
+		t.Fatalf("got error %v", err)
+	}
+}
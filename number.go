@@ -0,0 +1,239 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// A Number holds the value of a !!int or !!float scalar exactly, along
+// with its text, so that numbers may be compared or written back without
+// the rounding of a float64 or the limits of an int64. A Number may be
+// decoded into and encoded as a scalar, and the zero Number is 0.
+type Number struct {
+	// text holds the text of the scalar, and tag and style its tag and
+	// whether it was given explicitly.
+	text  string
+	tag   string
+	style Style
+
+	// float tells whether the number was written as a float, rather
+	// than as an integer.
+	float bool
+
+	// value holds the value of finite numbers, and special the value of
+	// infinities and NaN, or 0 for finite numbers.
+	value   *big.Rat
+	special float64
+}
+
+var (
+	minInt64 = big.NewInt(math.MinInt64)
+	maxInt64 = big.NewInt(math.MaxInt64)
+)
+
+// AsNumber returns the number held by n, a !!int or !!float scalar or an
+// alias to one, as AsString does. Integers of any size are held exactly,
+// and so are floats but for infinities and NaN, since the value of a
+// float written in decimal is a rational number.
+func (n *Node) AsNumber() (Number, error) {
+	var v Number
+	err := n.as(&v)
+	return v, err
+}
+
+// UnmarshalYAML implements the Unmarshaler interface.
+func (num *Number) UnmarshalYAML(value *Node) error {
+	v, ok := parseNumber(value)
+	if !ok {
+		d := newDecoder()
+		d.terror(value, "", reflect.ValueOf(num).Elem())
+		return newTypeError(d.terrors)
+	}
+	*num = v
+	return nil
+}
+
+// MarshalYAML implements the Marshaler interface, writing the number as
+// it was read.
+func (num Number) MarshalYAML() (interface{}, error) {
+	return &Node{Kind: ScalarNode, Style: num.style, Tag: num.tag, Value: num.String()}, nil
+}
+
+// parseNumber returns the number held by the scalar n, if it holds one.
+func parseNumber(n *Node) (Number, bool) {
+	tag := n.ShortTag()
+	if n.Kind != ScalarNode || tag != intTag && tag != floatTag {
+		return Number{}, false
+	}
+	num := Number{text: n.Value, tag: tag, style: n.Style & TaggedStyle}
+	if tag == floatTag {
+		if item, ok := resolveMap[n.Value]; ok && item.tag == floatTag {
+			num.float = true
+			num.special = item.value.(float64)
+			return num, true
+		}
+	}
+	plain := strings.Replace(n.Value, "_", "", -1)
+	if i, ok := parseInteger(plain); ok {
+		// Integers too large for an int64 or uint64 resolve to floats,
+		// but are held as integers unless tagged as floats.
+		rtag, _ := resolve("", n.Value)
+		num.float = tag == floatTag && (num.style != 0 || rtag != floatTag)
+		num.value = new(big.Rat).SetInt(i)
+		return num, true
+	}
+	if tag == floatTag && yamlStyleFloat.MatchString(plain) {
+		if r, ok := new(big.Rat).SetString(plain); ok {
+			num.float = true
+			num.value = r
+			return num, true
+		}
+	}
+	return Number{}, false
+}
+
+// parseInteger returns the integer written as s, in decimal, or in
+// hexadecimal, octal or binary with a 0x, 0o or 0b prefix, or in octal
+// with a 0 prefix, as for YAML 1.1.
+func parseInteger(s string) (*big.Int, bool) {
+	neg := false
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "0o"):
+		base, s = 8, s[2:]
+	case strings.HasPrefix(s, "0b"):
+		base, s = 2, s[2:]
+	case len(s) > 1 && s[0] == '0':
+		base, s = 8, s[1:]
+	}
+	if s == "" || s[0] == '+' || s[0] == '-' {
+		return nil, false
+	}
+	i, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, false
+	}
+	if neg {
+		i.Neg(i)
+	}
+	return i, true
+}
+
+// String returns the number as it was written.
+func (num Number) String() string {
+	if num.text == "" {
+		return "0"
+	}
+	return num.text
+}
+
+// IsFloat tells whether the number was written as a float, such as 1.0
+// or 1e3, rather than as an integer.
+func (num Number) IsFloat() bool {
+	return num.float
+}
+
+// rat returns the value of the finite number num.
+func (num Number) rat() *big.Rat {
+	if num.value == nil {
+		return new(big.Rat)
+	}
+	return num.value
+}
+
+// Int returns the number if it's an integer, whatever its size, which
+// is also the case of floats such as 1e3.
+func (num Number) Int() (*big.Int, bool) {
+	if num.special != 0 || !num.rat().IsInt() {
+		return nil, false
+	}
+	return new(big.Int).Set(num.rat().Num()), true
+}
+
+// Int64 returns the number if it's an integer that an int64 holds.
+func (num Number) Int64() (int64, bool) {
+	i, ok := num.Int()
+	if !ok || i.Cmp(minInt64) < 0 || i.Cmp(maxInt64) > 0 {
+		return 0, false
+	}
+	return i.Int64(), true
+}
+
+// Uint64 returns the number if it's an integer that a uint64 holds.
+func (num Number) Uint64() (uint64, bool) {
+	i, ok := num.Int()
+	if !ok || i.Sign() < 0 || i.BitLen() > 64 {
+		return 0, false
+	}
+	return i.Uint64(), true
+}
+
+// Rat returns the exact value of the number, unless it's an infinity or
+// NaN.
+func (num Number) Rat() (*big.Rat, bool) {
+	if num.special != 0 {
+		return nil, false
+	}
+	return new(big.Rat).Set(num.rat()), true
+}
+
+// Float64 returns the float64 nearest to the number.
+func (num Number) Float64() float64 {
+	if num.special != 0 {
+		return num.special
+	}
+	f, _ := num.rat().Float64()
+	return f
+}
+
+// Cmp compares the values of num and other, and returns -1, 0 or +1 as
+// num is less than, equal to or greater than other, whatever the way
+// they were written, so that 1, 1.0 and 0x1 are equal. NaN is less than
+// any other number, and equal to itself.
+func (num Number) Cmp(other Number) int {
+	a, b := num.special, other.special
+	switch {
+	case a != a || b != b:
+		if a != a && b != b {
+			return 0
+		} else if a != a {
+			return -1
+		}
+		return 1
+	case a != 0 || b != 0:
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	return num.rat().Cmp(other.rat())
+}
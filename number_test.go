@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"math"
+	"math/big"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+var numberTests = []struct {
+	text    string
+	float   bool
+	int64   string
+	uint64  string
+	rat     string
+	float64 float64
+}{
+	{"8080", false, "8080", "8080", "8080/1", 8080},
+	{"-0x1F", false, "-31", "", "-31/1", -31},
+	{"0o17", false, "15", "15", "15/1", 15},
+	{"0b1010", false, "10", "10", "10/1", 10},
+	{"1_000", false, "1000", "1000", "1000/1", 1000},
+	{"18446744073709551615", false, "", "18446744073709551615", "18446744073709551615/1", 18446744073709551615},
+	{"123456789012345678901234567890", false, "", "", "123456789012345678901234567890/1", 123456789012345678901234567890},
+	{"0.1", true, "", "", "1/10", 0.1},
+	{"1e3", true, "1000", "1000", "1000/1", 1000},
+	{"-.5", true, "", "", "-1/2", -0.5},
+	{"!!float 1", true, "1", "1", "1/1", 1},
+	{".inf", true, "", "", "", math.Inf(1)},
+	{"-.Inf", true, "", "", "", math.Inf(-1)},
+}
+
+func (s *S) TestNodeAsNumber(c *C) {
+	for _, item := range numberTests {
+		c.Logf("test: %q", item.text)
+		var n yaml.Node
+		c.Assert(yaml.Unmarshal([]byte(item.text), &n), IsNil)
+		num, err := n.Content[0].AsNumber()
+		c.Assert(err, IsNil)
+		c.Assert(num.IsFloat(), Equals, item.float)
+		c.Assert(num.Float64(), Equals, item.float64)
+
+		i, ok := num.Int64()
+		if item.int64 == "" {
+			c.Assert(ok, Equals, false)
+		} else {
+			c.Assert(ok, Equals, true)
+			c.Assert(big.NewInt(i).String(), Equals, item.int64)
+		}
+		u, ok := num.Uint64()
+		if item.uint64 == "" {
+			c.Assert(ok, Equals, false)
+		} else {
+			c.Assert(ok, Equals, true)
+			c.Assert(new(big.Int).SetUint64(u).String(), Equals, item.uint64)
+		}
+		r, ok := num.Rat()
+		if item.rat == "" {
+			c.Assert(ok, Equals, false)
+		} else {
+			c.Assert(ok, Equals, true)
+			c.Assert(r.String(), Equals, item.rat)
+		}
+
+		// Numbers are written back as they were read.
+		out, err := yaml.Marshal(num)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, item.text+"\n")
+	}
+
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("[web, ~]"), &n), IsNil)
+	_, err := n.Content[0].Content[0].AsNumber()
+	c.Assert(err, ErrorMatches, "line 1: cannot unmarshal !!str `web` into yaml.Number")
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeType)
+	_, err = n.Content[0].Content[1].AsNumber()
+	c.Assert(err, ErrorMatches, "line 1: cannot unmarshal !!null `~` into yaml.Number")
+}
+
+func (s *S) TestNumberCmp(c *C) {
+	var doc struct {
+		A, B, C, D, E, F, G yaml.Number
+	}
+	err := yaml.Unmarshal([]byte(`
+a: 1
+b: 1.0
+c: 0x1
+d: 12345678901234567890123
+e: 12345678901234567890124
+f: .nan
+g: -.inf
+`), &doc)
+	c.Assert(err, IsNil)
+	c.Assert(doc.A.Cmp(doc.B), Equals, 0)
+	c.Assert(doc.A.Cmp(doc.C), Equals, 0)
+	c.Assert(doc.D.Cmp(doc.E), Equals, -1)
+	c.Assert(doc.E.Cmp(doc.D), Equals, 1)
+	c.Assert(doc.F.Cmp(doc.F), Equals, 0)
+	c.Assert(doc.F.Cmp(doc.G), Equals, -1)
+	c.Assert(doc.G.Cmp(doc.A), Equals, -1)
+	c.Assert(doc.A.Cmp(yaml.Number{}), Equals, 1)
+
+	// The values decoded are written back as they were read.
+	out, err := yaml.Marshal(&doc)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a: 1\nb: 1.0\nc: 0x1\nd: 12345678901234567890123\ne: 12345678901234567890124\nf: .nan\ng: -.inf\n")
+
+	err = yaml.Unmarshal([]byte("a: [1]"), &doc)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into yaml.Number")
+}
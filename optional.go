@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18 && !yaml_noreflect
+// +build go1.18,!yaml_noreflect
+
+package yaml
+
+// Optional holds a value that may be left out of a document, as an
+// alternative to a pointer for optional fields. A field of this type is
+// Present once a value is decoded into it, and its Value is marshaled
+// when Present; otherwise it is marshaled as null, or left out with the
+// omitempty flag.
+//
+// Like a nil pointer, an Optional that isn't Present stands for both a
+// key left out and a key set to null. Decoder.TrackPresence tells these
+// apart when that matters.
+type Optional[T any] struct {
+	Value   T
+	Present bool
+}
+
+// Some returns an Optional holding v.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Value: v, Present: true}
+}
+
+// Get returns the value held by o, and whether it is present.
+func (o Optional[T]) Get() (v T, ok bool) {
+	return o.Value, o.Present
+}
+
+// IsZero reports whether o holds no value, for the omitempty flag.
+func (o Optional[T]) IsZero() bool {
+	return !o.Present
+}
+
+// MarshalYAML implements the Marshaler interface.
+func (o Optional[T]) MarshalYAML() (interface{}, error) {
+	if !o.Present {
+		return nil, nil
+	}
+	return o.Value, nil
+}
+
+// UnmarshalYAML implements the Unmarshaler interface.
+func (o *Optional[T]) UnmarshalYAML(value *Node) error {
+	if err := value.Decode(&o.Value); err != nil {
+		return err
+	}
+	o.Present = true
+	return nil
+}
+
+func (o *Optional[T]) setNull() {
+	*o = Optional[T]{}
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+type optionalT struct {
+	A yaml.Optional[int]
+	B yaml.Optional[string] `yaml:",omitempty"`
+	C yaml.Optional[[]int]  `yaml:",omitempty"`
+}
+
+func (s *S) TestOptionalUnmarshal(c *C) {
+	v := optionalT{A: yaml.Some(1), B: yaml.Some("x")}
+	err := yaml.Unmarshal([]byte("a: ~\nc: [1, 2]\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, optionalT{B: yaml.Some("x"), C: yaml.Some([]int{1, 2})})
+
+	a, ok := v.A.Get()
+	c.Assert(a, Equals, 0)
+	c.Assert(ok, Equals, false)
+
+	err = yaml.Unmarshal([]byte("a: 0\nb: ''\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.A, Equals, yaml.Some(0))
+	c.Assert(v.B, Equals, yaml.Some(""))
+
+	err = yaml.Unmarshal([]byte("a: x\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `x` into int")
+}
+
+func (s *S) TestOptionalMarshal(c *C) {
+	data, err := yaml.Marshal(optionalT{})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: null\n")
+
+	data, err = yaml.Marshal(optionalT{A: yaml.Some(0), B: yaml.Some(""), C: yaml.Some([]int{})})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: 0\nb: \"\"\nc: []\n")
+}
@@ -0,0 +1,314 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"bytes"
+	"io"
+)
+
+// An Option configures how UnmarshalWithOptions decodes or how
+// MarshalWithOptions encodes. Options that only apply to one of these
+// are ignored by the other, so that the same options may be passed
+// through layers of code for both.
+//
+// There are no options for the settings that only matter for streams,
+// such as the buffer sizes and Encoder.SetDocumentHooks, or whose results
+// are read back from the decoder, such as Decoder.TrackPresence.
+type Option func(o *options)
+
+type options struct {
+	dec *Decoder
+	enc *Encoder
+}
+
+// DecoderOption returns an Option that calls fn with the decoder used by
+// UnmarshalWithOptions, for settings that have no Option of their own.
+func DecoderOption(fn func(dec *Decoder)) Option {
+	return func(o *options) {
+		if o.dec != nil {
+			fn(o.dec)
+		}
+	}
+}
+
+// EncoderOption returns an Option that calls fn with the encoder used by
+// MarshalWithOptions, for settings that have no Option of their own.
+func EncoderOption(fn func(enc *Encoder)) Option {
+	return func(o *options) {
+		if o.enc != nil {
+			fn(o.enc)
+		}
+	}
+}
+
+// WithKnownFields is the Option for Decoder.KnownFields.
+func WithKnownFields(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.KnownFields(enable) })
+}
+
+// WithSchema is the Option for Decoder.SetSchema.
+func WithSchema(s *Schema) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetSchema(s) })
+}
+
+// WithProjection is the Option for Decoder.SetProjection.
+func WithProjection(paths ...string) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetProjection(paths...) })
+}
+
+// WithPreserveMergeKeys is the Option for Decoder.SetPreserveMergeKeys.
+func WithPreserveMergeKeys(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetPreserveMergeKeys(enable) })
+}
+
+// WithTrace is the Option for Decoder.SetTrace and Encoder.SetTrace.
+func WithTrace(fn func(phase Phase, index int) func()) Option {
+	return func(o *options) {
+		if o.dec != nil {
+			o.dec.SetTrace(fn)
+		}
+		if o.enc != nil {
+			o.enc.SetTrace(fn)
+		}
+	}
+}
+
+// WithMaxDepth is the Option for Decoder.SetMaxDepth and
+// Encoder.SetMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		if o.dec != nil {
+			o.dec.SetMaxDepth(n)
+		}
+		if o.enc != nil {
+			o.enc.SetMaxDepth(n)
+		}
+	}
+}
+
+// WithMaxAliasExpansions is the Option for Decoder.SetMaxAliasExpansions.
+func WithMaxAliasExpansions(n int) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetMaxAliasExpansions(n) })
+}
+
+// WithMaxErrors is the Option for Decoder.SetMaxErrors.
+func WithMaxErrors(n int) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetMaxErrors(n) })
+}
+
+// WithMaxBytes is the Option for Decoder.SetMaxBytes.
+func WithMaxBytes(n int) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetMaxBytes(n) })
+}
+
+// WithDisallowAliases is the Option for Decoder.DisallowAliases.
+func WithDisallowAliases(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.DisallowAliases(enable) })
+}
+
+// WithDisallowCustomTags is the Option for Decoder.DisallowCustomTags.
+func WithDisallowCustomTags(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.DisallowCustomTags(enable) })
+}
+
+// WithPatch is the Option for Decoder.Patch.
+func WithPatch(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.Patch(enable) })
+}
+
+// WithSlicePolicy is the Option for Decoder.SetSlicePolicy.
+func WithSlicePolicy(policy SlicePolicy) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetSlicePolicy(policy) })
+}
+
+// WithMapPolicy is the Option for Decoder.SetMapPolicy.
+func WithMapPolicy(policy MapPolicy) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetMapPolicy(policy) })
+}
+
+// WithKeyNaming is the Option for Decoder.SetKeyNaming and
+// Encoder.SetKeyNaming.
+func WithKeyNaming(naming KeyNaming) Option {
+	return func(o *options) {
+		if o.dec != nil {
+			o.dec.SetKeyNaming(naming)
+		}
+		if o.enc != nil {
+			o.enc.SetKeyNaming(naming)
+		}
+	}
+}
+
+// WithEncoding is the Option for Decoder.SetEncoding.
+func WithEncoding(enc Encoding) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetEncoding(enc) })
+}
+
+// WithTransform is the Option for Decoder.SetTransform.
+func WithTransform(fn func(dst, src []byte, atEOF bool) (nDst, nSrc int, err error)) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetTransform(fn) })
+}
+
+// WithReplaceInvalid is the Option for Decoder.ReplaceInvalid.
+func WithReplaceInvalid(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.ReplaceInvalid(enable) })
+}
+
+// WithFallbackToWindows1252 is the Option for Decoder.FallbackToWindows1252.
+func WithFallbackToWindows1252(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.FallbackToWindows1252(enable) })
+}
+
+// WithSurrogatePolicy is the Option for Decoder.SetSurrogatePolicy.
+func WithSurrogatePolicy(policy SurrogatePolicy) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetSurrogatePolicy(policy) })
+}
+
+// WithStrictCharacters is the Option for Decoder.StrictCharacters.
+func WithStrictCharacters(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.StrictCharacters(enable) })
+}
+
+// WithNormalizeLineEndings is the Option for Decoder.NormalizeLineEndings.
+func WithNormalizeLineEndings(enable bool) Option {
+	return DecoderOption(func(dec *Decoder) { dec.NormalizeLineEndings(enable) })
+}
+
+// WithNormalizer is the Option for Decoder.SetNormalizer.
+func WithNormalizer(fn func(string) string) Option {
+	return DecoderOption(func(dec *Decoder) { dec.SetNormalizer(fn) })
+}
+
+// WithIndent is the Option for Encoder.SetIndent.
+func WithIndent(spaces int) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetIndent(spaces) })
+}
+
+// WithSequenceIndent is the Option for Encoder.SetSequenceIndent.
+func WithSequenceIndent(spaces int) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetSequenceIndent(spaces) })
+}
+
+// WithCompactFlow is the Option for Encoder.SetCompactFlow.
+func WithCompactFlow(enable bool) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetCompactFlow(enable) })
+}
+
+// WithFlowFormat is the Option for Encoder.SetFlowFormat.
+func WithFlowFormat(format FlowFormat) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetFlowFormat(format) })
+}
+
+// WithMultilinePolicy is the Option for Encoder.SetMultilinePolicy.
+func WithMultilinePolicy(policy MultilinePolicy) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetMultilinePolicy(policy) })
+}
+
+// WithTagPolicy is the Option for Encoder.SetTagPolicy.
+func WithTagPolicy(policy TagPolicy) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetTagPolicy(policy) })
+}
+
+// WithYAML11 is the Option for Encoder.SetYAML11.
+func WithYAML11(enable bool) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetYAML11(enable) })
+}
+
+// WithNormalizeComments is the Option for Encoder.SetNormalizeComments.
+func WithNormalizeComments(enable bool) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetNormalizeComments(enable) })
+}
+
+// WithAnchors is the Option for Encoder.SetAnchors.
+func WithAnchors(enable bool) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetAnchors(enable) })
+}
+
+// WithAnchorNamer is the Option for Encoder.SetAnchorNamer.
+func WithAnchorNamer(fn func(path Path, value interface{}) string) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetAnchorNamer(fn) })
+}
+
+// WithDeduplication is the Option for Encoder.SetDeduplication.
+func WithDeduplication(minNodes int) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetDeduplication(minNodes) })
+}
+
+// WithBanner is the Option for Encoder.SetBanner.
+func WithBanner(text string, each bool) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetBanner(text, each) })
+}
+
+// WithDocComments is the Option for Encoder.SetDocComments.
+func WithDocComments(s *Schema, docs map[string]string) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetDocComments(s, docs) })
+}
+
+// WithMergeKeys is the Option for Encoder.SetMergeKeys.
+func WithMergeKeys(minEntries int) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetMergeKeys(minEntries) })
+}
+
+// WithLineWidth is the Option for Encoder.SetLineWidth.
+func WithLineWidth(width int) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetLineWidth(width) })
+}
+
+// WithScalarWrapping is the Option for Encoder.SetScalarWrapping.
+func WithScalarWrapping(enable bool) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetScalarWrapping(enable) })
+}
+
+// WithStringStyle is the Option for Encoder.SetStringStyle.
+func WithStringStyle(fn func(path Path, key bool, value string) Style) Option {
+	return EncoderOption(func(enc *Encoder) { enc.SetStringStyle(fn) })
+}
+
+// UnmarshalWithOptions is like Unmarshal, with the decoding configured
+// by opts.
+func UnmarshalWithOptions(in []byte, out interface{}, opts ...Option) error {
+	dec := &Decoder{parser: newParser(in)}
+	defer dec.parser.destroy()
+	o := options{dec: dec}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := dec.Decode(out); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// MarshalWithOptions is like Marshal, with the encoding configured by opts.
+func MarshalWithOptions(in interface{}, opts ...Option) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	o := options{enc: enc}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := enc.Encode(in); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
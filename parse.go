@@ -0,0 +1,592 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"fmt"
+	"io"
+)
+
+// ----------------------------------------------------------------------------
+// Parser, produces a node tree out of a libyaml event stream.
+
+type parser struct {
+	parser   yaml_parser_t
+	event    yaml_event_t
+	doc      *Node
+	anchors  map[string]*Node
+	doneInit bool
+	textless bool
+
+	// noAliases has anchors and aliases rejected.
+	noAliases bool
+
+	// noCustomTags has tags not known to the decoder rejected.
+	noCustomTags bool
+
+	// depth is the nesting of the collection being parsed, limited to
+	// maxDepth unless that is zero.
+	depth    int
+	maxDepth int
+
+	// end holds the end mark of the last event consumed.
+	end yaml_mark_t
+
+	// spans records where each node is in the input, unless it's nil.
+	spans map[*Node]nodeSpan
+
+	normalize func(string) string
+
+	// source gives the events in place of the parser, unless it's nil.
+	source func(e *yaml_event_t)
+
+	// keep has the values of mapping entries and sequence items that it
+	// returns false for, given their paths, skipped rather than parsed,
+	// unless it's nil. path holds the path of the value being parsed.
+	keep func(path Path) bool
+	path Path
+
+	// ignoring holds, for each collection being parsed, where it's decoded
+	// into, so that the values the decoder is sure to leave out are
+	// skipped as well, with a null in their place. It's nil unless the
+	// document is decoded into a struct.
+	ignoring []ignoreLevel
+}
+
+// A nodeSpan holds the offsets in the input of the first byte of a node,
+// including its anchor and tag, and of the byte after its last one.
+type nodeSpan struct {
+	start, end int
+}
+
+func newParser(b []byte) *parser {
+	p := parser{}
+	if !yaml_parser_initialize(&p.parser) {
+		panic("failed to initialize YAML emitter")
+	}
+	if len(b) == 0 {
+		b = []byte{'\n'}
+	}
+	yaml_parser_set_input_string(&p.parser, b)
+	return &p
+}
+
+func newParserFromReader(r io.Reader) *parser {
+	p := parser{}
+	if !yaml_parser_initialize(&p.parser) {
+		panic("failed to initialize YAML emitter")
+	}
+	yaml_parser_set_input_reader(&p.parser, r)
+	return &p
+}
+
+// reset prepares p for parsing a new input, keeping the buffers
+// and options of the underlying parser.
+func (p *parser) reset() {
+	if p.event.typ != yaml_NO_EVENT {
+		yaml_event_delete(&p.event)
+	}
+	yaml_parser_reset(&p.parser)
+	*p = parser{parser: p.parser, textless: p.textless, noAliases: p.noAliases, noCustomTags: p.noCustomTags, maxDepth: p.maxDepth, normalize: p.normalize, keep: p.keep}
+}
+
+func (p *parser) init() {
+	if p.doneInit {
+		return
+	}
+	p.anchors = make(map[string]*Node)
+	p.expect(yaml_STREAM_START_EVENT)
+	p.doneInit = true
+}
+
+func (p *parser) destroy() {
+	if p.event.typ != yaml_NO_EVENT {
+		yaml_event_delete(&p.event)
+	}
+	yaml_parser_delete(&p.parser)
+}
+
+// expect consumes an event from the event stream and
+// checks that it's of the expected type.
+func (p *parser) expect(e yaml_event_type_t) {
+	if p.event.typ == yaml_NO_EVENT {
+		if !p.nextEvent() {
+			p.fail()
+		}
+	}
+	if p.event.typ == yaml_STREAM_END_EVENT {
+		failCode(ErrCodeInternal, "attempted to go past the end of stream; corrupted value?")
+	}
+	if p.event.typ != e {
+		p.parser.problem = fmt.Sprintf("expected %s event but got %s", e, p.event.typ)
+		p.parser.problem_code = ErrCodeInternal
+		p.fail()
+	}
+	p.end = p.event.end_mark
+	yaml_parser_discard_retained(&p.parser, p.end.offset)
+	yaml_event_delete(&p.event)
+	p.event.typ = yaml_NO_EVENT
+}
+
+// peek peeks at the next event in the event stream,
+// puts the results into p.event and returns the event type.
+func (p *parser) peek() yaml_event_type_t {
+	if p.event.typ != yaml_NO_EVENT {
+		return p.event.typ
+	}
+	// It's curious choice from the underlying API to generally return a
+	// positive result on success, but on this case return true in an error
+	// scenario. This was the source of bugs in the past (issue #666).
+	if !p.nextEvent() || p.parser.error != yaml_NO_ERROR {
+		p.fail()
+	}
+	return p.event.typ
+}
+
+func (p *parser) nextEvent() bool {
+	if p.source != nil {
+		p.source(&p.event)
+		return true
+	}
+	return yaml_parser_parse(&p.parser, &p.event)
+}
+
+func (p *parser) fail() {
+	if p.parser.problem_err != nil {
+		fail(p.parser.problem_err)
+	}
+	if p.parser.error == yaml_READER_ERROR && p.parser.problem_bytes != nil {
+		fail(newEncodingError(&p.parser))
+	}
+	var line int
+	if p.parser.context_mark.line != 0 {
+		line = p.parser.context_mark.line
+		// Scanner errors don't iterate line before returning error
+		if p.parser.error == yaml_SCANNER_ERROR {
+			line++
+		}
+	} else if p.parser.problem_mark.line != 0 {
+		line = p.parser.problem_mark.line
+		// Scanner errors don't iterate line before returning error
+		if p.parser.error == yaml_SCANNER_ERROR {
+			line++
+		}
+	}
+	var msg string
+	if len(p.parser.problem) > 0 {
+		msg = p.parser.problem
+	} else {
+		msg = "unknown problem parsing YAML content"
+	}
+	fail(&Error{Code: p.errorCode(), Line: line, Message: msg})
+}
+
+// errorCode returns the code of the error the underlying parser failed with.
+func (p *parser) errorCode() ErrorCode {
+	switch {
+	case p.parser.error == yaml_READER_ERROR:
+		return ErrCodeInput
+	case p.parser.problem_code != "":
+		return p.parser.problem_code
+	}
+	return ErrCodeSyntax
+}
+
+func newEncodingError(parser *yaml_parser_t) *EncodingError {
+	err := &EncodingError{
+		Offset:  parser.problem_offset,
+		Bytes:   parser.problem_bytes,
+		Message: parser.problem,
+		Err:     ErrInvalidUTF8,
+	}
+	if parser.problem_disallowed {
+		err.Err = ErrDisallowedCharacter
+	} else if parser.encoding != yaml_UTF8_ENCODING {
+		err.Err = ErrInvalidUTF16
+	}
+	return err
+}
+
+// warnings converts the problems recovered from by the underlying
+// parser into their public representation.
+func (p *parser) warnings() []Warning {
+	var warnings []Warning
+	for _, w := range p.parser.warnings {
+		warnings = append(warnings, Warning{Offset: w.offset, Message: w.problem})
+	}
+	if n := p.parser.dropped_warnings; n > 0 {
+		warnings = append(warnings, Warning{Offset: -1, Message: fmt.Sprintf("%d more problems in the input left out", n)})
+	}
+	return warnings
+}
+
+func (p *parser) anchor(n *Node, anchor []byte) {
+	if anchor != nil {
+		if p.noAliases {
+			p.failDisallowed(string(anchor), "anchor '"+string(anchor)+"' is not allowed")
+		}
+		n.Anchor = string(anchor)
+		p.anchors[n.Anchor] = n
+	}
+}
+
+// failDisallowed fails for the anchor or alias of the current event
+// when aliases are disallowed.
+func (p *parser) failDisallowed(anchor, msg string) {
+	fail(&AnchorError{
+		Code:    ErrCodeAliasDisallowed,
+		Anchor:  anchor,
+		Line:    p.event.start_mark.line + 1,
+		Column:  p.event.start_mark.column + 1,
+		Message: msg,
+	})
+}
+
+func (p *parser) parse() *Node {
+	p.init()
+	switch p.peek() {
+	case yaml_SCALAR_EVENT:
+		return p.scalar()
+	case yaml_ALIAS_EVENT:
+		return p.alias()
+	case yaml_MAPPING_START_EVENT:
+		return p.mapping()
+	case yaml_SEQUENCE_START_EVENT:
+		return p.sequence()
+	case yaml_DOCUMENT_START_EVENT:
+		return p.document()
+	case yaml_STREAM_END_EVENT:
+		// Happens when attempting to decode an empty buffer.
+		return nil
+	case yaml_TAIL_COMMENT_EVENT:
+		panic("internal error: unexpected tail comment event (please report)")
+	default:
+		panic("internal error: attempted to parse unknown event (please report): " + p.event.typ.String())
+	}
+}
+
+func (p *parser) node(kind Kind, defaultTag, tag, value string) *Node {
+	var style Style
+	if tag != "" && tag != "!" {
+		tag = shortTag(tag)
+		style = TaggedStyle
+		if p.noCustomTags && !knownTag(tag) {
+			fail(&TagError{
+				Tag:    tag,
+				Line:   p.event.start_mark.line + 1,
+				Column: p.event.start_mark.column + 1,
+			})
+		}
+	} else if defaultTag != "" {
+		tag = defaultTag
+	} else if kind == ScalarNode {
+		tag, _ = resolve("", value)
+		if p.parser.debug != nil {
+			p.parser.debug("yaml: resolved", "value", value, "tag", tag,
+				"line", p.event.start_mark.line+1, "column", p.event.start_mark.column+1)
+		}
+	}
+	n := &Node{
+		Kind:  kind,
+		Tag:   tag,
+		Value: value,
+		Style: style,
+	}
+	if !p.textless {
+		n.Line = p.event.start_mark.line + 1
+		n.Column = p.event.start_mark.column + 1
+		n.HeadComment = string(p.event.head_comment)
+		n.LineComment = string(p.event.line_comment)
+		n.FootComment = string(p.event.foot_comment)
+	}
+	if p.spans != nil {
+		p.spans[n] = nodeSpan{start: p.event.start_mark.offset}
+	}
+	return n
+}
+
+// endSpan records the end of n, whose last event was just consumed.
+// Block collections end with their last item rather than with the
+// blanks and comments found before whatever follows them.
+func (p *parser) endSpan(n *Node) {
+	if p.spans == nil {
+		return
+	}
+	span := p.spans[n]
+	span.end = p.end.offset
+	if n.Style&FlowStyle == 0 && len(n.Content) > 0 && (n.Kind == MappingNode || n.Kind == SequenceNode) {
+		span.end = p.spans[n.Content[len(n.Content)-1]].end
+	}
+	p.spans[n] = span
+}
+
+func (p *parser) parseChild(parent *Node) *Node {
+	child := p.parse()
+	parent.Content = append(parent.Content, child)
+	return child
+}
+
+// parseItem parses the next value as a child of parent at elem, or skips
+// it and returns nil if p.keep leaves it out. A value the decoder leaves
+// out is replaced with a null child.
+func (p *parser) parseItem(parent *Node, elem PathElem) *Node {
+	if p.keep == nil && p.ignoring == nil {
+		return p.parseChild(parent)
+	}
+	n := len(p.path)
+	if p.keep != nil {
+		p.path = append(p.path, elem)
+	}
+	var level ignoreLevel
+	ignored := false
+	if p.ignoring != nil {
+		level, ignored = p.ignoring[len(p.ignoring)-1].item(elem, p.peek())
+	}
+	var child *Node
+	switch {
+	case p.keep != nil && !p.keep(p.path):
+		p.skipValue()
+	case ignored:
+		child = &Node{
+			Kind:   ScalarNode,
+			Tag:    nullTag,
+			Value:  "null",
+			Line:   p.event.start_mark.line + 1,
+			Column: p.event.start_mark.column + 1,
+		}
+		p.skipValue()
+		parent.Content = append(parent.Content, child)
+	case p.ignoring != nil:
+		p.ignoring = append(p.ignoring, level)
+		child = p.parseChild(parent)
+		p.ignoring = p.ignoring[:len(p.ignoring)-1]
+	default:
+		child = p.parseChild(parent)
+	}
+	p.path = p.path[:n]
+	return child
+}
+
+// parseKey parses the next value as a key of the mapping parent. Nothing
+// within a key is left out by the decoder.
+func (p *parser) parseKey(parent *Node) *Node {
+	if p.ignoring == nil || p.peek() == yaml_SCALAR_EVENT {
+		return p.parseChild(parent)
+	}
+	p.ignoring = append(p.ignoring, ignoreLevel{})
+	k := p.parseChild(parent)
+	p.ignoring = p.ignoring[:len(p.ignoring)-1]
+	return k
+}
+
+// skipDocument consumes the events of the next document as skipValue
+// does, and returns false if there's none.
+func (p *parser) skipDocument() bool {
+	p.init()
+	switch p.peek() {
+	case yaml_STREAM_END_EVENT:
+		return false
+	case yaml_DOCUMENT_START_EVENT:
+		p.expect(yaml_DOCUMENT_START_EVENT)
+		p.skipValue()
+		p.expect(yaml_DOCUMENT_END_EVENT)
+	default:
+		p.skipValue()
+	}
+	return true
+}
+
+// skipValue consumes the events of the next value without building its
+// nodes or resolving its scalars, but for the values with an anchor
+// within it, which are parsed for the aliases that may refer to them
+// later.
+func (p *parser) skipValue() {
+	depth := 0
+	for {
+		switch typ := p.peek(); typ {
+		case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			if len(p.event.anchor) > 0 {
+				keep, ignoring := p.keep, p.ignoring
+				p.keep, p.ignoring = nil, nil
+				p.parse()
+				p.keep, p.ignoring = keep, ignoring
+			} else if typ == yaml_SCALAR_EVENT {
+				p.expect(typ)
+			} else {
+				p.enter()
+				p.expect(typ)
+				depth++
+			}
+		case yaml_SEQUENCE_END_EVENT, yaml_MAPPING_END_EVENT:
+			p.depth--
+			p.expect(typ)
+			depth--
+		case yaml_TAIL_COMMENT_EVENT:
+			p.expect(typ)
+			continue
+		default:
+			p.expect(typ)
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+func (p *parser) document() *Node {
+	n := p.node(DocumentNode, "", "", "")
+	p.doc = n
+	p.expect(yaml_DOCUMENT_START_EVENT)
+	p.parseChild(n)
+	if p.peek() == yaml_DOCUMENT_END_EVENT {
+		n.FootComment = string(p.event.foot_comment)
+	}
+	p.expect(yaml_DOCUMENT_END_EVENT)
+	return n
+}
+
+func (p *parser) alias() *Node {
+	if p.noAliases {
+		p.failDisallowed(string(p.event.anchor), "alias of anchor '"+string(p.event.anchor)+"' is not allowed")
+	}
+	n := p.node(AliasNode, "", "", string(p.event.anchor))
+	n.Alias = p.anchors[n.Value]
+	if n.Alias == nil {
+		failAnchor(ErrCodeUnknownAnchor, n, "unknown anchor '"+n.Value+"' referenced")
+	}
+	p.expect(yaml_ALIAS_EVENT)
+	p.endSpan(n)
+	return n
+}
+
+func (p *parser) scalar() *Node {
+	var parsedStyle = p.event.scalar_style()
+	var nodeStyle Style
+	switch {
+	case parsedStyle&yaml_DOUBLE_QUOTED_SCALAR_STYLE != 0:
+		nodeStyle = DoubleQuotedStyle
+	case parsedStyle&yaml_SINGLE_QUOTED_SCALAR_STYLE != 0:
+		nodeStyle = SingleQuotedStyle
+	case parsedStyle&yaml_LITERAL_SCALAR_STYLE != 0:
+		nodeStyle = LiteralStyle
+	case parsedStyle&yaml_FOLDED_SCALAR_STYLE != 0:
+		nodeStyle = FoldedStyle
+	}
+	var nodeValue = string(p.event.value)
+	if p.normalize != nil {
+		nodeValue = p.normalize(nodeValue)
+	}
+	var nodeTag = string(p.event.tag)
+	var defaultTag string
+	if nodeStyle == 0 {
+		if nodeValue == "<<" {
+			defaultTag = mergeTag
+		}
+	} else {
+		defaultTag = strTag
+	}
+	n := p.node(ScalarNode, defaultTag, nodeTag, nodeValue)
+	n.Style |= nodeStyle
+	p.anchor(n, p.event.anchor)
+	p.expect(yaml_SCALAR_EVENT)
+	p.endSpan(n)
+	return n
+}
+
+// enter accounts for parsing the collection of the current event.
+func (p *parser) enter() {
+	p.depth++
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		fail(&Error{
+			Code:    ErrCodeMaxDepth,
+			Line:    p.event.start_mark.line + 1,
+			Message: fmt.Sprintf("exceeded max depth of %d", p.maxDepth),
+		})
+	}
+}
+
+func (p *parser) sequence() *Node {
+	n := p.node(SequenceNode, seqTag, string(p.event.tag), "")
+	if p.event.sequence_style()&yaml_FLOW_SEQUENCE_STYLE != 0 {
+		n.Style |= FlowStyle
+	}
+	p.anchor(n, p.event.anchor)
+	p.enter()
+	p.expect(yaml_SEQUENCE_START_EVENT)
+	for i := 0; p.peek() != yaml_SEQUENCE_END_EVENT; i++ {
+		if p.parseItem(n, IndexElem(i)) == nil {
+			// Items skipped are kept as nulls for the others to keep
+			// their indexes.
+			n.Content = append(n.Content, &Node{Kind: ScalarNode, Tag: nullTag, Value: "null"})
+		}
+	}
+	p.depth--
+	n.LineComment = string(p.event.line_comment)
+	n.FootComment = string(p.event.foot_comment)
+	p.expect(yaml_SEQUENCE_END_EVENT)
+	p.endSpan(n)
+	return n
+}
+
+func (p *parser) mapping() *Node {
+	n := p.node(MappingNode, mapTag, string(p.event.tag), "")
+	block := true
+	if p.event.mapping_style()&yaml_FLOW_MAPPING_STYLE != 0 {
+		block = false
+		n.Style |= FlowStyle
+	}
+	p.anchor(n, p.event.anchor)
+	p.enter()
+	p.expect(yaml_MAPPING_START_EVENT)
+	for p.peek() != yaml_MAPPING_END_EVENT {
+		k := p.parseKey(n)
+		if block && k.FootComment != "" {
+			// Must be a foot comment for the prior value when being dedented.
+			if len(n.Content) > 2 {
+				n.Content[len(n.Content)-3].FootComment = k.FootComment
+				k.FootComment = ""
+			}
+		}
+		v := p.parseItem(n, KeyElem(k.Value))
+		if v == nil {
+			n.Content = n.Content[:len(n.Content)-1]
+			if p.peek() == yaml_TAIL_COMMENT_EVENT {
+				p.expect(yaml_TAIL_COMMENT_EVENT)
+			}
+			continue
+		}
+		if k.FootComment == "" && v.FootComment != "" {
+			k.FootComment = v.FootComment
+			v.FootComment = ""
+		}
+		if p.peek() == yaml_TAIL_COMMENT_EVENT {
+			if k.FootComment == "" {
+				k.FootComment = string(p.event.foot_comment)
+			}
+			p.expect(yaml_TAIL_COMMENT_EVENT)
+		}
+	}
+	p.depth--
+	n.LineComment = string(p.event.line_comment)
+	n.FootComment = string(p.event.foot_comment)
+	if n.Style&FlowStyle == 0 && n.FootComment != "" && len(n.Content) > 1 {
+		n.Content[len(n.Content)-2].FootComment = n.FootComment
+		n.FootComment = ""
+	}
+	p.expect(yaml_MAPPING_END_EVENT)
+	p.endSpan(n)
+	return n
+}
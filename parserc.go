@@ -109,6 +109,14 @@ func yaml_parser_unfold_comments(parser *yaml_parser_t, token *yaml_token_t) {
 
 // Remove the next token from the queue (must be called after peek_token).
 func skip_token(parser *yaml_parser_t) {
+	if parser.debug != nil {
+		token := &parser.tokens[parser.tokens_head]
+		args := []interface{}{"type", token.typ.String(), "line", token.start_mark.line + 1, "column", token.start_mark.column + 1}
+		if len(token.value) > 0 {
+			args = append(args, "value", string(token.value))
+		}
+		parser.debug("yaml: token", args...)
+	}
 	parser.token_available = false
 	parser.tokens_parsed++
 	parser.stream_end_produced = parser.tokens[parser.tokens_head].typ == yaml_STREAM_END_TOKEN
@@ -126,11 +134,25 @@ func yaml_parser_parse(parser *yaml_parser_t, event *yaml_event_t) bool {
 	}
 
 	// Generate the next event.
-	return yaml_parser_state_machine(parser, event)
+	if parser.debug == nil {
+		return yaml_parser_state_machine(parser, event)
+	}
+	state := parser.state
+	if !yaml_parser_state_machine(parser, event) {
+		return false
+	}
+	parser.debug("yaml: event", "type", event.typ.String(), "state", state.String(), "next", parser.state.String(),
+		"line", event.start_mark.line+1, "column", event.start_mark.column+1)
+	return true
 }
 
 // Set parser error.
 func yaml_parser_set_parser_error(parser *yaml_parser_t, problem string, problem_mark yaml_mark_t) bool {
+	// [Go] The parser may fail for finding the input ended where a reader
+	// error was held back, once the scanner got there.
+	if parser.reader_error_held && parser.mark.offset >= parser.held_offset {
+		return yaml_parser_raise_held_error(parser)
+	}
 	parser.error = yaml_PARSER_ERROR
 	parser.problem = problem
 	parser.problem_mark = problem_mark
@@ -138,6 +160,9 @@ func yaml_parser_set_parser_error(parser *yaml_parser_t, problem string, problem
 }
 
 func yaml_parser_set_parser_error_context(parser *yaml_parser_t, context string, context_mark yaml_mark_t, problem string, problem_mark yaml_mark_t) bool {
+	if parser.reader_error_held && parser.mark.offset >= parser.held_offset {
+		return yaml_parser_raise_held_error(parser)
+	}
 	parser.error = yaml_PARSER_ERROR
 	parser.context = context
 	parser.context_mark = context_mark
@@ -305,6 +330,7 @@ func yaml_parser_parse_document_start(parser *yaml_parser_t, event *yaml_event_t
 			typ:        yaml_DOCUMENT_START_EVENT,
 			start_mark: token.start_mark,
 			end_mark:   token.end_mark,
+			implicit:   true,
 
 			head_comment: head_comment,
 		}
@@ -341,6 +367,12 @@ func yaml_parser_parse_document_start(parser *yaml_parser_t, event *yaml_event_t
 		skip_token(parser)
 
 	} else {
+		// [Go] The stream only seems to end here if a reader error was
+		// held back.
+		if parser.reader_error_held {
+			return yaml_parser_raise_held_error(parser)
+		}
+
 		// Parse the stream end.
 		parser.state = yaml_PARSE_END_STATE
 		*event = yaml_event_t{
@@ -398,6 +430,12 @@ func yaml_parser_parse_document_end(parser *yaml_parser_t, event *yaml_event_t)
 		implicit = false
 	}
 
+	// [Go] A document may not end where the stream only seems to end
+	// because a reader error was held back.
+	if implicit && token.typ == yaml_STREAM_END_TOKEN && parser.reader_error_held {
+		return yaml_parser_raise_held_error(parser)
+	}
+
 	parser.tag_directives = parser.tag_directives[:0]
 
 	parser.state = yaml_PARSE_DOCUMENT_START_STATE
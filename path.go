@@ -0,0 +1,279 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A Path locates a value within a document by the mapping keys and
+// sequence indexes leading to it from the document root.
+//
+// The string form of a path joins keys with dots and writes indexes
+// within brackets, as in "spec.containers[0].image". Keys that could be
+// misread that way are quoted, as in `labels["app.kubernetes.io/name"]`.
+type Path []PathElem
+
+// A PathElem is a step in a Path, either into the value of the mapping
+// entry with the given key, or into the sequence item at the given index.
+type PathElem struct {
+	Key   string
+	Index int // The sequence index, or -1 for a mapping key.
+}
+
+// KeyElem returns the PathElem stepping into the value of key.
+func KeyElem(key string) PathElem {
+	return PathElem{Key: key, Index: -1}
+}
+
+// IndexElem returns the PathElem stepping into the item at index.
+func IndexElem(index int) PathElem {
+	return PathElem{Index: index}
+}
+
+// IsKey reports whether e steps into the value of a mapping entry.
+func (e PathElem) IsKey() bool {
+	return e.Index < 0
+}
+
+func (p Path) String() string {
+	var b []byte
+	for i, e := range p {
+		switch {
+		case !e.IsKey():
+			b = append(b, '[')
+			b = strconv.AppendInt(b, int64(e.Index), 10)
+			b = append(b, ']')
+		case e.Key == "" || strings.IndexAny(e.Key, ".[]\"' \t\n") >= 0:
+			b = append(b, '[')
+			b = strconv.AppendQuote(b, e.Key)
+			b = append(b, ']')
+		default:
+			if i > 0 {
+				b = append(b, '.')
+			}
+			b = append(b, e.Key...)
+		}
+	}
+	return string(b)
+}
+
+// Key returns a copy of p extended with a step into the value of key.
+func (p Path) Key(key string) Path {
+	return append(p[:len(p):len(p)], KeyElem(key))
+}
+
+// Index returns a copy of p extended with a step into the item at index.
+func (p Path) Index(index int) Path {
+	return append(p[:len(p):len(p)], IndexElem(index))
+}
+
+// ParsePath parses the string form of a Path, as returned by its String
+// method.
+func ParsePath(s string) (Path, error) {
+	return parsePath(s, false)
+}
+
+// anyIndex is the index of the "[*]" steps of path patterns.
+const anyIndex = -2
+
+// parsePath parses the string form of a Path, or of a path pattern if
+// pattern is set, where "[*]" steps have the index anyIndex.
+func parsePath(s string, pattern bool) (Path, error) {
+	var p Path
+	for i := 0; i < len(s); {
+		var elem PathElem
+		var ok bool
+		switch {
+		case pattern && strings.HasPrefix(s[i:], "[*]"):
+			elem, i, ok = IndexElem(anyIndex), i+3, true
+		case s[i] == '[':
+			elem, i, ok = parseBracketElem(s, i+1)
+		case len(p) == 0 || s[i] == '.':
+			if len(p) > 0 {
+				i++
+			}
+			j := i
+			for j < len(s) && strings.IndexByte(".[]", s[j]) < 0 {
+				j++
+			}
+			elem, ok = KeyElem(s[i:j]), j > i
+			i = j
+		}
+		if !ok {
+			return nil, errors.New("yaml: invalid path " + strconv.Quote(s))
+		}
+		p = append(p, elem)
+	}
+	return p, nil
+}
+
+// parseBracketElem parses a quoted key or an index within brackets, from
+// just after the opening bracket at s[i:], and returns the offset after
+// the closing bracket.
+func parseBracketElem(s string, i int) (elem PathElem, end int, ok bool) {
+	j := i
+	if j < len(s) && s[j] == '"' {
+		for j++; j < len(s) && s[j] != '"'; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j+1 >= len(s) || s[j+1] != ']' {
+			return elem, 0, false
+		}
+		key, err := strconv.Unquote(s[i : j+1])
+		return KeyElem(key), j + 2, err == nil
+	}
+	for j < len(s) && s[j] != ']' {
+		j++
+	}
+	if j == len(s) {
+		return elem, 0, false
+	}
+	index, err := strconv.Atoi(s[i:j])
+	return IndexElem(index), j + 1, err == nil && index >= 0 && s[i] != '+'
+}
+
+// FindPath returns the node at path p within n, or nil if there is none.
+// The node n may be a document node, whose content the path starts from,
+// and aliases on the way are followed to the nodes they refer to.
+func FindPath(n *Node, p Path) *Node {
+	for _, e := range p {
+		n = pathContent(n)
+		if n == nil {
+			return nil
+		}
+		i := pathChild(n, e)
+		if i < 0 {
+			return nil
+		}
+		n = n.Content[i]
+	}
+	if n != nil && n.Kind == DocumentNode {
+		n = pathContent(n)
+	}
+	return n
+}
+
+// pathContent returns the node holding the content of n, following
+// documents and aliases.
+func pathContent(n *Node) *Node {
+	for n != nil {
+		switch {
+		case n.Kind == DocumentNode && len(n.Content) == 1:
+			n = n.Content[0]
+		case n.Kind == AliasNode:
+			n = n.Alias
+		case n.Kind == DocumentNode:
+			return nil
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+// pathChild returns the index within n.Content of the node that e steps
+// into, or -1 if there is none.
+func pathChild(n *Node, e PathElem) int {
+	switch {
+	case n.Kind == SequenceNode && !e.IsKey():
+		if e.Index < len(n.Content) {
+			return e.Index
+		}
+	case n.Kind == MappingNode && e.IsKey():
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == e.Key {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// matchPath reports whether p matches the path pattern pattern. A "**"
+// step of the pattern matches any number of steps of p, none included,
+// a "[*]" step any index, and a key holding "*" any key where each "*"
+// stands for any text.
+func matchPath(pattern, p Path) bool {
+	for len(pattern) > 0 {
+		e := pattern[0]
+		if e.Index != anyIndex && e.Key == "**" {
+			for i := 0; i <= len(p); i++ {
+				if matchPath(pattern[1:], p[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(p) == 0 || !matchElem(e, p[0]) {
+			return false
+		}
+		pattern, p = pattern[1:], p[1:]
+	}
+	return len(p) == 0
+}
+
+// matchPathPrefix reports whether p is at, under or on the way to a
+// path matching pattern, as matchPath does. Any path under the steps of
+// the pattern before a "**" step is taken to be on the way.
+func matchPathPrefix(pattern, p Path) bool {
+	for i, e := range pattern {
+		if e.Index != anyIndex && e.Key == "**" || i == len(p) {
+			return true
+		}
+		if !matchElem(e, p[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchElem reports whether the step e of a path pattern matches the
+// step pe of a path.
+func matchElem(e, pe PathElem) bool {
+	switch {
+	case e.Index == anyIndex:
+		return !pe.IsKey()
+	case e.IsKey():
+		return pe.IsKey() && matchKey(e.Key, pe.Key)
+	}
+	return !pe.IsKey() && pe.Index == e.Index
+}
+
+// matchKey reports whether key matches pattern, where each "*" stands
+// for any text.
+func matchKey(pattern, key string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == key
+	}
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(key, part)
+		if i < 0 {
+			return false
+		}
+		key = key[i+len(part):]
+	}
+	return strings.HasSuffix(key, parts[len(parts)-1])
+}
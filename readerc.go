@@ -23,7 +23,9 @@
 package yaml
 
 import (
+	"errors"
 	"io"
+	"unicode/utf8"
 )
 
 // Set the reader error and return 0.
@@ -35,6 +37,66 @@ func yaml_parser_set_reader_error(parser *yaml_parser_t, problem string, offset
 	return false
 }
 
+// [Go] Set the reader error for an invalid sequence of width bytes found at
+// the current position of the raw buffer and return 0.
+func yaml_parser_set_decoding_error(parser *yaml_parser_t, problem string, offset int, value int, width int) bool {
+	pos := parser.raw_buffer_pos
+	parser.problem_bytes = append([]byte(nil), parser.raw_buffer[pos:pos+width]...)
+	return yaml_parser_set_reader_error(parser, problem, offset, value)
+}
+
+// [Go] Set the reader error for a character that isn't allowed in YAML,
+// encoded in width bytes at the current position of the raw buffer, and
+// return 0.
+func yaml_parser_set_character_error(parser *yaml_parser_t, problem string, offset int, value int, width int) bool {
+	parser.problem_disallowed = true
+	return yaml_parser_set_decoding_error(parser, problem, offset, value, width)
+}
+
+// Record a reader warning and return the replacement character. Used in place
+// of yaml_parser_set_reader_error when invalid sequences are being replaced.
+func yaml_parser_replace_invalid(parser *yaml_parser_t, problem string, offset int, value int) rune {
+	yaml_parser_warn(parser, problem, offset, value)
+	return 0xFFFD
+}
+
+// [Go] Record a warning, or only count it if max_warnings are recorded
+// already.
+func yaml_parser_warn(parser *yaml_parser_t, problem string, offset int, value int) {
+	max := parser.max_warnings
+	if max == 0 {
+		max = default_max_warnings
+	}
+	if len(parser.warnings) >= max {
+		parser.dropped_warnings++
+		return
+	}
+	parser.warnings = append(parser.warnings, yaml_warning_t{
+		problem: problem,
+		offset:  offset,
+		value:   value,
+	})
+}
+
+// [Go] The characters encoded by the octets 0x80 to 0x9F in Windows-1252.
+// The five octets left undefined are read as the replacement character.
+var windows1252 = [32]rune{
+	0x20AC, 0xFFFD, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0xFFFD, 0x017D, 0xFFFD,
+	0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0xFFFD, 0x017E, 0x0178,
+}
+
+// [Go] Decode an octet that isn't valid UTF-8 as Windows-1252, recording a
+// warning as the input may be misread.
+func yaml_parser_decode_windows1252(parser *yaml_parser_t, octet byte) rune {
+	yaml_parser_warn(parser, "invalid UTF-8 octet read as Windows-1252", parser.offset, int(octet))
+	if octet < 0xA0 {
+		return windows1252[octet-0x80]
+	}
+	return rune(octet)
+}
+
 // Byte order marks.
 const (
 	bom_UTF8    = "\xef\xbb\xbf"
@@ -44,6 +106,8 @@ const (
 
 // Determine the input stream encoding by checking the BOM symbol. If no BOM is
 // found, the UTF-8 encoding is assumed. Return 1 on success, 0 on failure.
+//
+// [Go] If the encoding was set in advance, only a BOM matching it is skipped.
 func yaml_parser_determine_encoding(parser *yaml_parser_t) bool {
 	// Ensure that we had enough bytes in the raw buffer.
 	for !parser.eof && len(parser.raw_buffer)-parser.raw_buffer_pos < 3 {
@@ -56,21 +120,30 @@ func yaml_parser_determine_encoding(parser *yaml_parser_t) bool {
 	buf := parser.raw_buffer
 	pos := parser.raw_buffer_pos
 	avail := len(buf) - pos
-	if avail >= 2 && buf[pos] == bom_UTF16LE[0] && buf[pos+1] == bom_UTF16LE[1] {
+	forced := parser.encoding
+	if avail >= 2 && buf[pos] == bom_UTF16LE[0] && buf[pos+1] == bom_UTF16LE[1] &&
+		(forced == yaml_ANY_ENCODING || forced == yaml_UTF16LE_ENCODING) {
 		parser.encoding = yaml_UTF16LE_ENCODING
 		parser.raw_buffer_pos += 2
 		parser.offset += 2
-	} else if avail >= 2 && buf[pos] == bom_UTF16BE[0] && buf[pos+1] == bom_UTF16BE[1] {
+		parser.bom = true
+	} else if avail >= 2 && buf[pos] == bom_UTF16BE[0] && buf[pos+1] == bom_UTF16BE[1] &&
+		(forced == yaml_ANY_ENCODING || forced == yaml_UTF16BE_ENCODING) {
 		parser.encoding = yaml_UTF16BE_ENCODING
 		parser.raw_buffer_pos += 2
 		parser.offset += 2
-	} else if avail >= 3 && buf[pos] == bom_UTF8[0] && buf[pos+1] == bom_UTF8[1] && buf[pos+2] == bom_UTF8[2] {
+		parser.bom = true
+	} else if avail >= 3 && buf[pos] == bom_UTF8[0] && buf[pos+1] == bom_UTF8[1] && buf[pos+2] == bom_UTF8[2] &&
+		(forced == yaml_ANY_ENCODING || forced == yaml_UTF8_ENCODING) {
 		parser.encoding = yaml_UTF8_ENCODING
 		parser.raw_buffer_pos += 3
 		parser.offset += 3
-	} else {
+		parser.bom = true
+	} else if forced == yaml_ANY_ENCODING {
 		parser.encoding = yaml_UTF8_ENCODING
 	}
+	parser.encoding_determined = true
+	parser.mark.offset = parser.offset
 	return true
 }
 
@@ -88,6 +161,11 @@ func yaml_parser_update_raw_buffer(parser *yaml_parser_t) bool {
 		return true
 	}
 
+	// [Go] Decode string input from where it is.
+	if yaml_parser_borrow_raw_input(parser) {
+		return true
+	}
+
 	// Move the remaining bytes in the raw buffer to the beginning.
 	if parser.raw_buffer_pos > 0 && parser.raw_buffer_pos < len(parser.raw_buffer) {
 		copy(parser.raw_buffer, parser.raw_buffer[parser.raw_buffer_pos:])
@@ -96,16 +174,623 @@ func yaml_parser_update_raw_buffer(parser *yaml_parser_t) bool {
 	parser.raw_buffer_pos = 0
 
 	// Call the read handler to fill the buffer.
-	size_read, err := parser.read_handler(parser, parser.raw_buffer[len(parser.raw_buffer):cap(parser.raw_buffer)])
+	read_handler := yaml_parser_read_input
+	if parser.transform != nil {
+		read_handler = yaml_parser_read_transformed
+	}
+	size_read, err := read_handler(parser, parser.raw_buffer[len(parser.raw_buffer):cap(parser.raw_buffer)])
 	parser.raw_buffer = parser.raw_buffer[:len(parser.raw_buffer)+size_read]
+
+	// [Go] Keep the input that is read so that the part of it which isn't
+	// consumed can be handed back. String input is kept as a whole anyway.
+	if parser.input_reader != nil || parser.transform != nil {
+		parser.retained = append(parser.retained, parser.raw_buffer[len(parser.raw_buffer)-size_read:]...)
+	}
 	if err == io.EOF {
 		parser.eof = true
+	} else if err == errInputLimit {
+		parser.problem_err = &SizeLimitError{Limit: parser.max_bytes}
+		return yaml_parser_set_reader_error(parser, "input exceeds the size limit", parser.offset, -1)
 	} else if err != nil {
 		return yaml_parser_set_reader_error(parser, "input error: "+err.Error(), parser.offset, -1)
 	}
 	return true
 }
 
+var errInputLimit = errors.New("input limit exceeded")
+
+// [Go] Make the raw buffer the rest of the string input, rather than
+// copying the input into it bit by bit, so that the characters of the
+// input are only copied once, as they are decoded into the working
+// buffer. The input is never written to. Return true if the input is
+// borrowed.
+func yaml_parser_borrow_raw_input(parser *yaml_parser_t) bool {
+	if parser.input == nil || parser.input_reader != nil || parser.transform != nil ||
+		parser.raw_borrowed || parser.raw_buffer_pos != len(parser.raw_buffer) ||
+		parser.max_bytes > 0 && len(parser.input) > parser.max_bytes {
+		return false
+	}
+	rest := parser.input[parser.input_pos:]
+	parser.owned_raw_buffer = parser.raw_buffer
+	parser.raw_buffer = rest[:len(rest):len(rest)]
+	parser.raw_buffer_pos = 0
+	parser.raw_borrowed = true
+	parser.input_pos = len(parser.input)
+	parser.input_read += len(rest)
+	parser.eof = true
+	return true
+}
+
+// [Go] Discard the input retained before the given offset, which has been
+// consumed.
+func yaml_parser_discard_retained(parser *yaml_parser_t, offset int) {
+	if n := offset - parser.retained_offset; n > 0 && n <= len(parser.retained) {
+		parser.retained = parser.retained[n:]
+		parser.retained_offset = offset
+	}
+}
+
+// [Go] Return the input read from the given offset on, which must not be
+// before the last offset passed to yaml_parser_discard_retained.
+func yaml_parser_unconsumed_input(parser *yaml_parser_t, offset int) []byte {
+	if parser.input_reader == nil && parser.transform == nil {
+		return parser.input[offset:parser.input_pos]
+	}
+	return parser.retained[offset-parser.retained_offset:]
+}
+
+// [Go] Report the reader error held back by yaml_parser_update_buffer and
+// return 0.
+func yaml_parser_raise_held_error(parser *yaml_parser_t) bool {
+	parser.reader_error_held = false
+	parser.error = yaml_READER_ERROR
+	return false
+}
+
+// [Go] Call the read handler, counting the bytes read so that reading more
+// than max_bytes of input fails with errInputLimit.
+func yaml_parser_read_input(parser *yaml_parser_t, buffer []byte) (n int, err error) {
+	if parser.max_bytes > 0 && len(buffer) > parser.max_bytes-parser.input_read+1 {
+		buffer = buffer[:parser.max_bytes-parser.input_read+1]
+	}
+	n, err = parser.read_handler(parser, buffer)
+	parser.input_read += n
+	if parser.max_bytes > 0 && parser.input_read > parser.max_bytes {
+		return n, errInputLimit
+	}
+	return n, err
+}
+
+// [Go] Read the input through the transform function. Used in place of the
+// read handler when a transform is set.
+//
+// This follows transform.Reader from golang.org/x/text, but as the errors
+// reporting short buffers can't be told apart from others without depending
+// on it, any error is retried while more input can be read or the transform
+// is making progress.
+func yaml_parser_read_transformed(parser *yaml_parser_t, buffer []byte) (n int, err error) {
+	if parser.transform_src == nil {
+		parser.transform_src = make([]byte, 0, cap(parser.raw_buffer))
+	}
+	// Leave room for the longest character the transform may produce.
+	if len(buffer) < 4 {
+		return 0, nil
+	}
+	for {
+		src := parser.transform_src
+		if !parser.transform_eof && len(src) < cap(src) {
+			n, err := yaml_parser_read_input(parser, src[len(src):cap(src)])
+			src = src[:len(src)+n]
+			if err == io.EOF {
+				parser.transform_eof = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		n, n_src, err := parser.transform(buffer, src, parser.transform_eof)
+		parser.transform_src = src[:copy(src, src[n_src:])]
+		if parser.transform_eof && len(parser.transform_src) == 0 && err == nil {
+			return n, io.EOF
+		}
+		if n > 0 || n_src > 0 {
+			return n, nil
+		}
+		if parser.transform_eof || len(src) == cap(src) {
+			if err == nil {
+				err = errors.New("input transform made no progress")
+			}
+			return 0, err
+		}
+	}
+}
+
+// Decode as much of the raw buffer as fits into the buffer, starting at
+// buffer_len. Return the new buffer length, and false on failure.
+//
+// [Go] Split out of yaml_parser_update_buffer so the decoding loop can be
+// reused by Transformer.
+func yaml_parser_decode_raw(parser *yaml_parser_t, buffer_len int) (int, bool) {
+inner:
+	for parser.raw_buffer_pos != len(parser.raw_buffer) {
+		var value rune
+		var width int
+
+		// [Go] Replacement characters may take more room than the
+		// sequences they replace, so make sure the buffer can hold the
+		// largest character plus the NUL terminator.
+		if len(parser.buffer)-buffer_len < 5 {
+			break inner
+		}
+
+		raw_unread := len(parser.raw_buffer) - parser.raw_buffer_pos
+
+		// Decode the next character.
+	decode:
+		switch parser.encoding {
+		case yaml_UTF8_ENCODING:
+			// Decode a UTF-8 character.  Check RFC 3629
+			// (http://www.ietf.org/rfc/rfc3629.txt) for more details.
+			//
+			// The following table (taken from the RFC) is used for
+			// decoding.
+			//
+			//    Char. number range |        UTF-8 octet sequence
+			//      (hexadecimal)    |              (binary)
+			//   --------------------+------------------------------------
+			//   0000 0000-0000 007F | 0xxxxxxx
+			//   0000 0080-0000 07FF | 110xxxxx 10xxxxxx
+			//   0000 0800-0000 FFFF | 1110xxxx 10xxxxxx 10xxxxxx
+			//   0001 0000-0010 FFFF | 11110xxx 10xxxxxx 10xxxxxx 10xxxxxx
+			//
+			// Additionally, the characters in the range 0xD800-0xDFFF
+			// are prohibited as they are reserved for use with UTF-16
+			// surrogate pairs.
+
+			// Determine the length of the UTF-8 sequence.
+			octet := parser.raw_buffer[parser.raw_buffer_pos]
+
+			// [Go] Each document in a stream may start with a BOM,
+			// but the encoding cannot change between documents.
+			if octet == bom_UTF16LE[0] || octet == bom_UTF16BE[0] {
+				if raw_unread < 2 && !parser.eof {
+					break inner
+				}
+				if raw_unread >= 2 && (octet == bom_UTF16LE[0] && parser.raw_buffer[parser.raw_buffer_pos+1] == bom_UTF16LE[1] ||
+					octet == bom_UTF16BE[0] && parser.raw_buffer[parser.raw_buffer_pos+1] == bom_UTF16BE[1]) {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"found a UTF-16 byte order mark in a UTF-8 stream",
+						parser.offset, int(octet), 2)
+				}
+			}
+
+			// [Go] Read invalid UTF-8 as Windows-1252 if requested.
+			if parser.windows1252 && octet >= 0x80 && (parser.eof || utf8.FullRune(parser.raw_buffer[parser.raw_buffer_pos:])) {
+				if r, w := utf8.DecodeRune(parser.raw_buffer[parser.raw_buffer_pos:]); r == utf8.RuneError && w == 1 {
+					value = yaml_parser_decode_windows1252(parser, octet)
+					width = 1
+					break decode
+				}
+			}
+
+			switch {
+			case octet&0x80 == 0x00:
+				width = 1
+			case octet&0xE0 == 0xC0:
+				width = 2
+			case octet&0xF0 == 0xE0:
+				width = 3
+			case octet&0xF8 == 0xF0:
+				width = 4
+			default:
+				// The leading octet is invalid.
+				if !parser.replace_invalid {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"invalid leading UTF-8 octet",
+						parser.offset, int(octet), 1)
+				}
+				value = yaml_parser_replace_invalid(parser,
+					"invalid leading UTF-8 octet",
+					parser.offset, int(octet))
+				width = 1
+				break decode
+			}
+
+			// Check if the raw buffer contains an incomplete character.
+			if width > raw_unread {
+				if !parser.eof {
+					break inner
+				}
+				if !parser.replace_invalid {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"incomplete UTF-8 octet sequence",
+						parser.offset, -1, raw_unread)
+				}
+				value = yaml_parser_replace_invalid(parser,
+					"incomplete UTF-8 octet sequence",
+					parser.offset, -1)
+				width = raw_unread
+				break decode
+			}
+
+			// Decode the leading octet.
+			switch {
+			case octet&0x80 == 0x00:
+				value = rune(octet & 0x7F)
+			case octet&0xE0 == 0xC0:
+				value = rune(octet & 0x1F)
+			case octet&0xF0 == 0xE0:
+				value = rune(octet & 0x0F)
+			case octet&0xF8 == 0xF0:
+				value = rune(octet & 0x07)
+			default:
+				value = 0
+			}
+
+			// Check and decode the trailing octets.
+			for k := 1; k < width; k++ {
+				octet = parser.raw_buffer[parser.raw_buffer_pos+k]
+
+				// Check if the octet is valid.
+				if (octet & 0xC0) != 0x80 {
+					if !parser.replace_invalid {
+						return buffer_len, yaml_parser_set_decoding_error(parser,
+							"invalid trailing UTF-8 octet",
+							parser.offset+k, int(octet), k+1)
+					}
+					value = yaml_parser_replace_invalid(parser,
+						"invalid trailing UTF-8 octet",
+						parser.offset+k, int(octet))
+					width = k
+					break decode
+				}
+
+				// Decode the octet.
+				value = (value << 6) + rune(octet&0x3F)
+			}
+
+			// Check the length of the sequence against the value.
+			switch {
+			case width == 1:
+			case width == 2 && value >= 0x80:
+			case width == 3 && value >= 0x800:
+			case width == 4 && value >= 0x10000:
+			default:
+				if !parser.replace_invalid {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"invalid length of a UTF-8 sequence",
+						parser.offset, -1, width)
+				}
+				value = yaml_parser_replace_invalid(parser,
+					"invalid length of a UTF-8 sequence",
+					parser.offset, -1)
+				width = 1
+				break decode
+			}
+
+			// Check the range of the value.
+			if value >= 0xD800 && value <= 0xDFFF || value > 0x10FFFF {
+				if !parser.replace_invalid {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"invalid Unicode character",
+						parser.offset, int(value), width)
+				}
+				value = yaml_parser_replace_invalid(parser,
+					"invalid Unicode character",
+					parser.offset, int(value))
+				width = 1
+			}
+
+		case yaml_UTF16LE_ENCODING, yaml_UTF16BE_ENCODING:
+			var low, high int
+			if parser.encoding == yaml_UTF16LE_ENCODING {
+				low, high = 0, 1
+			} else {
+				low, high = 1, 0
+			}
+
+			// The UTF-16 encoding is not as simple as one might
+			// naively think.  Check RFC 2781
+			// (http://www.ietf.org/rfc/rfc2781.txt).
+			//
+			// Normally, two subsequent bytes describe a Unicode
+			// character.  However a special technique (called a
+			// surrogate pair) is used for specifying character
+			// values larger than 0xFFFF.
+			//
+			// A surrogate pair consists of two pseudo-characters:
+			//      high surrogate area (0xD800-0xDBFF)
+			//      low surrogate area (0xDC00-0xDFFF)
+			//
+			// The following formulas are used for decoding
+			// and encoding characters using surrogate pairs:
+			//
+			//  U  = U' + 0x10000   (0x01 00 00 <= U <= 0x10 FF FF)
+			//  U' = yyyyyyyyyyxxxxxxxxxx   (0 <= U' <= 0x0F FF FF)
+			//  W1 = 110110yyyyyyyyyy
+			//  W2 = 110111xxxxxxxxxx
+			//
+			// where U is the character value, W1 is the high surrogate
+			// area, W2 is the low surrogate area.
+
+			// Check for incomplete UTF-16 character.
+			if raw_unread < 2 {
+				if !parser.eof {
+					break inner
+				}
+				if !parser.replace_invalid {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"incomplete UTF-16 character",
+						parser.offset, -1, raw_unread)
+				}
+				value = yaml_parser_replace_invalid(parser,
+					"incomplete UTF-16 character",
+					parser.offset, -1)
+				width = raw_unread
+				break decode
+			}
+
+			// Get the character.
+			value = rune(parser.raw_buffer[parser.raw_buffer_pos+low]) +
+				(rune(parser.raw_buffer[parser.raw_buffer_pos+high]) << 8)
+
+			// Check for unexpected low surrogate area.
+			if value&0xFC00 == 0xDC00 {
+				if !parser.replace_invalid && parser.surrogates == yaml_SURROGATE_ERROR {
+					return buffer_len, yaml_parser_set_decoding_error(parser,
+						"unexpected low surrogate area",
+						parser.offset, int(value), 2)
+				}
+				width = 2
+				if parser.surrogates == yaml_SURROGATE_WTF8 {
+					break decode
+				}
+				value = yaml_parser_replace_invalid(parser,
+					"unexpected low surrogate area",
+					parser.offset, int(value))
+				break decode
+			}
+
+			// Check for a high surrogate area.
+			if value&0xFC00 == 0xD800 {
+				width = 4
+
+				// Check for incomplete surrogate pair.
+				if raw_unread < 4 {
+					if !parser.eof {
+						break inner
+					}
+					if !parser.replace_invalid && parser.surrogates == yaml_SURROGATE_ERROR {
+						return buffer_len, yaml_parser_set_decoding_error(parser,
+							"incomplete UTF-16 surrogate pair",
+							parser.offset, -1, raw_unread)
+					}
+					width = 2
+					if parser.surrogates == yaml_SURROGATE_WTF8 {
+						break decode
+					}
+					value = yaml_parser_replace_invalid(parser,
+						"incomplete UTF-16 surrogate pair",
+						parser.offset, -1)
+					break decode
+				}
+
+				// Get the next character.
+				value2 := rune(parser.raw_buffer[parser.raw_buffer_pos+low+2]) +
+					(rune(parser.raw_buffer[parser.raw_buffer_pos+high+2]) << 8)
+
+				// Check for a low surrogate area.
+				if value2&0xFC00 != 0xDC00 {
+					if !parser.replace_invalid && parser.surrogates == yaml_SURROGATE_ERROR {
+						return buffer_len, yaml_parser_set_decoding_error(parser,
+							"expected low surrogate area",
+							parser.offset+2, int(value2), 4)
+					}
+					width = 2
+					if parser.surrogates == yaml_SURROGATE_WTF8 {
+						break decode
+					}
+					value = yaml_parser_replace_invalid(parser,
+						"expected low surrogate area",
+						parser.offset+2, int(value2))
+					break decode
+				}
+
+				// Generate the value of the surrogate pair.
+				value = 0x10000 + ((value & 0x3FF) << 10) + (value2 & 0x3FF)
+			} else {
+				width = 2
+			}
+
+			// [Go] A byte-swapped BOM means a document is trying to
+			// change the byte order of the stream.
+			if value == 0xFFFE {
+				return buffer_len, yaml_parser_set_decoding_error(parser,
+					"found a byte order mark that does not match the UTF-16 stream",
+					parser.offset, int(value), width)
+			}
+
+		default:
+			panic("impossible")
+		}
+
+		// Check if the character is in the allowed range:
+		//      #x9 | #xA | #xD | [#x20-#x7E]               (8 bit)
+		//      | #x85 | [#xA0-#xD7FF] | [#xE000-#xFFFD]    (16 bit)
+		//      | [#x10000-#x10FFFF]                        (32 bit)
+		switch {
+		case value == 0x09:
+		case value == 0x0A:
+		case value == 0x0D:
+		case value >= 0x20 && value <= 0x7E:
+		case value == 0x85:
+		case value >= 0xA0 && value <= 0xD7FF:
+		case value >= 0xE000 && value <= 0xFFFD:
+		case value >= 0x10000 && value <= 0x10FFFF:
+		case value >= 0xD800 && value <= 0xDFFF && parser.surrogates == yaml_SURROGATE_WTF8:
+			// [Go] Unpaired surrogates are passed through as WTF-8.
+		default:
+			return buffer_len, yaml_parser_set_character_error(parser,
+				"control characters are not allowed",
+				parser.offset, int(value), width)
+		}
+
+		// [Go] In strict mode, also check for the Unicode noncharacters
+		// U+FDD0-U+FDEF and the last two code points of every plane.
+		// U+FFFE and U+FFFF are never allowed.
+		if parser.strict_chars && (value >= 0xFDD0 && value <= 0xFDEF || value&0xFFFE == 0xFFFE) {
+			if !parser.replace_invalid {
+				return buffer_len, yaml_parser_set_character_error(parser,
+					"noncharacters are not allowed",
+					parser.offset, int(value), width)
+			}
+			value = yaml_parser_replace_invalid(parser,
+				"noncharacters are not allowed",
+				parser.offset, int(value))
+		}
+
+		// [Go] Turn CR LF and lone CR into LF if requested. The LF
+		// following a CR is dropped when it is read.
+		if parser.normalize_breaks {
+			if value == '\n' && parser.last_cr {
+				parser.last_cr = false
+				parser.raw_buffer_pos += width
+				parser.offset += width
+				// Count the LF as part of the CR, or past the current
+				// position if the CR was read already.
+				if buffer_len > 0 {
+					yaml_parser_set_raw_width(parser, buffer_len-1, raw_width(parser, buffer_len-1)+width)
+				} else {
+					parser.mark.offset += width
+				}
+				continue
+			}
+			parser.last_cr = value == '\r'
+			if value == '\r' {
+				value = '\n'
+			}
+		}
+
+		// Move the raw pointers.
+		parser.raw_buffer_pos += width
+		parser.offset += width
+
+		// Finally put the character into the buffer.
+		start := buffer_len
+		if value <= 0x7F {
+			// 0000 0000-0000 007F . 0xxxxxxx
+			parser.buffer[buffer_len+0] = byte(value)
+			buffer_len += 1
+		} else if value <= 0x7FF {
+			// 0000 0080-0000 07FF . 110xxxxx 10xxxxxx
+			parser.buffer[buffer_len+0] = byte(0xC0 + (value >> 6))
+			parser.buffer[buffer_len+1] = byte(0x80 + (value & 0x3F))
+			buffer_len += 2
+		} else if value <= 0xFFFF {
+			// 0000 0800-0000 FFFF . 1110xxxx 10xxxxxx 10xxxxxx
+			parser.buffer[buffer_len+0] = byte(0xE0 + (value >> 12))
+			parser.buffer[buffer_len+1] = byte(0x80 + ((value >> 6) & 0x3F))
+			parser.buffer[buffer_len+2] = byte(0x80 + (value & 0x3F))
+			buffer_len += 3
+		} else {
+			// 0001 0000-0010 FFFF . 11110xxx 10xxxxxx 10xxxxxx 10xxxxxx
+			parser.buffer[buffer_len+0] = byte(0xF0 + (value >> 18))
+			parser.buffer[buffer_len+1] = byte(0x80 + ((value >> 12) & 0x3F))
+			parser.buffer[buffer_len+2] = byte(0x80 + ((value >> 6) & 0x3F))
+			parser.buffer[buffer_len+3] = byte(0x80 + (value & 0x3F))
+			buffer_len += 4
+		}
+
+		// [Go] Keep the input length of the character once it may differ
+		// from its length in the buffer, so that marks hold input offsets.
+		if width != buffer_len-start || parser.raw_widths != nil {
+			yaml_parser_set_raw_width(parser, start, width)
+		}
+
+		parser.unread++
+	}
+	return buffer_len, true
+}
+
+// [Go] Record the input length of the character at the given buffer
+// position. Input lengths are only kept once some differ from the lengths
+// of the characters in the buffer.
+func yaml_parser_set_raw_width(parser *yaml_parser_t, pos, raw int) {
+	if parser.raw_widths == nil {
+		if parser.read_handler == nil {
+			// Transformers have no use for input offsets.
+			return
+		}
+		parser.raw_widths = make([]byte, cap(parser.buffer))
+		for i := parser.buffer_pos; i < pos; i += width(parser.buffer[i]) {
+			parser.raw_widths[i] = byte(width(parser.buffer[i]))
+		}
+	}
+	parser.raw_widths[pos] = byte(raw)
+}
+
+// [Go] Make the working buffer borrow the input string, so that it isn't
+// copied. This is only possible when the input is valid UTF-8 made of
+// characters allowed in YAML, and it doesn't need to be altered while
+// reading it. Return true if the input is borrowed.
+func yaml_parser_borrow_input(parser *yaml_parser_t) bool {
+	if parser.input_pos != 0 || parser.transform != nil ||
+		parser.normalize_breaks || parser.strict_chars ||
+		parser.encoding != yaml_ANY_ENCODING && parser.encoding != yaml_UTF8_ENCODING ||
+		parser.max_bytes > 0 && len(parser.input) > parser.max_bytes {
+		return false
+	}
+	input := parser.input
+	bom := len(input) >= 3 && input[0] == bom_UTF8[0] && input[1] == bom_UTF8[1] && input[2] == bom_UTF8[2]
+	if bom {
+		input = input[3:]
+	}
+	unread, ok := yaml_check_input(input)
+	if !ok {
+		return false
+	}
+	parser.encoding = yaml_UTF8_ENCODING
+	parser.encoding_determined = true
+	parser.bom = bom
+	parser.owned_buffer = parser.buffer
+	parser.buffer = input[:len(input):len(input)]
+	parser.buffer_pos = 0
+	parser.unread = unread
+	parser.mark.offset = len(parser.input) - len(input)
+	parser.input_borrowed = true
+	parser.input_pos = len(parser.input)
+	parser.input_read = len(parser.input)
+	parser.offset = len(parser.input)
+	parser.eof = true
+	return true
+}
+
+// [Go] Check that b is valid UTF-8 made of characters allowed in YAML, and
+// return the number of characters in it.
+func yaml_check_input(b []byte) (n int, ok bool) {
+	for i := 0; i < len(b); n++ {
+		if b[i] < utf8.RuneSelf {
+			if b[i] < 0x20 && b[i] != 0x09 && b[i] != 0x0A && b[i] != 0x0D || b[i] == 0x7F {
+				return n, false
+			}
+			i++
+			continue
+		}
+		value, width := utf8.DecodeRune(b[i:])
+		switch {
+		case width == 1: // Invalid UTF-8.
+			return n, false
+		case value == 0x85:
+		case value >= 0xA0 && value <= 0xD7FF:
+		case value >= 0xE000 && value <= 0xFFFD:
+		case value >= 0x10000 && value <= 0x10FFFF:
+		default:
+			return n, false
+		}
+		i += width
+	}
+	return n, true
+}
+
 // Ensure that the buffer contains at least `length` characters.
 // Return true on success, false on failure.
 //
@@ -134,17 +819,44 @@ func yaml_parser_update_buffer(parser *yaml_parser_t, length int) bool {
 		return true
 	}
 
+	// [Go] Decode string input in place if possible.
+	if !parser.encoding_determined && parser.input != nil && yaml_parser_borrow_input(parser) && parser.unread >= length {
+		return true
+	}
+
 	// Determine the input encoding if it is not known yet.
-	if parser.encoding == yaml_ANY_ENCODING {
+	if !parser.encoding_determined {
 		if !yaml_parser_determine_encoding(parser) {
 			return false
 		}
 	}
 
+	// [Go] Stop borrowing the input once it runs short, going on with the
+	// rest of it copied into the working buffer.
+	if parser.input_borrowed {
+		rest := parser.buffer[parser.buffer_pos:]
+		buffer := parser.owned_buffer[:0]
+		if cap(buffer) < len(rest)+length+1 {
+			if parser.pooled_buffers {
+				put_buffer(buffer)
+				buffer = get_buffer(len(rest) + length + 1)
+			} else {
+				buffer = make([]byte, 0, len(rest)+length+1)
+			}
+		}
+		parser.buffer = append(buffer, rest...)
+		parser.buffer_pos = 0
+		parser.owned_buffer = nil
+		parser.input_borrowed = false
+	}
+
 	// Move the unread characters to the beginning of the buffer.
 	buffer_len := len(parser.buffer)
 	if parser.buffer_pos > 0 && parser.buffer_pos < buffer_len {
 		copy(parser.buffer, parser.buffer[parser.buffer_pos:])
+		if parser.raw_widths != nil {
+			copy(parser.raw_widths, parser.raw_widths[parser.buffer_pos:buffer_len])
+		}
 		buffer_len -= parser.buffer_pos
 		parser.buffer_pos = 0
 	} else if parser.buffer_pos == buffer_len {
@@ -157,7 +869,7 @@ func yaml_parser_update_buffer(parser *yaml_parser_t, length int) bool {
 
 	// Fill the buffer until it has enough characters.
 	first := true
-	for parser.unread < length {
+	for parser.unread < length && !parser.reader_error_held {
 
 		// Fill the raw buffer if necessary.
 		if !first || parser.raw_buffer_pos == len(parser.raw_buffer) {
@@ -169,251 +881,27 @@ func yaml_parser_update_buffer(parser *yaml_parser_t, length int) bool {
 		first = false
 
 		// Decode the raw buffer.
-	inner:
-		for parser.raw_buffer_pos != len(parser.raw_buffer) {
-			var value rune
-			var width int
-
-			raw_unread := len(parser.raw_buffer) - parser.raw_buffer_pos
-
-			// Decode the next character.
-			switch parser.encoding {
-			case yaml_UTF8_ENCODING:
-				// Decode a UTF-8 character.  Check RFC 3629
-				// (http://www.ietf.org/rfc/rfc3629.txt) for more details.
-				//
-				// The following table (taken from the RFC) is used for
-				// decoding.
-				//
-				//    Char. number range |        UTF-8 octet sequence
-				//      (hexadecimal)    |              (binary)
-				//   --------------------+------------------------------------
-				//   0000 0000-0000 007F | 0xxxxxxx
-				//   0000 0080-0000 07FF | 110xxxxx 10xxxxxx
-				//   0000 0800-0000 FFFF | 1110xxxx 10xxxxxx 10xxxxxx
-				//   0001 0000-0010 FFFF | 11110xxx 10xxxxxx 10xxxxxx 10xxxxxx
-				//
-				// Additionally, the characters in the range 0xD800-0xDFFF
-				// are prohibited as they are reserved for use with UTF-16
-				// surrogate pairs.
-
-				// Determine the length of the UTF-8 sequence.
-				octet := parser.raw_buffer[parser.raw_buffer_pos]
-				switch {
-				case octet&0x80 == 0x00:
-					width = 1
-				case octet&0xE0 == 0xC0:
-					width = 2
-				case octet&0xF0 == 0xE0:
-					width = 3
-				case octet&0xF8 == 0xF0:
-					width = 4
-				default:
-					// The leading octet is invalid.
-					return yaml_parser_set_reader_error(parser,
-						"invalid leading UTF-8 octet",
-						parser.offset, int(octet))
-				}
-
-				// Check if the raw buffer contains an incomplete character.
-				if width > raw_unread {
-					if parser.eof {
-						return yaml_parser_set_reader_error(parser,
-							"incomplete UTF-8 octet sequence",
-							parser.offset, -1)
-					}
-					break inner
-				}
-
-				// Decode the leading octet.
-				switch {
-				case octet&0x80 == 0x00:
-					value = rune(octet & 0x7F)
-				case octet&0xE0 == 0xC0:
-					value = rune(octet & 0x1F)
-				case octet&0xF0 == 0xE0:
-					value = rune(octet & 0x0F)
-				case octet&0xF8 == 0xF0:
-					value = rune(octet & 0x07)
-				default:
-					value = 0
-				}
-
-				// Check and decode the trailing octets.
-				for k := 1; k < width; k++ {
-					octet = parser.raw_buffer[parser.raw_buffer_pos+k]
-
-					// Check if the octet is valid.
-					if (octet & 0xC0) != 0x80 {
-						return yaml_parser_set_reader_error(parser,
-							"invalid trailing UTF-8 octet",
-							parser.offset+k, int(octet))
-					}
-
-					// Decode the octet.
-					value = (value << 6) + rune(octet&0x3F)
-				}
-
-				// Check the length of the sequence against the value.
-				switch {
-				case width == 1:
-				case width == 2 && value >= 0x80:
-				case width == 3 && value >= 0x800:
-				case width == 4 && value >= 0x10000:
-				default:
-					return yaml_parser_set_reader_error(parser,
-						"invalid length of a UTF-8 sequence",
-						parser.offset, -1)
-				}
-
-				// Check the range of the value.
-				if value >= 0xD800 && value <= 0xDFFF || value > 0x10FFFF {
-					return yaml_parser_set_reader_error(parser,
-						"invalid Unicode character",
-						parser.offset, int(value))
-				}
-
-			case yaml_UTF16LE_ENCODING, yaml_UTF16BE_ENCODING:
-				var low, high int
-				if parser.encoding == yaml_UTF16LE_ENCODING {
-					low, high = 0, 1
-				} else {
-					low, high = 1, 0
-				}
-
-				// The UTF-16 encoding is not as simple as one might
-				// naively think.  Check RFC 2781
-				// (http://www.ietf.org/rfc/rfc2781.txt).
-				//
-				// Normally, two subsequent bytes describe a Unicode
-				// character.  However a special technique (called a
-				// surrogate pair) is used for specifying character
-				// values larger than 0xFFFF.
-				//
-				// A surrogate pair consists of two pseudo-characters:
-				//      high surrogate area (0xD800-0xDBFF)
-				//      low surrogate area (0xDC00-0xDFFF)
-				//
-				// The following formulas are used for decoding
-				// and encoding characters using surrogate pairs:
-				//
-				//  U  = U' + 0x10000   (0x01 00 00 <= U <= 0x10 FF FF)
-				//  U' = yyyyyyyyyyxxxxxxxxxx   (0 <= U' <= 0x0F FF FF)
-				//  W1 = 110110yyyyyyyyyy
-				//  W2 = 110111xxxxxxxxxx
-				//
-				// where U is the character value, W1 is the high surrogate
-				// area, W2 is the low surrogate area.
-
-				// Check for incomplete UTF-16 character.
-				if raw_unread < 2 {
-					if parser.eof {
-						return yaml_parser_set_reader_error(parser,
-							"incomplete UTF-16 character",
-							parser.offset, -1)
-					}
-					break inner
-				}
-
-				// Get the character.
-				value = rune(parser.raw_buffer[parser.raw_buffer_pos+low]) +
-					(rune(parser.raw_buffer[parser.raw_buffer_pos+high]) << 8)
-
-				// Check for unexpected low surrogate area.
-				if value&0xFC00 == 0xDC00 {
-					return yaml_parser_set_reader_error(parser,
-						"unexpected low surrogate area",
-						parser.offset, int(value))
-				}
-
-				// Check for a high surrogate area.
-				if value&0xFC00 == 0xD800 {
-					width = 4
-
-					// Check for incomplete surrogate pair.
-					if raw_unread < 4 {
-						if parser.eof {
-							return yaml_parser_set_reader_error(parser,
-								"incomplete UTF-16 surrogate pair",
-								parser.offset, -1)
-						}
-						break inner
-					}
-
-					// Get the next character.
-					value2 := rune(parser.raw_buffer[parser.raw_buffer_pos+low+2]) +
-						(rune(parser.raw_buffer[parser.raw_buffer_pos+high+2]) << 8)
-
-					// Check for a low surrogate area.
-					if value2&0xFC00 != 0xDC00 {
-						return yaml_parser_set_reader_error(parser,
-							"expected low surrogate area",
-							parser.offset+2, int(value2))
-					}
-
-					// Generate the value of the surrogate pair.
-					value = 0x10000 + ((value & 0x3FF) << 10) + (value2 & 0x3FF)
-				} else {
-					width = 2
-				}
-
-			default:
-				panic("impossible")
-			}
-
-			// Check if the character is in the allowed range:
-			//      #x9 | #xA | #xD | [#x20-#x7E]               (8 bit)
-			//      | #x85 | [#xA0-#xD7FF] | [#xE000-#xFFFD]    (16 bit)
-			//      | [#x10000-#x10FFFF]                        (32 bit)
-			switch {
-			case value == 0x09:
-			case value == 0x0A:
-			case value == 0x0D:
-			case value >= 0x20 && value <= 0x7E:
-			case value == 0x85:
-			case value >= 0xA0 && value <= 0xD7FF:
-			case value >= 0xE000 && value <= 0xFFFD:
-			case value >= 0x10000 && value <= 0x10FFFF:
-			default:
-				return yaml_parser_set_reader_error(parser,
-					"control characters are not allowed",
-					parser.offset, int(value))
-			}
-
-			// Move the raw pointers.
-			parser.raw_buffer_pos += width
-			parser.offset += width
-
-			// Finally put the character into the buffer.
-			if value <= 0x7F {
-				// 0000 0000-0000 007F . 0xxxxxxx
-				parser.buffer[buffer_len+0] = byte(value)
-				buffer_len += 1
-			} else if value <= 0x7FF {
-				// 0000 0080-0000 07FF . 110xxxxx 10xxxxxx
-				parser.buffer[buffer_len+0] = byte(0xC0 + (value >> 6))
-				parser.buffer[buffer_len+1] = byte(0x80 + (value & 0x3F))
-				buffer_len += 2
-			} else if value <= 0xFFFF {
-				// 0000 0800-0000 FFFF . 1110xxxx 10xxxxxx 10xxxxxx
-				parser.buffer[buffer_len+0] = byte(0xE0 + (value >> 12))
-				parser.buffer[buffer_len+1] = byte(0x80 + ((value >> 6) & 0x3F))
-				parser.buffer[buffer_len+2] = byte(0x80 + (value & 0x3F))
-				buffer_len += 3
-			} else {
-				// 0001 0000-0010 FFFF . 11110xxx 10xxxxxx 10xxxxxx 10xxxxxx
-				parser.buffer[buffer_len+0] = byte(0xF0 + (value >> 18))
-				parser.buffer[buffer_len+1] = byte(0x80 + ((value >> 12) & 0x3F))
-				parser.buffer[buffer_len+2] = byte(0x80 + ((value >> 6) & 0x3F))
-				parser.buffer[buffer_len+3] = byte(0x80 + (value & 0x3F))
-				buffer_len += 4
+		var ok bool
+		if buffer_len, ok = yaml_parser_decode_raw(parser, buffer_len); !ok {
+			// [Go] Hold the error back until the characters before it
+			// are used up, so that a stream may go on with data that
+			// isn't YAML after a document. The input seems to end at the
+			// error until then, and the error is raised once the parser
+			// gets there.
+			if parser.unread == 0 {
+				return false
 			}
-
+			parser.error = yaml_NO_ERROR
+			parser.reader_error_held = true
+			parser.held_offset = parser.offset
+			parser.buffer[buffer_len] = 0
+			buffer_len++
 			parser.unread++
+			break
 		}
 
 		// On EOF, put NUL into the buffer and return.
-		if parser.eof {
+		if parser.eof && parser.raw_buffer_pos == len(parser.raw_buffer) {
 			parser.buffer[buffer_len] = 0
 			buffer_len++
 			parser.unread++
@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+// Redact replaces the values at the given paths within n with the string
+// replacement, keeping the rest of n as it is, with its comments, styles
+// and anchors, so that it may be logged or shown without its secrets.
+//
+// Paths are patterns in the string form of a Path, where a "**" step
+// matches any number of steps, none included, a "[*]" step any index,
+// and a key holding "*" any key where each "*" stands for any text, as
+// in "**.password", "users[*].token" or "**.*_key". The scalars within a
+// mapping or sequence matched are all replaced, but not the mapping keys.
+//
+// Aliases on the way are followed, so the values under their anchor are
+// replaced as well, while an alias matched itself is replaced on its own.
+// An error is returned for an invalid pattern, and n is left as it is.
+func Redact(n *Node, paths []string, replacement string) error {
+	patterns := make([]Path, len(paths))
+	for i, s := range paths {
+		p, err := parsePath(s, true)
+		if err != nil {
+			return err
+		}
+		patterns[i] = p
+	}
+	r := redactor{patterns: patterns, replacement: replacement, active: make(map[*Node]bool)}
+	r.node(n, nil, false)
+	return nil
+}
+
+type redactor struct {
+	patterns    []Path
+	replacement string
+
+	// active holds the nodes being redacted, for aliases within their
+	// anchored value to be skipped.
+	active map[*Node]bool
+}
+
+func (r *redactor) node(n *Node, path Path, all bool) {
+	if n == nil || r.active[n] {
+		return
+	}
+	if !all && n.Kind != DocumentNode {
+		all = r.matches(path)
+	}
+	r.active[n] = true
+	defer delete(r.active, n)
+	switch n.Kind {
+	case DocumentNode:
+		for _, c := range n.Content {
+			r.node(c, path, all)
+		}
+	case SequenceNode:
+		for i, c := range n.Content {
+			r.node(c, path.Index(i), all)
+		}
+	case MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			r.node(n.Content[i+1], path.Key(n.Content[i].Value), all)
+		}
+	case AliasNode:
+		if all {
+			n.Kind = ScalarNode
+			n.Alias = nil
+			r.scalar(n)
+		} else {
+			r.node(n.Alias, path, false)
+		}
+	case ScalarNode:
+		if all {
+			r.scalar(n)
+		}
+	}
+}
+
+func (r *redactor) matches(path Path) bool {
+	for _, p := range r.patterns {
+		if matchPath(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) scalar(n *Node) {
+	n.Tag = strTag
+	n.Style &^= TaggedStyle
+	n.Value = r.replacement
+}
@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestRedact(c *C) {
+	in := `# Database settings.
+db:
+  user: admin
+  password: hunter2 # changed yearly
+  api_key: !secret abc
+users:
+  - name: a
+    token: t1
+  - name: b
+    token: t2
+secrets: &s
+  x: 1
+  y: [2, 3]
+backup: *s
+other: &o plain
+copy: *o
+`
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(in), &n), IsNil)
+	err := yaml.Redact(&n, []string{"**.password", "**.*_key", "users[*].token", "secrets", "copy"}, "REDACTED")
+	c.Assert(err, IsNil)
+	data, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `# Database settings.
+db:
+    user: admin
+    password: REDACTED # changed yearly
+    api_key: REDACTED
+users:
+    - name: a
+      token: REDACTED
+    - name: b
+      token: REDACTED
+secrets: &s
+    x: REDACTED
+    y: [REDACTED, REDACTED]
+backup: *s
+other: &o plain
+copy: REDACTED
+`)
+
+	// Values reached through aliases are replaced under their anchor.
+	c.Assert(yaml.Unmarshal([]byte("a: &a {k: 1}\nb: *a\n"), &n), IsNil)
+	c.Assert(yaml.Redact(&n, []string{"b.k"}, "***"), IsNil)
+	data, err = yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "a: &a {k: '***'}\nb: *a\n")
+
+	c.Assert(yaml.Redact(&n, []string{"a[x"}, ""), ErrorMatches, `yaml: invalid path "a\[x"`)
+}
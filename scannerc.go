@@ -516,6 +516,7 @@ func skip(parser *yaml_parser_t) {
 	}
 	parser.mark.index++
 	parser.mark.column++
+	parser.mark.offset += raw_width(parser, parser.buffer_pos)
 	parser.unread--
 	parser.buffer_pos += width(parser.buffer[parser.buffer_pos])
 }
@@ -523,6 +524,7 @@ func skip(parser *yaml_parser_t) {
 func skip_line(parser *yaml_parser_t) {
 	if is_crlf(parser.buffer, parser.buffer_pos) {
 		parser.mark.index += 2
+		parser.mark.offset += raw_width(parser, parser.buffer_pos) + raw_width(parser, parser.buffer_pos+1)
 		parser.mark.column = 0
 		parser.mark.line++
 		parser.unread -= 2
@@ -530,6 +532,7 @@ func skip_line(parser *yaml_parser_t) {
 		parser.newlines++
 	} else if is_break(parser.buffer, parser.buffer_pos) {
 		parser.mark.index++
+		parser.mark.offset += raw_width(parser, parser.buffer_pos)
 		parser.mark.column = 0
 		parser.mark.line++
 		parser.unread--
@@ -550,6 +553,7 @@ func read(parser *yaml_parser_t, s []byte) []byte {
 	if len(s) == 0 {
 		s = make([]byte, 0, 32)
 	}
+	parser.mark.offset += raw_width(parser, parser.buffer_pos)
 	if w == 1 && len(s)+w <= cap(s) {
 		s = s[:len(s)+1]
 		s[len(s)-1] = parser.buffer[parser.buffer_pos]
@@ -574,6 +578,7 @@ func read_line(parser *yaml_parser_t, s []byte) []byte {
 		s = append(s, '\n')
 		parser.buffer_pos += 2
 		parser.mark.index++
+		parser.mark.offset += raw_width(parser, pos+1)
 		parser.unread--
 	case buf[pos] == '\r' || buf[pos] == '\n':
 		// CR|LF . LF
@@ -591,6 +596,7 @@ func read_line(parser *yaml_parser_t, s []byte) []byte {
 		return s
 	}
 	parser.mark.index++
+	parser.mark.offset += raw_width(parser, pos)
 	parser.mark.column = 0
 	parser.mark.line++
 	parser.unread--
@@ -629,6 +635,11 @@ func yaml_parser_scan(parser *yaml_parser_t, token *yaml_token_t) bool {
 
 // Set the scanner error and return false.
 func yaml_parser_set_scanner_error(parser *yaml_parser_t, context string, context_mark yaml_mark_t, problem string) bool {
+	// [Go] The scanner may fail for finding the input ended where a reader
+	// error was held back.
+	if parser.reader_error_held && parser.mark.offset >= parser.held_offset {
+		return yaml_parser_raise_held_error(parser)
+	}
 	parser.error = yaml_SCANNER_ERROR
 	parser.context = context
 	parser.context_mark = context_mark
@@ -637,6 +648,15 @@ func yaml_parser_set_scanner_error(parser *yaml_parser_t, context string, contex
 	return false
 }
 
+// [Go] Set a scanner error with the code to report it with.
+func yaml_parser_set_scanner_error_code(parser *yaml_parser_t, code ErrorCode, context string, context_mark yaml_mark_t, problem string) bool {
+	yaml_parser_set_scanner_error(parser, context, context_mark, problem)
+	if parser.error == yaml_SCANNER_ERROR {
+		parser.problem_code = code
+	}
+	return false
+}
+
 func yaml_parser_set_scanner_tag_error(parser *yaml_parser_t, directive bool, context_mark yaml_mark_t, problem string) bool {
 	context := "while parsing a tag"
 	if directive {
@@ -875,7 +895,12 @@ func yaml_parser_fetch_next_token(parser *yaml_parser_t) (ok bool) {
 	}
 
 	// If we don't determine the token type so far, it is an error.
-	return yaml_parser_set_scanner_error(parser,
+	// [Go] A tab there is most likely indentation.
+	code := ErrCodeSyntax
+	if is_tab(parser.buffer, parser.buffer_pos) {
+		code = ErrCodeTabIndent
+	}
+	return yaml_parser_set_scanner_error_code(parser, code,
 		"while scanning for the next token", parser.mark,
 		"found character that cannot start any token")
 }
@@ -968,7 +993,7 @@ func yaml_parser_increase_flow_level(parser *yaml_parser_t) bool {
 	// Increase the flow level.
 	parser.flow_level++
 	if parser.flow_level > max_flow_level {
-		return yaml_parser_set_scanner_error(parser,
+		return yaml_parser_set_scanner_error_code(parser, ErrCodeMaxDepth,
 			"while increasing flow level", parser.simple_keys[len(parser.simple_keys)-1].mark,
 			fmt.Sprintf("exceeded max depth of %d", max_flow_level))
 	}
@@ -1004,7 +1029,7 @@ func yaml_parser_roll_indent(parser *yaml_parser_t, column, number int, typ yaml
 		parser.indents = append(parser.indents, parser.indent)
 		parser.indent = column
 		if len(parser.indents) > max_indents {
-			return yaml_parser_set_scanner_error(parser,
+			return yaml_parser_set_scanner_error_code(parser, ErrCodeMaxDepth,
 				"while increasing indent level", parser.simple_keys[len(parser.simple_keys)-1].mark,
 				fmt.Sprintf("exceeded max depth of %d", max_indents))
 		}
@@ -1544,6 +1569,9 @@ func yaml_parser_scan_to_next_token(parser *yaml_parser_t) bool {
 		}
 		if parser.mark.column == 0 && is_bom(parser.buffer, parser.buffer_pos) {
 			skip(parser)
+			// [Go] The BOM isn't part of the line, so indicators such
+			// as "---" following it must still be seen at column 0.
+			parser.mark.column = 0
 		}
 
 		// Eat whitespaces.
@@ -2400,7 +2428,7 @@ func yaml_parser_scan_block_scalar_breaks(parser *yaml_parser_t, indent *int, br
 
 		// Check for a tab character messing the indentation.
 		if (*indent == 0 || parser.mark.column < *indent) && is_tab(parser.buffer, parser.buffer_pos) {
-			return yaml_parser_set_scanner_error(parser, "while scanning a block scalar",
+			return yaml_parser_set_scanner_error_code(parser, ErrCodeTabIndent, "while scanning a block scalar",
 				start_mark, "found a tab character where an indentation space is expected")
 		}
 
@@ -2779,7 +2807,7 @@ func yaml_parser_scan_plain_scalar(parser *yaml_parser_t, token *yaml_token_t) b
 
 				// Check for tab characters that abuse indentation.
 				if leading_blanks && parser.mark.column < indent && is_tab(parser.buffer, parser.buffer_pos) {
-					yaml_parser_set_scanner_error(parser, "while scanning a plain scalar",
+					yaml_parser_set_scanner_error_code(parser, ErrCodeTabIndent, "while scanning a plain scalar",
 						start_mark, "found a tab character that violates indentation")
 					return false
 				}
@@ -2945,10 +2973,10 @@ func yaml_parser_scan_comments(parser *yaml_parser_t, scan_mark yaml_mark_t) boo
 							scan_mark:  scan_mark,
 							token_mark: token_mark,
 							start_mark: start_mark,
-							end_mark:   yaml_mark_t{parser.mark.index + peek, line, column},
+							end_mark:   yaml_mark_t{parser.mark.index + peek, line, column, parser.mark.offset + peek},
 							foot:       text,
 						})
-						scan_mark = yaml_mark_t{parser.mark.index + peek, line, column}
+						scan_mark = yaml_mark_t{parser.mark.index + peek, line, column, parser.mark.offset + peek}
 						token_mark = scan_mark
 						text = nil
 					}
@@ -2975,10 +3003,10 @@ func yaml_parser_scan_comments(parser *yaml_parser_t, scan_mark yaml_mark_t) boo
 				scan_mark:  scan_mark,
 				token_mark: token_mark,
 				start_mark: start_mark,
-				end_mark:   yaml_mark_t{parser.mark.index + peek, line, column},
+				end_mark:   yaml_mark_t{parser.mark.index + peek, line, column, parser.mark.offset + peek},
 				foot:       text,
 			})
-			scan_mark = yaml_mark_t{parser.mark.index + peek, line, column}
+			scan_mark = yaml_mark_t{parser.mark.index + peek, line, column, parser.mark.offset + peek}
 			token_mark = scan_mark
 			text = nil
 		}
@@ -2988,7 +3016,7 @@ func yaml_parser_scan_comments(parser *yaml_parser_t, scan_mark yaml_mark_t) boo
 		}
 
 		if len(text) == 0 {
-			start_mark = yaml_mark_t{parser.mark.index + peek, line, column}
+			start_mark = yaml_mark_t{parser.mark.index + peek, line, column, parser.mark.offset + peek}
 		} else {
 			text = append(text, '\n')
 		}
@@ -3030,7 +3058,7 @@ func yaml_parser_scan_comments(parser *yaml_parser_t, scan_mark yaml_mark_t) boo
 			scan_mark:  scan_mark,
 			token_mark: start_mark,
 			start_mark: start_mark,
-			end_mark:   yaml_mark_t{parser.mark.index + peek - 1, line, column},
+			end_mark:   yaml_mark_t{parser.mark.index + peek - 1, line, column, parser.mark.offset + peek - 1},
 			head:       text,
 		})
 	}
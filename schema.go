@@ -0,0 +1,390 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// A Schema describes the values expected in a document, with a subset of
+// the keywords of JSON Schema. A JSON Schema document may be read into a
+// Schema with Unmarshal, as JSON is also YAML, and keywords that Schema
+// has no field for are ignored.
+type Schema struct {
+	// Type is one of "string", "integer", "number", "boolean", "object",
+	// "array" or "null", or "" for any type.
+	Type string `yaml:"type,omitempty"`
+
+	// Default is the value of properties that are missing or null.
+	Default interface{} `yaml:"default,omitempty"`
+
+	// Properties holds the schemas of the values of an object by key.
+	Properties map[string]*Schema `yaml:"properties,omitempty"`
+
+	// Items is the schema of the items of an array.
+	Items *Schema `yaml:"items,omitempty"`
+
+	// Description tells what the value is for, as written in the
+	// comments of Encoder.SetDocComments.
+	Description string `yaml:"description,omitempty"`
+
+	// The remaining fields are only used by Validate, with the meaning
+	// of the OpenAPI v3 keywords that Kubernetes uses for the structural
+	// schemas of custom resources.
+
+	Required             []string      `yaml:"required,omitempty"`
+	AdditionalProperties *Schema       `yaml:"additionalProperties,omitempty"`
+	Enum                 []interface{} `yaml:"enum,omitempty"`
+	Nullable             bool          `yaml:"nullable,omitempty"`
+	Minimum              *float64      `yaml:"minimum,omitempty"`
+	Maximum              *float64      `yaml:"maximum,omitempty"`
+	ExclusiveMinimum     bool          `yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool          `yaml:"exclusiveMaximum,omitempty"`
+	MinLength            *int          `yaml:"minLength,omitempty"`
+	MaxLength            *int          `yaml:"maxLength,omitempty"`
+	Pattern              string        `yaml:"pattern,omitempty"`
+	MinItems             *int          `yaml:"minItems,omitempty"`
+	MaxItems             *int          `yaml:"maxItems,omitempty"`
+
+	PreserveUnknownFields bool `yaml:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString           bool `yaml:"x-kubernetes-int-or-string,omitempty"`
+}
+
+// scalarTags maps the schema types of scalars to the tags these are
+// coerced to.
+var scalarTags = map[string]string{
+	"string":  strTag,
+	"integer": intTag,
+	"number":  floatTag,
+	"boolean": boolTag,
+}
+
+// coerce changes the tags of the scalars in n to the ones of the types
+// that s declares for them, when their values can be read as such, and
+// adds the defaults of missing properties.
+func (s *Schema) coerce(n *Node) {
+	if s == nil {
+		return
+	}
+	switch n.Kind {
+	case DocumentNode:
+		for _, c := range n.Content {
+			s.coerce(c)
+		}
+	case ScalarNode:
+		tag, ok := scalarTags[s.Type]
+		if !ok || n.ShortTag() == tag {
+			return
+		}
+		rtag, _ := resolve("", n.Value)
+		switch {
+		case tag == strTag && rtag != nullTag,
+			tag == rtag,
+			tag == floatTag && rtag == intTag:
+			n.Tag = tag
+		}
+	case SequenceNode:
+		for _, c := range n.Content {
+			s.Items.coerce(c)
+		}
+	case MappingNode:
+		if len(s.Properties) == 0 {
+			return
+		}
+		found := make(map[string]bool)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			p, ok := s.Properties[key.Value]
+			if !ok || p == nil || key.Kind != ScalarNode {
+				continue
+			}
+			found[key.Value] = true
+			if p.Default != nil && value.Kind == ScalarNode && value.ShortTag() == nullTag {
+				n.Content[i+1] = p.defaultNode()
+				continue
+			}
+			p.coerce(value)
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			p := s.Properties[key]
+			if !found[key] && p != nil && p.Default != nil {
+				n.Content = append(n.Content, &Node{Kind: ScalarNode, Tag: strTag, Value: key}, p.defaultNode())
+			}
+		}
+	}
+}
+
+// defaultNode returns a node holding the default of s.
+func (s *Schema) defaultNode() *Node {
+	n := &Node{}
+	if err := n.Encode(s.Default); err != nil {
+		fail(err)
+	}
+	s.coerce(n)
+	return n
+}
+
+// A SchemaError describes a value that does not follow its schema. Its
+// code is ErrCodeSchema.
+type SchemaError struct {
+	// Line and Column hold the position of the value, starting at 1.
+	Line   int
+	Column int
+
+	// Path holds the path of the value in its document.
+	Path Path
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("yaml: line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("yaml: line %d: %s: %s", e.Line, e.Path, e.Message)
+}
+
+// Validate checks the value of n against the schema s, and returns a
+// *SchemaError for each problem found, in document order. Keys of
+// objects with properties that none of them matches are reported as
+// unknown, unless allowed by AdditionalProperties or
+// PreserveUnknownFields.
+func (s *Schema) Validate(n *Node) []error {
+	v := schemaValidator{}
+	v.value(s, n, nil)
+	return v.errs
+}
+
+// ValidateManifest is like Validate, but for a Kubernetes manifest with
+// the OpenAPI v3 schema of its resource, as found in a
+// CustomResourceDefinition. The apiVersion, kind and metadata fields
+// are always allowed at the top of the manifest.
+func (s *Schema) ValidateManifest(n *Node) []error {
+	v := schemaValidator{manifest: true}
+	v.value(s, n, nil)
+	return v.errs
+}
+
+type schemaValidator struct {
+	manifest bool
+	errs     []error
+}
+
+func (v *schemaValidator) errorf(n *Node, path Path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &SchemaError{
+		Line:    n.Line,
+		Column:  n.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// manifestFields has the schemas of the fields that Kubernetes allows at
+// the top of every manifest.
+var manifestFields = map[string]*Schema{
+	"apiVersion": {Type: "string"},
+	"kind":       {Type: "string"},
+	"metadata":   {Type: "object", PreserveUnknownFields: true},
+}
+
+func (v *schemaValidator) value(s *Schema, n *Node, path Path) {
+	if n.Kind == DocumentNode {
+		if len(n.Content) > 0 {
+			v.value(s, n.Content[0], path)
+		}
+		return
+	}
+	if s == nil {
+		return
+	}
+	value := n
+	for value.Kind == AliasNode && value.Alias != nil {
+		value = value.Alias
+	}
+	tag := value.ShortTag()
+	if tag == nullTag && value.Kind == ScalarNode {
+		if !s.Nullable && s.Type != "" && s.Type != "null" {
+			v.errorf(n, path, "must not be null")
+		}
+		return
+	}
+	if !s.hasType(value, tag) {
+		v.typeError(s, n, path)
+		return
+	}
+	switch value.Kind {
+	case ScalarNode:
+		v.scalar(s, n, value, tag, path)
+	case SequenceNode:
+		v.length(s, n, len(value.Content), path)
+		for i, item := range value.Content {
+			v.value(s.Items, item, path.Index(i))
+		}
+	case MappingNode:
+		found := make(map[string]bool)
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			key, item := value.Content[i], value.Content[i+1]
+			found[key.Value] = true
+			v.value(v.property(s, key, path), item, path.Key(key.Value))
+		}
+		v.required(s, n, found, path)
+	}
+	if len(s.Enum) > 0 {
+		var decoded interface{}
+		if err := value.Decode(&decoded); err == nil && !inEnum(decoded, s.Enum) {
+			v.errorf(n, path, "must be one of the allowed values")
+		}
+	}
+}
+
+// typeError reports the value n at path as not of the type of s.
+func (v *schemaValidator) typeError(s *Schema, n *Node, path Path) {
+	want := s.Type
+	if s.IntOrString {
+		want = "integer or string"
+	}
+	v.errorf(n, path, "must be of type %s", want)
+}
+
+// length checks the number of items of the array n at path against s.
+func (v *schemaValidator) length(s *Schema, n *Node, items int, path Path) {
+	if s.MinItems != nil && items < *s.MinItems {
+		v.errorf(n, path, "must have at least %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && items > *s.MaxItems {
+		v.errorf(n, path, "must have at most %d items", *s.MaxItems)
+	}
+}
+
+// property returns the schema of the value of key in the object at path,
+// whose schema is s, or nil after reporting key as unknown if s doesn't
+// allow it.
+func (v *schemaValidator) property(s *Schema, key *Node, path Path) *Schema {
+	p, ok := s.Properties[key.Value]
+	if !ok && len(path) == 0 && v.manifest {
+		p, ok = manifestFields[key.Value]
+	}
+	switch {
+	case ok:
+		return p
+	case s.AdditionalProperties != nil:
+		return s.AdditionalProperties
+	case len(s.Properties) > 0 && !s.PreserveUnknownFields:
+		v.errorf(key, path.Key(key.Value), "unknown field")
+	}
+	return nil
+}
+
+// required reports the properties that s requires and the object n at
+// path lacks, given the keys found in it.
+func (v *schemaValidator) required(s *Schema, n *Node, found map[string]bool, path Path) {
+	for _, name := range s.Required {
+		if !found[name] {
+			v.errorf(n, path, "missing required field %q", name)
+		}
+	}
+}
+
+// hasType reports whether the value n, with the given short tag, is of
+// the type of s.
+func (s *Schema) hasType(n *Node, tag string) bool {
+	if s.IntOrString {
+		return n.Kind == ScalarNode && (tag == intTag || tag == strTag)
+	}
+	switch s.Type {
+	case "object":
+		return n.Kind == MappingNode
+	case "array":
+		return n.Kind == SequenceNode
+	case "string":
+		// Timestamps are strings once converted to JSON.
+		return n.Kind == ScalarNode && (tag == strTag || tag == timestampTag)
+	case "integer":
+		return n.Kind == ScalarNode && tag == intTag
+	case "number":
+		return n.Kind == ScalarNode && (tag == intTag || tag == floatTag)
+	case "boolean":
+		return n.Kind == ScalarNode && tag == boolTag
+	case "null":
+		return false
+	}
+	return true
+}
+
+func (v *schemaValidator) scalar(s *Schema, n, value *Node, tag string, path Path) {
+	switch tag {
+	case intTag, floatTag:
+		if s.Minimum == nil && s.Maximum == nil {
+			return
+		}
+		var f float64
+		if err := value.Decode(&f); err != nil {
+			return
+		}
+		if lo := s.Minimum; lo != nil && (f < *lo || s.ExclusiveMinimum && f == *lo) {
+			if s.ExclusiveMinimum {
+				v.errorf(n, path, "must be greater than %v", *lo)
+			} else {
+				v.errorf(n, path, "must be greater than or equal to %v", *lo)
+			}
+		}
+		if hi := s.Maximum; hi != nil && (f > *hi || s.ExclusiveMaximum && f == *hi) {
+			if s.ExclusiveMaximum {
+				v.errorf(n, path, "must be less than %v", *hi)
+			} else {
+				v.errorf(n, path, "must be less than or equal to %v", *hi)
+			}
+		}
+	case strTag, timestampTag:
+		length := utf8.RuneCountInString(value.Value)
+		if s.MinLength != nil && length < *s.MinLength {
+			v.errorf(n, path, "must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			v.errorf(n, path, "must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				v.errorf(n, path, "has invalid pattern in schema: %v", err)
+			} else if !re.MatchString(value.Value) {
+				v.errorf(n, path, "must match pattern %q", s.Pattern)
+			}
+		}
+	}
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(value, e) {
+			return true
+		}
+	}
+	return false
+}
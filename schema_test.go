@@ -0,0 +1,208 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"io"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+const serverSchema = `{
+  "type": "object",
+  "properties": {
+    "port": {"type": "integer", "default": 80},
+    "host": {"type": "string", "default": "localhost"},
+    "debug": {"type": "boolean", "default": false},
+    "ratio": {"type": "number"},
+    "version": {"type": "string"},
+    "tags": {"type": "array", "items": {"type": "string"}},
+    "limits": {"type": "object", "default": {"cpu": 1}}
+  }
+}`
+
+func (s *S) TestDecoderSchema(c *C) {
+	var schema yaml.Schema
+	c.Assert(yaml.Unmarshal([]byte(serverSchema), &schema), IsNil)
+
+	type server struct {
+		Port    int
+		Host    string
+		Debug   bool
+		Ratio   float64
+		Version string
+		Tags    []string
+		Limits  map[string]int
+	}
+	input := "port: \"8080\"\nhost:\nratio: 2\nversion: 1.10\ntags: [1, true, x]\n"
+	var v server
+	err := yaml.UnmarshalWithOptions([]byte(input), &v, yaml.WithSchema(&schema))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, server{
+		Port:    8080,
+		Host:    "localhost",
+		Ratio:   2,
+		Version: "1.10",
+		Tags:    []string{"1", "true", "x"},
+		Limits:  map[string]int{"cpu": 1},
+	})
+
+	var m map[string]interface{}
+	err = yaml.UnmarshalWithOptions([]byte(input), &m, yaml.WithSchema(&schema))
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string]interface{}{
+		"port":    8080,
+		"host":    "localhost",
+		"debug":   false,
+		"ratio":   2.0,
+		"version": "1.10",
+		"tags":    []interface{}{"1", "true", "x"},
+		"limits":  map[string]interface{}{"cpu": 1},
+	})
+
+	// Values that cannot be read as the declared type are left alone.
+	err = yaml.UnmarshalWithOptions([]byte("port: eighty\n"), &m, yaml.WithSchema(&schema))
+	c.Assert(err, IsNil)
+	c.Assert(m["port"], Equals, "eighty")
+}
+
+const widgetSchema = `
+type: object
+required: [spec]
+properties:
+  spec:
+    type: object
+    required: [size]
+    properties:
+      size: {type: string, enum: [small, large]}
+      replicas: {type: integer, minimum: 1, maximum: 10}
+      name: {type: string, maxLength: 5, pattern: '^[a-z]+$'}
+      port: {x-kubernetes-int-or-string: true}
+      ports: {type: array, maxItems: 1, items: {type: integer}}
+      labels: {type: object, additionalProperties: {type: string}}
+      extra: {type: object, x-kubernetes-preserve-unknown-fields: true}
+      note: {type: string, nullable: true}
+`
+
+func (s *S) TestSchemaValidateManifest(c *C) {
+	var schema yaml.Schema
+	c.Assert(yaml.Unmarshal([]byte(widgetSchema), &schema), IsNil)
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(`apiVersion: example.com/v1
+kind: Widget
+metadata: {name: w, labels: {a: b}}
+spec:
+  size: medium
+  replicas: 0
+  name: Widget
+  port: http
+  ports: [80, "443"]
+  labels: {a: 1}
+  extra: {anything: [1]}
+  note: null
+  color: red
+`), &node)
+	c.Assert(err, IsNil)
+
+	var msgs []string
+	for _, err := range schema.ValidateManifest(&node) {
+		c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeSchema)
+		msgs = append(msgs, err.Error())
+	}
+	c.Assert(msgs, DeepEquals, []string{
+		`yaml: line 5: spec.size: must be one of the allowed values`,
+		`yaml: line 6: spec.replicas: must be greater than or equal to 1`,
+		`yaml: line 7: spec.name: must be at most 5 characters long`,
+		`yaml: line 7: spec.name: must match pattern "^[a-z]+$"`,
+		`yaml: line 9: spec.ports: must have at most 1 items`,
+		`yaml: line 9: spec.ports[1]: must be of type integer`,
+		`yaml: line 10: spec.labels.a: must be of type string`,
+		`yaml: line 13: spec.color: unknown field`,
+	})
+
+	// Without the manifest fields, these are unknown too.
+	errs := schema.Validate(&node)
+	c.Assert(errs, HasLen, 11)
+	c.Assert(errs[0], ErrorMatches, "yaml: line 1: apiVersion: unknown field")
+
+	c.Assert(yaml.Unmarshal([]byte("spec: {replicas: 2}\n"), &node), IsNil)
+	errs = schema.Validate(&node)
+	c.Assert(errs, HasLen, 1)
+	serr := errs[0].(*yaml.SchemaError)
+	c.Assert(serr.Line, Equals, 1)
+	c.Assert(serr.Column, Equals, 7)
+	c.Assert(serr.Path, DeepEquals, yaml.Path{yaml.KeyElem("spec")})
+	c.Assert(serr.Message, Equals, `missing required field "size"`)
+}
+
+func (s *S) TestValidateStream(c *C) {
+	var schema yaml.Schema
+	c.Assert(yaml.Unmarshal([]byte(widgetSchema), &schema), IsNil)
+
+	docs := []string{`
+spec:
+  size: medium
+  replicas: 0
+  name: Widget
+  port: http
+  ports: [80, "443"]
+  labels: &labels {a: 1}
+  extra: {anything: [1]}
+  note: null
+  color: red
+`, `
+spec: [1]
+other: *labels
+`, `
+spec:
+  size: small # fine
+  ports: &ports [x, 1]
+  labels: *labels
+other: [*ports, *unknown]
+`}
+	in := strings.Join(docs, "---")
+	var want []string
+	dec := yaml.NewDecoder(strings.NewReader(strings.Replace(in, "*unknown", "~", 1)))
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err == io.EOF {
+			break
+		} else {
+			c.Assert(err, IsNil)
+		}
+		for _, err := range schema.Validate(&node) {
+			want = append(want, err.Error())
+		}
+	}
+	want = append(want, "yaml: line 20: unknown anchor 'unknown' referenced")
+
+	var got []string
+	for _, err := range yaml.ValidateStream(strings.NewReader(in), &schema) {
+		got = append(got, err.Error())
+	}
+	c.Assert(got, DeepEquals, want)
+	c.Assert(got[0], Equals, "yaml: line 3: spec.size: must be one of the allowed values")
+
+	errs := yaml.ValidateStream(strings.NewReader("spec: {size: large}\n---\nspec: {size: 1, ports: [\n"), &schema)
+	c.Assert(errs, HasLen, 2)
+	c.Assert(errs[0], ErrorMatches, "yaml: line 3: spec.size: must be of type string")
+	c.Assert(errs[1], ErrorMatches, "yaml: line 3: did not find expected node content")
+
+	c.Assert(yaml.ValidateStream(strings.NewReader("a: *x\n"), nil), HasLen, 1)
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21 && !yaml_noreflect
+// +build go1.21,!yaml_noreflect
+
+package yaml
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger has the decoder log how it reads the input to logger, at the
+// Debug level: the tokens found by the scanner, the events the parser
+// makes of them along with the states it goes through, and the tags
+// resolved for plain scalars. This is meant for finding out why input is
+// read the way it is, and slows decoding down. A nil logger, the default,
+// logs nothing.
+func (dec *Decoder) SetLogger(logger *slog.Logger) {
+	dec.parser.parser.debug = debugLog(logger)
+}
+
+// SetLogger has the encoder log how it writes its output to logger, at
+// the Debug level: the events emitted, and the styles chosen for scalars
+// when they differ from the ones asked for, as for Decoder.SetLogger.
+func (e *Encoder) SetLogger(logger *slog.Logger) {
+	e.encoder.emitter.debug = debugLog(logger)
+}
+
+// WithLogger is the Option for Decoder.SetLogger and Encoder.SetLogger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		if o.dec != nil {
+			o.dec.SetLogger(logger)
+		}
+		if o.enc != nil {
+			o.enc.SetLogger(logger)
+		}
+	}
+}
+
+// debugLog returns a function logging to logger at the Debug level, or
+// nil for a nil logger.
+func debugLog(logger *slog.Logger) func(msg string, args ...interface{}) {
+	if logger == nil {
+		return nil
+	}
+	return func(msg string, args ...interface{}) {
+		if logger.Enabled(context.Background(), slog.LevelDebug) {
+			logger.Debug(msg, args...)
+		}
+	}
+}
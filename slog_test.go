@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package yaml_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// debugLogger returns a logger writing to buf at the given level, without
+// the time of the records.
+func debugLogger(buf *bytes.Buffer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func (s *S) TestDecoderSetLogger(c *C) {
+	var buf bytes.Buffer
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\n"))
+	dec.SetLogger(debugLogger(&buf, slog.LevelDebug))
+	var v map[string]int
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]int{"a": 1})
+	for _, record := range []string{
+		`level=DEBUG msg="yaml: token" type=yaml_SCALAR_TOKEN line=1 column=4 value=1`,
+		`level=DEBUG msg="yaml: event" type="mapping start" state=yaml_PARSE_BLOCK_NODE_STATE next=yaml_PARSE_BLOCK_MAPPING_FIRST_KEY_STATE line=1 column=1`,
+		`level=DEBUG msg="yaml: resolved" value=a tag=!!str line=1 column=1`,
+		`level=DEBUG msg="yaml: resolved" value=1 tag=!!int line=1 column=4`,
+	} {
+		c.Assert(strings.Contains(buf.String(), record+"\n"), Equals, true, Commentf("%s", record))
+	}
+
+	// Nothing is logged above the Debug level, or without a logger.
+	buf.Reset()
+	dec.ResetBytes([]byte("a: 1\n"))
+	dec.SetLogger(debugLogger(&buf, slog.LevelInfo))
+	c.Assert(dec.Decode(&v), IsNil)
+	dec.ResetBytes([]byte("a: 1\n"))
+	dec.SetLogger(nil)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(buf.String(), Equals, "")
+}
+
+func (s *S) TestEncoderSetLogger(c *C) {
+	var buf bytes.Buffer
+	out, err := yaml.MarshalWithOptions(map[string]string{"a": "x: y"}, yaml.WithLogger(debugLogger(&buf, slog.LevelDebug)))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a: 'x: y'\n")
+	c.Assert(buf.String(), Matches, `(?s)level=DEBUG msg="yaml: event" type="stream start"\n.*`+
+		`level=DEBUG msg="yaml: scalar style" value="x: y" requested=plain style=single-quoted\n.*`+
+		`level=DEBUG msg="yaml: event" type="stream end"\n`)
+}
@@ -13,6 +13,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
 package yaml
 
 import (
@@ -0,0 +1,223 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// A RawDocument is the text of one document of a YAML stream, as returned
+// by SplitDocuments.
+type RawDocument struct {
+	// Data holds the bytes of the document, including its directives,
+	// its "---" and "..." markers and the comments around it.
+	Data []byte
+
+	// Offset is the position of Data in the stream, in bytes.
+	Offset int
+
+	// Line is the line of the stream that Data starts at, starting at 1.
+	Line int
+}
+
+// SplitDocuments reads a YAML stream from r and returns the text of each
+// of its documents, so that these may be handled one at a time, or
+// passed along as they are, without decoding the whole stream.
+//
+// The stream is split where the parser sees documents start and end, so
+// "---" and "..." lines within block scalars are left alone. The parser
+// still reads the content of every document to find these, but it builds
+// no nodes, and the data is split at the start of the line of each "---"
+// or directive, or after the line of each "...". So comments ahead of a
+// "---" belong to the document before it, those after a "..." to the
+// document after it, and the text after the last document belongs to it.
+// A stream holding no documents, such as one of comments only, yields
+// none.
+//
+// The error returned on invalid input is the one a Decoder reading the
+// stream would report, and the documents before it are returned with it.
+func SplitDocuments(r io.Reader) ([]RawDocument, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(data)
+	defer p.destroy()
+	var docs []RawDocument
+	err = p.split(data, &docs)
+	return docs, err
+}
+
+func (p *parser) split(data []byte, docs *[]RawDocument) (err error) {
+	defer handleDecodeErr(&err)
+	unit, bigEndian := 1, false
+	if p.peek() == yaml_STREAM_START_EVENT && p.event.encoding != yaml_UTF8_ENCODING {
+		unit, bigEndian = 2, p.event.encoding == yaml_UTF16BE_ENCODING
+	}
+	p.init()
+	start, line := 0, 1
+	for {
+		switch p.peek() {
+		case yaml_STREAM_END_EVENT:
+			if n := len(*docs); n > 0 {
+				// The text after the last document belongs to it.
+				last := &(*docs)[n-1]
+				last.Data = data[last.Offset:]
+			}
+			return nil
+		case yaml_DOCUMENT_END_EVENT:
+			end, endLine := p.event.start_mark.offset, p.event.start_mark.line+1
+			if !p.event.implicit {
+				// Take the rest of the line of the "...".
+				end, endLine = p.event.end_mark.offset, p.event.end_mark.line+1
+				if unit == 1 {
+					end = lineEnd(data, end)
+					if end > 0 && (data[end-1] == '\n' || data[end-1] == '\r') {
+						endLine++
+					}
+				} else {
+					var found bool
+					if end, found = lineEndUTF16(data, end, bigEndian); found {
+						endLine++
+					}
+				}
+			}
+			if end > len(data) {
+				end = len(data)
+			}
+			*docs = append(*docs, RawDocument{Data: data[start:end], Offset: start, Line: line})
+			start, line = end, endLine
+		}
+		p.expect(p.peek())
+	}
+}
+
+// lineEndUTF16 returns the offset in the UTF-16 data of the start of the
+// line after the one holding offset i, as lineEnd does, and whether the
+// line ends with a line break.
+func lineEndUTF16(data []byte, i int, bigEndian bool) (int, bool) {
+	char := func(i int) int {
+		if bigEndian {
+			return int(data[i])<<8 | int(data[i+1])
+		}
+		return int(data[i+1])<<8 | int(data[i])
+	}
+	for ; i+2 <= len(data); i += 2 {
+		switch char(i) {
+		case '\r':
+			if i+4 <= len(data) && char(i+2) == '\n' {
+				i += 2
+			}
+			return i + 2, true
+		case '\n':
+			return i + 2, true
+		}
+	}
+	return len(data), false
+}
+
+// JoinDocuments returns a stream holding the given documents, in order,
+// as the inverse of SplitDocuments. Each of docs is either the text of
+// one or more documents, as a []byte, string or RawDocument, or a value
+// that is encoded as a document of its own, such as a *Node.
+//
+// The text of documents is kept as it is, comments included, with a
+// "---" inserted ahead of any that doesn't start with one, and a "..."
+// inserted ahead of any with directives when the document before it
+// doesn't end with one. Text holding no documents, such as comments only,
+// is kept as well. The text must be UTF-8, and an error is returned for
+// text that is not valid YAML.
+func JoinDocuments(docs ...interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	started, ended := false, false
+	for _, doc := range docs {
+		var data []byte
+		switch doc := doc.(type) {
+		case []byte:
+			data = doc
+		case string:
+			data = []byte(doc)
+		case RawDocument:
+			data = doc.Data
+		default:
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			if err := enc.Encode(doc); err != nil {
+				return nil, err
+			}
+			if err := enc.Close(); err != nil {
+				return nil, err
+			}
+			data = buf.Bytes()
+		}
+		var info rawInfo
+		if err := info.read(data); err != nil {
+			return nil, err
+		}
+		if info.docs > 0 {
+			if info.directives && started && !ended {
+				out.WriteString("...\n")
+			}
+			if !info.explicitStart && started {
+				out.WriteString("---\n")
+			}
+			started, ended = true, info.explicitEnd
+		}
+		out.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// rawInfo describes the markers of the text of documents.
+type rawInfo struct {
+	docs          int  // The number of documents.
+	explicitStart bool // Whether the first document starts with "---".
+	directives    bool // Whether the first document has directives.
+	explicitEnd   bool // Whether the last document ends with "...".
+}
+
+func (info *rawInfo) read(data []byte) (err error) {
+	if len(data) == 0 {
+		return nil
+	}
+	p := newParser(data)
+	defer p.destroy()
+	defer handleDecodeErr(&err)
+	p.init()
+	for {
+		switch p.peek() {
+		case yaml_STREAM_END_EVENT:
+			return nil
+		case yaml_DOCUMENT_START_EVENT:
+			if info.docs == 0 {
+				info.explicitStart = !p.event.implicit
+				info.directives = p.event.version_directive != nil || len(p.event.tag_directives) > 0
+			}
+			info.docs++
+		case yaml_DOCUMENT_END_EVENT:
+			info.explicitEnd = !p.event.implicit
+		}
+		p.expect(p.peek())
+	}
+}
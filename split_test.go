@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestSplitDocuments(c *C) {
+	in := "# head\na: 1\n---\nb: |\n  ---\n  ...\n  x\n... # end\n# between\n%TAG !e! tag:example.com,2000:\n---\nc: !e!x 3\n# tail\n"
+	docs, err := yaml.SplitDocuments(strings.NewReader(in))
+	c.Assert(err, IsNil)
+	c.Assert(docs, DeepEquals, []yaml.RawDocument{
+		{Data: []byte("# head\na: 1\n"), Offset: 0, Line: 1},
+		{Data: []byte("---\nb: |\n  ---\n  ...\n  x\n... # end\n"), Offset: 12, Line: 3},
+		{Data: []byte("# between\n%TAG !e! tag:example.com,2000:\n---\nc: !e!x 3\n# tail\n"), Offset: 47, Line: 9},
+	})
+	for _, doc := range docs {
+		c.Assert(string(doc.Data), Equals, in[doc.Offset:doc.Offset+len(doc.Data)])
+	}
+
+	var v map[string]string
+	c.Assert(yaml.Unmarshal(docs[1].Data, &v), IsNil)
+	c.Assert(v["b"], Equals, "---\n...\nx\n")
+
+	// Lines may end with CR or CRLF as well.
+	for _, nl := range []string{"\r", "\r\n"} {
+		in := strings.Replace("a: 1\n... # end\n---\nb: 2\n", "\n", nl, -1)
+		docs, err := yaml.SplitDocuments(strings.NewReader(in))
+		c.Assert(err, IsNil)
+		c.Assert(docs, DeepEquals, []yaml.RawDocument{
+			{Data: []byte("a: 1" + nl + "... # end" + nl), Offset: 0, Line: 1},
+			{Data: []byte("---" + nl + "b: 2" + nl), Offset: 13 + 2*len(nl), Line: 3},
+		})
+	}
+
+	// And so in UTF-16.
+	var utf16 []byte
+	for _, r := range "\ufeffa: 1\r...\r---\rb: 2\r" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	docs, err = yaml.SplitDocuments(bytes.NewReader(utf16))
+	c.Assert(err, IsNil)
+	c.Assert(docs, HasLen, 2)
+	c.Assert(docs[1].Offset, Equals, 20)
+	c.Assert(docs[1].Line, Equals, 3)
+
+	docs, err = yaml.SplitDocuments(strings.NewReader("# only comments\n"))
+	c.Assert(err, IsNil)
+	c.Assert(docs, HasLen, 0)
+
+	in = "a: 1\n---\nb: [1\n"
+	docs, err = yaml.SplitDocuments(strings.NewReader(in))
+	c.Assert(err, ErrorMatches, "yaml: line 2: did not find expected ',' or ']'")
+	c.Assert(docs, DeepEquals, []yaml.RawDocument{{Data: []byte("a: 1\n"), Offset: 0, Line: 1}})
+}
+
+func (s *S) TestJoinDocuments(c *C) {
+	var node yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("# head\nx: 1 # line\n"), &node), IsNil)
+
+	data, err := yaml.JoinDocuments(
+		"a: 1",
+		[]byte("# about b\nb: 2\n...\n"),
+		yaml.RawDocument{Data: []byte("%TAG !e! tag:example.com,2000:\n---\nc: !e!x 3\n")},
+		"# between\n",
+		&node,
+		map[string]int{"y": 2},
+		"%TAG !e! tag:example.com,2000:\n---\nz: !e!x 1\n",
+	)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `a: 1
+---
+# about b
+b: 2
+...
+%TAG !e! tag:example.com,2000:
+---
+c: !e!x 3
+# between
+---
+# head
+x: 1 # line
+---
+"y": 2
+...
+%TAG !e! tag:example.com,2000:
+---
+z: !e!x 1
+`)
+
+	docs, err := yaml.SplitDocuments(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(docs, HasLen, 6)
+
+	_, err = yaml.JoinDocuments("a: 1", "b: [1")
+	c.Assert(err, ErrorMatches, "yaml: line 1: did not find expected ',' or ']'")
+}
@@ -0,0 +1,213 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"fmt"
+	"io"
+)
+
+// Stats describes the contents of a YAML stream.
+type Stats struct {
+	Documents int // The number of documents.
+	MaxDepth  int // The deepest nesting of mappings and sequences.
+
+	Mappings  int // The number of mapping nodes.
+	Sequences int // The number of sequence nodes.
+	Scalars   int // The number of scalar nodes.
+	Aliases   int // The number of alias nodes.
+	Anchors   int // The number of nodes with an anchor.
+
+	ScalarBytes    int64 // The total length of the scalar values.
+	MaxScalarBytes int   // The length of the longest scalar value.
+
+	// ScalarSizes holds the distribution of the lengths of the scalar
+	// values, where ScalarSizes[i] counts the values at least 1<<i>>1
+	// bytes long and shorter than 1<<i bytes, so that ScalarSizes[0]
+	// counts the empty ones.
+	ScalarSizes []int
+
+	// ExpandedNodes holds the number of nodes there would be with every
+	// alias replaced by the value of its anchor, as when decoding into Go
+	// values. An alias to an unknown anchor, or within the value of its
+	// anchor, counts as a single node.
+	ExpandedNodes int64
+}
+
+// Nodes returns the number of nodes in the stream, aliases included.
+func (s *Stats) Nodes() int {
+	return s.Mappings + s.Sequences + s.Scalars + s.Aliases
+}
+
+// Expansion returns the factor by which aliases multiply the number of
+// nodes in the stream when they are expanded, which is 1 for a stream
+// without aliases.
+func (s *Stats) Expansion() float64 {
+	if s.Nodes() == 0 {
+		return 1
+	}
+	return float64(s.ExpandedNodes) / float64(s.Nodes())
+}
+
+// Limits holds thresholds on the complexity of YAML content, for Check to
+// reject pathological documents before they are decoded. A zero field
+// sets no limit.
+type Limits struct {
+	MaxDepth            int     // The deepest nesting of mappings and sequences.
+	MaxNodes            int     // The number of nodes, aliases included.
+	MaxScalarBytes      int     // The length of the longest scalar value.
+	MaxTotalScalarBytes int64   // The total length of the scalar values.
+	MaxExpandedNodes    int64   // The number of nodes with aliases expanded.
+	MaxExpansion        float64 // The factor aliases multiply nodes by.
+}
+
+// Check returns an *Error describing the first limit the statistics
+// exceed, or nil if there's none. Its code is ErrCodeMaxDepth for the
+// depth, ErrCodeAliasLimit for the expansion of aliases, and
+// ErrCodeInputTooLarge for the others.
+func (s *Stats) Check(limits Limits) error {
+	fail := func(code ErrorCode, format string, args ...interface{}) error {
+		return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+	}
+	switch l := limits; {
+	case l.MaxDepth > 0 && s.MaxDepth > l.MaxDepth:
+		return fail(ErrCodeMaxDepth, "nesting depth %d exceeds the limit of %d", s.MaxDepth, l.MaxDepth)
+	case l.MaxNodes > 0 && s.Nodes() > l.MaxNodes:
+		return fail(ErrCodeInputTooLarge, "%d nodes exceed the limit of %d", s.Nodes(), l.MaxNodes)
+	case l.MaxScalarBytes > 0 && s.MaxScalarBytes > l.MaxScalarBytes:
+		return fail(ErrCodeInputTooLarge, "scalar of %d bytes exceeds the limit of %d", s.MaxScalarBytes, l.MaxScalarBytes)
+	case l.MaxTotalScalarBytes > 0 && s.ScalarBytes > l.MaxTotalScalarBytes:
+		return fail(ErrCodeInputTooLarge, "scalars of %d bytes in total exceed the limit of %d", s.ScalarBytes, l.MaxTotalScalarBytes)
+	case l.MaxExpandedNodes > 0 && s.ExpandedNodes > l.MaxExpandedNodes:
+		return fail(ErrCodeAliasLimit, "aliases expand to %d nodes, over the limit of %d", s.ExpandedNodes, l.MaxExpandedNodes)
+	case l.MaxExpansion > 0 && s.Expansion() > l.MaxExpansion:
+		return fail(ErrCodeAliasLimit, "aliases expand nodes by a factor of %.1f, over the limit of %.1f", s.Expansion(), l.MaxExpansion)
+	}
+	return nil
+}
+
+// ReadStats reads a YAML stream from r and returns the statistics of its
+// contents, without building nodes or values out of them, so that the
+// size of the data may be estimated before decoding it. Aliases are not
+// expanded, but the number of nodes they would expand to is estimated
+// from the sizes of the values of their anchors. When reading the stream
+// fails, the statistics of the part before the error are returned with
+// it.
+func ReadStats(r io.Reader) (*Stats, error) {
+	p := newParserFromReader(r)
+	defer p.destroy()
+	var stats Stats
+	err := p.stats(&stats)
+	return &stats, err
+}
+
+// maxExpandedNodes caps the count of expanded nodes, which grows
+// exponentially with nested aliases, below overflowing.
+const maxExpandedNodes = 1 << 62
+
+// addExpanded returns the sum of two counts of expanded nodes, capped at
+// maxExpandedNodes.
+func addExpanded(a, b int64) int64 {
+	if a > maxExpandedNodes-b {
+		return maxExpandedNodes
+	}
+	return a + b
+}
+
+func (p *parser) stats(stats *Stats) (err error) {
+	defer handleDecodeErr(&err)
+	// stack holds the expanded sizes of the nodes being read, with the
+	// document as the first, and anchors those of the anchored values
+	// read in the document.
+	type frame struct {
+		anchor string
+		size   int64
+	}
+	var stack []frame
+	var anchors map[string]int64
+	add := func(size int64) {
+		top := &stack[len(stack)-1]
+		top.size = addExpanded(top.size, size)
+	}
+	depth := 0
+	p.init()
+	for {
+		typ := p.peek()
+		e := &p.event
+		switch typ {
+		case yaml_STREAM_END_EVENT:
+			return nil
+		case yaml_DOCUMENT_START_EVENT:
+			stats.Documents++
+			stack = append(stack[:0], frame{})
+			anchors = make(map[string]int64)
+		case yaml_DOCUMENT_END_EVENT:
+			stats.ExpandedNodes = addExpanded(stats.ExpandedNodes, stack[0].size)
+		case yaml_MAPPING_START_EVENT, yaml_SEQUENCE_START_EVENT:
+			if typ == yaml_MAPPING_START_EVENT {
+				stats.Mappings++
+			} else {
+				stats.Sequences++
+			}
+			depth++
+			if depth > stats.MaxDepth {
+				stats.MaxDepth = depth
+			}
+			stack = append(stack, frame{anchor: string(e.anchor), size: 1})
+			delete(anchors, string(e.anchor))
+		case yaml_MAPPING_END_EVENT, yaml_SEQUENCE_END_EVENT:
+			depth--
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top.anchor != "" {
+				anchors[top.anchor] = top.size
+			}
+			add(top.size)
+		case yaml_SCALAR_EVENT:
+			stats.Scalars++
+			stats.ScalarBytes += int64(len(e.value))
+			if len(e.value) > stats.MaxScalarBytes {
+				stats.MaxScalarBytes = len(e.value)
+			}
+			i := 0
+			for n := len(e.value); n > 0; n >>= 1 {
+				i++
+			}
+			for len(stats.ScalarSizes) <= i {
+				stats.ScalarSizes = append(stats.ScalarSizes, 0)
+			}
+			stats.ScalarSizes[i]++
+			if len(e.anchor) > 0 {
+				anchors[string(e.anchor)] = 1
+			}
+			add(1)
+		case yaml_ALIAS_EVENT:
+			stats.Aliases++
+			if size, ok := anchors[string(e.anchor)]; ok {
+				add(size)
+			} else {
+				add(1)
+			}
+		}
+		if typ != yaml_ALIAS_EVENT && len(e.anchor) > 0 {
+			stats.Anchors++
+		}
+		p.expect(typ)
+	}
+}
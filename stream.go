@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// A Stream holds the documents of a YAML stream along with what lies
+// between them, as read by ParseStream, so that the stream can be written
+// back with its Encode method without losing either.
+type Stream struct {
+	Documents []*StreamDocument
+
+	// FootComment holds the comments after the "..." of the last
+	// document.
+	FootComment string
+}
+
+// A StreamDocument is a document of a Stream.
+type StreamDocument struct {
+	// Node is the DocumentNode holding the content of the document.
+	Node *Node
+
+	// Comment holds the comments ahead of the directives or "---" of the
+	// document that follow the "..." of the document before it. Other
+	// comments are found in Node.
+	Comment string
+
+	// Directives holds the %YAML and %TAG directives of the document,
+	// such as "%TAG !e! tag:example.com,2000:".
+	Directives []string
+
+	// ExplicitStart and ExplicitEnd report whether the document starts
+	// with "---" and ends with "...".
+	ExplicitStart bool
+	ExplicitEnd   bool
+
+	// Offset and End hold the range of the document in the stream, in
+	// bytes, from its first directive, "---" or content to the end of its
+	// "..." or content, and Line and EndLine the lines these are on,
+	// starting at 1.
+	Offset  int
+	End     int
+	Line    int
+	EndLine int
+}
+
+// ParseStream reads all the documents of a UTF-8 YAML stream from r. The
+// lines and columns of the nodes of each document are the ones in the
+// stream.
+func ParseStream(r io.Reader) (*Stream, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(data)
+	defer p.destroy()
+	s := &Stream{}
+	if err := p.stream(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stream finds the documents of data and parses each of them on its own,
+// so that the comments between them aren't taken into their nodes.
+func (p *parser) stream(data []byte, s *Stream) (err error) {
+	defer handleDecodeErr(&err)
+	p.init()
+	// prev is the end of the document before, after its "..." line, and
+	// bodyStart the start of the text parsed for the document. Their lines
+	// are kept along with them, counting from 0 as the scanner does, rather
+	// than counting the line breaks of data again for every document.
+	var prev, prevLine, bodyStart, bodyLine int
+	var doc *StreamDocument
+	for {
+		e := &p.event
+		switch p.peek() {
+		case yaml_STREAM_END_EVENT:
+			s.FootComment = commentText(data[prev:])
+			return nil
+		case yaml_DOCUMENT_START_EVENT:
+			doc = &StreamDocument{
+				ExplicitStart: !e.implicit,
+				Offset:        e.start_mark.offset,
+				Line:          e.start_mark.line + 1,
+			}
+			bodyStart, bodyLine = prev, prevLine
+			if doc.ExplicitStart {
+				doc.Comment = commentText(data[prev:e.start_mark.offset])
+				bodyStart, bodyLine = e.start_mark.offset, e.start_mark.line
+			}
+			doc.Directives = directivesOf(e)
+		case yaml_DOCUMENT_END_EVENT:
+			doc.ExplicitEnd = !e.implicit
+			doc.End = e.end_mark.offset
+			doc.EndLine = e.end_mark.line + 1
+			bodyEnd := e.start_mark.offset
+			prev, prevLine = bodyEnd, e.start_mark.line
+			if doc.ExplicitEnd {
+				prev, prevLine = lineEnd(data, doc.End), e.end_mark.line
+				if prev > doc.End && (data[prev-1] == '\n' || data[prev-1] == '\r') {
+					prevLine++
+				}
+			} else if e.start_mark.column == 0 && doc.EndLine > doc.Line {
+				// The document ends ahead of the next "---".
+				doc.EndLine--
+			}
+			q := newParser(data[bodyStart:bodyEnd])
+			q.parser.mark.line = bodyLine
+			doc.Node, err = q.streamDocument()
+			q.destroy()
+			if err != nil {
+				return err
+			}
+			s.Documents = append(s.Documents, doc)
+		}
+		p.expect(p.peek())
+	}
+}
+
+func (p *parser) streamDocument() (n *Node, err error) {
+	defer handleDecodeErr(&err)
+	p.init()
+	return p.parse(), nil
+}
+
+// lineEnd returns the offset after the line break that follows offset i
+// of data, or the length of data if there is none.
+func lineEnd(data []byte, i int) int {
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				i++
+			}
+			return i + 1
+		case '\n':
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// commentText returns the comments in data, which holds nothing else,
+// in the form used by the comment fields of Node.
+func commentText(data []byte) string {
+	lines := strings.Split(string(data), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Encode writes the documents of s to w, each with its directives,
+// markers and comments. Tags are written with the handles of the %TAG
+// directives of their document. A "---" is written ahead of every
+// document but the first one without directives, and a "..." ahead of
+// every one with directives that follows a document without it, so that
+// the stream stays valid when these were changed.
+func (s *Stream) Encode(w io.Writer) (err error) {
+	defer handleErr(&err)
+	var buf bytes.Buffer
+	ended := true
+	for i, doc := range s.Documents {
+		if doc.Comment != "" {
+			buf.WriteString(doc.Comment)
+			buf.WriteByte('\n')
+		}
+		e := newEncoderWithWriter(&buf)
+		e.explicitStart = doc.ExplicitStart || i > 0
+		e.explicitEnd = doc.ExplicitEnd
+		for _, d := range doc.Directives {
+			e.directive(d)
+		}
+		if !ended && (e.version != nil || len(e.tagDirectives) > 0) {
+			buf.WriteString("...\n")
+		}
+		e.marshalDoc("", reflect.ValueOf(doc.Node))
+		e.finish()
+		e.destroy()
+		ended = doc.ExplicitEnd
+	}
+	if s.FootComment != "" {
+		buf.WriteString(s.FootComment)
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// directive adds the %YAML or %TAG directive d to the documents of e.
+func (e *encoder) directive(d string) {
+	addDirective(&e.version, &e.tagDirectives, d)
+}
+
+// directivesOf returns the %YAML and %TAG directives of the document
+// start event e.
+func directivesOf(e *yaml_event_t) []string {
+	var directives []string
+	if v := e.version_directive; v != nil {
+		directives = append(directives, fmt.Sprintf("%%YAML %d.%d", v.major, v.minor))
+	}
+	for _, t := range e.tag_directives {
+		directives = append(directives, "%TAG "+string(t.handle)+" "+string(t.prefix))
+	}
+	return directives
+}
+
+// addDirective sets *version to the %YAML directive d, or adds the %TAG
+// directive d to *tags.
+func addDirective(version **yaml_version_directive_t, tags *[]yaml_tag_directive_t, d string) {
+	f := strings.Fields(d)
+	var major, minor int8
+	switch {
+	case len(f) == 2 && f[0] == "%YAML":
+		if _, err := fmt.Sscanf(f[1], "%d.%d", &major, &minor); err == nil {
+			*version = &yaml_version_directive_t{major: major, minor: minor}
+			return
+		}
+	case len(f) == 3 && f[0] == "%TAG":
+		*tags = append(*tags, yaml_tag_directive_t{handle: []byte(f[1]), prefix: []byte(f[2])})
+		return
+	}
+	failCode(ErrCodeEmitter, "invalid directive %q", d)
+}
@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestParseStream(c *C) {
+	in := `# top
+
+a: 1
+# about b
+---
+b: 2
+...
+# between
+%TAG !e! tag:example.com,2000:
+---
+c: !e!x 3 # line
+# foot
+...
+# tail
+`
+	stream, err := yaml.ParseStream(strings.NewReader(in))
+	c.Assert(err, IsNil)
+	c.Assert(stream.Documents, HasLen, 3)
+	c.Assert(stream.FootComment, Equals, "# tail")
+
+	var ranges [][4]int
+	for _, doc := range stream.Documents {
+		ranges = append(ranges, [4]int{doc.Offset, doc.End, doc.Line, doc.EndLine})
+	}
+	c.Assert(ranges, DeepEquals, [][4]int{{7, 22, 3, 4}, {22, 34, 5, 7}, {45, 107, 9, 13}})
+	c.Assert(in[45:107], Matches, `(?s)%TAG .*\.\.\.`)
+
+	doc := stream.Documents[2]
+	c.Assert(doc.Comment, Equals, "# between")
+	c.Assert(doc.Directives, DeepEquals, []string{"%TAG !e! tag:example.com,2000:"})
+	c.Assert(doc.ExplicitStart, Equals, true)
+	c.Assert(doc.ExplicitEnd, Equals, true)
+	c.Assert(stream.Documents[0].ExplicitStart, Equals, false)
+	c.Assert(stream.Documents[0].ExplicitEnd, Equals, false)
+
+	value := doc.Node.Content[0].Content[1]
+	c.Assert(value.Tag, Equals, "tag:example.com,2000:x")
+	c.Assert(value.Line, Equals, 11)
+	c.Assert(value.LineComment, Equals, "# line")
+
+	var buf bytes.Buffer
+	c.Assert(stream.Encode(&buf), IsNil)
+	c.Assert(buf.String(), Equals, in)
+
+	stream.Documents[1].ExplicitEnd = false
+	stream.Documents[2].Directives = []string{"%YAML 1.1"}
+	buf.Reset()
+	c.Assert(stream.Encode(&buf), IsNil)
+	c.Assert(buf.String(), Equals, "# top\n\na: 1\n# about b\n---\nb: 2\n# between\n...\n%YAML 1.1\n---\nc: !<tag:example.com,2000:x> 3 # line\n# foot\n...\n# tail\n")
+
+	stream.Documents[2].Directives = []string{"%BAD"}
+	c.Assert(stream.Encode(&buf), ErrorMatches, `yaml: invalid directive "%BAD"`)
+}
+
+func (s *S) TestParseStreamEmpty(c *C) {
+	stream, err := yaml.ParseStream(strings.NewReader("# only comments\n"))
+	c.Assert(err, IsNil)
+	c.Assert(stream.Documents, HasLen, 0)
+	c.Assert(stream.FootComment, Equals, "# only comments")
+
+	_, err = yaml.ParseStream(strings.NewReader("a: 1\n---\nb: [1\n"))
+	c.Assert(err, ErrorMatches, "yaml: line 2: did not find expected ',' or ']'")
+}
+
+func (s *S) TestParseStreamLines(c *C) {
+	// The lines of the nodes count every kind of line break, as the
+	// lines of the documents do.
+	for _, br := range []string{"\n", "\r\n", "\r"} {
+		in := strings.Replace("a: 1\n---\nb: 2\n...\n# c\n---\nc: [3]\n", "\n", br, -1)
+		stream, err := yaml.ParseStream(strings.NewReader(in))
+		c.Assert(err, IsNil)
+		var lines [][2]int
+		for _, doc := range stream.Documents {
+			lines = append(lines, [2]int{doc.Line, doc.Node.Content[0].Content[1].Line})
+		}
+		c.Assert(lines, DeepEquals, [][2]int{{1, 1}, {2, 3}, {6, 7}}, Commentf("line break %q", br))
+	}
+}
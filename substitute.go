@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A SubstitutionError describes a placeholder that Substitute cannot
+// replace. Its code is ErrCodeSubstitution.
+type SubstitutionError struct {
+	// Name holds the name of the variable, or "" for a placeholder that
+	// isn't closed.
+	Name string
+
+	// Line and Column hold the position of the scalar holding the
+	// placeholder, starting at 1.
+	Line   int
+	Column int
+
+	// Path holds the path of the scalar in its document.
+	Path Path
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *SubstitutionError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("yaml: line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("yaml: line %d: %s: %s", e.Line, e.Path, e.Message)
+}
+
+// Substitute replaces the ${name} placeholders in the scalars within n,
+// keys included, with the values that lookup returns for their names.
+// A placeholder written as ${name:-default} is replaced with the default
+// when lookup doesn't define the name, and one written as $${name} is
+// replaced with ${name} and left alone otherwise. Values are inserted as
+// they are, so placeholders within them are not replaced in turn.
+//
+// Plain scalars without an explicit tag have their tag resolved again
+// once substituted, so that a "port: ${PORT}" mapping holds an integer
+// when PORT is one, while quoted scalars stay strings.
+//
+// When strict is set, a placeholder for a name that is not defined, or
+// one that isn't closed, stops Substitute with a *SubstitutionError for
+// it, and n is left with the scalars before it substituted. Otherwise,
+// such placeholders are left as they are. Aliased nodes are substituted
+// once, under their anchor.
+func Substitute(n *Node, lookup func(name string) (string, bool), strict bool) error {
+	s := substituter{lookup: lookup, strict: strict, seen: make(map[*Node]bool)}
+	return s.node(n, nil)
+}
+
+// SubstituteMap is like Substitute with the values of the variables in
+// vars.
+func SubstituteMap(n *Node, vars map[string]string, strict bool) error {
+	return Substitute(n, func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}, strict)
+}
+
+type substituter struct {
+	lookup func(name string) (string, bool)
+	strict bool
+	seen   map[*Node]bool
+}
+
+func (s *substituter) node(n *Node, path Path) error {
+	if n == nil || s.seen[n] {
+		return nil
+	}
+	s.seen[n] = true
+	switch n.Kind {
+	case DocumentNode:
+		for _, c := range n.Content {
+			if err := s.node(c, path); err != nil {
+				return err
+			}
+		}
+	case SequenceNode:
+		for i, c := range n.Content {
+			if err := s.node(c, path.Index(i)); err != nil {
+				return err
+			}
+		}
+	case MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if err := s.node(n.Content[i], path); err != nil {
+				return err
+			}
+			if err := s.node(n.Content[i+1], path.Key(n.Content[i].Value)); err != nil {
+				return err
+			}
+		}
+	case ScalarNode:
+		return s.scalar(n, path)
+	}
+	return nil
+}
+
+func (s *substituter) scalar(n *Node, path Path) error {
+	if !strings.Contains(n.Value, "${") {
+		return nil
+	}
+	var out []string
+	rest := n.Value
+	for {
+		i := strings.Index(rest, "${")
+		if i < 0 {
+			break
+		}
+		if i > 0 && rest[i-1] == '$' {
+			// An escaped placeholder.
+			out = append(out, rest[:i-1], "${")
+			rest = rest[i+2:]
+			continue
+		}
+		out = append(out, rest[:i])
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			if s.strict {
+				return s.errorf(n, path, "", "placeholder is not closed")
+			}
+			out = append(out, rest[i:])
+			rest = ""
+			break
+		}
+		expr := rest[i+2 : i+j]
+		name, def, hasDef := expr, "", false
+		if k := strings.Index(expr, ":-"); k >= 0 {
+			name, def, hasDef = expr[:k], expr[k+2:], true
+		}
+		value, ok := s.lookup(name)
+		switch {
+		case ok:
+		case hasDef:
+			value = def
+		case s.strict:
+			return s.errorf(n, path, name, "variable %q is not defined", name)
+		default:
+			value = rest[i : i+j+1]
+		}
+		out = append(out, value)
+		rest = rest[i+j+1:]
+	}
+	out = append(out, rest)
+	n.Value = strings.Join(out, "")
+	if n.Style&(TaggedStyle|DoubleQuotedStyle|SingleQuotedStyle|LiteralStyle|FoldedStyle) == 0 {
+		tag, _ := resolve("", n.Value)
+		n.Tag = tag
+	}
+	return nil
+}
+
+func (s *substituter) errorf(n *Node, path Path, name string, format string, args ...interface{}) error {
+	return &SubstitutionError{
+		Name:    name,
+		Line:    n.Line,
+		Column:  n.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestSubstitute(c *C) {
+	var n yaml.Node
+	in := `
+host: ${HOST}
+port: ${PORT}
+url: "http://${HOST}:${PORT}/"
+${NAME}: $${HOME} ${MISSING}
+level: ${LEVEL:-info}
+base: &b
+  user: ${USER}
+copy: *b
+`
+	c.Assert(yaml.Unmarshal([]byte(in), &n), IsNil)
+	vars := map[string]string{"HOST": "db", "PORT": "5432", "NAME": "app", "USER": "root"}
+	c.Assert(yaml.SubstituteMap(&n, vars, false), IsNil)
+	data, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `host: db
+port: 5432
+url: "http://db:5432/"
+app: ${HOME} ${MISSING}
+level: info
+base: &b
+    user: root
+copy: *b
+`)
+
+	var v struct {
+		Port int
+		Copy map[string]string
+	}
+	c.Assert(n.Decode(&v), IsNil)
+	c.Assert(v.Port, Equals, 5432)
+	c.Assert(v.Copy, DeepEquals, map[string]string{"user": "root"})
+
+	// Quoted scalars stay strings.
+	c.Assert(yaml.Unmarshal([]byte("a: '${PORT}'\nb: ${PORT}\n"), &n), IsNil)
+	c.Assert(yaml.SubstituteMap(&n, vars, true), IsNil)
+	c.Assert(n.Content[0].Content[1].ShortTag(), Equals, "!!str")
+	c.Assert(n.Content[0].Content[3].ShortTag(), Equals, "!!int")
+}
+
+func (s *S) TestSubstituteStrict(c *C) {
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("a:\n  - ok\n  - x ${MISSING}\n"), &n), IsNil)
+	lookup := func(name string) (string, bool) { return "", false }
+	err := yaml.Substitute(&n, lookup, true)
+	c.Assert(err, DeepEquals, &yaml.SubstitutionError{
+		Name:    "MISSING",
+		Line:    3,
+		Column:  5,
+		Path:    yaml.Path{yaml.KeyElem("a"), yaml.IndexElem(1)},
+		Message: `variable "MISSING" is not defined`,
+	})
+	c.Assert(err, ErrorMatches, `yaml: line 3: a\[1\]: variable "MISSING" is not defined`)
+	c.Assert(yaml.CodeOf(err), Equals, yaml.ErrCodeSubstitution)
+
+	c.Assert(yaml.Unmarshal([]byte("a: ${OPEN\n"), &n), IsNil)
+	err = yaml.Substitute(&n, lookup, true)
+	c.Assert(err, ErrorMatches, "yaml: line 1: a: placeholder is not closed")
+	c.Assert(yaml.Substitute(&n, lookup, false), IsNil)
+	c.Assert(n.Content[0].Content[1].Value, Equals, "${OPEN")
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import "strconv"
+
+// A Phase is a stage of decoding or encoding a document, as reported to
+// the functions set with Decoder.SetTrace and Encoder.SetTrace.
+type Phase int
+
+const (
+	// PhaseParse is the reading of a document into nodes. Scanning the
+	// input and parsing its tokens are done together, a token at a time,
+	// so they make a single phase. Parsing that finds no more documents
+	// is reported as well, as it reads the rest of the input.
+	PhaseParse Phase = iota + 1
+
+	// PhaseDecode is the decoding of the nodes of a document into a Go
+	// value, which resolves the tags of scalars as it goes along, and
+	// applies the schema of the decoder first.
+	PhaseDecode
+
+	// PhaseEncode is the encoding of a Go value as a document, from
+	// building its events to writing them out.
+	PhaseEncode
+)
+
+var phaseNames = []string{
+	PhaseParse:  "parse",
+	PhaseDecode: "decode",
+	PhaseEncode: "encode",
+}
+
+func (p Phase) String() string {
+	if p > 0 && int(p) < len(phaseNames) {
+		return phaseNames[p]
+	}
+	return "Phase(" + strconv.Itoa(int(p)) + ")"
+}
+
+// tracePhase runs fn as the given phase of the document with the given
+// index, reporting it to trace unless it's nil.
+func tracePhase(trace func(phase Phase, index int) func(), phase Phase, index int, fn func()) {
+	if trace != nil {
+		if end := trace(phase, index); end != nil {
+			defer end()
+		}
+	}
+	fn()
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestDecoderSetTrace(c *C) {
+	var calls []string
+	trace := func(phase yaml.Phase, index int) func() {
+		calls = append(calls, fmt.Sprintf("start %s %d", phase, index))
+		return func() { calls = append(calls, fmt.Sprintf("end %s %d", phase, index)) }
+	}
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\n---\nb: [2\n"))
+	dec.SetTrace(trace)
+	var v map[string]int
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 2: did not find expected ',' or ']'")
+	c.Assert(calls, DeepEquals, []string{
+		"start parse 0", "end parse 0",
+		"start decode 0", "end decode 0",
+		"start parse 1", "end parse 1",
+	})
+
+	// Phases that fail end as well, and a nil end function is allowed.
+	calls = nil
+	dec.ResetBytes([]byte("a: x\n"))
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n.*")
+	c.Assert(dec.Decode(&v), Equals, io.EOF)
+	c.Assert(calls, DeepEquals, []string{
+		"start parse 0", "end parse 0",
+		"start decode 0", "end decode 0",
+		"start parse 1", "end parse 1",
+	})
+	dec.ResetBytes([]byte("a: 1\n"))
+	dec.SetTrace(func(phase yaml.Phase, index int) func() { return nil })
+	c.Assert(dec.Decode(&v), IsNil)
+
+	calls = nil
+	c.Assert(yaml.UnmarshalWithOptions([]byte("a: 1\n"), &v, yaml.WithTrace(trace)), IsNil)
+	c.Assert(calls, DeepEquals, []string{
+		"start parse 0", "end parse 0",
+		"start decode 0", "end decode 0",
+	})
+}
+
+func (s *S) TestEncoderSetTrace(c *C) {
+	var buf bytes.Buffer
+	var calls []string
+	enc := yaml.NewEncoder(&buf)
+	enc.SetTrace(func(phase yaml.Phase, index int) func() {
+		calls = append(calls, fmt.Sprintf("start %s %d %d", phase, index, buf.Len()))
+		return func() { calls = append(calls, fmt.Sprintf("end %s %d %d", phase, index, buf.Len())) }
+	})
+	c.Assert(enc.Encode(map[string]int{"a": 1}), IsNil)
+	c.Assert(enc.Encode([]int{1}), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(calls, DeepEquals, []string{
+		"start encode 0 0", "end encode 0 5",
+		"start encode 1 5", "end encode 1 13",
+	})
+	c.Assert(yaml.Phase(9).String(), Equals, "Phase(9)")
+}
@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrShortDst is returned by Transformer when dst is too short to
+	// receive the next transformed character.
+	ErrShortDst = errors.New("yaml: short destination buffer")
+
+	// ErrShortSrc is returned by Transformer when src holds an incomplete
+	// character and more input is needed to make progress.
+	ErrShortSrc = errors.New("yaml: short source buffer")
+)
+
+// A Transformer decodes a YAML stream into UTF-8 the same way a Decoder
+// reads its input: the encoding is detected from the byte order mark
+// unless it was given in advance, the byte order mark is dropped, and
+// characters that aren't allowed in YAML are rejected.
+//
+// Transformer has the method set of the Transformer interface in
+// golang.org/x/text/transform. As this package doesn't depend on x/text,
+// the errors reporting short buffers must be set to the ones defined
+// there for a Transformer to be used with that package:
+//
+//     t := yaml.NewTransformer(yaml.AnyEncoding)
+//     t.SetShortErrors(transform.ErrShortDst, transform.ErrShortSrc)
+//     r := transform.NewReader(input, transform.Chain(t, norm.NFC))
+//
+type Transformer struct {
+	parser   yaml_parser_t
+	encoding Encoding
+	shortDst error
+	shortSrc error
+}
+
+// NewTransformer returns a Transformer that decodes input in the given
+// encoding, or in the one detected from the input for AnyEncoding.
+func NewTransformer(enc Encoding) *Transformer {
+	if enc < AnyEncoding || enc > UTF16BE {
+		panic("yaml: unknown encoding")
+	}
+	t := &Transformer{encoding: enc, shortDst: ErrShortDst, shortSrc: ErrShortSrc}
+	t.Reset()
+	return t
+}
+
+// SetShortErrors sets the errors returned when dst or src are too short,
+// which are ErrShortDst and ErrShortSrc by default.
+func (t *Transformer) SetShortErrors(shortDst, shortSrc error) {
+	t.shortDst = shortDst
+	t.shortSrc = shortSrc
+}
+
+// ReplaceInvalid changes how byte sequences that are invalid in the input
+// encoding are handled, as for Decoder.ReplaceInvalid.
+func (t *Transformer) ReplaceInvalid(enable bool) {
+	t.parser.replace_invalid = enable
+}
+
+// Reset resets the state of t so that it can transform a new stream.
+func (t *Transformer) Reset() {
+	replace := t.parser.replace_invalid
+	t.parser = yaml_parser_t{}
+	t.parser.encoding = yaml_encoding_t(t.encoding)
+	t.parser.replace_invalid = replace
+}
+
+// Transform writes to dst the UTF-8 encoding of the characters in src,
+// returning the number of bytes written to dst and read from src.
+// atEOF reports whether src holds the end of the input.
+func (t *Transformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	parser := &t.parser
+	if parser.error != yaml_NO_ERROR {
+		return 0, 0, t.err()
+	}
+	parser.raw_buffer = src
+	parser.raw_buffer_pos = 0
+	parser.eof = atEOF
+	defer func() {
+		parser.raw_buffer = nil
+		parser.buffer = nil
+	}()
+
+	if !parser.encoding_determined {
+		if !atEOF && len(src) < len(bom_UTF8) {
+			return 0, 0, t.shortSrc
+		}
+		yaml_parser_determine_encoding(parser)
+	}
+
+	parser.buffer = dst
+	nDst, ok := yaml_parser_decode_raw(parser, 0)
+	nSrc = parser.raw_buffer_pos
+	if !ok {
+		return nDst, nSrc, t.err()
+	}
+	if nSrc < len(src) {
+		// The decoding loop stops either for lack of room in dst, or
+		// because src ends in the middle of a character.
+		if len(dst)-nDst < 5 {
+			return nDst, nSrc, t.shortDst
+		}
+		return nDst, nSrc, t.shortSrc
+	}
+	return nDst, nSrc, nil
+}
+
+func (t *Transformer) err() error {
+	if t.parser.problem_bytes != nil {
+		return newEncodingError(&t.parser)
+	}
+	return fmt.Errorf("yaml: %s at byte %d", t.parser.problem, t.parser.problem_offset)
+}
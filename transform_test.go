@@ -0,0 +1,112 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+var transformTests = []struct {
+	enc   yaml.Encoding
+	input string
+	want  string
+	error string
+}{{
+	input: "a: b\n",
+	want:  "a: b\n",
+}, {
+	input: "\xef\xbb\xbfa: \xc3\xa9\n",
+	want:  "a: é\n",
+}, {
+	input: "\xff\xfea\x00:\x00 \x00=\xd8\x00\xde\n\x00",
+	want:  "a: 😀\n",
+}, {
+	input: "\xfe\xff\x00a\x00:\x00 \x00\xe9\x00\n",
+	want:  "a: é\n",
+}, {
+	enc:   yaml.UTF16LE,
+	input: "a\x00:\x00 \x00b\x00",
+	want:  "a: b",
+}, {
+	input: "a: \xc3\n",
+	error: "yaml: invalid trailing UTF-8 octet at byte 4",
+}, {
+	input: "a: \x01",
+	error: "yaml: control characters are not allowed at byte 3",
+}}
+
+// transformAll drives t the way golang.org/x/text/transform does, with
+// source and destination buffers of the given sizes.
+func transformAll(t *yaml.Transformer, input []byte, srcSize, dstSize int) (string, error) {
+	var out []byte
+	dst := make([]byte, dstSize)
+	src := make([]byte, 0, srcSize)
+	for {
+		n := copy(src[len(src):cap(src)], input)
+		src = src[:len(src)+n]
+		input = input[n:]
+		atEOF := len(input) == 0
+		nDst, nSrc, err := t.Transform(dst, src, atEOF)
+		out = append(out, dst[:nDst]...)
+		src = src[:copy(src, src[nSrc:])]
+		switch err {
+		case nil:
+			if atEOF {
+				return string(out), nil
+			}
+		case yaml.ErrShortDst, yaml.ErrShortSrc:
+			if nDst == 0 && nSrc == 0 && (err == yaml.ErrShortDst || atEOF || len(src) == cap(src)) {
+				return string(out), err
+			}
+		default:
+			return string(out), err
+		}
+	}
+}
+
+func (s *S) TestTransformer(c *C) {
+	for i, item := range transformTests {
+		for _, size := range []int{1, 2, 3, 5, 64} {
+			t := yaml.NewTransformer(item.enc)
+			srcSize := size
+			if srcSize < 4 {
+				srcSize = 4
+			}
+			out, err := transformAll(t, []byte(item.input), srcSize, size+4)
+			if item.error != "" {
+				c.Assert(err, ErrorMatches, item.error, Commentf("test %d, size %d", i, size))
+				continue
+			}
+			c.Assert(err, IsNil, Commentf("test %d, size %d", i, size))
+			c.Assert(out, Equals, item.want, Commentf("test %d, size %d", i, size))
+		}
+	}
+}
+
+func (s *S) TestTransformerShortErrors(c *C) {
+	shortDst := errors.New("short destination")
+	t := yaml.NewTransformer(yaml.AnyEncoding)
+	t.SetShortErrors(shortDst, yaml.ErrShortSrc)
+	_, _, err := t.Transform(make([]byte, 6), []byte("abcdefgh"), true)
+	c.Assert(err, Equals, shortDst)
+
+	t.Reset()
+	_, _, err = t.Transform(make([]byte, 16), []byte("a\xc3"), false)
+	c.Assert(err, Equals, yaml.ErrShortSrc)
+}
@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// Unflatten returns a document holding the values by the string form of
+// their paths, as the inverse of FlattenStrings, such as for applying
+// settings given as "server.tls.cert=..." or "list[0]=a" on a command
+// line or in environment variables. The paths are taken in sorted order,
+// and the values are read as plain scalars, so "8080" is an integer and
+// "true" a boolean, with "{}" and "[]" for an empty mapping and sequence.
+// See UnflattenLeaves for how the paths are combined.
+func Unflatten(values map[string]string) (*Node, error) {
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	leaves := make([]Leaf, len(paths))
+	for i, path := range paths {
+		p, err := ParsePath(path)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = Leaf{Path: p, Value: values[path]}
+	}
+	return UnflattenLeaves(leaves)
+}
+
+// UnflattenLeaves returns a document holding the values of the leaves at
+// their paths, as the inverse of Flatten. Only the paths, values and tags
+// of the leaves are used, and a leaf without a tag has its value read as
+// a plain scalar. Keys make mappings and indexes make sequences, in the
+// order the leaves first reach them, and the items missing from a
+// sequence before the highest index set are null. Indexes may exceed the
+// number of leaves by at most 1000, so that a few leaves can't make huge
+// sequences.
+//
+// An error is returned for leaves that conflict, such as a value set at
+// both "a" and "a.b", keys and indexes used on the same value, or the
+// same path set twice, and for indexes too large.
+func UnflattenLeaves(leaves []Leaf) (*Node, error) {
+	doc := &Node{Kind: DocumentNode, Content: []*Node{{}}}
+	set := make(map[*Node]bool)
+	for _, leaf := range leaves {
+		n := doc.Content[0]
+		for i, e := range leaf.Path {
+			var problem string
+			if n, problem = unflattenStep(n, e, set, len(leaves)+maxUnflattenGap); problem != "" {
+				at := "the root"
+				if i > 0 {
+					at = strconv.Quote(leaf.Path[:i].String())
+				}
+				return nil, errors.New("yaml: cannot set " + strconv.Quote(leaf.Path.String()) + " as " + at + problem)
+			}
+		}
+		if n.Kind != 0 {
+			return nil, errors.New("yaml: cannot set " + strconv.Quote(leaf.Path.String()) + " twice")
+		}
+		setLeaf(n, leaf)
+		set[n] = true
+	}
+	fillNulls(doc)
+	return doc, nil
+}
+
+// maxUnflattenGap is how much the indexes of the paths given to
+// UnflattenLeaves may exceed their number by.
+const maxUnflattenGap = 1000
+
+// unflattenStep returns the node that e steps into from n, added to n if
+// missing, or the problem with n if it can't. Indexes from maxIndex on
+// are a problem.
+func unflattenStep(n *Node, e PathElem, set map[*Node]bool, maxIndex int) (*Node, string) {
+	switch {
+	case set[n]:
+		return nil, " is set to a value"
+	case e.IsKey():
+		if n.Kind == 0 {
+			n.Kind, n.Tag = MappingNode, mapTag
+		} else if n.Kind != MappingNode {
+			return nil, " is a sequence"
+		}
+		if i := pathChild(n, e); i >= 0 {
+			return n.Content[i], ""
+		}
+		value := &Node{}
+		n.Content = append(n.Content, &Node{Kind: ScalarNode, Tag: strTag, Value: e.Key}, value)
+		return value, ""
+	default:
+		if n.Kind == 0 {
+			n.Kind, n.Tag = SequenceNode, seqTag
+		} else if n.Kind != SequenceNode {
+			return nil, " is a mapping"
+		}
+		if e.Index >= maxIndex {
+			return nil, " is too short for index " + strconv.Itoa(e.Index)
+		}
+		for len(n.Content) <= e.Index {
+			n.Content = append(n.Content, &Node{})
+		}
+		return n.Content[e.Index], ""
+	}
+}
+
+// setLeaf sets n to the value of leaf.
+func setLeaf(n *Node, leaf Leaf) {
+	tag := leaf.Tag
+	if tag == "" {
+		switch leaf.Value {
+		case "{}":
+			tag = mapTag
+		case "[]":
+			tag = seqTag
+		default:
+			tag, _ = resolve("", leaf.Value)
+		}
+	}
+	switch tag {
+	case mapTag:
+		n.Kind, n.Style = MappingNode, FlowStyle
+	case seqTag:
+		n.Kind, n.Style = SequenceNode, FlowStyle
+	default:
+		n.Kind, n.Value = ScalarNode, leaf.Value
+	}
+	n.Tag = tag
+}
+
+// fillNulls makes the nodes within n left unset null.
+func fillNulls(n *Node) {
+	if n.Kind == 0 {
+		n.Kind, n.Tag, n.Value = ScalarNode, nullTag, "null"
+	}
+	for _, c := range n.Content {
+		fillNulls(c)
+	}
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *S) TestUnflatten(c *C) {
+	n, err := yaml.Unflatten(map[string]string{
+		"server.tls.cert":                  "/etc/cert",
+		"server.port":                      "8080",
+		"list[0]":                          "a",
+		"list[2]":                          "c",
+		`labels["app.kubernetes.io/name"]`: "web",
+		"empty":                            "{}",
+	})
+	c.Assert(err, IsNil)
+	data, err := yaml.Marshal(n)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `empty: {}
+labels:
+    app.kubernetes.io/name: web
+list:
+    - a
+    - null
+    - c
+server:
+    port: 8080
+    tls:
+        cert: /etc/cert
+`)
+}
+
+func (s *S) TestUnflattenLeaves(c *C) {
+	var in yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("b: {c: '1', d: [x, 2]}\na: []\n"), &in), IsNil)
+	n, err := yaml.UnflattenLeaves(yaml.Flatten(&in))
+	c.Assert(err, IsNil)
+	data, err := yaml.Marshal(n)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "b:\n    c: \"1\"\n    d:\n        - x\n        - 2\na: []\n")
+
+	leaves := []yaml.Leaf{
+		{Path: yaml.Path{yaml.KeyElem("a"), yaml.IndexElem(0)}, Value: "1"},
+		{Path: yaml.Path{yaml.KeyElem("a"), yaml.KeyElem("b")}, Value: "2"},
+	}
+	_, err = yaml.UnflattenLeaves(leaves)
+	c.Assert(err, ErrorMatches, `yaml: cannot set "a.b" as "a" is a sequence`)
+}
+
+var unflattenErrorTests = []struct {
+	values map[string]string
+	error  string
+}{
+	{map[string]string{"a": "1", "a.b": "2"}, `yaml: cannot set "a.b" as "a" is set to a value`},
+	{map[string]string{"a.b": "1", "a[0]": "2"}, `yaml: cannot set "a\[0\]" as "a" is a mapping`},
+	{map[string]string{"a.b": "1", `a["b"]`: "2"}, `yaml: cannot set "a.b" twice`},
+	{map[string]string{"a.b": "1", "[0]": "2"}, `yaml: cannot set "a.b" as the root is a sequence`},
+	{map[string]string{"a[x]": "1"}, `yaml: invalid path "a\[x\]"`},
+	{map[string]string{"a[20000000]": "1"}, `yaml: cannot set "a\[20000000\]" as "a" is too short for index 20000000`},
+	{map[string]string{"a[1001]": "1"}, `yaml: cannot set "a\[1001\]" as "a" is too short for index 1001`},
+}
+
+func (s *S) TestUnflattenErrors(c *C) {
+	for _, t := range unflattenErrorTests {
+		_, err := yaml.Unflatten(t.values)
+		c.Assert(err, ErrorMatches, t.error)
+	}
+}
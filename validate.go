@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
+package yaml
+
+import "io"
+
+// Valid reports whether in holds a valid YAML stream, as far as it can
+// tell without decoding it. This is much cheaper than unmarshalling the
+// input, and finds the same syntax errors and aliases of unknown anchors,
+// but not the problems of decoding into a particular Go value, such as
+// duplicate mapping keys.
+func Valid(in []byte) bool {
+	return validate(newParser(in)) == nil
+}
+
+// Validate reads a YAML stream from r and returns the problems found in
+// it, as Valid does. No further problems are found after a syntax error.
+func Validate(r io.Reader) []error {
+	return validate(newParserFromReader(r))
+}
+
+func validate(p *parser) []error {
+	defer p.destroy()
+	var errs []error
+	if err := p.validate(&errs); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func (p *parser) validate(errs *[]error) (err error) {
+	defer handleDecodeErr(&err)
+	anchors := make(map[string]bool)
+	p.init()
+	for {
+		typ := p.peek()
+		if typ == yaml_STREAM_END_EVENT {
+			return nil
+		}
+		e := &p.event
+		if typ == yaml_ALIAS_EVENT {
+			anchor := string(e.anchor)
+			if !anchors[anchor] {
+				*errs = append(*errs, &AnchorError{
+					Code:    ErrCodeUnknownAnchor,
+					Anchor:  anchor,
+					Line:    e.start_mark.line + 1,
+					Column:  e.start_mark.column + 1,
+					Message: "unknown anchor '" + anchor + "' referenced",
+				})
+			}
+		} else if len(e.anchor) > 0 {
+			anchors[string(e.anchor)] = true
+		}
+		p.expect(typ)
+	}
+}
+
+// ValidateStream reads a YAML stream from r and returns the problems found
+// in it as Validate does, along with a *SchemaError for each value of its
+// documents that doesn't follow s, as s.Validate finds them, unless s is
+// nil. The documents are checked as they are read, without building their
+// nodes, so that the memory used doesn't grow with their size. Only the
+// values with an anchor are kept as nodes, for the aliases to them to be
+// checked, and the mappings and sequences whose schema has an enum, for
+// these to be compared. An alias of an unknown anchor within any of these
+// stops the validation, as a syntax error does.
+func ValidateStream(r io.Reader, s *Schema) []error {
+	if s == nil {
+		return Validate(r)
+	}
+	p := newParserFromReader(r)
+	defer p.destroy()
+	v := streamValidator{p: p}
+	if err := v.stream(s); err != nil {
+		v.errs = append(v.errs, err)
+	}
+	return v.errs
+}
+
+// streamValidator checks the documents of a stream against a schema as
+// their events are read.
+type streamValidator struct {
+	schemaValidator
+	p *parser
+}
+
+func (v *streamValidator) stream(s *Schema) (err error) {
+	defer handleDecodeErr(&err)
+	p := v.p
+	p.init()
+	for p.peek() != yaml_STREAM_END_EVENT {
+		p.expect(yaml_DOCUMENT_START_EVENT)
+		v.next(s, nil)
+		p.expect(yaml_DOCUMENT_END_EVENT)
+	}
+	return nil
+}
+
+// next checks the next value of the stream, at path, against s, or only
+// reads it if s is nil.
+func (v *streamValidator) next(s *Schema, path Path) {
+	p := v.p
+	typ := p.peek()
+	e := &p.event
+	switch {
+	case typ == yaml_ALIAS_EVENT:
+		if anchor := string(e.anchor); p.anchors[anchor] == nil {
+			v.errs = append(v.errs, &AnchorError{
+				Code:    ErrCodeUnknownAnchor,
+				Anchor:  anchor,
+				Line:    e.start_mark.line + 1,
+				Column:  e.start_mark.column + 1,
+				Message: "unknown anchor '" + anchor + "' referenced",
+			})
+			p.expect(typ)
+			return
+		}
+	case typ == yaml_SCALAR_EVENT, len(e.anchor) > 0, s != nil && len(s.Enum) > 0:
+	default:
+		v.collection(s, path)
+		return
+	}
+	v.value(s, p.parse(), path)
+}
+
+// collection checks the next mapping or sequence of the stream, at path,
+// against s, as next does.
+func (v *streamValidator) collection(s *Schema, path Path) {
+	p := v.p
+	start := p.peek()
+	n := &Node{
+		Kind:   MappingNode,
+		Line:   p.event.start_mark.line + 1,
+		Column: p.event.start_mark.column + 1,
+	}
+	end := yaml_MAPPING_END_EVENT
+	if start == yaml_SEQUENCE_START_EVENT {
+		n.Kind = SequenceNode
+		end = yaml_SEQUENCE_END_EVENT
+	}
+	if s != nil && !s.hasType(n, "") {
+		v.typeError(s, n, path)
+		s = nil
+	}
+	p.enter()
+	p.expect(start)
+	// The problems with the length of a sequence come before those of
+	// its items, as for Schema.Validate.
+	at := len(v.errs)
+	found := make(map[string]bool)
+	i := 0
+	for ; p.peek() != end; i++ {
+		if n.Kind == SequenceNode {
+			var items *Schema
+			if s != nil {
+				items = s.Items
+			}
+			v.next(items, path.Index(i))
+			continue
+		}
+		key := p.parse()
+		found[key.Value] = true
+		var value *Schema
+		if s != nil {
+			value = v.property(s, key, path)
+		}
+		v.next(value, path.Key(key.Value))
+		if p.peek() == yaml_TAIL_COMMENT_EVENT {
+			p.expect(yaml_TAIL_COMMENT_EVENT)
+		}
+	}
+	p.depth--
+	p.expect(end)
+	switch {
+	case s == nil:
+	case n.Kind == SequenceNode:
+		items := v.errs[at:]
+		v.errs = v.errs[:at:at]
+		v.length(s, n, i, path)
+		v.errs = append(v.errs, items...)
+	default:
+		v.required(s, n, found, path)
+	}
+}
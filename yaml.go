@@ -13,6 +13,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !yaml_noreflect
+// +build !yaml_noreflect
+
 // Package yaml implements YAML support for the Go language.
 //
 // Source code and other details for the project are available at GitHub:
@@ -22,33 +25,32 @@
 package yaml
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode"
 	"unicode/utf8"
 )
 
-// The Unmarshaler interface may be implemented by types to customize their
-// behavior when being unmarshaled from a YAML document.
-type Unmarshaler interface {
-	UnmarshalYAML(value *Node) error
-}
-
 type obsoleteUnmarshaler interface {
 	UnmarshalYAML(unmarshal func(interface{}) error) error
 }
 
-// The Marshaler interface may be implemented by types to customize their
-// behavior when being marshaled into a YAML document. The returned value
-// is marshaled in place of the original value implementing Marshaler.
-//
-// If an error is returned by MarshalYAML, the marshaling procedure stops
-// and returns with the provided error.
-type Marshaler interface {
-	MarshalYAML() (interface{}, error)
+// MapSlice encodes and decodes as a YAML mapping, keeping the order of
+// its items. When decoding into a MapSlice, or into a []MapItem, the
+// mappings decoded into interface{} values within it are MapSlice values
+// as well, and the items of merged mappings follow the other ones.
+type MapSlice []MapItem
+
+// MapItem is an item in a MapSlice.
+type MapItem struct {
+	Key, Value interface{}
 }
 
 // Unmarshal decodes the first document found within the in byte slice
@@ -63,14 +65,19 @@ type Marshaler interface {
 // values in out. If one or more values cannot be decoded due to a type
 // mismatches, decoding continues partially until the end of the YAML
 // content, and a *yaml.TypeError is returned with details for all
-// missed values.
+// missed values. The same goes for values that are not valid for their
+// explicit tag, such as a !!binary scalar that isn't base64, and for
+// values rejected by the UnmarshalText method of their Go type: these
+// are reported in the *yaml.TypeError with ErrCodeInvalidValue rather
+// than stopping the decoding.
 //
 // Struct fields are only unmarshalled if they are exported (have an
 // upper case first letter), and are unmarshalled using the field name
-// lowercased as the default key. Custom keys may be defined via the
-// "yaml" name in the field tag: the content preceding the first comma
-// is used as the key, and the following comma-separated options are
-// used to tweak the marshalling process (see Marshal).
+// lowercased as the default key, or named as set by Decoder.SetKeyNaming.
+// Custom keys may be defined via the "yaml" name in the field tag: the
+// content preceding the first comma is used as the key, and the following
+// comma-separated options are used to tweak the marshalling process (see
+// Marshal).
 // Conflicting names result in a runtime error.
 //
 // For example:
@@ -89,10 +96,39 @@ func Unmarshal(in []byte, out interface{}) (err error) {
 	return unmarshal(in, out, false)
 }
 
+// UnmarshalStrict is like Unmarshal but for input that must match out
+// exactly. Keys that match no struct field are reported as errors, as
+// Decoder.KnownFields does, and values are only decoded into Go types
+// that represent them without conversion: only strings are decoded into
+// string values, only integers into integer values, and only true and
+// false into bool values. Duplicate mapping keys are rejected by
+// Unmarshal as well.
+func UnmarshalStrict(in []byte, out interface{}) (err error) {
+	return unmarshal(in, out, true)
+}
+
 // A Decoder reads and decodes YAML values from an input stream.
 type Decoder struct {
 	parser      *parser
 	knownFields bool
+	encoding    Encoding
+	warnings    []Warning
+
+	maxAliasCount int
+	maxErrors     int
+	patch         bool
+	slicePolicy   SlicePolicy
+	mapPolicy     MapPolicy
+	keyNaming     KeyNaming
+	keepMerges    bool
+
+	trackPresence bool
+	presence      map[string]bool
+
+	schema *Schema
+
+	trace func(phase Phase, index int) func()
+	docs  int
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -100,17 +136,506 @@ type Decoder struct {
 // The decoder introduces its own buffering and may read
 // data from r beyond the YAML values requested.
 func NewDecoder(r io.Reader) *Decoder {
+	p := newParserFromReader(r)
+	// Nothing tells when the decoder is no longer used, so it holds
+	// buffers of its own rather than ones from the pools.
+	yaml_parser_set_buffers(&p.parser, make([]byte, 0, input_raw_buffer_size), make([]byte, 0, input_buffer_size))
 	return &Decoder{
-		parser: newParserFromReader(r),
+		parser: p,
 	}
 }
 
+// NewSafeDecoder returns a new decoder that reads from r, with limits and
+// options suited to input that isn't trusted. It is the same as a decoder
+// returned by NewDecoder configured with:
+//
+//     dec.SetMaxDepth(100)
+//     dec.SetMaxAliasExpansions(10000)
+//     dec.SetMaxBytes(8 << 20)
+//     dec.SetMaxErrors(100)
+//     dec.DisallowCustomTags(true)
+//
+// The settings may be changed afterwards as for any other decoder.
+// Duplicate mapping keys are rejected by all decoders.
+func NewSafeDecoder(r io.Reader) *Decoder {
+	dec := NewDecoder(r)
+	dec.SetMaxDepth(100)
+	dec.SetMaxAliasExpansions(10000)
+	dec.SetMaxBytes(8 << 20)
+	dec.SetMaxErrors(100)
+	dec.DisallowCustomTags(true)
+	return dec
+}
+
+// Reset discards any state and buffered data of the decoder and makes
+// it read from r, as if it was returned by NewDecoder. Options and
+// buffers are preserved, which allows decoders to be pooled and reused.
+func (dec *Decoder) Reset(r io.Reader) {
+	dec.parser.reset()
+	dec.warnings = nil
+	dec.presence = nil
+	dec.docs = 0
+	dec.parser.parser.encoding = yaml_encoding_t(dec.encoding)
+	yaml_parser_set_input_reader(&dec.parser.parser, r)
+}
+
+// ResetBytes is like Reset but makes the decoder read from b.
+func (dec *Decoder) ResetBytes(b []byte) {
+	dec.parser.reset()
+	dec.warnings = nil
+	dec.presence = nil
+	dec.docs = 0
+	dec.parser.parser.encoding = yaml_encoding_t(dec.encoding)
+	if len(b) == 0 {
+		b = []byte{'\n'}
+	}
+	yaml_parser_set_input_string(&dec.parser.parser, b)
+}
+
 // KnownFields ensures that the keys in decoded mappings to
 // exist as fields in the struct being decoded into.
 func (dec *Decoder) KnownFields(enable bool) {
 	dec.knownFields = enable
 }
 
+// SetProjection makes the decoder read only the values at the given
+// paths in the documents it decodes, in the string form of a Path, along
+// with the mappings and sequences leading to them. The events of any
+// other value are skipped as they are parsed, without building nodes or
+// resolving scalars, so that a few values may be read from large
+// documents cheaply. Mapping keys skipped are left out, as if missing
+// from the document, and sequence items skipped are read as null, for the
+// others to keep their indexes.
+//
+// The paths may be patterns as for Redact, and a "**" step keeps all the
+// values under the steps before it. Values with an anchor are always
+// read, for aliases to them. It panics for an invalid path, and no paths
+// makes the decoder read whole documents again.
+func (dec *Decoder) SetProjection(paths ...string) {
+	if len(paths) == 0 {
+		dec.parser.keep = nil
+		return
+	}
+	patterns := make([]Path, len(paths))
+	for i, s := range paths {
+		p, err := parsePath(s, true)
+		if err != nil {
+			panic(err.Error())
+		}
+		patterns[i] = p
+	}
+	dec.parser.keep = func(path Path) bool {
+		for _, p := range patterns {
+			if matchPathPrefix(p, path) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipValue skips the next document in the input without decoding it,
+// consuming its events without building nodes or resolving scalars, for
+// the documents of a stream that are not needed to be passed over
+// cheaply. It returns io.EOF when there are no more documents, and an
+// error for a document that isn't valid YAML.
+//
+// Decode skips the values that can only be left out of the value it
+// decodes into the same way, such as those of keys matching no field of
+// a struct, or matching a field tagged with "-".
+func (dec *Decoder) SkipValue() (err error) {
+	defer handleDecodeErr(&err)
+	if !dec.parser.skipDocument() {
+		return io.EOF
+	}
+	return nil
+}
+
+// DisallowAliases makes the decoder reject any anchor or alias in the
+// input with an *AnchorError, for input that must not rely on aliasing
+// or be amplified by it.
+func (dec *Decoder) DisallowAliases(enable bool) {
+	dec.parser.noAliases = enable
+}
+
+// DisallowCustomTags makes the decoder reject any explicit tag besides
+// the ones it knows, !!str, !!int, !!float, !!bool, !!null, !!seq, !!map,
+// !!binary, !!timestamp and !!merge, with a *TagError. The non-specific
+// tag ! is allowed.
+func (dec *Decoder) DisallowCustomTags(enable bool) {
+	dec.parser.noCustomTags = enable
+}
+
+// Patch makes the decoder change only the parts of the value decoded into
+// that the document has keys for, for applying a document onto defaults.
+// Struct fields are always left alone when their keys are missing; with
+// Patch, map entries that already exist are decoded into in the same way
+// rather than replaced, including maps held in interface values.
+// Sequences still replace the slices they are decoded into.
+func (dec *Decoder) Patch(enable bool) {
+	dec.patch = enable
+}
+
+// A SlicePolicy controls how sequences are decoded into slices that
+// already hold items.
+type SlicePolicy int
+
+const (
+	// SliceReplace replaces the slice with a new one holding the items of
+	// the sequence. This is the default.
+	SliceReplace SlicePolicy = iota + 1
+
+	// SliceReuse replaces the items of the slice with those of the
+	// sequence, reusing the array underlying the slice when it has the
+	// capacity for them.
+	SliceReuse
+
+	// SliceAppend appends the items of the sequence to the slice.
+	SliceAppend
+)
+
+var slicePolicies = map[string]SlicePolicy{
+	"replace": SliceReplace,
+	"reuse":   SliceReuse,
+	"append":  SliceAppend,
+}
+
+// SetSlicePolicy sets how the decoder decodes sequences into slices that
+// already hold items. The policy of a struct field may be set in its tag
+// instead, with the replace, reuse or append flags; see Marshal.
+func (dec *Decoder) SetSlicePolicy(policy SlicePolicy) {
+	dec.slicePolicy = policy
+}
+
+// A MapPolicy controls how mappings are decoded into maps that already
+// hold entries.
+type MapPolicy int
+
+const (
+	// MapMerge adds the entries of the mapping to the map, replacing the
+	// ones with the same keys. This is the default.
+	MapMerge MapPolicy = iota + 1
+
+	// MapReplace replaces the map with a new one holding the entries of
+	// the mapping. Maps in struct fields with the inline or rest flags
+	// are replaced as well.
+	MapReplace
+)
+
+// SetMapPolicy sets how the decoder decodes mappings into maps that
+// already hold entries. With MapReplace, no map entries are left to be
+// decoded into by Patch.
+func (dec *Decoder) SetMapPolicy(policy MapPolicy) {
+	dec.mapPolicy = policy
+}
+
+// SetKeyNaming sets how the keys of struct fields are derived from their
+// names when their tag names no key. Keys are the lowercased field names
+// by default.
+func (dec *Decoder) SetKeyNaming(naming KeyNaming) {
+	dec.keyNaming = naming
+}
+
+// SetPreserveMergeKeys sets whether "<<" merge keys are kept when
+// decoding mappings into maps of Node values, such as the maps
+// of struct fields with the rest flag, rather than the entries of the
+// mappings they merge. The entry of the merge key then holds the alias
+// to the merged mapping as it was found, so that the document may be
+// edited and written back with it. The fields of a struct still take
+// the values merged, while its rest map leaves out the ones the merge key
+// stands for. Merge keys are always kept when decoding into a Node.
+func (dec *Decoder) SetPreserveMergeKeys(enable bool) {
+	dec.keepMerges = enable
+}
+
+// A Presence tells whether a document had a value at a given path.
+type Presence int
+
+const (
+	// Absent is the presence of a path the document had no value at.
+	Absent Presence = iota
+
+	// PresentNull is the presence of a path the document had null at,
+	// whether written as null, ~, or left empty.
+	PresentNull
+
+	// Present is the presence of a path the document had any other
+	// value at.
+	Present
+)
+
+// TrackPresence makes the decoder record the paths it decodes values at,
+// for Presence to tell a key that was left out of a document from one
+// that was set to null. This matters when applying a document onto
+// existing values, as both leave a struct field unchanged.
+func (dec *Decoder) TrackPresence(enable bool) {
+	dec.trackPresence = enable
+}
+
+// Presence reports whether the document last decoded had a value at
+// path, in the string form of a Path, such as "spec.replicas". It is
+// only known for paths into values decoded, including keys brought in
+// by merge keys, and not for keys ignored for not matching any struct
+// field or the contents of a Node decoded into. See TrackPresence.
+func (dec *Decoder) Presence(path string) Presence {
+	null, ok := dec.presence[path]
+	switch {
+	case !ok:
+		return Absent
+	case null:
+		return PresentNull
+	}
+	return Present
+}
+
+// SetEncoding forces the character encoding used to read the input,
+// for when detection based on the byte order mark isn't accurate, such
+// as with UTF-16 input that has no byte order mark. A byte order mark
+// matching the given encoding is still skipped. SetEncoding must be
+// called before the first call to Decode.
+func (dec *Decoder) SetEncoding(enc Encoding) {
+	if enc < AnyEncoding || enc > UTF16BE {
+		panic("yaml: unknown encoding")
+	}
+	dec.encoding = enc
+	dec.parser.parser.encoding = yaml_encoding_t(enc)
+}
+
+// SetTransform makes the decoder pass its input through fn before
+// decoding it, so that input in encodings other than UTF-8 and UTF-16
+// can be read without converting it in advance. fn has the semantics of
+// the Transform method of the Transformer interface in
+// golang.org/x/text/transform, so for instance input in Shift JIS may
+// be read with:
+//
+//     dec.SetTransform(japanese.ShiftJIS.NewDecoder().Transform)
+//
+// The output of fn is then decoded as usual, including the detection
+// of the Unicode encoding in use, and offsets reported by the decoder
+// refer to it rather than to the original input. SetTransform must be
+// called before the first call to Decode.
+func (dec *Decoder) SetTransform(fn func(dst, src []byte, atEOF bool) (nDst, nSrc int, err error)) {
+	yaml_parser_set_transform(&dec.parser.parser, fn)
+}
+
+// DetectedEncoding returns the character encoding of the input and
+// whether it started with a byte order mark. The encoding is only known
+// once decoding has begun; before that AnyEncoding is returned.
+func (dec *Decoder) DetectedEncoding() (enc Encoding, bom bool) {
+	if !dec.parser.parser.encoding_determined {
+		return AnyEncoding, false
+	}
+	return Encoding(dec.parser.parser.encoding), dec.parser.parser.bom
+}
+
+// SetBufferSize sets how many bytes are read from the underlying reader
+// at a time, which is 512 by default. Larger sizes reduce the number of
+// reads on large inputs, while smaller ones reduce memory use. The decoder
+// holds a working buffer of three times this size in addition to it.
+// Neither buffer grows as the input is read, whatever its size, so the
+// memory they take is known in advance; SetMaxBytes limits the input
+// itself. SetBufferSize must be called before the first call to Decode.
+func (dec *Decoder) SetBufferSize(n int) {
+	if n < input_min_raw_buffer_size {
+		n = input_min_raw_buffer_size
+	}
+	yaml_parser_set_buffers(&dec.parser.parser, make([]byte, 0, n), make([]byte, 0, n*3))
+}
+
+// SetBuffer makes the decoder use buf for its input buffering instead of
+// allocating buffers of its own. A quarter of buf is used for reading
+// from the underlying reader and the rest as the working buffer. buf must
+// be at least 64 bytes long and must not be used by the caller while the
+// decoder is in use. SetBuffer must be called before the first call to
+// Decode.
+func (dec *Decoder) SetBuffer(buf []byte) {
+	if len(buf) < input_min_raw_buffer_size*4 {
+		panic("yaml: decoder buffer must be at least 64 bytes long")
+	}
+	n := len(buf) / 4
+	yaml_parser_set_buffers(&dec.parser.parser, buf[:0:n], buf[n:n:len(buf)])
+}
+
+// SetTrace sets a function called as each phase of decoding a document
+// starts, given the phase and the index of the document, counting from 0.
+// The function it returns, unless it's nil, is called as the phase ends,
+// even if it fails. This lets the time spent on YAML show up in traces,
+// with spans started from a context the function is a closure over:
+//
+//     dec.SetTrace(func(phase yaml.Phase, index int) func() {
+//         _, span := tracer.Start(ctx, "yaml."+phase.String())
+//         return func() { span.End() }
+//     })
+//
+func (dec *Decoder) SetTrace(fn func(phase Phase, index int) func()) {
+	dec.trace = fn
+}
+
+// SetSchema sets the schema the documents decoded are expected to follow.
+// Scalars are read as the types the schema declares for them where their
+// values allow, such as "8080" as an integer, and properties that are
+// missing or null take the defaults of their schemas. Values are not
+// otherwise checked against the schema.
+func (dec *Decoder) SetSchema(s *Schema) {
+	dec.schema = s
+}
+
+// SetMaxDepth limits the nesting of mappings and sequences in the input
+// to n levels. Decoding deeper input fails with an error of code
+// ErrCodeMaxDepth. A limit of 0, the default, leaves only the limit built
+// into the parser of 10000 levels.
+func (dec *Decoder) SetMaxDepth(n int) {
+	dec.parser.maxDepth = n
+}
+
+// SetMaxAliasExpansions limits to n the values decoded from within aliases
+// in a document. Once more are, decoding fails with an *AnchorError of
+// code ErrCodeAliasLimit. A limit of 0, the default, leaves only the
+// limit on the proportion of such values built into the decoder. Aliases
+// are not expanded when decoding into a Node.
+func (dec *Decoder) SetMaxAliasExpansions(n int) {
+	dec.maxAliasCount = n
+}
+
+// SetMaxErrors limits to n the problems reported for a document that
+// cannot be decoded, such as values of the wrong type or unknown fields,
+// which are otherwise all found in one pass and returned together in a
+// *TypeError, for a file to be fixed at once. The problems past the limit
+// are left out. A limit of 0, the default, means no limit.
+//
+// The limit applies as well to the problems found while reading the input
+// and reported by Warnings, which are otherwise limited to 1000. Warnings
+// ends with a count of those left out, if any.
+func (dec *Decoder) SetMaxErrors(n int) {
+	dec.maxErrors = n
+	dec.parser.parser.max_warnings = n
+}
+
+// SetMaxBytes limits the input read by the decoder to n bytes, counted
+// before the input is transformed or decoded from UTF-16. Once more input
+// is found, decoding fails with a *SizeLimitError. A limit of 0, the
+// default, means no limit.
+func (dec *Decoder) SetMaxBytes(n int) {
+	dec.parser.parser.max_bytes = n
+}
+
+// ReplaceInvalid changes how byte sequences that are invalid in the
+// input encoding are handled. By default they cause decoding to fail.
+// When enabled, each invalid sequence is replaced by the Unicode
+// replacement character U+FFFD and reported via Warnings instead.
+func (dec *Decoder) ReplaceInvalid(enable bool) {
+	dec.parser.parser.replace_invalid = enable
+}
+
+// FallbackToWindows1252 makes the decoder read octets that aren't valid
+// UTF-8 as Windows-1252, a superset of Latin-1, instead of failing, so that
+// input predating the use of UTF-8 can be read on a best-effort basis. Each
+// octet read this way is reported via Warnings. This takes precedence over
+// ReplaceInvalid for UTF-8 input.
+func (dec *Decoder) FallbackToWindows1252(enable bool) {
+	dec.parser.parser.windows1252 = enable
+}
+
+// SetSurrogatePolicy sets how unpaired surrogates in UTF-16 input are
+// handled. By default they cause decoding to fail, as they do not encode
+// any character.
+func (dec *Decoder) SetSurrogatePolicy(policy SurrogatePolicy) {
+	if policy < SurrogateError || policy > SurrogateWTF8 {
+		panic("yaml: unknown surrogate policy")
+	}
+	dec.parser.parser.surrogates = yaml_surrogate_policy_t(policy)
+}
+
+// StrictCharacters makes the decoder reject the Unicode noncharacters,
+// U+FDD0 to U+FDEF and the last two code points of each plane, which are
+// otherwise passed through. Control characters are always rejected. If
+// invalid input is being replaced, noncharacters are replaced as well.
+func (dec *Decoder) StrictCharacters(enable bool) {
+	dec.parser.parser.strict_chars = enable
+}
+
+// NormalizeLineEndings makes the decoder turn CR LF sequences and lone
+// CR characters into LF as the input is read, so that documents are
+// decoded alike whichever line endings they were written with, including
+// in comments. Lines and columns reported by the decoder are unaffected.
+func (dec *Decoder) NormalizeLineEndings(enable bool) {
+	dec.parser.parser.normalize_breaks = enable
+}
+
+// SetNormalizer makes the decoder pass the value of every scalar through
+// fn before it is resolved, so that keys and values that only differ in
+// their Unicode normalization form are treated alike. For instance, the
+// NFC form may be used with norm.NFC.String from golang.org/x/text/unicode/norm.
+// Positions reported by the decoder still refer to the original input.
+func (dec *Decoder) SetNormalizer(fn func(string) string) {
+	dec.parser.normalize = fn
+}
+
+// Warnings returns the problems found in the input read so far
+// that did not prevent it from being decoded. Besides invalid input
+// that was replaced, these include values decoded following YAML 1.1
+// rather than 1.2, and keys ignored for not matching any struct field.
+// Problems found while reading the input come first.
+func (dec *Decoder) Warnings() []Warning {
+	warnings := dec.parser.warnings()
+	return append(warnings, dec.warnings...)
+}
+
+// InputOffset returns the input stream byte offset of the current decoder
+// position. After a call to Decode, this is where the document it decoded
+// ended, including the "..." marker if there was one. The offset counts
+// input bytes as read from the underlying reader, or as produced by the
+// function set with SetTransform.
+func (dec *Decoder) InputOffset() int64 {
+	return int64(dec.parser.end.offset)
+}
+
+// Buffered returns a reader of the data read from the underlying reader
+// but not consumed yet, from the position given by InputOffset on. This
+// allows a stream holding other data after a YAML document, ended with
+// "..." or followed by "---", to be read on once the document is decoded.
+// Such data is only reported as invalid if decoding goes on into it.
+// With SetTransform, the data is returned as transformed.
+func (dec *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(yaml_parser_unconsumed_input(&dec.parser.parser, dec.parser.end.offset))
+}
+
+// InputPos returns the line and column, starting from 1, of the current
+// decoder position, as described for InputOffset. Columns are counted in
+// characters.
+func (dec *Decoder) InputPos() (line, column int) {
+	return dec.parser.end.line + 1, dec.parser.end.column + 1
+}
+
+// Anchors returns the nodes with an anchor in the documents decoded so
+// far, by anchor name. An anchor defined again refers to the last node
+// defined with it. When decoding into a Node, the nodes returned are the
+// ones in the decoded tree; otherwise they may be decoded as needed with
+// Node.Decode.
+func (dec *Decoder) Anchors() map[string]*Node {
+	anchors := make(map[string]*Node, len(dec.parser.anchors))
+	for name, n := range dec.parser.anchors {
+		anchors[name] = n
+	}
+	return anchors
+}
+
+// More reports whether there is another document in the input, without
+// decoding it. When More returns false, Decode returns io.EOF. A problem
+// found in the input counts as a document, so that Decode reports it.
+func (dec *Decoder) More() (more bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			if _, ok := v.(yamlError); !ok {
+				panic(v)
+			}
+			more = true
+		}
+	}()
+	dec.parser.init()
+	return dec.parser.peek() != yaml_STREAM_END_EVENT
+}
+
 // Decode reads the next YAML-encoded value from its input
 // and stores it in the value pointed to by v.
 //
@@ -119,18 +644,42 @@ func (dec *Decoder) KnownFields(enable bool) {
 func (dec *Decoder) Decode(v interface{}) (err error) {
 	d := newDecoder()
 	d.knownFields = dec.knownFields
-	defer handleErr(&err)
-	node := dec.parser.parse()
-	if node == nil {
-		return io.EOF
+	d.maxAliasCount = dec.maxAliasCount
+	d.maxErrors = dec.maxErrors
+	d.patch = dec.patch
+	d.slicePolicy = dec.slicePolicy
+	d.mapPolicy = dec.mapPolicy
+	d.keyNaming = dec.keyNaming
+	d.keepMerges = dec.keepMerges
+	dec.presence = nil
+	if dec.trackPresence {
+		dec.presence = make(map[string]bool)
+		d.presence = dec.presence
 	}
+	defer handleDecodeErr(&err)
 	out := reflect.ValueOf(v)
 	if out.Kind() == reflect.Ptr && !out.IsNil() {
 		out = out.Elem()
 	}
-	d.unmarshal(node, out)
+	dec.parser.ignoring = nil
+	if out.IsValid() && dec.schema == nil {
+		// The schema may check the values the decoder leaves out.
+		dec.parser.ignoring = ignoring(out.Type(), dec.keyNaming)
+	}
+	var node *Node
+	tracePhase(dec.trace, PhaseParse, dec.docs, func() { node = dec.parser.parse() })
+	if node == nil {
+		return io.EOF
+	}
+	index := dec.docs
+	dec.docs++
+	tracePhase(dec.trace, PhaseDecode, index, func() {
+		dec.schema.coerce(node)
+		d.unmarshal(node, out)
+	})
+	dec.warnings = append(dec.warnings, d.warnings...)
 	if len(d.terrors) > 0 {
-		return &TypeError{d.terrors}
+		return newTypeError(d.terrors)
 	}
 	return nil
 }
@@ -141,33 +690,38 @@ func (dec *Decoder) Decode(v interface{}) (err error) {
 // conversion of YAML into a Go value.
 func (n *Node) Decode(v interface{}) (err error) {
 	d := newDecoder()
-	defer handleErr(&err)
+	defer handleDecodeErr(&err)
 	out := reflect.ValueOf(v)
 	if out.Kind() == reflect.Ptr && !out.IsNil() {
 		out = out.Elem()
 	}
 	d.unmarshal(n, out)
 	if len(d.terrors) > 0 {
-		return &TypeError{d.terrors}
+		return newTypeError(d.terrors)
 	}
 	return nil
 }
 
 func unmarshal(in []byte, out interface{}, strict bool) (err error) {
-	defer handleErr(&err)
+	defer handleDecodeErr(&err)
 	d := newDecoder()
+	d.knownFields = strict
+	d.strictTypes = strict
 	p := newParser(in)
 	defer p.destroy()
+	v := reflect.ValueOf(out)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.IsValid() {
+		p.ignoring = ignoring(v.Type(), 0)
+	}
 	node := p.parse()
 	if node != nil {
-		v := reflect.ValueOf(out)
-		if v.Kind() == reflect.Ptr && !v.IsNil() {
-			v = v.Elem()
-		}
 		d.unmarshal(node, v)
 	}
 	if len(d.terrors) > 0 {
-		return &TypeError{d.terrors}
+		return newTypeError(d.terrors)
 	}
 	return nil
 }
@@ -178,9 +732,10 @@ func unmarshal(in []byte, out interface{}, strict bool) (err error) {
 //
 // Struct fields are only marshalled if they are exported (have an upper case
 // first letter), and are marshalled using the field name lowercased as the
-// default key. Custom keys may be defined via the "yaml" name in the field
-// tag: the content preceding the first comma is used as the key, and the
-// following comma-separated options are used to tweak the marshalling process.
+// default key, or named as set by Encoder.SetKeyNaming. Custom keys may be
+// defined via the "yaml" name in the field tag: the content preceding the
+// first comma is used as the key, and the following comma-separated options
+// are used to tweak the marshalling process.
 // Conflicting names result in a runtime error.
 //
 // The field tag format accepted is:
@@ -204,8 +759,33 @@ func unmarshal(in []byte, out interface{}, strict bool) (err error) {
 //                  they were part of the outer struct. For maps, keys must
 //                  not conflict with the yaml keys of other struct fields.
 //
+//     rest         Collect the keys matching no other field into the
+//                  field, which must be a map with string keys, and
+//                  marshal its entries after the other fields. This is
+//                  the same as inline for a map. A map[string]yaml.Node
+//                  keeps the values as they were found, with comments.
+//
+//     replace      Unmarshal sequences into the field, which must be a
+//     reuse        slice, with the SliceReplace, SliceReuse or SliceAppend
+//     append       policy rather than the one of the decoder.
+//
+//     anchor       Marshal the value with an anchor, named after the key
+//                  unless given as in anchor=name.
+//
+//     alias        Marshal the value as an alias of the field with the
+//                  anchor named after the key, or given as in alias=name,
+//                  when it holds an equal value. When unmarshalling an
+//                  alias of such a field, the field is set to its value,
+//                  so pointers, maps and slices are shared.
+//
 // In addition, if the key is "-", the field is ignored.
 //
+// The text of a "comment" tag is written as a comment above the key of
+// the field, and the one of a "linecomment" tag as a comment after it, on
+// its line, as in:
+//
+//     Retries int `yaml:"retries" comment:"number of times to retry; 0 disables"`
+//
 // For example:
 //
 //     type T struct {
@@ -225,20 +805,69 @@ func Marshal(in interface{}) (out []byte, err error) {
 	return
 }
 
+// MarshalIndent is like Marshal but indents nested block collections by
+// the given number of spaces, as Encoder.SetIndent does.
+func MarshalIndent(in interface{}, spaces int) (out []byte, err error) {
+	if spaces < 0 {
+		panic("yaml: cannot indent to a negative number of spaces")
+	}
+	defer handleErr(&err)
+	e := newEncoder()
+	defer e.destroy()
+	e.indent = spaces
+	e.marshalDoc("", reflect.ValueOf(in))
+	e.finish()
+	out = e.out
+	return
+}
+
+// MarshalFlow is like Marshal but writes collections in flow style, as
+// in "{a: 1, b: [2, 3]}", which keeps the document on a single line
+// unless it holds comments.
+func MarshalFlow(in interface{}) (out []byte, err error) {
+	defer handleErr(&err)
+	e := newEncoder()
+	defer e.destroy()
+	e.flow = true
+	e.marshalDoc("", reflect.ValueOf(in))
+	e.finish()
+	out = e.out
+	return
+}
+
 // An Encoder writes YAML values to an output stream.
 type Encoder struct {
 	encoder *encoder
+	out     *countingWriter
+	docs    int
+
+	before, after func(index int, n int64)
+	trace         func(phase Phase, index int) func()
 }
 
 // NewEncoder returns a new encoder that writes to w.
 // The Encoder should be closed after use to flush all data
 // to w.
 func NewEncoder(w io.Writer) *Encoder {
+	out := &countingWriter{w: w}
 	return &Encoder{
-		encoder: newEncoderWithWriter(w),
+		encoder: newEncoderWithWriter(out),
+		out:     out,
 	}
 }
 
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
 // Encode writes the YAML encoding of v to the stream.
 // If multiple items are encoded to the stream, the
 // second and subsequent document will be preceded
@@ -248,10 +877,57 @@ func NewEncoder(w io.Writer) *Encoder {
 // values to YAML.
 func (e *Encoder) Encode(v interface{}) (err error) {
 	defer handleErr(&err)
-	e.encoder.marshalDoc("", reflect.ValueOf(v))
+	if e.before != nil {
+		e.before(e.docs, e.out.n)
+	}
+	start := e.out.n
+	tracePhase(e.trace, PhaseEncode, e.docs, func() { e.encoder.marshalDoc("", reflect.ValueOf(v)) })
+	if e.after != nil {
+		e.after(e.docs, e.out.n-start)
+	}
+	e.docs++
 	return nil
 }
 
+// SetTrace sets a function called as Encode starts encoding a document,
+// as for Decoder.SetTrace, with PhaseEncode.
+func (e *Encoder) SetTrace(fn func(phase Phase, index int) func()) {
+	e.trace = fn
+}
+
+// SetBufferSize sets how many bytes of output the encoder holds before
+// writing them to the underlying writer, which is 128 by default. The
+// output held is also written at the end of every document. Larger sizes
+// make for fewer, larger writes on large documents, while smaller ones
+// reduce memory use. Sizes below 16 are taken as 16. SetBufferSize may
+// be called between documents.
+func (e *Encoder) SetBufferSize(n int) {
+	if n < output_min_buffer_size {
+		n = output_min_buffer_size
+	}
+	yaml_emitter_set_buffer_size(&e.encoder.emitter, n)
+}
+
+// BytesWritten returns the number of bytes the encoder has written to the
+// underlying writer so far. After a call to Encode, this is where the
+// document it encoded ends, as the output of every document is written
+// by then.
+func (e *Encoder) BytesWritten() int64 {
+	return e.out.n
+}
+
+// SetDocumentHooks sets functions called by Encode before and after each
+// document is written, with the index of the document counting from 0.
+// Before is given the number of bytes the encoder has written so far,
+// and after the number of bytes the document took, including any "---"
+// separator preceding it. Either may be nil. The output of a document is
+// written to the underlying writer by the time after is called, so hooks
+// may write to it as well, such as to add separators of their own.
+func (e *Encoder) SetDocumentHooks(before, after func(index int, n int64)) {
+	e.before = before
+	e.after = after
+}
+
 // Encode encodes value v and stores its representation in n.
 //
 // See the documentation for Marshal for details about the
@@ -278,208 +954,434 @@ func (e *Encoder) SetIndent(spaces int) {
 	e.encoder.indent = spaces
 }
 
-// Close closes the encoder by writing any remaining data.
-// It does not write a stream terminating string "...".
-func (e *Encoder) Close() (err error) {
-	defer handleErr(&err)
-	e.encoder.finish()
-	return nil
-}
-
-func handleErr(err *error) {
-	if v := recover(); v != nil {
-		if e, ok := v.(yamlError); ok {
-			*err = e.err
-		} else {
-			panic(v)
-		}
+// SetSequenceIndent changes the indentation of block sequences that are
+// mapping values, relative to their keys, which is otherwise the one set
+// with SetIndent. With zero spaces, the dashes line up with the keys.
+func (e *Encoder) SetSequenceIndent(spaces int) {
+	if spaces < 0 {
+		panic("yaml: cannot indent to a negative number of spaces")
 	}
+	e.encoder.emitter.seq_indent = spaces
 }
 
-type yamlError struct {
-	err error
+// SetCompactFlow sets whether flow collections are written without the
+// spaces that separate their items, as in [1,2,3], for output meant for
+// programs rather than people. The space after the colon of a mapping key
+// is left out only when the key is quoted, as in {"a":1,b: 2}, since
+// otherwise the value would read as part of the key.
+func (e *Encoder) SetCompactFlow(enable bool) {
+	e.encoder.emitter.tight_colon = enable
+	e.encoder.emitter.tight_comma = enable
 }
 
-func fail(err error) {
-	panic(yamlError{err})
+// FlowFormat describes the spacing of flow collections, for
+// Encoder.SetFlowFormat. The zero value is the compact format of
+// Encoder.SetCompactFlow, while by default only SpaceAfterColon and
+// SpaceAfterComma are set.
+type FlowFormat struct {
+	// SpaceAfterColon writes a space after the colon of each mapping
+	// key. It is only left out after quoted keys, as in {"a":1}.
+	SpaceAfterColon bool
+
+	// SpaceAfterComma writes a space after the comma of each item.
+	SpaceAfterComma bool
+
+	// SpaceInside writes a space inside the brackets and braces of
+	// collections that are not empty, as in [ 1, 2 ] and { a: 1 }.
+	SpaceInside bool
+
+	// ItemPerLine writes each item of a collection on a line of its own
+	// when the collection would not fit in the line width, as set with
+	// Encoder.SetLineWidth. The fit is estimated before the style of
+	// the scalars is known, so collections close to the width may be
+	// broken up although they would have fit.
+	ItemPerLine bool
 }
 
-func failf(format string, args ...interface{}) {
-	panic(yamlError{fmt.Errorf("yaml: "+format, args...)})
+// SetFlowFormat sets the spacing of flow collections, so the output can
+// follow the conventions of a style guide.
+func (e *Encoder) SetFlowFormat(format FlowFormat) {
+	e.encoder.emitter.tight_colon = !format.SpaceAfterColon
+	e.encoder.emitter.tight_comma = !format.SpaceAfterComma
+	e.encoder.emitter.padded = format.SpaceInside
+	e.encoder.emitter.wrap_items = format.ItemPerLine
 }
 
-// A TypeError is returned by Unmarshal when one or more fields in
-// the YAML document cannot be properly decoded into the requested
-// types. When this error is returned, the value is still
-// unmarshaled partially.
-type TypeError struct {
-	Errors []string
+// SetLineWidth sets the preferred width of the lines written, beyond
+// which flow collections and scalars are broken onto more lines where
+// their style allows. Lines are not broken with a negative width, which
+// is the default.
+func (e *Encoder) SetLineWidth(width int) {
+	yaml_emitter_set_width(&e.encoder.emitter, width)
 }
 
-func (e *TypeError) Error() string {
-	return fmt.Sprintf("yaml: unmarshal errors:\n  %s", strings.Join(e.Errors, "\n  "))
+// SetScalarWrapping sets whether scalars longer than the line width are
+// broken onto more lines, which is the default. Scalars kept on their
+// lines read the same to parsers that don't handle such breaks well, and
+// remain easy to search for, while flow collections are still broken.
+func (e *Encoder) SetScalarWrapping(enable bool) {
+	e.encoder.emitter.no_breaks = !enable
 }
 
-type Kind uint32
+// SetStringStyle sets a function choosing the style of the strings
+// written, given their path in the document, whether they are mapping
+// keys, and their value. The function may return DoubleQuotedStyle,
+// SingleQuotedStyle, LiteralStyle or FoldedStyle, or 0 to leave the
+// choice to the encoder. Where the style returned cannot represent a
+// string, such as a literal style for a key, a double-quoted style is
+// used instead. Strings in Node values are only passed to the function
+// if they have none of these styles set.
+func (e *Encoder) SetStringStyle(fn func(path Path, key bool, value string) Style) {
+	e.encoder.stringStyle = fn
+}
 
-const (
-	DocumentNode Kind = 1 << iota
-	SequenceNode
-	MappingNode
-	ScalarNode
-	AliasNode
-)
+// SetMultilinePolicy sets the policy choosing the style of strings that
+// span more than one line, which are otherwise written in the literal
+// style, or double-quoted inside flow collections. A style that cannot
+// represent a string, or is not allowed where it appears, falls back to
+// a double-quoted style. A function set with SetStringStyle takes
+// precedence over the policy.
+func (e *Encoder) SetMultilinePolicy(policy MultilinePolicy) {
+	e.encoder.multiline = policy
+}
 
-type Style uint32
+// SetTagPolicy sets when the tags of values are written, both for Node
+// values and for any other values.
+func (e *Encoder) SetTagPolicy(policy TagPolicy) {
+	e.encoder.tags = policy
+}
 
-const (
-	TaggedStyle Style = 1 << iota
-	DoubleQuotedStyle
-	SingleQuotedStyle
-	LiteralStyle
-	FoldedStyle
-	FlowStyle
-)
+// SetKeyNaming sets how the keys of struct fields are derived from their
+// names when their tag names no key. Keys are the lowercased field names
+// by default.
+func (e *Encoder) SetKeyNaming(naming KeyNaming) {
+	e.encoder.keyNaming = naming
+}
 
-// Node represents an element in the YAML document hierarchy. While documents
-// are typically encoded and decoded into higher level types, such as structs
-// and maps, Node is an intermediate representation that allows detailed
-// control over the content being decoded or encoded.
-//
-// It's worth noting that although Node offers access into details such as
-// line numbers, colums, and comments, the content when re-encoded will not
-// have its original textual representation preserved. An effort is made to
-// render the data plesantly, and to preserve comments near the data they
-// describe, though.
-//
-// Values that make use of the Node type interact with the yaml package in the
-// same way any other type would do, by encoding and decoding yaml data
-// directly or indirectly into them.
-//
-// For example:
-//
-//     var person struct {
-//             Name    string
-//             Address yaml.Node
-//     }
-//     err := yaml.Unmarshal(data, &person)
-// 
-// Or by itself:
-//
-//     var person Node
-//     err := yaml.Unmarshal(data, &person)
-//
-type Node struct {
-	// Kind defines whether the node is a document, a mapping, a sequence,
-	// a scalar value, or an alias to another node. The specific data type of
-	// scalar nodes may be obtained via the ShortTag and LongTag methods.
-	Kind  Kind
-
-	// Style allows customizing the apperance of the node in the tree.
-	Style Style
-
-	// Tag holds the YAML tag defining the data type for the value.
-	// When decoding, this field will always be set to the resolved tag,
-	// even when it wasn't explicitly provided in the YAML content.
-	// When encoding, if this field is unset the value type will be
-	// implied from the node properties, and if it is set, it will only
-	// be serialized into the representation if TaggedStyle is used or
-	// the implicit tag diverges from the provided one.
-	Tag string
+// SetYAML11 sets whether the output is written so it reads the same to
+// parsers that follow version 1.1 of the YAML specification, as many
+// older ones do. Strings such as yes, off and 1:20 are then quoted, as
+// are strings with colons inside flow collections and mapping keys,
+// integers are written with a 0 prefix rather than 0o for octal, and
+// floats in exponent notation always have a dot and a signed exponent.
+func (e *Encoder) SetYAML11(enable bool) {
+	e.encoder.emitter.yaml11 = enable
+}
 
-	// Value holds the unescaped and unquoted represenation of the value.
-	Value string
+// SetNormalizeComments sets whether the comments of the nodes written
+// are normalized: every line of a comment starts with "# ", unless it's
+// blank or starts with "##" or "# " already, the whitespace around lines
+// and the blank lines around comments are removed, and the lines of a
+// line comment are joined into one. These are the comments of the form
+// that Node.SetHeadComment and the like set.
+func (e *Encoder) SetNormalizeComments(enable bool) {
+	e.encoder.normalizeComments = enable
+}
 
-	// Anchor holds the anchor name for this node, which allows aliases to point to it.
-	Anchor string
+// SetBanner sets a comment written at the top of the stream, such as a
+// license header or a note that the file is generated and should not be
+// edited, or at the top of every document if each is set. The text is
+// written as FormatComment does, with its lines broken at spaces to fit
+// the line width, if any, except for the lines that start with whitespace.
+// The banner comes ahead of the head comment of a document node, apart
+// from it by a blank line. An empty text writes no banner.
+func (e *Encoder) SetBanner(text string, each bool) {
+	e.encoder.banner = text
+	e.encoder.bannerEach = each
+}
 
-	// Alias holds the node that this alias points to. Only valid when Kind is AliasNode.
-	Alias *Node
+// SetDocComments has the mapping entries written documented in head
+// comments, for generating an example configuration from its defaults.
+// The comment of an entry holds its description, if any, followed by the
+// type of its value, the default and the allowed values, as declared for
+// it by s, if s isn't nil. The descriptions are taken from docs by the
+// paths of the values, as patterns in the form that Redact accepts, then
+// from the "description" tag of struct fields, then from s. Entries that
+// have no description nor schema are left undocumented, as are the ones
+// whose key already has a head comment. It panics if a path in docs is
+// invalid.
+func (e *Encoder) SetDocComments(s *Schema, docs map[string]string) {
+	if s == nil && docs == nil {
+		e.encoder.docs = nil
+		return
+	}
+	d := &docComments{schema: s}
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p, err := parsePath(key, true)
+		if err != nil {
+			panic(err.Error())
+		}
+		d.patterns = append(d.patterns, p)
+		d.texts = append(d.texts, docs[key])
+	}
+	e.encoder.docs = d
+}
 
-	// Content holds contained nodes for documents, mappings, and sequences.
-	Content []*Node
+// SetAnchors sets whether values reached more than once through the same
+// pointer or map within a document are written in full only the first
+// time, with an anchor, and as aliases to it after that. The anchors are
+// named id001, id002 and so on, unless named with SetAnchorNamer. Values
+// that contain themselves can only be encoded with anchors.
+func (e *Encoder) SetAnchors(enable bool) {
+	e.encoder.anchors = enable
+}
 
-	// HeadComment holds any comments in the lines preceding the node and
-	// not separated by an empty line.
-	HeadComment string
+// SetAnchorNamer sets a function naming the anchors written as set with
+// SetAnchors, given the path of the value in the document and the pointer
+// or map itself. The names may hold letters, digits, '-' and '_' only.
+// A number is appended to a name that is already in use, and an empty
+// name leaves the anchor numbered.
+func (e *Encoder) SetAnchorNamer(fn func(path Path, value interface{}) string) {
+	e.encoder.anchorNamer = fn
+}
 
-	// LineComment holds any comments at the end of the line where the node is in.
-	LineComment string
+// SetDeduplication sets the number of nodes from which collections that
+// are equal to an earlier one in the same document are written as aliases
+// to it, with the earlier one anchored, which shrinks documents with much
+// repeated content. The nodes of a collection count itself along with all
+// the scalars, aliases and collections within it. Collections holding
+// anchors or comments are always written in full. Zero, the default,
+// writes all collections in full.
+func (e *Encoder) SetDeduplication(minNodes int) {
+	if minNodes < 0 {
+		panic("yaml: cannot deduplicate collections with a negative number of nodes")
+	}
+	e.encoder.dedup = minNodes
+}
 
-	// FootComment holds any comments following the node and before empty lines.
-	FootComment string
+// SetMergeKeys sets the number of entries from which mappings that hold
+// every key of an earlier mapping in the same document, and that many of
+// its entries with equal values, are written with a "<<" merge key and an
+// alias to it, with the earlier mapping anchored, followed by the entries
+// that differ, as in:
+//
+//     base: &id001
+//         image: app
+//         replicas: 1
+//     prod:
+//         <<: *id001
+//         replicas: 3
+//
+// This keeps variants of a configuration built from a common base, as by
+// a Loader, as short as a document written by hand. Mappings with a tag,
+// with keys other than scalars, or equal to the earlier mapping, and the
+// entries holding anchors or comments, are written in full. Zero, the
+// default, writes all mappings in full.
+func (e *Encoder) SetMergeKeys(minEntries int) {
+	if minEntries < 0 {
+		panic("yaml: cannot merge mappings with a negative number of entries")
+	}
+	e.encoder.mergeKeys = minEntries
+}
 
-	// Line and Column hold the node position in the decoded YAML text.
-	// These fields are not respected when encoding the node.
-	Line   int
-	Column int
+// SetMaxDepth limits the nesting of mappings and sequences written to n
+// levels. Encoding deeper values, or values that contain themselves
+// without SetAnchors, fails with an error of code ErrCodeMaxDepth. A
+// limit of 0, the default, leaves a built-in limit of 10000 levels.
+func (e *Encoder) SetMaxDepth(n int) {
+	e.encoder.maxDepth = n
 }
 
-// IsZero returns whether the node has all of its fields unset.
-func (n *Node) IsZero() bool {
-	return n.Kind == 0 && n.Style == 0 && n.Tag == "" && n.Value == "" && n.Anchor == "" && n.Alias == nil && n.Content == nil &&
-		n.HeadComment == "" && n.LineComment == "" && n.FootComment == "" && n.Line == 0 && n.Column == 0
+// Close closes the encoder by writing any remaining data.
+// It does not write a stream terminating string "...".
+func (e *Encoder) Close() (err error) {
+	defer handleErr(&err)
+	e.encoder.finish()
+	return nil
 }
 
+// Encoding identifies the character encoding of a YAML stream.
+type Encoding int
+
+const (
+	// AnyEncoding lets the decoder choose the encoding based on the
+	// byte order mark found at the start of the input, or UTF-8 if
+	// there is none.
+	AnyEncoding Encoding = iota
+
+	UTF8    // The UTF-8 encoding.
+	UTF16LE // The UTF-16 little-endian encoding.
+	UTF16BE // The UTF-16 big-endian encoding.
+)
 
-// LongTag returns the long form of the tag that indicates the data type for
-// the node. If the Tag field isn't explicitly defined, one will be computed
-// based on the node properties.
-func (n *Node) LongTag() string {
-	return longTag(n.ShortTag())
+var encodingNames = []string{
+	AnyEncoding: "any",
+	UTF8:        "utf-8",
+	UTF16LE:     "utf-16le",
+	UTF16BE:     "utf-16be",
 }
 
-// ShortTag returns the short form of the YAML tag that indicates data type for
-// the node. If the Tag field isn't explicitly defined, one will be computed
-// based on the node properties.
-func (n *Node) ShortTag() string {
-	if n.indicatedString() {
-		return strTag
+// String returns the name of the encoding, one of "any", "utf-8",
+// "utf-16le" and "utf-16be".
+func (enc Encoding) String() string {
+	if enc < 0 || int(enc) >= len(encodingNames) {
+		return "Encoding(" + strconv.Itoa(int(enc)) + ")"
 	}
-	if n.Tag == "" || n.Tag == "!" {
-		switch n.Kind {
-		case MappingNode:
-			return mapTag
-		case SequenceNode:
-			return seqTag
-		case AliasNode:
-			if n.Alias != nil {
-				return n.Alias.ShortTag()
-			}
-		case ScalarNode:
-			tag, _ := resolve("", n.Value)
-			return tag
-		case 0:
-			// Special case to make the zero value convenient.
-			if n.IsZero() {
-				return nullTag
+	return encodingNames[enc]
+}
+
+// ParseEncoding returns the encoding with the given name, as returned by
+// Encoding.String. Names are matched regardless of case.
+func ParseEncoding(name string) (Encoding, error) {
+	for enc, encName := range encodingNames {
+		if strings.EqualFold(name, encName) {
+			return Encoding(enc), nil
+		}
+	}
+	return AnyEncoding, fmt.Errorf("yaml: unknown encoding %q", name)
+}
+
+// SurrogatePolicy defines how unpaired surrogates found in UTF-16
+// input are decoded.
+type SurrogatePolicy int
+
+const (
+	// SurrogateError makes decoding fail with an *EncodingError.
+	SurrogateError SurrogatePolicy = iota
+
+	// SurrogateReplace replaces unpaired surrogates with the Unicode
+	// replacement character U+FFFD and reports them via Decoder.Warnings.
+	SurrogateReplace
+
+	// SurrogateWTF8 passes unpaired surrogates through, encoded as in
+	// UTF-8 as if they were characters. The resulting strings, known as
+	// WTF-8, aren't valid UTF-8 but preserve the input exactly.
+	SurrogateWTF8
+)
+
+// CodeOf returns the code identifying the kind of err, or of the first
+// error of this package that err wraps, as errors.As finds it, or the
+// empty string if there is none.
+func CodeOf(err error) ErrorCode {
+	for err != nil {
+		if code := codeOf(err); code != "" {
+			return code
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				if code := CodeOf(err); code != "" {
+					return code
+				}
 			}
+			return ""
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// codeOf returns the code of err if it's an error of this package.
+func codeOf(err error) ErrorCode {
+	switch err := err.(type) {
+	case *Error:
+		return err.Code
+	case *EncodingError:
+		if err.Err == ErrDisallowedCharacter {
+			return ErrCodeDisallowedChar
 		}
-		return ""
+		return ErrCodeInvalidEncoding
+	case *SizeLimitError:
+		return ErrCodeInputTooLarge
+	case *AnchorError:
+		return err.Code
+	case *TagError:
+		return ErrCodeCustomTag
+	case *TypeError:
+		return ErrCodeType
+	case *UnmarshalError:
+		return err.Code
+	case *EmitterError:
+		return ErrCodeEmitter
+	case *SchemaError:
+		return ErrCodeSchema
+	case *SubstitutionError:
+		return ErrCodeSubstitution
+	}
+	return ""
+}
+
+// A TypeError is returned by Unmarshal when one or more fields in
+// the YAML document cannot be properly decoded into the requested
+// types, or hold values that are invalid for their tag or rejected by
+// UnmarshalText. When this error is returned, the value is still
+// unmarshaled partially.
+type TypeError struct {
+	// Errors holds the messages describing each problem.
+	Errors []string
+
+	// Details holds the problems themselves, in the same order as
+	// Errors. It may be empty for a TypeError returned by an
+	// Unmarshaler, in which case Errors alone describes the problems.
+	Details []*UnmarshalError
+}
+
+func newTypeError(details []*UnmarshalError) *TypeError {
+	e := &TypeError{Errors: make([]string, len(details)), Details: details}
+	for i, d := range details {
+		e.Errors[i] = d.Error()
 	}
-	return shortTag(n.Tag)
+	return e
 }
 
-func (n *Node) indicatedString() bool {
-	return n.Kind == ScalarNode &&
-		(shortTag(n.Tag) == strTag ||
-			(n.Tag == "" || n.Tag == "!") && n.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0)
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("yaml: unmarshal errors:\n  %s", strings.Join(e.Errors, "\n  "))
 }
 
-// SetString is a convenience function that sets the node to a string value
-// and defines its style in a pleasant way depending on its content.
-func (n *Node) SetString(s string) {
-	n.Kind = ScalarNode
-	if utf8.ValidString(s) {
-		n.Value = s
-		n.Tag = strTag
-	} else {
-		n.Value = encodeBase64(s)
-		n.Tag = binaryTag
+// Unwrap returns the problems in e.Details, so that errors.As may be
+// used to find the first *UnmarshalError.
+func (e *TypeError) Unwrap() []error {
+	errs := make([]error, len(e.Details))
+	for i, d := range e.Details {
+		errs[i] = d
 	}
-	if strings.Contains(n.Value, "\n") {
-		n.Style = LiteralStyle
+	return errs
+}
+
+// An UnmarshalError describes a single value that could not be decoded
+// into the requested type. Decoding carries on past such problems, and
+// all of them are reported together in a TypeError.
+type UnmarshalError struct {
+	// Code is one of ErrCodeType, ErrCodeInvalidValue,
+	// ErrCodeDuplicateKey, ErrCodeDuplicateField or
+	// ErrCodeUnknownField.
+	Code ErrorCode
+
+	// Path locates the value in the document.
+	Path Path
+
+	// Line and Column hold the position of the value, or 0 if unknown.
+	Line   int
+	Column int
+
+	// Tag holds the short tag of the value, such as "!!str".
+	Tag string
+
+	// Type holds the Go type the value was being decoded into, or nil
+	// for problems with the mapping keys themselves.
+	Type reflect.Type
+
+	// Message describes the problem.
+	Message string
+
+	// Err holds the error returned by the UnmarshalText method of the
+	// value, if that's the problem.
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	if e.Line != 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
 	}
+	return e.Message
 }
 
 // --------------------------------------------------------------------------
@@ -507,6 +1409,25 @@ type fieldInfo struct {
 	Num       int
 	OmitEmpty bool
 	Flow      bool
+
+	// SlicePolicy holds the policy set in the tag of a slice field, if any.
+	SlicePolicy SlicePolicy
+
+	// Anchor holds the anchor the value of the field is written with, and
+	// Alias the anchor of the field it is written as an alias of, if any.
+	Anchor string
+	Alias  string
+
+	// Description holds the description in the "description" tag of the
+	// field, written by Encoder.SetDocComments.
+	Description string
+
+	// Comment and LineComment hold the text of the "comment" and
+	// "linecomment" tags of the field, written as the head and line
+	// comments of its key.
+	Comment     string
+	LineComment string
+
 	// Id holds the unique field identifier, so we can cheaply
 	// check for field duplicates without maintaining an extra map.
 	Id int
@@ -515,7 +1436,86 @@ type fieldInfo struct {
 	Inline []int
 }
 
-var structMap = make(map[reflect.Type]*structInfo)
+// A KeyNaming derives the keys of struct fields from their names, for the
+// fields whose tag names no key.
+type KeyNaming int
+
+const (
+	// KeyLowercase lowercases the name, so that the key of a field named
+	// UserID is userid. This is the default.
+	KeyLowercase KeyNaming = iota + 1
+
+	// KeySnakeCase lowercases the words of the name and joins them with
+	// underscores, so that the key of a field named UserID is user_id.
+	KeySnakeCase
+
+	// KeyKebabCase lowercases the words of the name and joins them with
+	// dashes, so that the key of a field named UserID is user-id.
+	KeyKebabCase
+
+	// KeyCamelCase lowercases the first word of the name and capitalizes
+	// the others, so that the key of a field named UserID is userId.
+	KeyCamelCase
+)
+
+// key returns the key of a field named name.
+func (naming KeyNaming) key(name string) string {
+	switch naming {
+	case KeySnakeCase:
+		return strings.ToLower(strings.Join(nameWords(name), "_"))
+	case KeyKebabCase:
+		return strings.ToLower(strings.Join(nameWords(name), "-"))
+	case KeyCamelCase:
+		words := nameWords(name)
+		for i, w := range words {
+			w = strings.ToLower(w)
+			if i > 0 {
+				r, size := utf8.DecodeRuneInString(w)
+				w = string(unicode.ToUpper(r)) + w[size:]
+			}
+			words[i] = w
+		}
+		return strings.Join(words, "")
+	}
+	return strings.ToLower(name)
+}
+
+// nameWords splits a Go name into its words, at underscores and where a
+// capital letter follows a letter that isn't, or starts a word after an
+// acronym, as in HTTPServer.
+func nameWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(runes[i-1]) || next {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// structKey identifies the fields found for a struct type, which depend
+// on how their keys are named.
+type structKey struct {
+	t      reflect.Type
+	naming KeyNaming
+}
+
+var structMap = make(map[structKey]*structInfo)
 var fieldMapMutex sync.RWMutex
 var unmarshalerType reflect.Type
 
@@ -524,9 +1524,12 @@ func init() {
 	unmarshalerType = reflect.ValueOf(&v).Elem().Type()
 }
 
-func getStructInfo(st reflect.Type) (*structInfo, error) {
+func getStructInfo(st reflect.Type, naming KeyNaming) (*structInfo, error) {
+	if naming == 0 {
+		naming = KeyLowercase
+	}
 	fieldMapMutex.RLock()
-	sinfo, found := structMap[st]
+	sinfo, found := structMap[structKey{st, naming}]
 	fieldMapMutex.RUnlock()
 	if found {
 		return sinfo, nil
@@ -543,7 +1546,12 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			continue // Private field
 		}
 
-		info := fieldInfo{Num: i}
+		info := fieldInfo{
+			Num:         i,
+			Description: field.Tag.Get("description"),
+			Comment:     field.Tag.Get("comment"),
+			LineComment: field.Tag.Get("linecomment"),
+		}
 
 		tag := field.Tag.Get("yaml")
 		if tag == "" && strings.Index(string(field.Tag), ":") < 0 {
@@ -553,10 +1561,20 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			continue
 		}
 
-		inline := false
+		inline, anchor, alias := false, false, false
 		fields := strings.Split(tag, ",")
 		if len(fields) > 1 {
 			for _, flag := range fields[1:] {
+				if j := strings.Index(flag, "="); j >= 0 {
+					switch flag[:j] {
+					case "anchor":
+						anchor, info.Anchor = true, flag[j+1:]
+						continue
+					case "alias":
+						alias, info.Alias = true, flag[j+1:]
+						continue
+					}
+				}
 				switch flag {
 				case "omitempty":
 					info.OmitEmpty = true
@@ -564,6 +1582,24 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 					info.Flow = true
 				case "inline":
 					inline = true
+				case "anchor":
+					anchor = true
+				case "alias":
+					alias = true
+				case "replace", "reuse", "append":
+					ftype := field.Type
+					for ftype.Kind() == reflect.Ptr {
+						ftype = ftype.Elem()
+					}
+					if ftype.Kind() != reflect.Slice {
+						return nil, errors.New("option ," + flag + " may only be used on a slice field")
+					}
+					info.SlicePolicy = slicePolicies[flag]
+				case "rest":
+					if field.Type.Kind() != reflect.Map {
+						return nil, errors.New("option ,rest may only be used on a map field")
+					}
+					inline = true
 				default:
 					return nil, errors.New(fmt.Sprintf("unsupported flag %q in tag %q of type %s", flag, tag, st))
 				}
@@ -571,6 +1607,13 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			tag = fields[0]
 		}
 
+		if anchor && alias {
+			return nil, errors.New("options ,anchor and ,alias may not be used together in tag of " + st.String())
+		}
+		if inline && (anchor || alias) {
+			return nil, errors.New("option ,inline may not be used with ,anchor or ,alias in tag of " + st.String())
+		}
+
 		if inline {
 			switch field.Type.Kind() {
 			case reflect.Map:
@@ -592,7 +1635,7 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 				if reflect.PtrTo(ftype).Implements(unmarshalerType) {
 					inlineUnmarshalers = append(inlineUnmarshalers, []int{i})
 				} else {
-					sinfo, err := getStructInfo(ftype)
+					sinfo, err := getStructInfo(ftype, naming)
 					if err != nil {
 						return nil, err
 					}
@@ -623,7 +1666,13 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		if tag != "" {
 			info.Key = tag
 		} else {
-			info.Key = strings.ToLower(field.Name)
+			info.Key = naming.key(field.Name)
+		}
+		if anchor && info.Anchor == "" {
+			info.Anchor = info.Key
+		}
+		if alias && info.Alias == "" {
+			info.Alias = info.Key
 		}
 
 		if _, found = fieldsMap[info.Key]; found {
@@ -644,7 +1693,7 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 	}
 
 	fieldMapMutex.Lock()
-	structMap[st] = sinfo
+	structMap[structKey{st, naming}] = sinfo
 	fieldMapMutex.Unlock()
 	return sinfo, nil
 }
@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yamlfuzz provides fuzzing entry points for the yaml package.
+//
+// Each entry point has the signature go-fuzz and OSS-Fuzz expect,
+// returning 1 for inputs that parse and 0 otherwise, and panics when it
+// finds a bug. From a native Go fuzz test, call one as in:
+//
+//     func FuzzParse(f *testing.F) {
+//         f.Fuzz(func(t *testing.T, data []byte) {
+//             yamlfuzz.Parse(data)
+//         })
+//     }
+//
+// SuiteSeeds reads the inputs of the YAML test suite to seed a corpus.
+package yamlfuzz
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parse parses data into a Node, and panics if that fails internally.
+func Parse(data []byte) int {
+	var n yaml.Node
+	err := yaml.Unmarshal(data, &n)
+	if yaml.CodeOf(err) == yaml.ErrCodeInternal {
+		panic(err)
+	}
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// Decode decodes data into an interface{} value, and panics if that fails
+// internally.
+func Decode(data []byte) int {
+	var v interface{}
+	err := yaml.Unmarshal(data, &v)
+	if yaml.CodeOf(err) == yaml.ErrCodeInternal {
+		panic(err)
+	}
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// RoundTrip decodes data into an interface{} value, and panics unless
+// the value can be encoded, and the encoding decodes into a value that is
+// encoded the same way again.
+func RoundTrip(data []byte) int {
+	var v interface{}
+	if yaml.Unmarshal(data, &v) != nil {
+		return 0
+	}
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode %#v: %v", v, err))
+	}
+	var w interface{}
+	if err := yaml.Unmarshal(out, &w); err != nil {
+		panic(fmt.Sprintf("cannot decode %q: %v", out, err))
+	}
+	again, err := yaml.Marshal(w)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode %#v: %v", w, err))
+	}
+	if !bytes.Equal(out, again) {
+		panic(fmt.Sprintf("encoding changed from %q to %q", out, again))
+	}
+	return 1
+}
+
+// Transcode decodes data into UTF-8 with a Transformer, and panics unless
+// the result is valid UTF-8 that is the same when transformed in small
+// pieces, and that decodes into the same value as data itself.
+func Transcode(data []byte) int {
+	out, err := transformAll(data, len(data)+4, 4*len(data)+4)
+	small, smallErr := transformAll(data, 4, 8)
+	if (err == nil) != (smallErr == nil) || err != nil && err.Error() != smallErr.Error() {
+		panic(fmt.Sprintf("transforming at once gives %v, in pieces %v", err, smallErr))
+	}
+	if !bytes.Equal(out, small) {
+		panic(fmt.Sprintf("transforming at once gives %q, in pieces %q", out, small))
+	}
+	if err != nil {
+		return 0
+	}
+	if !utf8.Valid(out) {
+		panic(fmt.Sprintf("transforming gives invalid UTF-8 %q", out))
+	}
+	var v, w interface{}
+	err = yaml.Unmarshal(data, &v)
+	errOut := yaml.Unmarshal(out, &w)
+	if (err == nil) != (errOut == nil) || err != nil && err.Error() != errOut.Error() {
+		panic(fmt.Sprintf("decoding the input gives %v, its transformation %v", err, errOut))
+	}
+	if err != nil {
+		return 0
+	}
+	vOut, _ := yaml.Marshal(v)
+	wOut, _ := yaml.Marshal(w)
+	if !bytes.Equal(vOut, wOut) {
+		panic(fmt.Sprintf("decoding the input gives %q, its transformation %q", vOut, wOut))
+	}
+	return 1
+}
+
+// transformAll drives a Transformer the way golang.org/x/text/transform
+// does, with source and destination buffers of the given sizes.
+func transformAll(input []byte, srcSize, dstSize int) ([]byte, error) {
+	t := yaml.NewTransformer(yaml.AnyEncoding)
+	var out []byte
+	dst := make([]byte, dstSize)
+	src := make([]byte, 0, srcSize)
+	for {
+		n := copy(src[len(src):cap(src)], input)
+		src = src[:len(src)+n]
+		input = input[n:]
+		atEOF := len(input) == 0
+		nDst, nSrc, err := t.Transform(dst, src, atEOF)
+		out = append(out, dst[:nDst]...)
+		src = src[:copy(src, src[nSrc:])]
+		switch err {
+		case nil:
+			if atEOF {
+				return out, nil
+			}
+		case yaml.ErrShortDst, yaml.ErrShortSrc:
+			if nDst == 0 && nSrc == 0 && (err == yaml.ErrShortDst || atEOF || len(src) == cap(src)) {
+				panic(fmt.Sprintf("transforming makes no progress: %v", err))
+			}
+		default:
+			return out, err
+		}
+	}
+}
+
+// SuiteSeeds returns the inputs of the test cases found under dir, which
+// holds a checkout of the data branch of the YAML test suite at
+// https://github.com/yaml/yaml-test-suite.
+func SuiteSeeds(dir string) ([][]byte, error) {
+	var seeds [][]byte
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != "in.yaml" {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		seeds = append(seeds, data)
+		return nil
+	})
+	return seeds, err
+}
@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package yamlfuzz_test
+
+import (
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v3/yamlfuzz"
+)
+
+var seeds = []string{
+	"",
+	"a: b\n",
+	"- [1, 2.5, true, null]\n- {x: &a y, z: *a}\n",
+	"--- |\n  literal\n--- >-\n  folded\n",
+	"# comment\n? complex\n: !!str 1\n",
+	"\xef\xbb\xbfa: \xc3\xa9\n",
+	"\xff\xfea\x00:\x00 \x00b\x00\n\x00",
+	"\xfe\xff\x00a\x00:\x00 \x00b",
+	"a: \xc3\n",
+}
+
+func addSeeds(f *testing.F) {
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	// YAML_TEST_SUITE may name a checkout of the test suite data.
+	if dir := os.Getenv("YAML_TEST_SUITE"); dir != "" {
+		data, err := yamlfuzz.SuiteSeeds(dir)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, d := range data {
+			f.Add(d)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) { yamlfuzz.Parse(data) })
+}
+
+func FuzzDecode(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) { yamlfuzz.Decode(data) })
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) { yamlfuzz.RoundTrip(data) })
+}
+
+func FuzzTranscode(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) { yamlfuzz.Transcode(data) })
+}
@@ -51,6 +51,15 @@ const (
 	yaml_UTF16BE_ENCODING // The UTF-16-BE encoding with BOM.
 )
 
+type yaml_surrogate_policy_t int
+
+// [Go] The handling of unpaired UTF-16 surrogates.
+const (
+	yaml_SURROGATE_ERROR   yaml_surrogate_policy_t = iota // Fail with a reader error.
+	yaml_SURROGATE_REPLACE                                // Replace them with U+FFFD.
+	yaml_SURROGATE_WTF8                                   // Pass them through as WTF-8.
+)
+
 type yaml_break_t int
 
 // Line break types.
@@ -84,6 +93,7 @@ type yaml_mark_t struct {
 	index  int // The position index.
 	line   int // The position line.
 	column int // The position column.
+	offset int // [Go] The position offset in the input (in bytes).
 }
 
 // Node Styles
@@ -104,6 +114,24 @@ const (
 	yaml_FOLDED_SCALAR_STYLE                                        // The folded scalar style.
 )
 
+func (style yaml_scalar_style_t) String() string {
+	switch style {
+	case yaml_ANY_SCALAR_STYLE:
+		return "any"
+	case yaml_PLAIN_SCALAR_STYLE:
+		return "plain"
+	case yaml_SINGLE_QUOTED_SCALAR_STYLE:
+		return "single-quoted"
+	case yaml_DOUBLE_QUOTED_SCALAR_STYLE:
+		return "double-quoted"
+	case yaml_LITERAL_SCALAR_STYLE:
+		return "literal"
+	case yaml_FOLDED_SCALAR_STYLE:
+		return "folded"
+	}
+	return fmt.Sprintf("unknown style %d", style)
+}
+
 type yaml_sequence_style_t yaml_style_t
 
 // Sequence styles.
@@ -448,6 +476,11 @@ type yaml_document_t struct {
 // size_read to 0 and return 1.
 type yaml_read_handler_t func(parser *yaml_parser_t, buffer []byte) (n int, err error)
 
+// [Go] The prototype of a function transforming the input before it is
+// decoded, with the semantics of the Transform method of the Transformer
+// interface in golang.org/x/text/transform.
+type yaml_transform_t func(dst, src []byte, atEOF bool) (nDst, nSrc int, err error)
+
 // This structure holds information about a potential simple key.
 type yaml_simple_key_t struct {
 	possible     bool        // Is a simple key possible?
@@ -563,8 +596,13 @@ type yaml_parser_t struct {
 	// The byte about which the problem occurred.
 	problem_offset int
 	problem_value  int
+	problem_bytes  []byte // [Go] The invalid input sequence, for decoding errors.
 	problem_mark   yaml_mark_t
 
+	problem_disallowed bool      // [Go] Is the problem a character that isn't allowed in YAML?
+	problem_err        error     // [Go] The error to report for the problem, if not the description.
+	problem_code       ErrorCode // [Go] The code of the problem, if not a syntax error.
+
 	// The error context.
 	context      string
 	context_mark yaml_mark_t
@@ -579,9 +617,28 @@ type yaml_parser_t struct {
 
 	eof bool // EOF flag
 
+	input_read int // [Go] The number of bytes read from the input.
+	max_bytes  int // [Go] The maximum number of bytes to read, or 0 for no limit.
+
+	retained        []byte // [Go] The input kept from the last consumed position on.
+	retained_offset int    // [Go] The offset of the retained input.
+
+	transform     yaml_transform_t // Transforms the input before decoding.
+	transform_src []byte           // Input read but not transformed yet.
+	transform_eof bool             // Has all the input been read?
+
 	buffer     []byte // The working buffer.
 	buffer_pos int    // The current position of the buffer.
 
+	input_borrowed bool   // [Go] Is the working buffer borrowing the input string?
+	owned_buffer   []byte // [Go] The working buffer put aside while borrowing the input.
+	pooled_buffers bool   // [Go] Were the raw and working buffers taken from the buffer pools?
+
+	raw_widths []byte // [Go] The input lengths of the characters in the buffer, if they differ.
+
+	reader_error_held bool // [Go] Is a reader error held back until the input before it is used up?
+	held_offset       int  // [Go] The offset where the input seems to end while the error is held back.
+
 	unread int // The number of unread characters in the buffer.
 
 	newlines int // The number of line breaks since last non-break/non-blank character
@@ -589,11 +646,29 @@ type yaml_parser_t struct {
 	raw_buffer     []byte // The raw buffer.
 	raw_buffer_pos int    // The current position of the buffer.
 
-	encoding yaml_encoding_t // The input encoding.
+	raw_borrowed     bool   // [Go] Is the raw buffer borrowing the input string?
+	owned_raw_buffer []byte // [Go] The raw buffer put aside while borrowing the input.
+
+	encoding            yaml_encoding_t // The input encoding.
+	encoding_determined bool            // Has the input been checked for a BOM?
+	bom                 bool            // Did the input start with a BOM?
+
+	replace_invalid bool // Replace invalid input sequences with U+FFFD?
+	strict_chars    bool // Reject Unicode noncharacters?
+
+	surrogates  yaml_surrogate_policy_t // How to decode unpaired UTF-16 surrogates.
+	windows1252 bool                    // Read invalid UTF-8 as Windows-1252?
+
+	normalize_breaks bool // Turn CR LF and CR into LF?
+	last_cr          bool // Was the last character read a CR?
 
 	offset int         // The offset of the current position (in bytes).
 	mark   yaml_mark_t // The mark of the current position.
 
+	warnings         []yaml_warning_t // The non-fatal problems found so far.
+	max_warnings     int              // [Go] The number of warnings recorded, or 0 for default_max_warnings.
+	dropped_warnings int              // [Go] The number of warnings found past max_warnings.
+
 	// Comments
 
 	head_comment []byte // The current head comments
@@ -636,6 +711,17 @@ type yaml_parser_t struct {
 	aliases []yaml_alias_data_t // The alias data.
 
 	document *yaml_document_t // The currently parsed document.
+
+	// [Go] Logs the tokens scanned, the events parsed and the tags
+	// resolved, unless nil.
+	debug func(msg string, args ...interface{})
+}
+
+// A problem that was recovered from without failing.
+type yaml_warning_t struct {
+	problem string // The problem description.
+	offset  int    // The byte about which the problem occurred.
+	value   int    // The problematic value, or -1.
 }
 
 type yaml_comment_t struct {
@@ -726,8 +812,15 @@ type yaml_emitter_t struct {
 
 	canonical   bool         // If the output is in the canonical style?
 	best_indent int          // The number of indentation spaces.
+	seq_indent  int          // The indentation of sequences in mappings, or -1 for best_indent.
 	best_width  int          // The preferred width of the output lines.
+	no_breaks   bool         // Keep scalars on their lines, regardless of best_width?
+	tight_colon bool         // Leave out the space after ':' in flow mappings where possible?
+	tight_comma bool         // Leave out the space after ',' in flow collections?
+	padded      bool         // Write spaces inside the brackets of flow collections?
+	wrap_items  bool         // Write flow collections that do not fit one item per line?
 	unicode     bool         // Allow unescaped non-ASCII characters?
+	yaml11      bool         // Write output that reads the same to YAML 1.1 parsers?
 	line_break  yaml_break_t // The preferred line break.
 
 	state  yaml_emitter_state_t   // The current emitter state.
@@ -742,6 +835,10 @@ type yaml_emitter_t struct {
 
 	indent int // The current indentation level.
 
+	json_key bool // Was the last simple key in a flow mapping quoted?
+
+	wrapped []bool // Is each open flow collection written one item per line?
+
 	flow_level int // The current flow level.
 
 	root_context       bool // Is it the document root context?
@@ -804,4 +901,8 @@ type yaml_emitter_t struct {
 	last_anchor_id int // The last assigned anchor id.
 
 	document *yaml_document_t // The currently emitted document.
+
+	// [Go] Logs the events emitted and the scalar styles chosen, unless
+	// nil.
+	debug func(msg string, args ...interface{})
 }
@@ -30,6 +30,10 @@ const (
 	// It should be possible to decode the whole raw buffer.
 	input_buffer_size = input_raw_buffer_size * 3
 
+	// The smallest size of the input raw buffer that still leaves
+	// room in the input buffer for the longest lookahead.
+	input_min_raw_buffer_size = 16
+
 	// The size of the output buffer.
 	output_buffer_size = 128
 
@@ -37,6 +41,14 @@ const (
 	// It should be possible to encode the whole output buffer.
 	output_raw_buffer_size = (output_buffer_size*2 + 2)
 
+	// The smallest size of the output buffer that still leaves room
+	// for the longest character written at once.
+	output_min_buffer_size = 16
+
+	// [Go] The number of warnings a parser records when no other limit
+	// is set. Those past it are only counted.
+	default_max_warnings = 1000
+
 	// The size of other stacks and queues.
 	initial_stack_size  = 16
 	initial_queue_size  = 16
@@ -101,7 +113,7 @@ func is_z(b []byte, i int) bool {
 
 // Check if the beginning of the buffer is a BOM.
 func is_bom(b []byte, i int) bool {
-	return b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF
+	return b[i] == 0xEF && b[i+1] == 0xBB && b[i+2] == 0xBF
 }
 
 // Check if the character at the specified position is space.
@@ -196,3 +208,12 @@ func width(b byte) int {
 	return 0
 
 }
+
+// [Go] Determine the number of input bytes the character at the given
+// buffer position was read from.
+func raw_width(parser *yaml_parser_t, pos int) int {
+	if parser.raw_widths != nil {
+		return int(parser.raw_widths[pos])
+	}
+	return width(parser.buffer[pos])
+}
@@ -0,0 +1,208 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamltest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GoldenOptions configures CheckGolden.
+type GoldenOptions struct {
+	// Indent is the indentation the files are encoded with, as given to
+	// Encoder.SetIndent. Zero means the default of the Encoder.
+	Indent int
+
+	// Semantic has the encoding of a file compared with it by the values
+	// decoded from both, rather than byte by byte.
+	Semantic bool
+}
+
+// CheckGolden checks that each of the files matching pattern, as for
+// filepath.Glob, is encoded again the same way after being decoded into
+// nodes, and reports an error to t for every file that isn't. The error
+// shows the lines that differ between the file and its encoding.
+//
+// A nil opts is the same as the zero GoldenOptions.
+func CheckGolden(t TestingT, pattern string, opts *GoldenOptions) {
+	if opts == nil {
+		opts = &GoldenOptions{}
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Errorf("yamltest: %v", err)
+		return
+	}
+	if len(files) == 0 {
+		t.Errorf("yamltest: no files match %s", pattern)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("yamltest: %v", err)
+			continue
+		}
+		out, err := reencode(data, opts.Indent)
+		if err != nil {
+			t.Errorf("yamltest: %s: %v", file, err)
+			continue
+		}
+		if !opts.Semantic {
+			if !bytes.Equal(data, out) {
+				t.Errorf("yamltest: %s is encoded differently:\n%s", file, diff(string(data), string(out)))
+			}
+			continue
+		}
+		want, err := decodeAll(data)
+		if err != nil {
+			t.Errorf("yamltest: %s: %v", file, err)
+			continue
+		}
+		got, err := decodeAll(out)
+		if err != nil {
+			t.Errorf("yamltest: %s: cannot decode its encoding: %v", file, err)
+			continue
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("yamltest: %s is encoded with different values:\n%s", file, diff(dump(want), dump(got)))
+		}
+	}
+}
+
+// reencode decodes the documents in data into nodes and encodes these.
+func reencode(data []byte, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	if indent > 0 {
+		enc.SetIndent(indent)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(&node); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeAll(data []byte) ([]interface{}, error) {
+	var values []interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+}
+
+func dump(values []interface{}) string {
+	var buf bytes.Buffer
+	for _, v := range values {
+		fmt.Fprintf(&buf, "%#v\n", v)
+	}
+	return buf.String()
+}
+
+// diff returns the lines of a and b, marking those only in a with "-"
+// and those only in b with "+". Unchanged lines far from any change are
+// left out.
+func diff(a, b string) string {
+	x := strings.SplitAfter(a, "\n")
+	y := strings.SplitAfter(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i]})
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, line{'-', x[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j]})
+			j++
+		}
+	}
+
+	const context = 2
+	var buf bytes.Buffer
+	for k, l := range lines {
+		near := false
+		for d := k - context; d <= k+context && !near; d++ {
+			near = d >= 0 && d < len(lines) && lines[d].op != ' '
+		}
+		if !near || l.text == "" {
+			continue
+		}
+		buf.WriteByte(l.op)
+		buf.WriteByte(' ')
+		buf.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			buf.WriteString("\n\\ no newline at end\n")
+		}
+	}
+	return buf.String()
+}
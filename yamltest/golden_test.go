@@ -0,0 +1,40 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamltest_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3/yamltest"
+)
+
+func TestCheckGolden(t *testing.T) {
+	yamltest.CheckGolden(t, "testdata/indent2.yaml", &yamltest.GoldenOptions{Indent: 2})
+	yamltest.CheckGolden(t, "testdata/*.yaml", &yamltest.GoldenOptions{Indent: 2, Semantic: true})
+
+	var got errorf
+	yamltest.CheckGolden(&got, "testdata/*.yaml", nil)
+	want := errorf{
+		"yamltest: testdata/indent2.yaml is encoded differently:\n" +
+			"  a: 1\n  b:\n-   - x # comment\n-   - \"y\"\n+     - x # comment\n+     - \"y\"\n",
+		"yamltest: testdata/loose.yaml is encoded differently:\n" +
+			"- a:   1\n+ a: 1\n  b: [x, y]\n  ---\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CheckGolden reported %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,310 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yamltest provides helpers for testing how values fare when
+// encoded and decoded by the yaml package.
+package yamltest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A RoundTripError reports a value that is not encoded the same way
+// after a round trip through Marshal and Unmarshal.
+type RoundTripError struct {
+	// Value is the smallest failing value found by taking the original
+	// one apart, which fails the same way as the original.
+	Value interface{}
+
+	// First holds the encoding of Value, and Second the encoding of the
+	// value decoded from First, when these were produced.
+	First, Second []byte
+
+	// Err is the error from encoding or decoding, if the failure was one.
+	Err error
+}
+
+func (e *RoundTripError) Error() string {
+	switch {
+	case e.Err != nil && e.First == nil:
+		return fmt.Sprintf("yamltest: cannot encode %#v: %v", e.Value, e.Err)
+	case e.Err != nil && e.Second == nil:
+		return fmt.Sprintf("yamltest: cannot decode %q encoded from %#v: %v", e.First, e.Value, e.Err)
+	case e.Err != nil:
+		return fmt.Sprintf("yamltest: cannot encode again %q encoded from %#v: %v", e.First, e.Value, e.Err)
+	}
+	return fmt.Sprintf("yamltest: encoding of %#v changed from %q to %q", e.Value, e.First, e.Second)
+}
+
+// RoundTrip checks that v is encoded by Marshal the same way as the value
+// of the same type decoded from that encoding by Unmarshal. Both Go values
+// and *yaml.Node trees may be checked.
+//
+// When the check fails, a *RoundTripError is returned holding the smallest
+// part of v found to fail the same way, such as a single element of a
+// slice, or a string with the characters not needed for failing removed.
+func RoundTrip(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil
+	}
+	e := roundTrip(rv)
+	if e == nil {
+		return nil
+	}
+	stage := e.stage()
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for _, c := range candidates(rv) {
+			if ce := roundTrip(c); ce != nil && ce.stage() == stage {
+				rv, e = c, ce
+				shrunk = true
+				break
+			}
+		}
+	}
+	return e
+}
+
+// TestingT is the part of *testing.T that Check uses.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Check reports an error to t for each of values that fails RoundTrip.
+func Check(t TestingT, values ...interface{}) {
+	for _, v := range values {
+		if err := RoundTrip(v); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+}
+
+func roundTrip(v reflect.Value) *RoundTripError {
+	e := &RoundTripError{Value: v.Interface()}
+	if e.First, e.Err = yaml.Marshal(e.Value); e.Err != nil {
+		e.First = nil
+		return e
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	out := reflect.New(t)
+	if e.Err = yaml.Unmarshal(e.First, out.Interface()); e.Err != nil {
+		return e
+	}
+	if v.Kind() != reflect.Ptr {
+		out = out.Elem()
+	}
+	if e.Second, e.Err = yaml.Marshal(out.Interface()); e.Err != nil {
+		e.Second = []byte{}
+		return e
+	}
+	if bytes.Equal(e.First, e.Second) {
+		return nil
+	}
+	return e
+}
+
+// stage tells the failures of different steps of a round trip apart,
+// so that shrinking a value doesn't turn up an unrelated failure.
+func (e *RoundTripError) stage() int {
+	switch {
+	case e.Err != nil && e.First == nil:
+		return 1
+	case e.Err != nil && e.Second == nil:
+		return 2
+	case e.Err != nil:
+		return 3
+	}
+	return 4
+}
+
+var nodeType = reflect.TypeOf(yaml.Node{})
+
+// candidates returns values of the type of v that are smaller than v.
+func candidates(v reflect.Value) []reflect.Value {
+	var cs []reflect.Value
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			break
+		}
+		if v.Type().Elem() == nodeType {
+			for _, n := range nodeCandidates(v.Interface().(*yaml.Node)) {
+				cs = append(cs, reflect.ValueOf(n))
+			}
+			break
+		}
+		for _, c := range candidates(v.Elem()) {
+			p := reflect.New(c.Type())
+			p.Elem().Set(c)
+			cs = append(cs, p)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			break
+		}
+		for _, c := range candidates(v.Elem()) {
+			i := reflect.New(v.Type()).Elem()
+			i.Set(c)
+			cs = append(cs, i)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			s := reflect.MakeSlice(v.Type(), 0, v.Len()-1)
+			s = reflect.AppendSlice(s, v.Slice(0, i))
+			s = reflect.AppendSlice(s, v.Slice(i+1, v.Len()))
+			cs = append(cs, s)
+		}
+		for i := 0; i < v.Len(); i++ {
+			for _, c := range candidates(v.Index(i)) {
+				s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(s, v)
+				s.Index(i).Set(c)
+				cs = append(cs, s)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			for _, c := range candidates(v.Index(i)) {
+				a := reflect.New(v.Type()).Elem()
+				a.Set(v)
+				a.Index(i).Set(c)
+				cs = append(cs, a)
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		keys := v.MapKeys()
+		for _, k := range keys {
+			m := copyMap(v)
+			m.SetMapIndex(k, reflect.Value{})
+			cs = append(cs, m)
+		}
+		for _, k := range keys {
+			for _, c := range candidates(v.MapIndex(k)) {
+				m := copyMap(v)
+				m.SetMapIndex(k, c)
+				cs = append(cs, m)
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).CanInterface() {
+				continue
+			}
+			zero := reflect.Zero(v.Field(i).Type())
+			if !reflect.DeepEqual(v.Field(i).Interface(), zero.Interface()) {
+				s := reflect.New(v.Type()).Elem()
+				s.Set(v)
+				s.Field(i).Set(zero)
+				cs = append(cs, s)
+			}
+			for _, c := range candidates(v.Field(i)) {
+				s := reflect.New(v.Type()).Elem()
+				s.Set(v)
+				s.Field(i).Set(c)
+				cs = append(cs, s)
+			}
+		}
+	case reflect.String:
+		for _, s := range stringCandidates(v.String()) {
+			c := reflect.New(v.Type()).Elem()
+			c.SetString(s)
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+func copyMap(v reflect.Value) reflect.Value {
+	m := reflect.MakeMap(v.Type())
+	for _, k := range v.MapKeys() {
+		m.SetMapIndex(k, v.MapIndex(k))
+	}
+	return m
+}
+
+// stringCandidates returns s with each one of its characters removed.
+func stringCandidates(s string) []string {
+	var cs []string
+	for i := 0; i < len(s); {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		cs = append(cs, s[:i]+s[i+size:])
+		i += size
+	}
+	return cs
+}
+
+// nodeCandidates returns the trees smaller than the one at n, which have
+// fewer items, comments or characters in scalars. Entries of mappings are
+// removed together with their keys.
+func nodeCandidates(n *yaml.Node) []*yaml.Node {
+	var cs []*yaml.Node
+	with := func(f func(c *yaml.Node)) {
+		c := *n
+		c.Content = append([]*yaml.Node(nil), n.Content...)
+		f(&c)
+		cs = append(cs, &c)
+	}
+	step := 1
+	if n.Kind == yaml.MappingNode {
+		step = 2
+	}
+	if n.Kind != yaml.DocumentNode {
+		for i := 0; i+step <= len(n.Content); i += step {
+			i := i
+			with(func(c *yaml.Node) { c.Content = append(c.Content[:i], c.Content[i+step:]...) })
+		}
+	}
+	for i, child := range n.Content {
+		i := i
+		for _, cc := range nodeCandidates(child) {
+			cc := cc
+			with(func(c *yaml.Node) { c.Content[i] = cc })
+		}
+	}
+	if n.HeadComment != "" {
+		with(func(c *yaml.Node) { c.HeadComment = "" })
+	}
+	if n.LineComment != "" {
+		with(func(c *yaml.Node) { c.LineComment = "" })
+	}
+	if n.FootComment != "" {
+		with(func(c *yaml.Node) { c.FootComment = "" })
+	}
+	if n.Style != 0 {
+		with(func(c *yaml.Node) { c.Style = 0 })
+	}
+	if n.Kind == yaml.ScalarNode {
+		for _, s := range stringCandidates(n.Value) {
+			s := s
+			with(func(c *yaml.Node) { c.Value = s })
+		}
+	}
+	return cs
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamltest_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"gopkg.in/yaml.v3/yamltest"
+)
+
+// exclaimed gains an exclamation mark with each encoding.
+type exclaimed string
+
+func (e exclaimed) MarshalYAML() (interface{}, error) {
+	return string(e) + "!", nil
+}
+
+type record struct {
+	A []exclaimed
+	B int
+	C map[string]string
+}
+
+func TestRoundTrip(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("# head\na: [1, {b: c}] # line\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []interface{}{nil, 1, "a", []int{1, 2}, map[string]interface{}{"a": []interface{}{1.5, "b"}}, &node} {
+		if err := yamltest.RoundTrip(v); err != nil {
+			t.Errorf("RoundTrip(%#v): %v", v, err)
+		}
+	}
+
+	err := yamltest.RoundTrip(record{A: []exclaimed{"x", "yz"}, B: 1, C: map[string]string{"k": "v"}})
+	e, ok := err.(*yamltest.RoundTripError)
+	if !ok {
+		t.Fatalf("RoundTrip returned %#v, want a *RoundTripError", err)
+	}
+	want := &yamltest.RoundTripError{
+		Value:  record{A: []exclaimed{""}},
+		First:  []byte("a:\n    - '!'\nb: 0\nc: {}\n"),
+		Second: []byte("a:\n    - '!!'\nb: 0\nc: {}\n"),
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Fatalf("RoundTrip returned %#v, want %#v", e, want)
+	}
+}
+
+type errorf []string
+
+func (e *errorf) Errorf(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+func TestCheck(t *testing.T) {
+	var got errorf
+	yamltest.Check(&got, 1, exclaimed("a"), "b")
+	want := errorf{`yamltest: encoding of "" changed from "'!'\n" to "'!!'\n"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Check reported %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,313 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yamlv2 implements the API of gopkg.in/yaml.v2 with the yaml
+// package, so that code written for yaml.v2 can move to yaml.v3 one
+// package at a time, by changing its import path alone.
+//
+// Values are decoded and encoded the way yaml.v2 does where the two
+// differ: mappings decoded into interface{} values are
+// map[interface{}]interface{} maps, duplicate mapping keys are only
+// rejected in strict mode, and values are written with the indentation
+// and line width of yaml.v2. Errors have the messages of yaml.v2.
+package yamlv2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MapSlice encodes and decodes as a YAML mapping, keeping the order of
+// its items. Mappings decoded within it are MapSlice values as well. It
+// is the MapSlice of the yaml package, so the items merged with a "<<"
+// key follow the ones of the mapping itself.
+type MapSlice = yaml.MapSlice
+
+// MapItem is an item in a MapSlice.
+type MapItem = yaml.MapItem
+
+// The Unmarshaler interface may be implemented by types to customize
+// their behavior when being unmarshaled from a YAML document. The
+// UnmarshalYAML method receives a function that may be called to
+// unmarshal the original YAML value into a field or variable.
+type Unmarshaler interface {
+	UnmarshalYAML(unmarshal func(interface{}) error) error
+}
+
+// The Marshaler interface may be implemented by types to customize their
+// behavior when being marshaled into a YAML document. The returned value
+// is marshaled in place of the original value implementing Marshaler.
+type Marshaler interface {
+	MarshalYAML() (interface{}, error)
+}
+
+// IsZeroer is used to check whether an object is zero to determine
+// whether it should be omitted when marshaling with the omitempty flag.
+type IsZeroer interface {
+	IsZero() bool
+}
+
+// A TypeError is returned by Unmarshal when one or more fields in the
+// YAML document cannot be properly decoded into the requested types.
+// When this error is returned, the value is still unmarshaled partially.
+type TypeError struct {
+	Errors []string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("yaml: unmarshal errors:\n  %s", strings.Join(e.Errors, "\n  "))
+}
+
+// lineWidth is the width at which lines are broken when encoding.
+var lineWidth = 80
+
+// FutureLineWrap globally disables line wrapping when encoding long
+// strings, as yaml.v3 does by default.
+func FutureLineWrap() {
+	lineWidth = -1
+}
+
+// Unmarshal decodes the first document found within the in byte slice
+// and assigns decoded values into the out value, as yaml.v2 does.
+func Unmarshal(in []byte, out interface{}) error {
+	return unmarshal(in, out, false)
+}
+
+// UnmarshalStrict is like Unmarshal except that any fields that are
+// found in the data that do not have corresponding struct members, or
+// mapping keys that are duplicates, will result in an error.
+func UnmarshalStrict(in []byte, out interface{}) error {
+	return unmarshal(in, out, true)
+}
+
+func unmarshal(in []byte, out interface{}, strict bool) error {
+	dec := NewDecoder(bytes.NewReader(in))
+	dec.SetStrict(strict)
+	if err := dec.Decode(out); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// A Decoder reads and decodes YAML values from an input stream.
+type Decoder struct {
+	dec    *yaml.Decoder
+	strict bool
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: yaml.NewDecoder(r)}
+}
+
+// SetStrict sets whether strict decoding behaviour is enabled when
+// decoding items in the data (see UnmarshalStrict). By default, decoding
+// is not strict.
+func (dec *Decoder) SetStrict(strict bool) {
+	dec.strict = strict
+	dec.dec.KnownFields(strict)
+}
+
+// Decode reads the next YAML-encoded value from its input and stores it
+// in the value pointed to by v. It returns io.EOF at the end of the
+// input.
+func (dec *Decoder) Decode(v interface{}) error {
+	var err error
+	if dec.strict {
+		err = dec.dec.Decode(v)
+	} else {
+		// Duplicate keys are dropped ahead of decoding, as the last
+		// one wins with yaml.v2.
+		var n yaml.Node
+		if err := dec.dec.Decode(&n); err != nil {
+			return err
+		}
+		lastKeys(&n, make(map[*yaml.Node]bool))
+		err = n.Decode(v)
+	}
+	generalMaps(reflect.ValueOf(v), make(map[uintptr]bool))
+	return dec.v2Error(err)
+}
+
+// lastKeys removes the entries of the mappings within n whose keys are
+// repeated later in the same mapping.
+func lastKeys(n *yaml.Node, seen map[*yaml.Node]bool) {
+	if seen[n] {
+		return
+	}
+	seen[n] = true
+	if n.Kind == yaml.MappingNode {
+		content := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			repeated := false
+			for j := i + 2; j+1 < len(n.Content) && !repeated; j += 2 {
+				repeated = k.Kind == n.Content[j].Kind && k.Value == n.Content[j].Value
+			}
+			if !repeated {
+				content = append(content, k, n.Content[i+1])
+			}
+		}
+		n.Content = content
+	}
+	for _, c := range n.Content {
+		lastKeys(c, seen)
+	}
+	if n.Alias != nil {
+		lastKeys(n.Alias, seen)
+	}
+}
+
+// v2Error returns err as yaml.v2 reports it, or nil if it would not.
+func (dec *Decoder) v2Error(err error) error {
+	te, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+	var errs []string
+	for i, msg := range te.Errors {
+		if i < len(te.Details) {
+			d := te.Details[i]
+			switch d.Code {
+			case yaml.ErrCodeDuplicateKey, yaml.ErrCodeDuplicateField:
+				if !dec.strict {
+					continue
+				}
+				if d.Code == yaml.ErrCodeDuplicateKey && len(d.Path) > 0 {
+					msg = fmt.Sprintf("line %d: key %#v already set in map", d.Line, d.Path[len(d.Path)-1].Key)
+				}
+			}
+		}
+		errs = append(errs, msg)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &TypeError{Errors: errs}
+}
+
+// generalMaps replaces the map[string]interface{} maps held in the
+// interface{} values within v with map[interface{}]interface{} ones.
+func generalMaps(v reflect.Value, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		generalMaps(v.Elem(), seen)
+	case reflect.Interface:
+		if !v.IsNil() && v.CanSet() {
+			if g := general(v.Elem().Interface()); g != nil {
+				v.Set(reflect.ValueOf(g))
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				generalMaps(f, seen)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			generalMaps(v.Index(i), seen)
+		}
+	case reflect.Map:
+		switch v.Type().Elem().Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return
+		}
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			generalMaps(e, seen)
+			v.SetMapIndex(k, e)
+		}
+	}
+}
+
+// general returns the generic value v with its map[string]interface{}
+// maps replaced with map[interface{}]interface{} ones.
+func general(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, e := range v {
+			m[k] = general(e)
+		}
+		return m
+	case map[interface{}]interface{}:
+		for k, e := range v {
+			v[k] = general(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = general(e)
+		}
+	case MapSlice:
+		for i := range v {
+			v[i].Value = general(v[i].Value)
+		}
+	}
+	return v
+}
+
+// Marshal serializes the value provided into a YAML document, as
+// yaml.v2 does.
+func Marshal(in interface{}) (out []byte, err error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(in); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// An Encoder writes YAML values to an output stream.
+type Encoder struct {
+	enc *yaml.Encoder
+}
+
+// NewEncoder returns a new encoder that writes to w. The Encoder should
+// be closed after use to flush all data to w.
+func NewEncoder(w io.Writer) *Encoder {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	enc.SetSequenceIndent(0)
+	enc.SetLineWidth(lineWidth)
+	return &Encoder{enc: enc}
+}
+
+// Encode writes the YAML encoding of v to the stream. If multiple items
+// are encoded to the stream, the second and subsequent document will be
+// preceded with a "---" document separator, but the first will not.
+func (e *Encoder) Encode(v interface{}) error {
+	return e.enc.Encode(v)
+}
+
+// Close closes the encoder by writing any remaining data. It does not
+// write a stream terminating string "...".
+func (e *Encoder) Close() error {
+	return e.enc.Close()
+}
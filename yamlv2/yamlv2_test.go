@@ -0,0 +1,195 @@
+//
+// Copyright (c) 2011-2019 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamlv2_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3/yamlv2"
+)
+
+func TestUnmarshalGenericMaps(t *testing.T) {
+	var v interface{}
+	err := yamlv2.Unmarshal([]byte("a:\n  b: [1, {c: d}]\n1: x\n"), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[interface{}]interface{}{
+		"a": map[interface{}]interface{}{"b": []interface{}{1, map[interface{}]interface{}{"c": "d"}}},
+		1:   "x",
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("got %#v, want %#v", v, want)
+	}
+
+	var s struct {
+		A interface{}
+		B map[string]interface{}
+		C []interface{}
+	}
+	err = yamlv2.Unmarshal([]byte("a: {x: 1}\nb: {y: {z: 2}}\nc: [{w: 3}]\n"), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.A.(map[interface{}]interface{}); !ok {
+		t.Errorf("got %T for A", s.A)
+	}
+	if _, ok := s.B["y"].(map[interface{}]interface{}); !ok {
+		t.Errorf("got %T for B.y", s.B["y"])
+	}
+	if _, ok := s.C[0].(map[interface{}]interface{}); !ok {
+		t.Errorf("got %T for C[0]", s.C[0])
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	type T struct {
+		A int
+	}
+	var v T
+	if err := yamlv2.Unmarshal([]byte("a: 1\na: 2\nb: 3\n"), &v); err != nil || v.A != 2 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+	var m map[string]int
+	if err := yamlv2.Unmarshal([]byte("a: 1\na: 2\n"), &m); err != nil || m["a"] != 2 {
+		t.Fatalf("got %v, %v", m, err)
+	}
+
+	err := yamlv2.UnmarshalStrict([]byte("a: 1\nb: 3\n"), &v)
+	want := "yaml: unmarshal errors:\n  line 2: field b not found in type yamlv2_test.T"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v, want %s", err, want)
+	}
+	err = yamlv2.UnmarshalStrict([]byte("a: 1\na: 2\n"), &m)
+	want = "yaml: unmarshal errors:\n  line 2: key \"a\" already set in map"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v, want %s", err, want)
+	}
+	if _, ok := err.(*yamlv2.TypeError); !ok {
+		t.Fatalf("got %T", err)
+	}
+
+	err = yamlv2.Unmarshal([]byte("a: x\n"), &v)
+	want = "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `x` into int"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v, want %s", err, want)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	data, err := yamlv2.Marshal(map[string]interface{}{
+		"a": []int{1, 2},
+		"b": map[string]interface{}{"c": "yes", "d": []string{"x"}},
+		"e": strings.Repeat("word ", 20),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `a:
+- 1
+- 2
+b:
+  c: "yes"
+  d:
+  - x
+e: 'word word word word word word word word word word word word word word word word
+  word word word word '
+`
+	if string(data) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestMapSlice(t *testing.T) {
+	in := "z: 1\na:\n  y: [2, {x: 3}]\n  b: c\nbase: &base {k: v}\nm:\n  <<: *base\n  l: w\n"
+	var s yamlv2.MapSlice
+	if err := yamlv2.Unmarshal([]byte(in), &s); err != nil {
+		t.Fatal(err)
+	}
+	want := yamlv2.MapSlice{
+		{Key: "z", Value: 1},
+		{Key: "a", Value: yamlv2.MapSlice{
+			{Key: "y", Value: []interface{}{2, yamlv2.MapSlice{{Key: "x", Value: 3}}}},
+			{Key: "b", Value: "c"},
+		}},
+		{Key: "base", Value: yamlv2.MapSlice{{Key: "k", Value: "v"}}},
+		{Key: "m", Value: yamlv2.MapSlice{{Key: "l", Value: "w"}, {Key: "k", Value: "v"}}},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("got %#v, want %#v", s, want)
+	}
+
+	data, err := yamlv2.Marshal(s[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "z: 1\na:\n  \"y\":\n  - 2\n  - x: 3\n  b: c\n" {
+		t.Fatalf("got:\n%s", data)
+	}
+
+	err = yamlv2.Unmarshal([]byte("[1]"), &s)
+	if err == nil || err.Error() != "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into yaml.MapSlice" {
+		t.Fatalf("got %v", err)
+	}
+
+	// Aliases are expanded within the limits of the decoder.
+	laughs := "a: &a [lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+	for c := 'b'; c <= 'h'; c++ {
+		laughs += fmt.Sprintf("%c: &%c [%s]\n", c, c, strings.TrimSuffix(strings.Repeat(fmt.Sprintf("*%c, ", c-1), 9), ", "))
+	}
+	err = yamlv2.Unmarshal([]byte(laughs), &s)
+	if err == nil || !strings.Contains(err.Error(), "excessive aliasing") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := yamlv2.NewEncoder(&buf)
+	for _, v := range []interface{}{map[string]int{"a": 1}, []string{"b"}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "a: 1\n---\n- b\n" {
+		t.Fatalf("got %q", buf.String())
+	}
+
+	dec := yamlv2.NewDecoder(&buf)
+	var docs []interface{}
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, v)
+	}
+	want := []interface{}{map[interface{}]interface{}{"a": 1}, []interface{}{"b"}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %#v", docs)
+	}
+}